@@ -0,0 +1,354 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/Abhishek-B-R/chat-app-golang/internals/apierror"
+	"github.com/Abhishek-B-R/chat-app-golang/internals/logging"
+	"github.com/Abhishek-B-R/chat-app-golang/internals/middleware"
+	"github.com/Abhishek-B-R/chat-app-golang/internals/store"
+	"github.com/Abhishek-B-R/chat-app-golang/internals/utils"
+	"github.com/Abhishek-B-R/chat-app-golang/internals/webhooks"
+)
+
+const (
+	defaultPageSize = 50
+	maxPageSize     = 200
+)
+
+// AdminHandler is the platform administrators' view of every account and
+// chat. Everything it changes is recorded in the audit log.
+type AdminHandler struct {
+	userStore store.UserStore
+	tokenStore store.TokenStore
+	chatStore store.ChatStore
+	chatMemberStore store.ChatMemberStore
+	messageStore store.MessageStore
+	auditStore store.AuditStore
+	webhooks *webhooks.Publisher
+}
+
+func NewAdminHandler(userStore store.UserStore, tokenStore store.TokenStore, chatStore store.ChatStore, chatMemberStore store.ChatMemberStore, messageStore store.MessageStore, auditStore store.AuditStore, publisher *webhooks.Publisher) *AdminHandler {
+	return &AdminHandler{
+		userStore: userStore,
+		tokenStore: tokenStore,
+		chatStore: chatStore,
+		chatMemberStore: chatMemberStore,
+		messageStore: messageStore,
+		auditStore: auditStore,
+		webhooks: publisher,
+	}
+}
+
+// readPage reads ?limit= and ?offset=, falling back to the first page of
+// defaultPageSize.
+func readPage(r *http.Request) (limit, offset int64) {
+	limit, err := utils.ReadQueryParamInt64(r, "limit")
+	if err != nil || limit <= 0 || limit > maxPageSize {
+		limit = defaultPageSize
+	}
+	offset, err = utils.ReadQueryParamInt64(r, "offset")
+	if err != nil || offset < 0 {
+		offset = 0
+	}
+	return limit, offset
+}
+
+// readOptionalID reads an ID from the query string, nil when it is absent.
+func readOptionalID(r *http.Request, name string) (*int64, error) {
+	if r.URL.Query().Get(name) == "" {
+		return nil, nil
+	}
+	id, err := utils.ReadQueryParamInt64(r, name)
+	if err != nil {
+		return nil, err
+	}
+	return &id, nil
+}
+
+// HandleSearchUsers lists accounts, optionally matching ?q= against
+// usernames and emails and ?suspended=true|false.
+func (ah *AdminHandler) HandleSearchUsers(w http.ResponseWriter, r *http.Request) {
+	search := store.UserSearch{Query: strings.TrimSpace(r.URL.Query().Get("q"))}
+	if s := r.URL.Query().Get("suspended"); s != "" {
+		suspended, err := strconv.ParseBool(s)
+		if err != nil {
+			apierror.Write(w, r, apierror.BadRequest("suspended must be true or false"))
+			return
+		}
+		search.Suspended = &suspended
+	}
+	search.Limit, search.Offset = readPage(r)
+
+	users, err := ah.userStore.SearchUsers(r.Context(), search)
+	if err != nil {
+		logging.FromContext(r.Context()).Error("searchUsers", "error", err)
+		apierror.Write(w, r, apierror.Internal("failed to search users"))
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"users":users})
+}
+
+func (ah *AdminHandler) HandleGetUser(w http.ResponseWriter, r *http.Request) {
+	userID, err := utils.ReadParam(r, "userID")
+	if err != nil {
+		apierror.Write(w, r, apierror.BadRequest("invalid user id"))
+		return
+	}
+
+	user, err := ah.userStore.GetUserByID(r.Context(), userID)
+	if err != nil {
+		apierror.Write(w, r, apierror.FromStore(err, "user"))
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"user":user})
+}
+
+// HandleSuspendUser locks an account out and ends its sessions. Its API
+// keys stop working too, Authenticate refuses suspended accounts.
+func (ah *AdminHandler) HandleSuspendUser(w http.ResponseWriter, r *http.Request) {
+	admin, ok := middleware.GetUser(r)
+	if !ok {
+		apierror.Write(w, r, apierror.Unauthorized("authentication required"))
+		return
+	}
+
+	userID, err := utils.ReadParam(r, "userID")
+	if err != nil {
+		apierror.Write(w, r, apierror.BadRequest("invalid user id"))
+		return
+	}
+	if userID == admin.ID {
+		apierror.Write(w, r, apierror.Unprocessable("you can't suspend yourself"))
+		return
+	}
+
+	user, err := ah.userStore.GetUserByID(r.Context(), userID)
+	if err != nil {
+		apierror.Write(w, r, apierror.FromStore(err, "user"))
+		return
+	}
+	if user.IsAdmin {
+		apierror.Write(w, r, apierror.Forbidden("platform administrators can't be suspended"))
+		return
+	}
+
+	if err := ah.userStore.SuspendUser(r.Context(), userID); err != nil {
+		apierror.Write(w, r, apierror.FromStore(err, "user"))
+		return
+	}
+	if err := ah.tokenStore.DeleteAllTokensForUser(r.Context(), userID); err != nil {
+		logging.FromContext(r.Context()).Error("deleteAllTokensForUser", "error", err)
+		apierror.Write(w, r, apierror.Internal("the account was suspended but its sessions could not be revoked"))
+		return
+	}
+
+	ah.respondWithSuspension(w, r, user, store.AuditUserSuspended)
+}
+
+func (ah *AdminHandler) HandleReactivateUser(w http.ResponseWriter, r *http.Request) {
+	userID, err := utils.ReadParam(r, "userID")
+	if err != nil {
+		apierror.Write(w, r, apierror.BadRequest("invalid user id"))
+		return
+	}
+
+	user, err := ah.userStore.GetUserByID(r.Context(), userID)
+	if err != nil {
+		apierror.Write(w, r, apierror.FromStore(err, "user"))
+		return
+	}
+
+	if err := ah.userStore.ReactivateUser(r.Context(), userID); err != nil {
+		apierror.Write(w, r, apierror.FromStore(err, "user"))
+		return
+	}
+
+	ah.respondWithSuspension(w, r, user, store.AuditUserReactivated)
+}
+
+// respondWithSuspension audits a change to before's suspension and responds
+// with the updated account.
+func (ah *AdminHandler) respondWithSuspension(w http.ResponseWriter, r *http.Request, before *store.User, action string) {
+	after, err := ah.userStore.GetUserByID(r.Context(), before.ID)
+	if err != nil {
+		apierror.Write(w, r, apierror.FromStore(err, "user"))
+		return
+	}
+
+	entry := auditEntry(action, store.AuditTargetUser, before.ID)
+	entry.Before = auditValue(utils.Envelope{"suspended_at":before.SuspendedAt})
+	entry.After = auditValue(utils.Envelope{"suspended_at":after.SuspendedAt})
+	audit(r, ah.auditStore, entry)
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"user":after})
+}
+
+// HandleRevokeSessions logs the user out everywhere. API keys are not
+// sessions and keep working.
+func (ah *AdminHandler) HandleRevokeSessions(w http.ResponseWriter, r *http.Request) {
+	userID, err := utils.ReadParam(r, "userID")
+	if err != nil {
+		apierror.Write(w, r, apierror.BadRequest("invalid user id"))
+		return
+	}
+
+	if _, err := ah.userStore.GetUserByID(r.Context(), userID); err != nil {
+		apierror.Write(w, r, apierror.FromStore(err, "user"))
+		return
+	}
+
+	if err := ah.tokenStore.DeleteAllTokensForUser(r.Context(), userID); err != nil {
+		logging.FromContext(r.Context()).Error("deleteAllTokensForUser", "error", err)
+		apierror.Write(w, r, apierror.Internal("failed to revoke sessions"))
+		return
+	}
+	audit(r, ah.auditStore, auditEntry(store.AuditUserSessionsRevoked, store.AuditTargetUser, userID))
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (ah *AdminHandler) getChat(w http.ResponseWriter, r *http.Request) (*store.Chat, bool) {
+	chatID, err := utils.ReadParam(r, "chatID")
+	if err != nil {
+		apierror.Write(w, r, apierror.BadRequest("invalid chat id"))
+		return nil, false
+	}
+
+	chat, err := ah.chatStore.GetChatByID(r.Context(), chatID)
+	if err == nil && chat == nil {
+		err = store.ErrNotFound
+	}
+	if err != nil {
+		apierror.Write(w, r, apierror.FromStore(err, "chat"))
+		return nil, false
+	}
+	return chat, true
+}
+
+// HandleGetChat shows any chat, whether or not the admin is a member.
+func (ah *AdminHandler) HandleGetChat(w http.ResponseWriter, r *http.Request) {
+	chat, ok := ah.getChat(w, r)
+	if !ok {
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"chat":presentChat(r, chat)})
+}
+
+func (ah *AdminHandler) HandleGetChatMembers(w http.ResponseWriter, r *http.Request) {
+	chat, ok := ah.getChat(w, r)
+	if !ok {
+		return
+	}
+
+	members, err := ah.chatMemberStore.GetChatMembers(r.Context(), chat.ChatID)
+	if err != nil {
+		logging.FromContext(r.Context()).Error("getChatMembers", "error", err)
+		apierror.Write(w, r, apierror.Internal("failed to get chat members"))
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"chat_members":members})
+}
+
+// HandleGetChatMessages pages through a chat's messages, newest first.
+func (ah *AdminHandler) HandleGetChatMessages(w http.ResponseWriter, r *http.Request) {
+	chat, ok := ah.getChat(w, r)
+	if !ok {
+		return
+	}
+	limit, offset := readPage(r)
+
+	// nobody is blocked from the admin's point of view
+	messages, err := ah.messageStore.GetChatMessages(r.Context(), chat.ChatID, 0, limit, offset)
+	if err != nil {
+		logging.FromContext(r.Context()).Error("getChatMessages", "error", err)
+		apierror.Write(w, r, apierror.Internal("failed to get chat messages"))
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"messages":messages})
+}
+
+func (ah *AdminHandler) HandleDeleteChat(w http.ResponseWriter, r *http.Request) {
+	chat, ok := ah.getChat(w, r)
+	if !ok {
+		return
+	}
+
+	if err := ah.chatStore.DeleteChat(r.Context(), chat.ChatID); err != nil {
+		apierror.Write(w, r, apierror.FromStore(err, "chat"))
+		return
+	}
+
+	entry := auditEntry(store.AuditChatDeleted, store.AuditTargetChat, chat.ChatID)
+	entry.ChatID = &chat.ChatID
+	entry.Before = auditValue(chat)
+	audit(r, ah.auditStore, entry)
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (ah *AdminHandler) HandleDeleteMessage(w http.ResponseWriter, r *http.Request) {
+	msgID, err := utils.ReadParam(r, "msgID")
+	if err != nil {
+		apierror.Write(w, r, apierror.BadRequest("invalid message id"))
+		return
+	}
+
+	msg, err := ah.messageStore.GetMessage(r.Context(), msgID)
+	if err != nil {
+		apierror.Write(w, r, apierror.FromStore(err, "message"))
+		return
+	}
+
+	if err := ah.messageStore.DeleteMessage(r.Context(), msgID); err != nil {
+		logging.FromContext(r.Context()).Error("deleteMessage", "error", err)
+		apierror.Write(w, r, apierror.Internal("failed to delete message"))
+		return
+	}
+	ah.webhooks.Publish(r.Context(), msg.ChatID, webhooks.EventMessageDeleted, utils.Envelope{"id":msgID})
+
+	entry := auditEntry(store.AuditMessageDeleted, store.AuditTargetMessage, msgID)
+	entry.ChatID = &msg.ChatID
+	entry.Before = auditValue(msg)
+	audit(r, ah.auditStore, entry)
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// HandleGetAuditLog searches the whole audit log, newest first, by
+// ?actor_id=, ?chat_id=, ?target_type= with ?target_id= and ?action=.
+func (ah *AdminHandler) HandleGetAuditLog(w http.ResponseWriter, r *http.Request) {
+	actorID, err := readOptionalID(r, "actor_id")
+	chatID, err2 := readOptionalID(r, "chat_id")
+	targetID, err3 := readOptionalID(r, "target_id")
+	if err := errors.Join(err, err2, err3); err != nil {
+		apierror.Write(w, r, apierror.BadRequest("actor_id, chat_id and target_id must be ids"))
+		return
+	}
+
+	query := store.AuditQuery{
+		ActorID: actorID,
+		ChatID: chatID,
+		TargetType: r.URL.Query().Get("target_type"),
+		TargetID: targetID,
+		Action: r.URL.Query().Get("action"),
+	}
+	query.Limit, query.Offset = readPage(r)
+
+	entries, err := ah.auditStore.GetAuditLog(r.Context(), query)
+	if err != nil {
+		logging.FromContext(r.Context()).Error("getAuditLog", "error", err)
+		apierror.Write(w, r, apierror.Internal("failed to get the audit log"))
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"entries":entries})
+}
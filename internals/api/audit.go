@@ -0,0 +1,63 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/Abhishek-B-R/chat-app-golang/internals/logging"
+	"github.com/Abhishek-B-R/chat-app-golang/internals/middleware"
+	"github.com/Abhishek-B-R/chat-app-golang/internals/store"
+)
+
+// auditEntry starts an audit log entry about the target.
+func auditEntry(action, targetType string, targetID int64) *store.AuditEntry {
+	return &store.AuditEntry{
+		Action: action,
+		TargetType: &targetType,
+		TargetID: &targetID,
+	}
+}
+
+// auditValue is v as the before or after value of an audit log entry.
+func auditValue(v any) json.RawMessage {
+	if v == nil {
+		return nil
+	}
+	doc, err := json.Marshal(v)
+	if err != nil {
+		return nil
+	}
+	return doc
+}
+
+// audit appends entry to the audit log, filling in the caller as the actor
+// unless set, and the request's ID, client IP and user agent. The action has
+// already happened by then, so a failure is logged instead of failing the
+// request.
+func audit(r *http.Request, auditStore store.AuditStore, entry *store.AuditEntry) {
+	if user, ok := middleware.GetUser(r); ok && entry.ActorID == nil {
+		entry.ActorID = &user.ID
+	}
+	if id := middleware.GetRequestID(r); id != "" {
+		entry.RequestID = &id
+	}
+	if ip := middleware.GetClientIP(r); ip != "" {
+		entry.IP = &ip
+	}
+	if ua := r.UserAgent(); ua != "" {
+		entry.UserAgent = &ua
+	}
+
+	if err := auditStore.RecordAudit(r.Context(), entry); err != nil {
+		logging.FromContext(r.Context()).Error("recordAudit", "action", entry.Action, "error", err)
+	}
+}
+
+// auditLogin records a sign-in attempt by userID. The caller isn't
+// authenticated yet, so the actor is set from the account itself.
+func auditLogin(r *http.Request, auditStore store.AuditStore, action string, userID int64, details map[string]any) {
+	entry := auditEntry(action, store.AuditTargetUser, userID)
+	entry.ActorID = &userID
+	entry.After = auditValue(details)
+	audit(r, auditStore, entry)
+}
@@ -0,0 +1,98 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/Abhishek-B-R/chat-app-golang/internals/apierror"
+	"github.com/Abhishek-B-R/chat-app-golang/internals/logging"
+	"github.com/Abhishek-B-R/chat-app-golang/internals/middleware"
+	"github.com/Abhishek-B-R/chat-app-golang/internals/store"
+	"github.com/Abhishek-B-R/chat-app-golang/internals/utils"
+)
+
+type BlockHandler struct {
+	blockStore store.BlockStore
+}
+
+func NewBlockHandler(blockStore store.BlockStore) *BlockHandler {
+	return &BlockHandler{
+		blockStore: blockStore,
+	}
+}
+
+func (bh *BlockHandler) HandleGetBlocks(w http.ResponseWriter, r *http.Request) {
+	authenticatedUser, ok := middleware.GetUser(r)
+	if !ok {
+		apierror.Write(w, r, apierror.Unauthorized("authentication required"))
+		return
+	}
+
+	blocks, err := bh.blockStore.GetBlockedUsers(r.Context(), authenticatedUser.ID)
+	if err != nil {
+		logging.FromContext(r.Context()).Error("getBlockedUsers", "error", err)
+		apierror.Write(w, r, apierror.Internal("failed to get blocked users"))
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"blocks":blocks})
+}
+
+// HandleBlockUser blocks {userID}. Blocking someone already blocked is fine.
+func (bh *BlockHandler) HandleBlockUser(w http.ResponseWriter, r *http.Request) {
+	authenticatedUser, ok := middleware.GetUser(r)
+	if !ok {
+		apierror.Write(w, r, apierror.Unauthorized("authentication required"))
+		return
+	}
+
+	userID, err := utils.ReadParam(r, "userID")
+	if err != nil {
+		apierror.Write(w, r, apierror.BadRequest("invalid user id"))
+		return
+	}
+	if userID == authenticatedUser.ID {
+		apierror.Write(w, r, apierror.Unprocessable("you can't block yourself"))
+		return
+	}
+
+	err = bh.blockStore.BlockUser(r.Context(), authenticatedUser.ID, userID)
+	if errors.Is(err, store.ErrNotFound) {
+		apierror.Write(w, r, apierror.NotFound("user not found"))
+		return
+	}
+	if err != nil {
+		logging.FromContext(r.Context()).Error("blockUser", "error", err)
+		apierror.Write(w, r, apierror.Internal("failed to block user"))
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (bh *BlockHandler) HandleUnblockUser(w http.ResponseWriter, r *http.Request) {
+	authenticatedUser, ok := middleware.GetUser(r)
+	if !ok {
+		apierror.Write(w, r, apierror.Unauthorized("authentication required"))
+		return
+	}
+
+	userID, err := utils.ReadParam(r, "userID")
+	if err != nil {
+		apierror.Write(w, r, apierror.BadRequest("invalid user id"))
+		return
+	}
+
+	err = bh.blockStore.UnblockUser(r.Context(), authenticatedUser.ID, userID)
+	if errors.Is(err, store.ErrNotFound) {
+		apierror.Write(w, r, apierror.NotFound("user is not blocked"))
+		return
+	}
+	if err != nil {
+		logging.FromContext(r.Context()).Error("unblockUser", "error", err)
+		apierror.Write(w, r, apierror.Internal("failed to unblock user"))
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,248 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/Abhishek-B-R/chat-app-golang/internals/apierror"
+	"github.com/Abhishek-B-R/chat-app-golang/internals/logging"
+	"github.com/Abhishek-B-R/chat-app-golang/internals/middleware"
+	"github.com/Abhishek-B-R/chat-app-golang/internals/store"
+	"github.com/Abhishek-B-R/chat-app-golang/internals/tokens"
+	"github.com/Abhishek-B-R/chat-app-golang/internals/utils"
+	"github.com/Abhishek-B-R/chat-app-golang/internals/validate"
+)
+
+type createBotRequest struct {
+	Username string `json:"username"`
+	Bio string `json:"bio"`
+	AvatarURL string `json:"avatar_url"`
+}
+
+type createAPIKeyRequest struct {
+	Name string `json:"name"`
+	Scopes []string `json:"scopes"`
+	ChatIDs []int64 `json:"chat_ids"`
+	ExpiresInDays int `json:"expires_in_days"`
+}
+
+type BotHandler struct {
+	userStore store.UserStore
+	apiKeyStore store.APIKeyStore
+	auditStore store.AuditStore
+}
+
+func NewBotHandler(userStore store.UserStore, apiKeyStore store.APIKeyStore, auditStore store.AuditStore) *BotHandler {
+	return &BotHandler{
+		userStore: userStore,
+		apiKeyStore: apiKeyStore,
+		auditStore: auditStore,
+	}
+}
+
+func (bh *BotHandler) HandleCreateBot(w http.ResponseWriter, r *http.Request) {
+	authenticatedUser, ok := middleware.GetUser(r)
+	if !ok {
+		apierror.Write(w, r, apierror.Unauthorized("authentication required"))
+		return
+	}
+
+	var req createBotRequest
+	err := validate.DecodeJSON(r, &req)
+	if err != nil {
+		apierror.Write(w, r, err)
+		return
+	}
+
+	req.Username = strings.ToLower(strings.TrimSpace(req.Username))
+	var v validate.Validator
+	v.Username("username", req.Username)
+	if err := v.Err(); err != nil {
+		apierror.Write(w, r, err)
+		return
+	}
+
+	bot := &store.User{
+		Username: req.Username,
+		// bots never receive mail, but users.email is required and unique
+		Email: fmt.Sprintf("%s@bots.invalid", req.Username),
+		BotOwnerID: &authenticatedUser.ID,
+	}
+	if req.Bio != "" {
+		bot.Bio = &req.Bio
+	}
+	if req.AvatarURL != "" {
+		bot.AvatarURL = &req.AvatarURL
+	}
+
+	err = bh.userStore.CreateBot(r.Context(), bot)
+	if errors.Is(err, store.ErrConflict) {
+		apierror.Write(w, r, apierror.Conflict("username is already taken"))
+		return
+	}
+	if err != nil {
+		logging.FromContext(r.Context()).Error("createBot", "error", err)
+		apierror.Write(w, r, apierror.Internal("failed to create bot"))
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusCreated, utils.Envelope{"bot":bot})
+}
+
+func (bh *BotHandler) HandleGetBots(w http.ResponseWriter, r *http.Request) {
+	authenticatedUser, ok := middleware.GetUser(r)
+	if !ok {
+		apierror.Write(w, r, apierror.Unauthorized("authentication required"))
+		return
+	}
+
+	bots, err := bh.userStore.GetBotsByOwner(r.Context(), authenticatedUser.ID)
+	if err != nil {
+		logging.FromContext(r.Context()).Error("getBotsByOwner", "error", err)
+		apierror.Write(w, r, apierror.Internal("failed to get bots"))
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"bots":bots})
+}
+
+func (bh *BotHandler) HandleCreateAPIKey(w http.ResponseWriter, r *http.Request) {
+	bot, ok := bh.ownedBot(w, r)
+	if !ok {
+		return
+	}
+
+	var req createAPIKeyRequest
+	err := validate.DecodeJSON(r, &req)
+	if err != nil {
+		apierror.Write(w, r, err)
+		return
+	}
+
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" {
+		apierror.Write(w, r, apierror.BadRequest("name cannot be empty"))
+		return
+	}
+	if len(req.Scopes) == 0 {
+		apierror.Write(w, r, apierror.BadRequest("at least one scope is required"))
+		return
+	}
+	for _, scope := range req.Scopes {
+		if !tokens.ValidScope(scope) {
+			apierror.Write(w, r, apierror.BadRequest("unknown scope: " + scope))
+			return
+		}
+	}
+	if req.ExpiresInDays < 0 {
+		apierror.Write(w, r, apierror.BadRequest("expires_in_days cannot be negative"))
+		return
+	}
+
+	token, err := tokens.GenerateAPIKey(bot.ID)
+	if err != nil {
+		logging.FromContext(r.Context()).Error("generating api key", "error", err)
+		apierror.Write(w, r, apierror.Internal("internal server error"))
+		return
+	}
+
+	key := &store.APIKey{
+		UserID: bot.ID,
+		Name: req.Name,
+		Scopes: req.Scopes,
+		ChatIDs: req.ChatIDs,
+		CreatedBy: bot.BotOwnerID,
+	}
+	if req.ExpiresInDays > 0 {
+		expiresAt := time.Now().Add(time.Duration(req.ExpiresInDays) * 24 * time.Hour)
+		key.ExpiresAt = &expiresAt
+	}
+
+	err = bh.apiKeyStore.CreateAPIKey(r.Context(), key, token)
+	if err != nil {
+		logging.FromContext(r.Context()).Error("createAPIKey", "error", err)
+		apierror.Write(w, r, apierror.Internal("failed to create api key"))
+		return
+	}
+
+	// the plaintext key is only ever shown once
+	utils.WriteJSON(w, http.StatusCreated, utils.Envelope{"api_key":key, "key":token.Plaintext})
+}
+
+func (bh *BotHandler) HandleGetAPIKeys(w http.ResponseWriter, r *http.Request) {
+	bot, ok := bh.ownedBot(w, r)
+	if !ok {
+		return
+	}
+
+	keys, err := bh.apiKeyStore.GetAPIKeysForUser(r.Context(), bot.ID)
+	if err != nil {
+		logging.FromContext(r.Context()).Error("getAPIKeysForUser", "error", err)
+		apierror.Write(w, r, apierror.Internal("failed to get api keys"))
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"api_keys":keys})
+}
+
+func (bh *BotHandler) HandleRevokeAPIKey(w http.ResponseWriter, r *http.Request) {
+	bot, ok := bh.ownedBot(w, r)
+	if !ok {
+		return
+	}
+
+	keyID, err := utils.ReadParam(r, "keyID")
+	if err != nil {
+		apierror.Write(w, r, apierror.BadRequest("invalid key id"))
+		return
+	}
+
+	err = bh.apiKeyStore.RevokeAPIKey(r.Context(), bot.ID, keyID)
+	if errors.Is(err, store.ErrNotFound) {
+		apierror.Write(w, r, apierror.NotFound("api key not found or already revoked"))
+		return
+	}
+	if err != nil {
+		logging.FromContext(r.Context()).Error("revokeAPIKey", "error", err)
+		apierror.Write(w, r, apierror.Internal("failed to revoke api key"))
+		return
+	}
+
+	entry := auditEntry(store.AuditAPIKeyRevoked, store.AuditTargetAPIKey, keyID)
+	entry.After = auditValue(utils.Envelope{"bot_id":bot.ID})
+	audit(r, bh.auditStore, entry)
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ownedBot loads the {botID} URL parameter and checks that the caller manages
+// that bot. It writes the error response itself when it returns false.
+func (bh *BotHandler) ownedBot(w http.ResponseWriter, r *http.Request) (*store.User, bool) {
+	authenticatedUser, ok := middleware.GetUser(r)
+	if !ok {
+		apierror.Write(w, r, apierror.Unauthorized("authentication required"))
+		return nil, false
+	}
+
+	botID, err := utils.ReadParam(r, "botID")
+	if err != nil {
+		apierror.Write(w, r, apierror.BadRequest("invalid bot id"))
+		return nil, false
+	}
+
+	bot, err := bh.userStore.GetUserByID(r.Context(), botID)
+	if err != nil && !errors.Is(err, store.ErrNotFound) {
+		logging.FromContext(r.Context()).Error("getUserByID", "error", err)
+		apierror.Write(w, r, apierror.Internal("internal server error"))
+		return nil, false
+	}
+	if err != nil || !bot.IsBot || bot.BotOwnerID == nil || *bot.BotOwnerID != authenticatedUser.ID {
+		apierror.Write(w, r, apierror.NotFound("bot not found"))
+		return nil, false
+	}
+
+	return bot, true
+}
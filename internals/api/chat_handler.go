@@ -1,127 +1,298 @@
 package api
 
 import (
-	"database/sql"
-	"encoding/json"
-	"log"
+	"errors"
+	"fmt"
 	"net/http"
 
+	"github.com/Abhishek-B-R/chat-app-golang/internals/apierror"
+	"github.com/Abhishek-B-R/chat-app-golang/internals/logging"
 	"github.com/Abhishek-B-R/chat-app-golang/internals/middleware"
 	"github.com/Abhishek-B-R/chat-app-golang/internals/store"
 	"github.com/Abhishek-B-R/chat-app-golang/internals/utils"
+	"github.com/Abhishek-B-R/chat-app-golang/internals/validate"
+	"github.com/Abhishek-B-R/chat-app-golang/internals/webhooks"
 )
 
 type ChatHandler struct {
 	chatStore store.ChatStore
-	logger *log.Logger
+	auditStore store.AuditStore
+	webhooks *webhooks.Publisher
 }
 
-func NewChatHandler(chatStore store.ChatStore, logger *log.Logger) *ChatHandler {
+func NewChatHandler(chatStore store.ChatStore, auditStore store.AuditStore, publisher *webhooks.Publisher) *ChatHandler {
 	return &ChatHandler{
 		chatStore: chatStore,
-		logger: logger,
+		auditStore: auditStore,
+		webhooks: publisher,
 	}
 }
 
 func (ch *ChatHandler) HandleCreateChat(w http.ResponseWriter, r *http.Request) {
 	var chat store.Chat
-	err := json.NewDecoder(r.Body).Decode(&chat)
+	err := validate.DecodeJSON(r, &chat)
 	if err != nil {
-		ch.logger.Printf("ERROR: decodingCreateChat: %v", err)
-		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error":"invalid request sent"})
+		apierror.Write(w, r, err)
+		return
+	}
+
+	var v validate.Validator
+	checkChatSettings(&v, "settings.", chat.Settings)
+	if err := v.Err(); err != nil {
+		apierror.Write(w, r, err)
 		return
 	}
 
 	authenticatedUser, ok := middleware.GetUser(r)
 	if !ok {
-		utils.WriteJSON(w, http.StatusUnauthorized, utils.Envelope{"error":"authentication required"})
+		apierror.Write(w, r, apierror.Unauthorized("authentication required"))
 		return
 	}
 
 	createdChat, err := ch.chatStore.CreateChat(r.Context(), &chat, authenticatedUser.ID)
 	if err != nil {
-		ch.logger.Printf("ERROR: createChat: %v\n",err)
-		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error":"Failed to create chat"})
+		logging.FromContext(r.Context()).Error("createChat", "error", err)
+		apierror.Write(w, r, apierror.Internal("Failed to create chat"))
 		return
 	}
 
-	utils.WriteJSON(w, http.StatusCreated, utils.Envelope{"chat":createdChat})
+	utils.WriteJSON(w, http.StatusCreated, utils.Envelope{"chat":presentChat(r, createdChat)})
 }
 
 func (ch *ChatHandler) HandleGetUserChats(w http.ResponseWriter, r *http.Request) {
 	authenticatedUser, ok := middleware.GetUser(r)
 	if !ok {
-		utils.WriteJSON(w, http.StatusUnauthorized, utils.Envelope{"error":"authentication required"})
+		apierror.Write(w, r, apierror.Unauthorized("authentication required"))
 		return
 	}
 
 	userChats, err := ch.chatStore.GetUserChats(r.Context(), authenticatedUser.ID)
 	if err != nil {
-		ch.logger.Printf("ERROR: GetUserChats: %v\n", err)
-		utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error":"internal server error"})
+		logging.FromContext(r.Context()).Error("GetUserChats", "error", err)
+		apierror.Write(w, r, apierror.Internal("internal server error"))
+		return
+	}
+
+	// a key limited to some chats doesn't get to see the others either
+	if key, ok := middleware.GetAPIKey(r); ok {
+		allowed := []store.Chat{}
+		for _, chat := range *userChats {
+			if key.AllowsChat(chat.ChatID) {
+				allowed = append(allowed, chat)
+			}
+		}
+		userChats = &allowed
 	}
 
-	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"chats":userChats})
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"chats":presentChats(r, userChats)})
 }
 
 func (ch *ChatHandler) HandleGetChatByID(w http.ResponseWriter, r *http.Request) {
 	chatID, err := utils.ReadParam(r, "chatID")
 	if err != nil {
-		ch.logger.Printf("ERROR: readIDParam: %v\n", err)
-		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error":"invalid chat id"})
+		logging.FromContext(r.Context()).Error("readIDParam", "error", err)
+		apierror.Write(w, r, apierror.BadRequest("invalid chat id"))
 		return
 	}
 
 	chat, err := ch.chatStore.GetChatByID(r.Context(), chatID)
+	if err == nil && chat == nil {
+		err = store.ErrNotFound
+	}
 	if err != nil {
-		ch.logger.Printf("ERROR: GetWorkoutByID: %v\n", err)
-		utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error":"internal server error"})
+		apierror.Write(w, r, apierror.FromStore(err, "chat"))
 		return
 	}
 
-	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"chat":chat})
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"chat":presentChat(r, chat)})
 }
 
 func (ch *ChatHandler) HandleUpdateChat(w http.ResponseWriter, r *http.Request) {
 	var chat store.Chat
-	err := json.NewDecoder(r.Body).Decode(&chat)
+	err := validate.DecodeJSON(r, &chat)
 	if err != nil {
-		ch.logger.Printf("ERROR: decodingUpdateChat: %v\n", err)
-		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error":"invalid request sent"})
+		apierror.Write(w, r, err)
 		return
 	}
 
 	chatID, err := utils.ReadParam(r, "chatID")
 	if err != nil {
-		ch.logger.Printf("ERROR: no chatID field: %v",err)
-		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error":"no chatid field sent"})
+		logging.FromContext(r.Context()).Error("no chatID field", "error", err)
+		apierror.Write(w, r, apierror.BadRequest("no chatid field sent"))
 		return
 	}
 
-	err = ch.chatStore.UpdateChat(r.Context(), &chat, chatID)
+	before, err := ch.chatStore.GetChatByID(r.Context(), chatID)
+	if err == nil && before == nil {
+		err = store.ErrNotFound
+	}
 	if err != nil {
-		ch.logger.Printf("ERROR: updateChat: %v\n", err)
-		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error":"failed to update chat"})
+		apierror.Write(w, r, apierror.FromStore(err, "chat"))
 		return
 	}
 
-	utils.WriteJSON(w, http.StatusCreated, utils.Envelope{"chat":chat})
+	// a system message is only posted when the name actually changes
+	var event *store.SystemEvent
+	if !sameName(before.Name, chat.Name) {
+		event = &store.SystemEvent{Kind: store.SystemChatRenamed, Name: chat.Name}
+		if user, ok := middleware.GetUser(r); ok {
+			event.ActorID = &user.ID
+		}
+	}
+
+	sysMsg, err := ch.chatStore.UpdateChat(r.Context(), &chat, chatID, event)
+	if err != nil {
+		apierror.Write(w, r, apierror.FromStore(err, "chat"))
+		return
+	}
+	// webhook payloads are not versioned, subscribers keep getting the v1 shape
+	ch.webhooks.Publish(r.Context(), chatID, webhooks.EventChatUpdated, toChatV1(&chat))
+	publishSystemMessage(r, ch.webhooks, sysMsg)
+
+	entry := auditEntry(store.AuditChatUpdated, store.AuditTargetChat, chatID)
+	entry.ChatID = &chatID
+	entry.Before = auditValue(utils.Envelope{"name":before.Name})
+	entry.After = auditValue(utils.Envelope{"name":chat.Name})
+	audit(r, ch.auditStore, entry)
+
+	utils.WriteJSON(w, http.StatusCreated, utils.Envelope{"chat":presentChat(r, &chat)})
+}
+
+func sameName(a, b *string) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
+
+// maxSlowModeSeconds caps slow mode at six hours.
+const maxSlowModeSeconds = 6 * 60 * 60
+
+// checkChatSettings validates settings on chat creation and on update, with
+// prefix in front of the field names.
+func checkChatSettings(v *validate.Validator, prefix string, settings store.ChatSettings) {
+	v.Check(settings.SlowModeSeconds >= 0 && settings.SlowModeSeconds <= maxSlowModeSeconds, prefix+"slow_mode_seconds", fmt.Sprintf("must be between 0 and %d", maxSlowModeSeconds))
+}
+
+// HandleUpdateChatSettings replaces the chat's posting restrictions. Only
+// chat admins get here.
+func (ch *ChatHandler) HandleUpdateChatSettings(w http.ResponseWriter, r *http.Request) {
+	chatID, err := utils.ReadParam(r, "chatID")
+	if err != nil {
+		apierror.Write(w, r, apierror.BadRequest("invalid chat id"))
+		return
+	}
+
+	var settings store.ChatSettings
+	err = validate.DecodeJSON(r, &settings)
+	if err != nil {
+		apierror.Write(w, r, err)
+		return
+	}
+
+	var v validate.Validator
+	checkChatSettings(&v, "", settings)
+	if err := v.Err(); err != nil {
+		apierror.Write(w, r, err)
+		return
+	}
+
+	before, err := ch.chatStore.GetChatByID(r.Context(), chatID)
+	if err == nil && before == nil {
+		err = store.ErrNotFound
+	}
+	if err != nil {
+		apierror.Write(w, r, apierror.FromStore(err, "chat"))
+		return
+	}
+
+	err = ch.chatStore.UpdateChatSettings(r.Context(), chatID, settings)
+	if err != nil {
+		apierror.Write(w, r, apierror.FromStore(err, "chat"))
+		return
+	}
+
+	chat, err := ch.chatStore.GetChatByID(r.Context(), chatID)
+	if err == nil && chat == nil {
+		err = store.ErrNotFound
+	}
+	if err != nil {
+		apierror.Write(w, r, apierror.FromStore(err, "chat"))
+		return
+	}
+	ch.webhooks.Publish(r.Context(), chatID, webhooks.EventChatUpdated, toChatV1(chat))
+
+	entry := auditEntry(store.AuditChatSettingsUpdated, store.AuditTargetChat, chatID)
+	entry.ChatID = &chatID
+	entry.Before = auditValue(before.Settings)
+	entry.After = auditValue(chat.Settings)
+	audit(r, ch.auditStore, entry)
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"chat":presentChat(r, chat)})
 }
 
 func (ch *ChatHandler) HandleDeleteChat(w http.ResponseWriter, r *http.Request) {
 	chatID, err := utils.ReadParam(r, "chatID")
 	if err != nil {
-		ch.logger.Printf("ERROR: readIDParam: %v", err)
-		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error":"invalid chat delete id"})
+		logging.FromContext(r.Context()).Error("readIDParam", "error", err)
+		apierror.Write(w, r, apierror.BadRequest("invalid chat delete id"))
+		return
+	}
+
+	chat, err := ch.chatStore.GetChatByID(r.Context(), chatID)
+	if err == nil && chat == nil {
+		err = store.ErrNotFound
+	}
+	if err != nil {
+		apierror.Write(w, r, apierror.FromStore(err, "chat"))
 		return
 	}
 
 	err = ch.chatStore.DeleteChat(r.Context(), chatID)
-	if err == sql.ErrNoRows {
-		ch.logger.Printf("ERROR: deleteChat: %v\n",err)
-		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error":"No such chat found in db"})
+	if err != nil {
+		apierror.Write(w, r, apierror.FromStore(err, "chat"))
 		return
 	}
 
+	entry := auditEntry(store.AuditChatDeleted, store.AuditTargetChat, chatID)
+	entry.ChatID = &chatID
+	entry.Before = auditValue(chat)
+	audit(r, ch.auditStore, entry)
+
 	w.WriteHeader(http.StatusNoContent)
-}
\ No newline at end of file
+}
+// HandleGetChatAuditLog is the audit log of one chat, newest first, for its
+// admins. It takes the same filters as the platform-wide audit log except
+// ?chat_id=.
+func (ch *ChatHandler) HandleGetChatAuditLog(w http.ResponseWriter, r *http.Request) {
+	chatID, err := utils.ReadParam(r, "chatID")
+	if err != nil {
+		apierror.Write(w, r, apierror.BadRequest("invalid chat id"))
+		return
+	}
+
+	actorID, err := readOptionalID(r, "actor_id")
+	targetID, err2 := readOptionalID(r, "target_id")
+	if err := errors.Join(err, err2); err != nil {
+		apierror.Write(w, r, apierror.BadRequest("actor_id and target_id must be ids"))
+		return
+	}
+
+	query := store.AuditQuery{
+		ActorID: actorID,
+		ChatID: &chatID,
+		TargetType: r.URL.Query().Get("target_type"),
+		TargetID: targetID,
+		Action: r.URL.Query().Get("action"),
+	}
+	query.Limit, query.Offset = readPage(r)
+
+	entries, err := ch.auditStore.GetAuditLog(r.Context(), query)
+	if err != nil {
+		logging.FromContext(r.Context()).Error("getAuditLog", "error", err)
+		apierror.Write(w, r, apierror.Internal("failed to get the audit log"))
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"entries":entries})
+}
@@ -1,51 +1,125 @@
 package api
 
 import (
-	"database/sql"
-	"encoding/json"
-	"log"
+	"errors"
+	"fmt"
 	"net/http"
+	"time"
 
+	"github.com/Abhishek-B-R/chat-app-golang/internals/apierror"
+	"github.com/Abhishek-B-R/chat-app-golang/internals/logging"
 	"github.com/Abhishek-B-R/chat-app-golang/internals/middleware"
 	"github.com/Abhishek-B-R/chat-app-golang/internals/store"
 	"github.com/Abhishek-B-R/chat-app-golang/internals/utils"
+	"github.com/Abhishek-B-R/chat-app-golang/internals/validate"
+	"github.com/Abhishek-B-R/chat-app-golang/internals/webhooks"
 )
 
 type ChatMemberHandler struct {
 	chatMemberStore store.ChatMemberStore
 	messageStore store.MessageStore
-	logger *log.Logger
+	blockStore store.BlockStore
+	auditStore store.AuditStore
+	webhooks *webhooks.Publisher
 }
 
-func NewChatMemberHandler(ChatMemberStore store.ChatMemberStore, MessageStore store.MessageStore, logger *log.Logger) *ChatMemberHandler {
+func NewChatMemberHandler(ChatMemberStore store.ChatMemberStore, MessageStore store.MessageStore, BlockStore store.BlockStore, AuditStore store.AuditStore, publisher *webhooks.Publisher) *ChatMemberHandler {
 	return &ChatMemberHandler{
 		chatMemberStore: ChatMemberStore,
 		messageStore: MessageStore,
-		logger: logger,
+		blockStore: BlockStore,
+		auditStore: AuditStore,
+		webhooks: publisher,
 	}
 }
 
 func (cmh *ChatMemberHandler) HandleAddMember(w http.ResponseWriter, r *http.Request) {
 	var params struct{
-		UserID int64
-		Role string
+		UserID int64 `json:"user_id"`
+		// LegacyUserID is the key this endpoint took before it was tagged
+		LegacyUserID int64 `json:"UserID"`
+		Role string `json:"role"`
+	}
+	chatID, err := utils.ReadParam(r, "chatID")
+	if err != nil {
+		apierror.Write(w, r, apierror.BadRequest("invalid chat id"))
+		return
 	}
-	err := json.NewDecoder(r.Body).Decode(&params)
 
-	chatID, err2 := utils.ReadParam(r, "chatID")
-	if err != nil || err2 != nil {
-		cmh.logger.Printf("ERROR: decodingAddMember: %v %v\n",err, err2)
-		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error":"invalid request sent"})
+	err = validate.DecodeJSON(r, &params)
+	if err != nil {
+		apierror.Write(w, r, err)
+		return
+	}
+
+	if params.UserID == 0 {
+		params.UserID = params.LegacyUserID
+	}
+	if params.Role == "" {
+		params.Role = string(store.MEMBER)
+	}
+	var v validate.Validator
+	v.Check(params.UserID > 0, "user_id", "user_id is required")
+	v.Check(params.Role == string(store.MEMBER) || params.Role == string(store.ADMIN), "role", "role must be member or admin")
+	if err := v.Err(); err != nil {
+		apierror.Write(w, r, err)
 		return
 	}
 
-	err = cmh.chatMemberStore.AddMember(r.Context(), chatID, params.UserID, params.Role)
+	authenticatedUser, ok := middleware.GetUser(r)
+	if !ok {
+		apierror.Write(w, r, apierror.Unauthorized("authentication required"))
+		return
+	}
+	// any member can add people, but only admins can hand out admin
+	if params.Role != string(store.MEMBER) {
+		callerRole, err := cmh.chatMemberStore.GetUserRole(r.Context(), chatID, authenticatedUser.ID)
+		if err != nil && !errors.Is(err, store.ErrNotFound) {
+			logging.FromContext(r.Context()).Error("getUserRole", "error", err)
+			apierror.Write(w, r, apierror.Internal("internal server error"))
+			return
+		}
+		if callerRole != string(store.OWNER) && callerRole != string(store.ADMIN) {
+			apierror.Write(w, r, apierror.Forbidden("only chat admins can add admins"))
+			return
+		}
+	}
+	blocked, err := cmh.blockStore.HasBlocked(r.Context(), params.UserID, authenticatedUser.ID)
 	if err != nil {
-		cmh.logger.Printf("ERROR: addMember: %v\n",err)
-		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error":"failed to add member"})
+		logging.FromContext(r.Context()).Error("hasBlocked", "error", err)
+		apierror.Write(w, r, apierror.Internal("internal server error"))
+		return
+	}
+	if blocked {
+		apierror.Write(w, r, apierror.Forbidden("this user has blocked you").WithCode(apierror.CodeBlocked))
 		return
 	}
 
+	event := systemEvent(store.SystemMemberJoined, authenticatedUser.ID, params.UserID)
+	role := store.ChatGroupRole(params.Role)
+	event.Role = &role
+	sysMsg, err := cmh.chatMemberStore.AddMember(r.Context(), chatID, params.UserID, params.Role, event)
+	if errors.Is(err, store.ErrConflict) {
+		apierror.Write(w, r, apierror.Conflict("user is already a member of this chat"))
+		return
+	}
+	if errors.Is(err, store.ErrNotFound) {
+		apierror.Write(w, r, apierror.NotFound("user not found"))
+		return
+	}
+	if err != nil {
+		logging.FromContext(r.Context()).Error("addMember", "error", err)
+		apierror.Write(w, r, apierror.Internal("failed to add member"))
+		return
+	}
+	cmh.webhooks.Publish(r.Context(), chatID, webhooks.EventMemberAdded, utils.Envelope{"user_id":params.UserID, "role":params.Role})
+	publishSystemMessage(r, cmh.webhooks, sysMsg)
+
+	entry := auditEntry(store.AuditMemberAdded, store.AuditTargetUser, params.UserID)
+	entry.ChatID = &chatID
+	entry.After = auditValue(utils.Envelope{"role":params.Role})
+	audit(r, cmh.auditStore, entry)
+
 	utils.WriteJSON(w, http.StatusCreated, utils.Envelope{"msg":"added user"})
 }
 
@@ -54,38 +128,145 @@ func (cmh *ChatMemberHandler) HandleRemoveMember(w http.ResponseWriter, r *http.
 	userID, err2 := utils.ReadParam(r, "userID")
 
 	if err != nil {
-		cmh.logger.Printf("ERROR: decodingRemoveMember: err: %v\n",err)
-		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error":"invalid request sent"})
+		logging.FromContext(r.Context()).Error("decodingRemoveMember: err", "error", err)
+		apierror.Write(w, r, apierror.BadRequest("invalid request sent"))
 		return
 	}
 	if err2 != nil {
-		cmh.logger.Printf("ERROR: decodingRemoveMember: err2: %v\n",err)
-		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error":"invalid request sent"})
+		logging.FromContext(r.Context()).Error("decodingRemoveMember: err2", "error", err)
+		apierror.Write(w, r, apierror.BadRequest("invalid request sent"))
+		return
+	}
+
+	authenticatedUser, ok := middleware.GetUser(r)
+	if !ok {
+		apierror.Write(w, r, apierror.Unauthorized("authentication required"))
+		return
+	}
+	// removing yourself is leaving, which must not orphan the chat
+	if userID == authenticatedUser.ID {
+		cmh.HandleLeaveChat(w, r)
 		return
 	}
+	callerRole, err := cmh.chatMemberStore.GetUserRole(r.Context(), chatID, authenticatedUser.ID)
+	if err != nil && !errors.Is(err, store.ErrNotFound) {
+		logging.FromContext(r.Context()).Error("getUserRole", "error", err)
+		apierror.Write(w, r, apierror.Internal("internal server error"))
+		return
+	}
+	if callerRole != string(store.OWNER) && callerRole != string(store.ADMIN) {
+		apierror.Write(w, r, apierror.Forbidden("only chat admins can remove members").WithCode(apierror.CodeAdminsOnly))
+		return
+	}
+
+	event := systemEvent(store.SystemMemberRemoved, authenticatedUser.ID, userID)
 
-	err = cmh.chatMemberStore.RemoveMember(r.Context(), chatID, userID)
+	var sysMsg *store.Message
+	role, err := cmh.chatMemberStore.GetUserRole(r.Context(), chatID, userID)
+	// the same rules as changing roles: the owner stays, and only the owner
+	// can take an admin out
+	switch {
+	case err == nil && role == string(store.OWNER):
+		apierror.Write(w, r, apierror.Forbidden("the owner can't be removed"))
+		return
+	case err == nil && role == string(store.ADMIN) && callerRole != string(store.OWNER):
+		apierror.Write(w, r, apierror.Forbidden("only the owner can remove admins"))
+		return
+	case err == nil:
+		sysMsg, err = cmh.chatMemberStore.RemoveMember(r.Context(), chatID, userID, event)
+	}
+	if errors.Is(err, store.ErrNotFound) {
+		apierror.Write(w, r, apierror.NotFound("user is not a member of this chat"))
+		return
+	}
 	if err != nil {
-		cmh.logger.Printf("ERROR: removeMember: %v\n",err)
-		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error":"failed to remove member"})
+		logging.FromContext(r.Context()).Error("removeMember", "error", err)
+		apierror.Write(w, r, apierror.Internal("failed to remove member"))
 		return
 	}
+	cmh.webhooks.Publish(r.Context(), chatID, webhooks.EventMemberRemoved, utils.Envelope{"user_id":userID})
+	publishSystemMessage(r, cmh.webhooks, sysMsg)
+
+	entry := auditEntry(store.AuditMemberRemoved, store.AuditTargetUser, userID)
+	entry.ChatID = &chatID
+	entry.Before = auditValue(utils.Envelope{"role":role})
+	audit(r, cmh.auditStore, entry)
 
 	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"status":"success"})
 }
 
+// HandleLeaveChat removes the caller from the chat. When no owner is left,
+// the longest-standing admin, or member if there is no admin, takes over;
+// when the last member leaves, the chat is deleted.
+func (cmh *ChatMemberHandler) HandleLeaveChat(w http.ResponseWriter, r *http.Request) {
+	chatID, err := utils.ReadParam(r, "chatID")
+	if err != nil {
+		apierror.Write(w, r, apierror.BadRequest("invalid chat id"))
+		return
+	}
+
+	authenticatedUser, ok := middleware.GetUser(r)
+	if !ok {
+		apierror.Write(w, r, apierror.Unauthorized("authentication required"))
+		return
+	}
+
+	res, err := cmh.chatMemberStore.LeaveChat(r.Context(), chatID, authenticatedUser.ID, nil)
+	if errors.Is(err, store.ErrNotFound) {
+		apierror.Write(w, r, apierror.NotFound("you are not a member of this chat"))
+		return
+	}
+	if err != nil {
+		logging.FromContext(r.Context()).Error("leaveChat", "error", err)
+		apierror.Write(w, r, apierror.Internal("failed to leave chat"))
+		return
+	}
+
+	entry := auditEntry(store.AuditMemberLeft, store.AuditTargetUser, authenticatedUser.ID)
+	entry.ChatID = &chatID
+	entry.Before = auditValue(utils.Envelope{"role":res.Role})
+	audit(r, cmh.auditStore, entry)
+
+	if res.ChatDeleted {
+		entry := auditEntry(store.AuditChatDeleted, store.AuditTargetChat, chatID)
+		entry.ChatID = &chatID
+		entry.After = auditValue(utils.Envelope{"reason":"last member left"})
+		audit(r, cmh.auditStore, entry)
+
+		utils.WriteJSON(w, http.StatusOK, utils.Envelope{"status":"success", "chat_deleted":true})
+		return
+	}
+
+	cmh.webhooks.Publish(r.Context(), chatID, webhooks.EventMemberRemoved, utils.Envelope{"user_id":authenticatedUser.ID})
+	if res.NewOwnerID != nil {
+		cmh.webhooks.Publish(r.Context(), chatID, webhooks.EventMemberUpdated, utils.Envelope{"user_id":*res.NewOwnerID, "role":store.OWNER})
+
+		// recorded as the leaving member's doing, it is what caused it
+		entry := auditEntry(store.AuditMemberRoleChanged, store.AuditTargetUser, *res.NewOwnerID)
+		entry.ChatID = &chatID
+		entry.Before = auditValue(utils.Envelope{"role":res.NewOwnerPreviousRole})
+		entry.After = auditValue(utils.Envelope{"role":store.OWNER, "reason":"no owner left"})
+		audit(r, cmh.auditStore, entry)
+	}
+	for _, msg := range res.Messages {
+		publishSystemMessage(r, cmh.webhooks, msg)
+	}
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"status":"success", "chat_deleted":false, "new_owner_id":res.NewOwnerID})
+}
+
 func (cmh *ChatMemberHandler) HandleGetChatMembers(w http.ResponseWriter, r *http.Request){
 	chatID, err := utils.ReadParam(r, "chatID")
 	if err != nil {
-		cmh.logger.Printf("ERROR: decodingGetChatMembers: %v\n",err)
-		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error":"invalid request sent"})
+		logging.FromContext(r.Context()).Error("decodingGetChatMembers", "error", err)
+		apierror.Write(w, r, apierror.BadRequest("invalid request sent"))
 		return
 	}
 
 	chatMembers, err := cmh.chatMemberStore.GetChatMembers(r.Context(), chatID)
 	if err != nil {
-		cmh.logger.Printf("ERROR: getChatMembers: %v\n",err)
-		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error":"failed to retrieve chat members"})
+		logging.FromContext(r.Context()).Error("getChatMembers", "error", err)
+		apierror.Write(w, r, apierror.Internal("failed to retrieve chat members"))
 		return
 	}
 
@@ -97,20 +278,20 @@ func (cmh *ChatMemberHandler) HandleGetUserRole(w http.ResponseWriter, r *http.R
 	userID, err2 := utils.ReadParam(r, "userID")
 
 	if err != nil || err2 != nil {
-		cmh.logger.Printf("ERROR: decodingGetUserRole: %v %v\n",err, err2)
-		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error":"invalid request sent"})
+		logging.FromContext(r.Context()).Error("decodingGetUserRole", "error", errors.Join(err, err2))
+		apierror.Write(w, r, apierror.BadRequest("invalid request sent"))
 		return
 	}
 
 	role, err := cmh.chatMemberStore.GetUserRole(r.Context(), chatID, userID)
 	if err != nil {
-		if err == sql.ErrNoRows {
-			utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "user is not a member of this chat"})
+		if errors.Is(err, store.ErrNotFound) {
+			apierror.Write(w, r, apierror.NotFound("user is not a member of this chat"))
 			return
 		}
 		
-		cmh.logger.Printf("ERROR: getUserRole: %v\n",err)
-		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error":"failed to retrieve user role"})
+		logging.FromContext(r.Context()).Error("getUserRole", "error", err)
+		apierror.Write(w, r, apierror.Internal("failed to retrieve user role"))
 		return
 	}
 
@@ -122,15 +303,15 @@ func (cmh *ChatMemberHandler) HandleIsMember(w http.ResponseWriter, r *http.Requ
 	userID, err2 := utils.ReadParam(r, "userID")
 
 	if err != nil || err2 != nil {
-		cmh.logger.Printf("ERROR: decodingIsMember: %v %v\n",err, err2)
-		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error":"invalid request sent"})
+		logging.FromContext(r.Context()).Error("decodingIsMember", "error", errors.Join(err, err2))
+		apierror.Write(w, r, apierror.BadRequest("invalid request sent"))
 		return
 	}
 
 	isMember, err := cmh.chatMemberStore.IsMember(r.Context(), chatID, userID)
 	if err != nil {
-		cmh.logger.Printf("ERROR: isMember: %v\n",err)
-		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error":"failed to retrieve is_member"})
+		logging.FromContext(r.Context()).Error("isMember", "error", err)
+		apierror.Write(w, r, apierror.Internal("failed to retrieve is_member"))
 		return
 	}
 
@@ -140,40 +321,40 @@ func (cmh *ChatMemberHandler) HandleIsMember(w http.ResponseWriter, r *http.Requ
 func (cmh *ChatMemberHandler) HandleUpdateLastRead(w http.ResponseWriter, r *http.Request) {
 	user, ok := middleware.GetUser(r)
 	if !ok {
-		utils.WriteJSON(w, http.StatusUnauthorized, utils.Envelope{"error": "authentication required"})
+		apierror.Write(w, r, apierror.Unauthorized("authentication required"))
 		return
 	}
 
 	chatID, err := utils.ReadParam(r, "chatID")
 	if err != nil {
-		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid chat ID"})
+		apierror.Write(w, r, apierror.BadRequest("invalid chat ID"))
 		return
 	}
 
 	var req struct {
 		MessageID int64 `json:"message_id"`
 	}
-	err = json.NewDecoder(r.Body).Decode(&req)
+	err = validate.DecodeJSON(r, &req)
 	if err != nil {
-		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid request"})
+		apierror.Write(w, r, err)
 		return
 	}
 
 	msg, err := cmh.messageStore.GetMessage(r.Context(), req.MessageID)
 	if err != nil {
-		utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "message not found"})
+		apierror.Write(w, r, apierror.FromStore(err, "message"))
 		return
 	}
 
 	if msg.ChatID != chatID {
-		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "message does not belong to this chat"})
+		apierror.Write(w, r, apierror.BadRequest("message does not belong to this chat"))
 		return
 	}
 
 	err = cmh.chatMemberStore.UpdateLastRead(r.Context(), chatID, user.ID, req.MessageID)
 	if err != nil {
-		cmh.logger.Printf("ERROR: updating last read: %v", err)
-		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "failed to update"})
+		logging.FromContext(r.Context()).Error("updating last read", "error", err)
+		apierror.Write(w, r, apierror.Internal("failed to update"))
 		return
 	}
 
@@ -186,19 +367,19 @@ func (cmh *ChatMemberHandler) HandleUpdateLastRead(w http.ResponseWriter, r *htt
 func (cmh *ChatMemberHandler) HandleMuteChat(w http.ResponseWriter, r *http.Request) {
 	user, ok := middleware.GetUser(r)
 	if !ok {
-		utils.WriteJSON(w, http.StatusUnauthorized, utils.Envelope{"error": "authentication required"})
+		apierror.Write(w, r, apierror.Unauthorized("authentication required"))
 		return
 	}
 
 	chatID, err := utils.ReadParam(r, "chatID")
 	if err != nil {
-		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error":"no chatID field"})
+		apierror.Write(w, r, apierror.BadRequest("no chatID field"))
 		return
 	}
 
 	err = cmh.chatMemberStore.MuteChat(r.Context(), user.ID, chatID)
 	if err != nil {
-		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error":"internal server error"})
+		apierror.Write(w, r, apierror.Internal("internal server error"))
 		return
 	}
 
@@ -208,21 +389,185 @@ func (cmh *ChatMemberHandler) HandleMuteChat(w http.ResponseWriter, r *http.Requ
 func (cmh *ChatMemberHandler) HandleUnMuteChat(w http.ResponseWriter, r *http.Request) {
 	user, ok := middleware.GetUser(r)
 	if !ok {
-		utils.WriteJSON(w, http.StatusUnauthorized, utils.Envelope{"error": "authentication required"})
+		apierror.Write(w, r, apierror.Unauthorized("authentication required"))
 		return
 	}
 
 	chatID, err := utils.ReadParam(r, "chatID")
 	if err != nil {
-		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error":"no chatID field"})
+		apierror.Write(w, r, apierror.BadRequest("no chatID field"))
 		return
 	}
 
-	err = cmh.chatMemberStore.MuteChat(r.Context(), user.ID, chatID)
+	err = cmh.chatMemberStore.UnMuteChat(r.Context(), user.ID, chatID)
 	if err != nil {
-		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error":"internal server error"})
+		apierror.Write(w, r, apierror.Internal("internal server error"))
 		return
 	}
 
 	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"msg":"unmuted chat successfully"})
 }
+
+
+// maxPostingMute is the longest an admin can mute a member from posting.
+const maxPostingMute = 365 * 24 * time.Hour
+
+// HandleMutePosting keeps a member from posting in the chat for a while.
+// Owners and admins can't be muted.
+func (cmh *ChatMemberHandler) HandleMutePosting(w http.ResponseWriter, r *http.Request) {
+	chatID, err := utils.ReadParam(r, "chatID")
+	userID, err2 := utils.ReadParam(r, "userID")
+	if err != nil || err2 != nil {
+		apierror.Write(w, r, apierror.BadRequest("invalid request sent"))
+		return
+	}
+
+	var req struct {
+		DurationSeconds int64 `json:"duration_seconds"`
+	}
+	err = validate.DecodeJSON(r, &req)
+	if err != nil {
+		apierror.Write(w, r, err)
+		return
+	}
+
+	duration := time.Duration(req.DurationSeconds) * time.Second
+	var v validate.Validator
+	v.Check(req.DurationSeconds > 0 && duration <= maxPostingMute, "duration_seconds", fmt.Sprintf("must be between 1 and %d", int64(maxPostingMute.Seconds())))
+	if err := v.Err(); err != nil {
+		apierror.Write(w, r, err)
+		return
+	}
+
+	role, err := cmh.chatMemberStore.GetUserRole(r.Context(), chatID, userID)
+	if errors.Is(err, store.ErrNotFound) {
+		apierror.Write(w, r, apierror.NotFound("user is not a member of this chat"))
+		return
+	}
+	if err != nil {
+		logging.FromContext(r.Context()).Error("getUserRole", "error", err)
+		apierror.Write(w, r, apierror.Internal("internal server error"))
+		return
+	}
+	if role != string(store.MEMBER) {
+		apierror.Write(w, r, apierror.Forbidden("chat admins can't be muted"))
+		return
+	}
+
+	until := time.Now().Add(duration).UTC()
+	err = cmh.chatMemberStore.SetPostingMute(r.Context(), chatID, userID, &until)
+	if err != nil {
+		apierror.Write(w, r, apierror.FromStore(err, "chat member"))
+		return
+	}
+
+	entry := auditEntry(store.AuditMemberPostingMuted, store.AuditTargetUser, userID)
+	entry.ChatID = &chatID
+	entry.After = auditValue(utils.Envelope{"posting_muted_until":until})
+	audit(r, cmh.auditStore, entry)
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"user_id":userID, "posting_muted_until":until})
+}
+
+// HandleUnmutePosting lifts a member's posting mute.
+func (cmh *ChatMemberHandler) HandleUnmutePosting(w http.ResponseWriter, r *http.Request) {
+	chatID, err := utils.ReadParam(r, "chatID")
+	userID, err2 := utils.ReadParam(r, "userID")
+	if err != nil || err2 != nil {
+		apierror.Write(w, r, apierror.BadRequest("invalid request sent"))
+		return
+	}
+
+	err = cmh.chatMemberStore.SetPostingMute(r.Context(), chatID, userID, nil)
+	if err != nil {
+		apierror.Write(w, r, apierror.FromStore(err, "chat member"))
+		return
+	}
+
+	entry := auditEntry(store.AuditMemberPostingUnmuted, store.AuditTargetUser, userID)
+	entry.ChatID = &chatID
+	audit(r, cmh.auditStore, entry)
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// HandleUpdateMemberRole promotes a member to admin or demotes an admin.
+// Only chat admins get here, and only the owner can demote an admin. The
+// owner's own role can't be changed.
+func (cmh *ChatMemberHandler) HandleUpdateMemberRole(w http.ResponseWriter, r *http.Request) {
+	chatID, err := utils.ReadParam(r, "chatID")
+	userID, err2 := utils.ReadParam(r, "userID")
+	if err != nil || err2 != nil {
+		apierror.Write(w, r, apierror.BadRequest("invalid request sent"))
+		return
+	}
+
+	var req struct {
+		Role store.ChatGroupRole `json:"role"`
+	}
+	err = validate.DecodeJSON(r, &req)
+	if err != nil {
+		apierror.Write(w, r, err)
+		return
+	}
+
+	var v validate.Validator
+	v.Check(req.Role == store.MEMBER || req.Role == store.ADMIN, "role", "role must be member or admin")
+	if err := v.Err(); err != nil {
+		apierror.Write(w, r, err)
+		return
+	}
+
+	user, ok := middleware.GetUser(r)
+	if !ok {
+		apierror.Write(w, r, apierror.Unauthorized("signin to continue"))
+		return
+	}
+	callerRole, err := cmh.chatMemberStore.GetUserRole(r.Context(), chatID, user.ID)
+	if err != nil {
+		logging.FromContext(r.Context()).Error("getUserRole", "error", err)
+		apierror.Write(w, r, apierror.Internal("internal server error"))
+		return
+	}
+
+	previous, err := cmh.chatMemberStore.GetUserRole(r.Context(), chatID, userID)
+	if errors.Is(err, store.ErrNotFound) {
+		apierror.Write(w, r, apierror.NotFound("user is not a member of this chat"))
+		return
+	}
+	if err != nil {
+		logging.FromContext(r.Context()).Error("getUserRole", "error", err)
+		apierror.Write(w, r, apierror.Internal("internal server error"))
+		return
+	}
+
+	switch {
+	case previous == string(store.OWNER):
+		apierror.Write(w, r, apierror.Forbidden("the owner's role can't be changed"))
+		return
+	case previous == string(store.ADMIN) && req.Role == store.MEMBER && callerRole != string(store.OWNER):
+		apierror.Write(w, r, apierror.Forbidden("only the owner can demote admins"))
+		return
+	case previous == string(req.Role):
+		utils.WriteJSON(w, http.StatusOK, utils.Envelope{"user_id":userID, "role":req.Role})
+		return
+	}
+
+	event := systemEvent(store.SystemMemberRoleChanged, user.ID, userID)
+	event.Role = &req.Role
+	sysMsg, err := cmh.chatMemberStore.UpdateMemberRole(r.Context(), chatID, userID, req.Role, event)
+	if err != nil {
+		apierror.Write(w, r, apierror.FromStore(err, "chat member"))
+		return
+	}
+	cmh.webhooks.Publish(r.Context(), chatID, webhooks.EventMemberUpdated, utils.Envelope{"user_id":userID, "role":req.Role})
+	publishSystemMessage(r, cmh.webhooks, sysMsg)
+
+	entry := auditEntry(store.AuditMemberRoleChanged, store.AuditTargetUser, userID)
+	entry.ChatID = &chatID
+	entry.Before = auditValue(utils.Envelope{"role":previous})
+	entry.After = auditValue(utils.Envelope{"role":req.Role})
+	audit(r, cmh.auditStore, entry)
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"user_id":userID, "role":req.Role})
+}
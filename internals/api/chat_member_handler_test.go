@@ -0,0 +1,196 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/Abhishek-B-R/chat-app-golang/internals/middleware"
+	"github.com/Abhishek-B-R/chat-app-golang/internals/store"
+	"github.com/Abhishek-B-R/chat-app-golang/internals/webhooks"
+	"github.com/go-chi/chi"
+)
+
+// memRoles is a chat's members by role.
+type memRoles struct {
+	store.ChatMemberStore
+	roles map[int64]store.ChatGroupRole
+}
+
+func (m memRoles) GetUserRole(ctx context.Context, chatID, userID int64) (string, error) {
+	role, ok := m.roles[userID]
+	if !ok {
+		return "", store.ErrNotFound
+	}
+	return string(role), nil
+}
+
+func (m memRoles) AddMember(ctx context.Context, chatID, userID int64, role string, event *store.SystemEvent) (*store.Message, error) {
+	if _, ok := m.roles[userID]; ok {
+		return nil, store.ErrConflict
+	}
+	m.roles[userID] = store.ChatGroupRole(role)
+	return nil, nil
+}
+
+func (m memRoles) RemoveMember(ctx context.Context, chatID, userID int64, event *store.SystemEvent) (*store.Message, error) {
+	if _, ok := m.roles[userID]; !ok {
+		return nil, store.ErrNotFound
+	}
+	delete(m.roles, userID)
+	return nil, nil
+}
+
+type noBlocks struct {
+	store.BlockStore
+}
+
+func (noBlocks) HasBlocked(ctx context.Context, blockerID, blockedID int64) (bool, error) {
+	return false, nil
+}
+
+func addMember(t *testing.T, members memRoles, callerID int64, body string) *httptest.ResponseRecorder {
+	t.Helper()
+	h := NewChatMemberHandler(members, nil, noBlocks{}, memAudit{}, webhooks.NewPublisher(nopQueue{}))
+
+	r := chi.NewRouter()
+	r.Post("/chats/{chatID}/members", h.HandleAddMember)
+	req := httptest.NewRequest("POST", "/chats/7/members", strings.NewReader(body))
+	req = middleware.SetUser(req, &store.User{ID: callerID, Username: "caller"})
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestOnlyAdminsAddAdmins(t *testing.T) {
+	members := memRoles{roles: map[int64]store.ChatGroupRole{1: store.OWNER, 2: store.ADMIN, 3: store.MEMBER}}
+
+	rec := addMember(t, members, 3, `{"user_id":10,"role":"admin"}`)
+	if rec.Code != http.StatusForbidden {
+		t.Errorf("member adding an admin: status %d: %s", rec.Code, rec.Body)
+	}
+	if _, ok := members.roles[10]; ok {
+		t.Error("member added an admin")
+	}
+
+	rec = addMember(t, members, 3, `{"user_id":11}`)
+	if rec.Code != http.StatusCreated || members.roles[11] != store.MEMBER {
+		t.Errorf("member adding a member: status %d: %s", rec.Code, rec.Body)
+	}
+
+	for callerID, userID := range map[int64]int64{1: 12, 2: 13} {
+		rec = addMember(t, members, callerID, fmt.Sprintf(`{"user_id":%d,"role":"admin"}`, userID))
+		if rec.Code != http.StatusCreated || members.roles[userID] != store.ADMIN {
+			t.Errorf("%s adding an admin: status %d: %s", members.roles[callerID], rec.Code, rec.Body)
+		}
+	}
+}
+
+func TestAddMemberAcceptsTheOldKey(t *testing.T) {
+	members := memRoles{roles: map[int64]store.ChatGroupRole{1: store.OWNER}}
+
+	for userID, body := range map[int64]string{10: `{"UserID":10}`, 11: `{"userid":11,"Role":"admin"}`} {
+		rec := addMember(t, members, 1, body)
+		if rec.Code != http.StatusCreated {
+			t.Errorf("%s: status %d: %s", body, rec.Code, rec.Body)
+		}
+		if _, ok := members.roles[userID]; !ok {
+			t.Errorf("%s: user was not added", body)
+		}
+	}
+
+	rec := addMember(t, members, 1, `{"role":"admin"}`)
+	if rec.Code != http.StatusUnprocessableEntity || !strings.Contains(rec.Body.String(), "user_id") {
+		t.Errorf("without a user: status %d: %s", rec.Code, rec.Body)
+	}
+}
+
+func removeMember(t *testing.T, members memRoles, callerID, userID int64) *httptest.ResponseRecorder {
+	t.Helper()
+	h := NewChatMemberHandler(members, nil, noBlocks{}, memAudit{}, webhooks.NewPublisher(nopQueue{}))
+
+	r := chi.NewRouter()
+	r.Delete("/chats/{chatID}/members/{userID}", h.HandleRemoveMember)
+	req := httptest.NewRequest("DELETE", fmt.Sprintf("/chats/7/members/%d", userID), nil)
+	req = middleware.SetUser(req, &store.User{ID: callerID, Username: "caller"})
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestOnlyAdminsRemoveMembers(t *testing.T) {
+	members := memRoles{roles: map[int64]store.ChatGroupRole{1: store.OWNER, 2: store.ADMIN, 3: store.MEMBER, 4: store.MEMBER, 5: store.MEMBER, 6: store.ADMIN}}
+
+	rec := removeMember(t, members, 3, 4)
+	if rec.Code != http.StatusForbidden || !strings.Contains(rec.Body.String(), "admins_only") {
+		t.Errorf("member removing a member: status %d: %s", rec.Code, rec.Body)
+	}
+	if _, ok := members.roles[4]; !ok {
+		t.Error("member removed another member")
+	}
+
+	rec = removeMember(t, members, 2, 4)
+	if _, ok := members.roles[4]; rec.Code != http.StatusOK || ok {
+		t.Errorf("admin removing a member: status %d: %s", rec.Code, rec.Body)
+	}
+
+	rec = removeMember(t, members, 2, 6)
+	if rec.Code != http.StatusForbidden {
+		t.Errorf("admin removing an admin: status %d: %s", rec.Code, rec.Body)
+	}
+	rec = removeMember(t, members, 2, 1)
+	if rec.Code != http.StatusForbidden {
+		t.Errorf("admin removing the owner: status %d: %s", rec.Code, rec.Body)
+	}
+
+	rec = removeMember(t, members, 1, 6)
+	if _, ok := members.roles[6]; rec.Code != http.StatusOK || ok {
+		t.Errorf("owner removing an admin: status %d: %s", rec.Code, rec.Body)
+	}
+
+	// someone who isn't in the chat at all
+	rec = removeMember(t, members, 99, 5)
+	if rec.Code != http.StatusForbidden {
+		t.Errorf("outsider removing a member: status %d: %s", rec.Code, rec.Body)
+	}
+}
+
+// mutedChats is whether each user has muted the chat.
+type mutedChats struct {
+	store.ChatMemberStore
+	muted map[int64]bool
+}
+
+func (m mutedChats) MuteChat(ctx context.Context, userID, chatID int64) error {
+	m.muted[userID] = true
+	return nil
+}
+
+func (m mutedChats) UnMuteChat(ctx context.Context, userID, chatID int64) error {
+	m.muted[userID] = false
+	return nil
+}
+
+func TestUnmuteChat(t *testing.T) {
+	members := mutedChats{muted: map[int64]bool{}}
+	h := NewChatMemberHandler(members, nil, noBlocks{}, memAudit{}, webhooks.NewPublisher(nopQueue{}))
+
+	r := chi.NewRouter()
+	r.Post("/chats/{chatID}/mute", h.HandleMuteChat)
+	r.Post("/chats/{chatID}/unmute", h.HandleUnMuteChat)
+	for _, path := range []string{"/chats/7/mute", "/chats/7/unmute"} {
+		req := httptest.NewRequest("POST", path, nil)
+		req = middleware.SetUser(req, &store.User{ID: 3, Username: "caller"})
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, req)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("%s: status %d: %s", path, rec.Code, rec.Body)
+		}
+		if want := strings.HasSuffix(path, "/mute"); members.muted[3] != want {
+			t.Errorf("after %s muted is %v, want %v", path, members.muted[3], want)
+		}
+	}
+}
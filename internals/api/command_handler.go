@@ -0,0 +1,176 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/Abhishek-B-R/chat-app-golang/internals/apierror"
+	"github.com/Abhishek-B-R/chat-app-golang/internals/commands"
+	"github.com/Abhishek-B-R/chat-app-golang/internals/logging"
+	"github.com/Abhishek-B-R/chat-app-golang/internals/middleware"
+	"github.com/Abhishek-B-R/chat-app-golang/internals/store"
+	"github.com/Abhishek-B-R/chat-app-golang/internals/utils"
+	"github.com/Abhishek-B-R/chat-app-golang/internals/validate"
+	"github.com/Abhishek-B-R/chat-app-golang/internals/webhooks"
+)
+
+type createCommandRequest struct {
+	Name string `json:"name"`
+	URL string `json:"url"`
+	Description string `json:"description"`
+	Usage string `json:"usage"`
+}
+
+type CommandHandler struct {
+	commandStore store.CommandStore
+	registry *commands.Registry
+}
+
+func NewCommandHandler(commandStore store.CommandStore, registry *commands.Registry) *CommandHandler {
+	return &CommandHandler{
+		commandStore: commandStore,
+		registry: registry,
+	}
+}
+
+func (ch *CommandHandler) HandleGetCommands(w http.ResponseWriter, r *http.Request) {
+	chatID, err := utils.ReadParam(r, "chatID")
+	if err != nil {
+		apierror.Write(w, r, apierror.BadRequest("invalid chat id"))
+		return
+	}
+
+	cmds, err := ch.registry.List(r.Context(), chatID)
+	if err != nil {
+		logging.FromContext(r.Context()).Error("listing commands", "error", err)
+		apierror.Write(w, r, apierror.Internal("failed to get commands"))
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"commands":cmds})
+}
+
+// HandleGetChatCommands lists the bot commands registered in the chat,
+// including their endpoints, for the chat's admins.
+func (ch *CommandHandler) HandleGetChatCommands(w http.ResponseWriter, r *http.Request) {
+	chatID, err := utils.ReadParam(r, "chatID")
+	if err != nil {
+		apierror.Write(w, r, apierror.BadRequest("invalid chat id"))
+		return
+	}
+
+	cmds, err := ch.commandStore.GetChatCommands(r.Context(), chatID)
+	if err != nil {
+		logging.FromContext(r.Context()).Error("getChatCommands", "error", err)
+		apierror.Write(w, r, apierror.Internal("failed to get commands"))
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"commands":cmds})
+}
+
+func (ch *CommandHandler) HandleCreateCommand(w http.ResponseWriter, r *http.Request) {
+	authenticatedUser, ok := middleware.GetUser(r)
+	if !ok {
+		apierror.Write(w, r, apierror.Unauthorized("authentication required"))
+		return
+	}
+
+	chatID, err := utils.ReadParam(r, "chatID")
+	if err != nil {
+		apierror.Write(w, r, apierror.BadRequest("invalid chat id"))
+		return
+	}
+
+	var req createCommandRequest
+	err = validate.DecodeJSON(r, &req)
+	if err != nil {
+		apierror.Write(w, r, err)
+		return
+	}
+
+	req.Name = strings.TrimPrefix(strings.ToLower(strings.TrimSpace(req.Name)), "/")
+	if !commands.ValidName(req.Name) {
+		apierror.Write(w, r, apierror.BadRequest("command names are 1-32 characters of a-z, 0-9, _ and -"))
+		return
+	}
+	if ch.registry.IsBuiltin(req.Name) {
+		apierror.Write(w, r, apierror.Conflict("/" + req.Name + " is a built-in command"))
+		return
+	}
+
+	target, err := webhooks.CheckURL(r.Context(), req.URL)
+	if err != nil {
+		apierror.Write(w, r, apierror.BadRequest(err.Error()))
+		return
+	}
+
+	secret, err := webhooks.GenerateSecret()
+	if err != nil {
+		logging.FromContext(r.Context()).Error("generating command secret", "error", err)
+		apierror.Write(w, r, apierror.Internal("internal server error"))
+		return
+	}
+
+	cmd := &store.ChatCommand{
+		ChatID: chatID,
+		Name: req.Name,
+		URL: target.String(),
+		Secret: secret,
+		CreatedBy: &authenticatedUser.ID,
+	}
+	if req.Description != "" {
+		cmd.Description = &req.Description
+	}
+	if req.Usage != "" {
+		cmd.Usage = &req.Usage
+	}
+
+	existing, err := ch.commandStore.GetChatCommandByName(r.Context(), chatID, cmd.Name)
+	if err != nil {
+		logging.FromContext(r.Context()).Error("getChatCommandByName", "error", err)
+		apierror.Write(w, r, apierror.Internal("internal server error"))
+		return
+	}
+	if existing != nil {
+		apierror.Write(w, r, apierror.Conflict("/" + cmd.Name + " is already registered in this chat"))
+		return
+	}
+
+	err = ch.commandStore.CreateChatCommand(r.Context(), cmd)
+	if errors.Is(err, store.ErrConflict) {
+		apierror.Write(w, r, apierror.Conflict("/" + cmd.Name + " is already registered in this chat"))
+		return
+	}
+	if err != nil {
+		logging.FromContext(r.Context()).Error("createChatCommand", "error", err)
+		apierror.Write(w, r, apierror.Internal("failed to register command"))
+		return
+	}
+
+	// the secret is only returned once, the bot needs it to verify signatures
+	utils.WriteJSON(w, http.StatusCreated, utils.Envelope{"command":cmd, "secret":cmd.Secret})
+}
+
+func (ch *CommandHandler) HandleDeleteCommand(w http.ResponseWriter, r *http.Request) {
+	chatID, err := utils.ReadParam(r, "chatID")
+	commandID, err2 := utils.ReadParam(r, "commandID")
+	if err != nil || err2 != nil {
+		apierror.Write(w, r, apierror.BadRequest("invalid request sent"))
+		return
+	}
+
+	err = ch.commandStore.DeleteChatCommand(r.Context(), chatID, commandID)
+	if errors.Is(err, store.ErrNotFound) {
+		apierror.Write(w, r, apierror.NotFound("command not found"))
+		return
+	}
+	if err != nil {
+		logging.FromContext(r.Context()).Error("deleteChatCommand", "error", err)
+		apierror.Write(w, r, apierror.Internal("failed to delete command"))
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
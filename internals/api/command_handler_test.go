@@ -0,0 +1,44 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/Abhishek-B-R/chat-app-golang/internals/commands"
+	"github.com/Abhishek-B-R/chat-app-golang/internals/config"
+	"github.com/Abhishek-B-R/chat-app-golang/internals/middleware"
+	"github.com/Abhishek-B-R/chat-app-golang/internals/store"
+	"github.com/go-chi/chi"
+)
+
+func TestCommandResponseIsValidated(t *testing.T) {
+	messages := &memMessages{}
+	limits := config.Default().Limits
+	// /shrug answers with the arguments plus the shrug, so a message at the
+	// limit becomes too long
+	rec := postCommand(t, memFilters{}, messages, "/shrug "+strings.Repeat("a", limits.MaxMessageLength-len("/shrug ")))
+	if rec.Code != http.StatusBadGateway {
+		t.Errorf("too long response: status %d, want %d: %s", rec.Code, http.StatusBadGateway, rec.Body)
+	}
+	if len(messages.created) != 0 {
+		t.Error("too long command response was stored")
+	}
+}
+
+func TestBotEndpointsMustBePublic(t *testing.T) {
+	h := NewCommandHandler(nil, commands.NewRegistry(nil, config.Default().Commands))
+	r := chi.NewRouter()
+	r.Post("/chats/{chatID}/commands", h.HandleCreateCommand)
+
+	for _, url := range []string{"http://127.0.0.1:8080/bot", "http://169.254.169.254/latest/meta-data", "http://10.0.0.5/bot", "http://[::1]/bot", "ftp://example.com/bot"} {
+		req := httptest.NewRequest("POST", "/chats/7/commands", strings.NewReader(`{"name":"deploy","url":"`+url+`"}`))
+		req = middleware.SetUser(req, &store.User{ID: 1, Username: "owner"})
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, req)
+		if rec.Code != http.StatusBadRequest || !strings.Contains(rec.Body.String(), "url must") {
+			t.Errorf("%s: status %d: %s", url, rec.Code, rec.Body)
+		}
+	}
+}
@@ -0,0 +1,63 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/Abhishek-B-R/chat-app-golang/internals/apierror"
+	"github.com/Abhishek-B-R/chat-app-golang/internals/filter"
+	"github.com/Abhishek-B-R/chat-app-golang/internals/logging"
+	"github.com/Abhishek-B-R/chat-app-golang/internals/metrics"
+	"github.com/Abhishek-B-R/chat-app-golang/internals/store"
+)
+
+// filterContent runs the content filters of the chat, the global ones
+// first, over content and applies their replacements in place. Every path
+// that stores message content goes through it: users, edits, command
+// responses and incoming webhooks. It writes the error response itself when
+// it returns false.
+func filterContent(w http.ResponseWriter, r *http.Request, filterStore store.ContentFilterStore, recorder metrics.Recorder, chatID int64, content *string) bool {
+	if content == nil || *content == "" {
+		return true
+	}
+
+	filters, err := filterStore.GetFiltersForChat(r.Context(), chatID)
+	if err != nil {
+		logging.FromContext(r.Context()).Error("getFiltersForChat", "error", err)
+		apierror.Write(w, r, apierror.Internal("internal server error"))
+		return false
+	}
+	if len(filters) == 0 {
+		return true
+	}
+
+	pipeline, err := filter.New(filters)
+	if err != nil {
+		logging.FromContext(r.Context()).Error("building content filters", "chat_id", chatID, "error", err)
+		apierror.Write(w, r, apierror.Internal("internal server error"))
+		return false
+	}
+
+	res := pipeline.Run(*content)
+	for _, hit := range res.Hits {
+		recorder.ContentFiltered(string(hit.Kind), string(hit.Action))
+		logging.FromContext(r.Context()).Info("content filter fired", "chat_id", chatID, "filter_id", hit.ID, "action", hit.Action)
+	}
+
+	if rule := res.Rejected; rule != nil {
+		scope := "chat"
+		if rule.Global() {
+			scope = "global"
+		}
+		apierror.Write(w, r, apierror.New(http.StatusUnprocessableEntity, apierror.CodeContentRejected, fmt.Sprintf("the message was rejected by the content filter %q", rule.Name)).WithRule(apierror.Rule{
+			ID: rule.ID,
+			Name: rule.Name,
+			Kind: string(rule.Kind),
+			Scope: scope,
+		}))
+		return false
+	}
+
+	*content = res.Content
+	return true
+}
@@ -0,0 +1,150 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Abhishek-B-R/chat-app-golang/internals/commands"
+	"github.com/Abhishek-B-R/chat-app-golang/internals/config"
+	"github.com/Abhishek-B-R/chat-app-golang/internals/metrics"
+	"github.com/Abhishek-B-R/chat-app-golang/internals/middleware"
+	"github.com/Abhishek-B-R/chat-app-golang/internals/ratelimit"
+	"github.com/Abhishek-B-R/chat-app-golang/internals/store"
+	"github.com/Abhishek-B-R/chat-app-golang/internals/webhooks"
+	"github.com/go-chi/chi"
+)
+
+// memMessages stores created messages in memory.
+type memMessages struct {
+	store.MessageStore
+
+	mu      sync.Mutex
+	created []*store.Message
+}
+
+func (m *memMessages) CreateMessage(ctx context.Context, msg *store.Message) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	msg.ID = int64(len(m.created) + 1)
+	msg.CreatedAt = time.Now()
+	m.created = append(m.created, msg)
+	return nil
+}
+
+func (m *memMessages) PostMessage(ctx context.Context, msg *store.Message, minInterval time.Duration) error {
+	return m.CreateMessage(ctx, msg)
+}
+
+type memFilters struct {
+	store.ContentFilterStore
+	filters []*store.ContentFilter
+}
+
+func (m memFilters) GetFiltersForChat(ctx context.Context, chatID int64) ([]*store.ContentFilter, error) {
+	return m.filters, nil
+}
+
+func wordFilter(action store.FilterAction, word, replacement string) memFilters {
+	cfg, _ := json.Marshal(map[string]any{"words": []string{word}, "replacement": replacement})
+	return memFilters{filters: []*store.ContentFilter{{ID: 1, Name: "words", Kind: store.FilterWords, Action: action, Config: cfg}}}
+}
+
+type memIncomingHooks struct {
+	store.IncomingWebhookStore
+	hook *store.IncomingWebhook
+}
+
+func (m memIncomingHooks) GetIncomingWebhookByToken(ctx context.Context, plaintext string) (*store.IncomingWebhook, error) {
+	return m.hook, nil
+}
+
+// memPostingState lets every member post as often as they like.
+type memPostingState struct {
+	store.ChatMemberStore
+	role store.ChatGroupRole
+}
+
+func (m memPostingState) GetPostingState(ctx context.Context, chatID, userID int64) (*store.PostingState, error) {
+	return &store.PostingState{Role: m.role, Now: time.Now()}, nil
+}
+
+// nopQueue drops the webhook events handlers publish.
+type nopQueue struct {
+	store.WebhookStore
+}
+
+func (nopQueue) EnqueueEvent(ctx context.Context, chatID int64, eventType string, payload []byte) error {
+	return nil
+}
+
+func postIncomingWebhook(t *testing.T, filters memFilters, messages store.MessageStore, body string) *httptest.ResponseRecorder {
+	t.Helper()
+	hooks := memIncomingHooks{hook: &store.IncomingWebhook{ID: 1, ChatID: 7, Name: "CI"}}
+	h := NewIncomingWebhookHandler(hooks, messages, filters, webhooks.NewPublisher(nopQueue{}), ratelimit.NewMemoryLimiter(), config.Default().Limits, metrics.Nop{})
+
+	r := chi.NewRouter()
+	r.Post("/hooks/{token}", h.HandlePostMessage)
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest("POST", "/hooks/token", strings.NewReader(body)))
+	return rec
+}
+
+func TestIncomingWebhookIsFiltered(t *testing.T) {
+	messages := &memMessages{}
+	rec := postIncomingWebhook(t, wordFilter(store.FilterReject, "broke", ""), messages, `{"content":"the deploy broke prod"}`)
+	if rec.Code != http.StatusUnprocessableEntity || !strings.Contains(rec.Body.String(), "content_rejected") {
+		t.Errorf("rejected content: status %d: %s", rec.Code, rec.Body)
+	}
+	if len(messages.created) != 0 {
+		t.Error("rejected content was stored")
+	}
+
+	rec = postIncomingWebhook(t, wordFilter(store.FilterReplace, "broke", "fixed"), messages, `{"content":"the deploy broke prod"}`)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("replaced content: status %d: %s", rec.Code, rec.Body)
+	}
+	if got := *messages.created[0].Content; got != "the deploy fixed prod" {
+		t.Errorf("stored %q, want the replacement applied", got)
+	}
+}
+
+func postCommand(t *testing.T, filters memFilters, messages *memMessages, content string) *httptest.ResponseRecorder {
+	t.Helper()
+	registry := commands.NewRegistry(nil, config.Default().Commands)
+	h := NewMessageHandler(messages, memPostingState{role: store.MEMBER}, filters, nil, webhooks.NewPublisher(nopQueue{}), registry, config.Default().Limits, metrics.Nop{})
+
+	r := chi.NewRouter()
+	r.Post("/chats/{chatID}/messages", h.HandleCreateMessage)
+	body, _ := json.Marshal(map[string]string{"content": content})
+	req := httptest.NewRequest("POST", "/chats/7/messages", strings.NewReader(string(body)))
+	req = middleware.SetUser(req, &store.User{ID: 3, Username: "alice"})
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestCommandResponseIsFiltered(t *testing.T) {
+	// "rolled" is only in the command's response, not in what the user typed
+	messages := &memMessages{}
+	rec := postCommand(t, wordFilter(store.FilterReject, "rolled", ""), messages, "/roll")
+	if rec.Code != http.StatusUnprocessableEntity || !strings.Contains(rec.Body.String(), "content_rejected") {
+		t.Errorf("rejected response: status %d: %s", rec.Code, rec.Body)
+	}
+	if len(messages.created) != 0 {
+		t.Error("rejected command response was stored")
+	}
+
+	rec = postCommand(t, wordFilter(store.FilterReplace, "rolled", "threw"), messages, "/roll")
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("replaced response: status %d: %s", rec.Code, rec.Body)
+	}
+	if got := *messages.created[0].Content; !strings.HasPrefix(got, "alice threw ") {
+		t.Errorf("stored %q, want the replacement applied", got)
+	}
+}
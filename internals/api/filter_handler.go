@@ -0,0 +1,173 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/Abhishek-B-R/chat-app-golang/internals/apierror"
+	"github.com/Abhishek-B-R/chat-app-golang/internals/filter"
+	"github.com/Abhishek-B-R/chat-app-golang/internals/logging"
+	"github.com/Abhishek-B-R/chat-app-golang/internals/middleware"
+	"github.com/Abhishek-B-R/chat-app-golang/internals/store"
+	"github.com/Abhishek-B-R/chat-app-golang/internals/utils"
+	"github.com/Abhishek-B-R/chat-app-golang/internals/validate"
+)
+
+// maxFilters caps the rules of one chat, and the global rules, since every
+// message runs through all of them.
+const maxFilters = 50
+
+type createFilterRequest struct {
+	Name string `json:"name"`
+	Kind store.FilterKind `json:"kind"`
+	Action store.FilterAction `json:"action"`
+	Config json.RawMessage `json:"config"`
+}
+
+// FilterHandler manages content filter rules: a chat's own, for its
+// admins, and the global ones, for platform administrators.
+type FilterHandler struct {
+	filterStore store.ContentFilterStore
+}
+
+func NewFilterHandler(filterStore store.ContentFilterStore) *FilterHandler {
+	return &FilterHandler{
+		filterStore: filterStore,
+	}
+}
+
+func (fh *FilterHandler) HandleGetChatFilters(w http.ResponseWriter, r *http.Request) {
+	chatID, err := utils.ReadParam(r, "chatID")
+	if err != nil {
+		apierror.Write(w, r, apierror.BadRequest("invalid chat id"))
+		return
+	}
+	fh.getFilters(w, r, &chatID)
+}
+
+func (fh *FilterHandler) HandleCreateChatFilter(w http.ResponseWriter, r *http.Request) {
+	chatID, err := utils.ReadParam(r, "chatID")
+	if err != nil {
+		apierror.Write(w, r, apierror.BadRequest("invalid chat id"))
+		return
+	}
+	fh.createFilter(w, r, &chatID)
+}
+
+func (fh *FilterHandler) HandleDeleteChatFilter(w http.ResponseWriter, r *http.Request) {
+	chatID, err := utils.ReadParam(r, "chatID")
+	if err != nil {
+		apierror.Write(w, r, apierror.BadRequest("invalid chat id"))
+		return
+	}
+	fh.deleteFilter(w, r, &chatID)
+}
+
+func (fh *FilterHandler) HandleGetGlobalFilters(w http.ResponseWriter, r *http.Request) {
+	fh.getFilters(w, r, nil)
+}
+
+func (fh *FilterHandler) HandleCreateGlobalFilter(w http.ResponseWriter, r *http.Request) {
+	fh.createFilter(w, r, nil)
+}
+
+func (fh *FilterHandler) HandleDeleteGlobalFilter(w http.ResponseWriter, r *http.Request) {
+	fh.deleteFilter(w, r, nil)
+}
+
+func (fh *FilterHandler) getFilters(w http.ResponseWriter, r *http.Request, chatID *int64) {
+	filters, err := fh.filterStore.GetFilters(r.Context(), chatID)
+	if err != nil {
+		logging.FromContext(r.Context()).Error("getFilters", "error", err)
+		apierror.Write(w, r, apierror.Internal("failed to get content filters"))
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"filters":filters})
+}
+
+func (fh *FilterHandler) createFilter(w http.ResponseWriter, r *http.Request, chatID *int64) {
+	authenticatedUser, ok := middleware.GetUser(r)
+	if !ok {
+		apierror.Write(w, r, apierror.Unauthorized("authentication required"))
+		return
+	}
+
+	var req createFilterRequest
+	err := validate.DecodeJSON(r, &req)
+	if err != nil {
+		apierror.Write(w, r, err)
+		return
+	}
+
+	f := &store.ContentFilter{
+		ChatID: chatID,
+		Name: strings.TrimSpace(req.Name),
+		Kind: req.Kind,
+		Action: req.Action,
+		Config: req.Config,
+		CreatedBy: &authenticatedUser.ID,
+	}
+	if len(f.Config) == 0 || string(f.Config) == "null" {
+		f.Config = json.RawMessage(`{}`)
+	}
+
+	var v validate.Validator
+	v.Check(f.Name != "", "name", "name is required")
+	v.Check(utf8.RuneCountInString(f.Name) <= 64, "name", "name cannot be longer than 64 characters")
+	v.Check(filter.ValidKind(f.Kind), "kind", "must be one of: " + strings.Join(filter.Kinds(), ", "))
+	v.Check(filter.ValidAction(f.Action), "action", "must be one of: match, replace, reject")
+	if filter.ValidKind(f.Kind) && filter.ValidAction(f.Action) {
+		_, err := filter.Compile(f)
+		v.Check(err == nil, "config", fmt.Sprint(err))
+	}
+	if err := v.Err(); err != nil {
+		apierror.Write(w, r, err)
+		return
+	}
+
+	existing, err := fh.filterStore.GetFilters(r.Context(), chatID)
+	if err != nil {
+		logging.FromContext(r.Context()).Error("getFilters", "error", err)
+		apierror.Write(w, r, apierror.Internal("internal server error"))
+		return
+	}
+	if len(existing) >= maxFilters {
+		apierror.Write(w, r, apierror.Unprocessable(fmt.Sprintf("there can't be more than %d content filters", maxFilters)))
+		return
+	}
+
+	err = fh.filterStore.CreateFilter(r.Context(), f)
+	if err != nil {
+		logging.FromContext(r.Context()).Error("createFilter", "error", err)
+		apierror.Write(w, r, apierror.Internal("failed to create content filter"))
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusCreated, utils.Envelope{"filter":f})
+}
+
+func (fh *FilterHandler) deleteFilter(w http.ResponseWriter, r *http.Request, chatID *int64) {
+	filterID, err := utils.ReadParam(r, "filterID")
+	if err != nil {
+		apierror.Write(w, r, apierror.BadRequest("invalid filter id"))
+		return
+	}
+
+	err = fh.filterStore.DeleteFilter(r.Context(), chatID, filterID)
+	if errors.Is(err, store.ErrNotFound) {
+		apierror.Write(w, r, apierror.NotFound("content filter not found"))
+		return
+	}
+	if err != nil {
+		logging.FromContext(r.Context()).Error("deleteFilter", "error", err)
+		apierror.Write(w, r, apierror.Internal("failed to delete content filter"))
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
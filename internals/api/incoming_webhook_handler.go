@@ -0,0 +1,311 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/Abhishek-B-R/chat-app-golang/internals/apierror"
+	"github.com/Abhishek-B-R/chat-app-golang/internals/config"
+	"github.com/Abhishek-B-R/chat-app-golang/internals/logging"
+	"github.com/Abhishek-B-R/chat-app-golang/internals/metrics"
+	"github.com/Abhishek-B-R/chat-app-golang/internals/middleware"
+	"github.com/Abhishek-B-R/chat-app-golang/internals/ratelimit"
+	"github.com/Abhishek-B-R/chat-app-golang/internals/store"
+	"github.com/Abhishek-B-R/chat-app-golang/internals/tokens"
+	"github.com/Abhishek-B-R/chat-app-golang/internals/utils"
+	"github.com/Abhishek-B-R/chat-app-golang/internals/validate"
+	"github.com/Abhishek-B-R/chat-app-golang/internals/webhooks"
+	"github.com/go-chi/chi"
+)
+
+type createIncomingWebhookRequest struct {
+	Name string `json:"name"`
+	AvatarURL string `json:"avatar_url"`
+}
+
+// incomingWebhookPayload accepts our own shape ({"content", "display_name",
+// "avatar_url", "attachments"}) as well as Slack's ({"text", "username",
+// "icon_url", "attachments"}).
+type incomingWebhookPayload struct {
+	Content string `json:"content"`
+	DisplayName string `json:"display_name"`
+	AvatarURL string `json:"avatar_url"`
+	Attachments []incomingAttachment `json:"attachments"`
+
+	Text string `json:"text"`
+	Username string `json:"username"`
+	IconURL string `json:"icon_url"`
+}
+
+type incomingAttachment struct {
+	Type store.AttachmentType `json:"type"`
+	URL string `json:"url"`
+	Filename *string `json:"filename"`
+	SizeBytes *int64 `json:"size_bytes"`
+
+	// Slack attachment fields
+	Fallback string `json:"fallback"`
+	Pretext string `json:"pretext"`
+	Title string `json:"title"`
+	TitleLink string `json:"title_link"`
+	Text string `json:"text"`
+	ImageURL string `json:"image_url"`
+	Color string `json:"color"`
+}
+
+type IncomingWebhookHandler struct {
+	incomingWebhookStore store.IncomingWebhookStore
+	messageStore store.MessageStore
+	filterStore store.ContentFilterStore
+	webhooks *webhooks.Publisher
+	limiter ratelimit.Limiter
+	limit ratelimit.Rule
+	limits config.LimitsConfig
+	metrics metrics.Recorder
+}
+
+func NewIncomingWebhookHandler(incomingWebhookStore store.IncomingWebhookStore, messageStore store.MessageStore, filterStore store.ContentFilterStore, publisher *webhooks.Publisher, limiter ratelimit.Limiter, limits config.LimitsConfig, recorder metrics.Recorder) *IncomingWebhookHandler {
+	return &IncomingWebhookHandler{
+		incomingWebhookStore: incomingWebhookStore,
+		messageStore: messageStore,
+		filterStore: filterStore,
+		webhooks: publisher,
+		limiter: limiter,
+		limit: ratelimit.Rule{Limit: limits.IncomingWebhookPerMinute, Period: time.Minute},
+		limits: limits,
+		metrics: recorder,
+	}
+}
+
+func (ih *IncomingWebhookHandler) HandleCreateIncomingWebhook(w http.ResponseWriter, r *http.Request) {
+	authenticatedUser, ok := middleware.GetUser(r)
+	if !ok {
+		apierror.Write(w, r, apierror.Unauthorized("authentication required"))
+		return
+	}
+
+	chatID, err := utils.ReadParam(r, "chatID")
+	if err != nil {
+		apierror.Write(w, r, apierror.BadRequest("invalid chat id"))
+		return
+	}
+
+	var req createIncomingWebhookRequest
+	err = validate.DecodeJSON(r, &req)
+	if err != nil {
+		apierror.Write(w, r, err)
+		return
+	}
+
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" {
+		apierror.Write(w, r, apierror.BadRequest("name cannot be empty"))
+		return
+	}
+
+	token, err := tokens.GenerateSecret()
+	if err != nil {
+		logging.FromContext(r.Context()).Error("generating incoming webhook token", "error", err)
+		apierror.Write(w, r, apierror.Internal("internal server error"))
+		return
+	}
+
+	hook := &store.IncomingWebhook{
+		ChatID: chatID,
+		Name: req.Name,
+		CreatedBy: &authenticatedUser.ID,
+	}
+	if req.AvatarURL != "" {
+		hook.AvatarURL = &req.AvatarURL
+	}
+
+	err = ih.incomingWebhookStore.CreateIncomingWebhook(r.Context(), hook, token)
+	if err != nil {
+		logging.FromContext(r.Context()).Error("createIncomingWebhook", "error", err)
+		apierror.Write(w, r, apierror.Internal("failed to create incoming webhook"))
+		return
+	}
+
+	// the token is part of the URL and is only shown once
+	utils.WriteJSON(w, http.StatusCreated, utils.Envelope{"incoming_webhook":hook, "path":"/hooks/" + token.Plaintext})
+}
+
+func (ih *IncomingWebhookHandler) HandleGetIncomingWebhooks(w http.ResponseWriter, r *http.Request) {
+	chatID, err := utils.ReadParam(r, "chatID")
+	if err != nil {
+		apierror.Write(w, r, apierror.BadRequest("invalid chat id"))
+		return
+	}
+
+	hooks, err := ih.incomingWebhookStore.GetChatIncomingWebhooks(r.Context(), chatID)
+	if err != nil {
+		logging.FromContext(r.Context()).Error("getChatIncomingWebhooks", "error", err)
+		apierror.Write(w, r, apierror.Internal("failed to get incoming webhooks"))
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"incoming_webhooks":hooks})
+}
+
+func (ih *IncomingWebhookHandler) HandleDeleteIncomingWebhook(w http.ResponseWriter, r *http.Request) {
+	chatID, err := utils.ReadParam(r, "chatID")
+	hookID, err2 := utils.ReadParam(r, "hookID")
+	if err != nil || err2 != nil {
+		apierror.Write(w, r, apierror.BadRequest("invalid request sent"))
+		return
+	}
+
+	err = ih.incomingWebhookStore.DeleteIncomingWebhook(r.Context(), chatID, hookID)
+	if errors.Is(err, store.ErrNotFound) {
+		apierror.Write(w, r, apierror.NotFound("incoming webhook not found"))
+		return
+	}
+	if err != nil {
+		logging.FromContext(r.Context()).Error("deleteIncomingWebhook", "error", err)
+		apierror.Write(w, r, apierror.Internal("failed to delete incoming webhook"))
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// HandlePostMessage is the unauthenticated endpoint behind an incoming
+// webhook URL; the secret token in the path is the credential. Only chat
+// admins can create incoming webhooks, so like admins they are exempt from
+// the chat's posting restrictions: announcement-only chats are what many
+// integrations post to.
+func (ih *IncomingWebhookHandler) HandlePostMessage(w http.ResponseWriter, r *http.Request) {
+	hook, err := ih.incomingWebhookStore.GetIncomingWebhookByToken(r.Context(), chi.URLParam(r, "token"))
+	if err != nil {
+		logging.FromContext(r.Context()).Error("getIncomingWebhookByToken", "error", err)
+		apierror.Write(w, r, apierror.Internal("internal server error"))
+		return
+	}
+	if hook == nil {
+		apierror.Write(w, r, apierror.NotFound("unknown webhook"))
+		return
+	}
+
+	res, err := ih.limiter.Allow(r.Context(), fmt.Sprintf("incoming_webhook:%d", hook.ID), ih.limit)
+	if err != nil {
+		logging.FromContext(r.Context()).Error("rate limiting incoming webhook", "incoming_webhook_id", hook.ID, "error", err)
+	} else {
+		res.WriteHeaders(w.Header(), ih.limit)
+		if !res.Allowed {
+			apierror.Write(w, r, apierror.TooManyRequests("rate limit exceeded"))
+			return
+		}
+	}
+
+	var payload incomingWebhookPayload
+	err = validate.DecodeJSONAllowUnknown(r, &payload)
+	if err != nil {
+		apierror.Write(w, r, err)
+		return
+	}
+
+	msg := payload.toMessage(hook)
+	var v validate.Validator
+	v.Message(msg.Content, msg.Attachments, ih.limits)
+	if err := v.Err(); err != nil {
+		apierror.Write(w, r, err)
+		return
+	}
+	if !filterContent(w, r, ih.filterStore, ih.metrics, msg.ChatID, msg.Content) {
+		return
+	}
+
+	err = ih.messageStore.CreateMessage(r.Context(), msg)
+	if err != nil {
+		logging.FromContext(r.Context()).Error("createMessage from incoming webhook", "incoming_webhook_id", hook.ID, "error", err)
+		apierror.Write(w, r, apierror.Internal("failed to create message"))
+		return
+	}
+	ih.metrics.MessageCreated(metrics.SourceIncomingWebhook)
+	ih.webhooks.Publish(r.Context(), msg.ChatID, webhooks.EventMessageCreated, msg)
+
+	utils.WriteJSON(w, http.StatusCreated, utils.Envelope{"message":msg})
+}
+
+func (p *incomingWebhookPayload) toMessage(hook *store.IncomingWebhook) *store.Message {
+	lines := []string{}
+	for _, text := range []string{p.Content, p.Text} {
+		if text = strings.TrimSpace(text); text != "" {
+			lines = append(lines, text)
+		}
+	}
+
+	var attachments []store.MessageAttachment
+	for _, a := range p.Attachments {
+		if a.URL != "" && a.Type != "" {
+			attachments = append(attachments, store.MessageAttachment{
+				Type: a.Type,
+				URL: a.URL,
+				Filename: a.Filename,
+				SizeBytes: a.SizeBytes,
+			})
+			continue
+		}
+
+		// Slack attachments are mostly text, keep it readable in the message body
+		lines = append(lines, a.slackLines()...)
+		if a.ImageURL != "" {
+			metadata, _ := json.Marshal(map[string]string{"title": a.Title, "color": a.Color})
+			attachments = append(attachments, store.MessageAttachment{
+				Type: store.AttachmentImage,
+				URL: a.ImageURL,
+				Metadata: metadata,
+			})
+		}
+	}
+
+	msg := &store.Message{
+		ChatID: hook.ChatID,
+		Type: store.MessageTypeText,
+		WebhookID: &hook.ID,
+		DisplayName: &hook.Name,
+		AvatarURL: hook.AvatarURL,
+		Attachments: attachments,
+	}
+
+	content := strings.Join(lines, "\n")
+	msg.Content = &content
+
+	for _, name := range []string{p.DisplayName, p.Username} {
+		if name = strings.TrimSpace(name); name != "" {
+			msg.DisplayName = &name
+			break
+		}
+	}
+	for _, avatar := range []string{p.AvatarURL, p.IconURL} {
+		if avatar != "" {
+			msg.AvatarURL = &avatar
+			break
+		}
+	}
+	return msg
+}
+
+func (a *incomingAttachment) slackLines() []string {
+	var lines []string
+	if a.Pretext != "" {
+		lines = append(lines, a.Pretext)
+	}
+	switch {
+	case a.Title != "" && a.TitleLink != "":
+		lines = append(lines, fmt.Sprintf("%s (%s)", a.Title, a.TitleLink))
+	case a.Title != "":
+		lines = append(lines, a.Title)
+	}
+	if a.Text != "" {
+		lines = append(lines, a.Text)
+	}
+	if len(lines) == 0 && a.Fallback != "" {
+		lines = append(lines, a.Fallback)
+	}
+	return lines
+}
@@ -0,0 +1,98 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Abhishek-B-R/chat-app-golang/internals/commands"
+	"github.com/Abhishek-B-R/chat-app-golang/internals/config"
+	"github.com/Abhishek-B-R/chat-app-golang/internals/metrics"
+	"github.com/Abhishek-B-R/chat-app-golang/internals/middleware"
+	"github.com/Abhishek-B-R/chat-app-golang/internals/store"
+	"github.com/Abhishek-B-R/chat-app-golang/internals/webhooks"
+	"github.com/go-chi/chi"
+)
+
+// restrictedChat is a member's posting state in a chat with restrictions.
+type restrictedChat struct {
+	store.ChatMemberStore
+	state store.PostingState
+}
+
+func (m restrictedChat) GetPostingState(ctx context.Context, chatID, userID int64) (*store.PostingState, error) {
+	state := m.state
+	return &state, nil
+}
+
+// restrictedMessages refuses posts within slow mode's interval of the last
+// one, like the store does.
+type restrictedMessages struct {
+	*memMessages
+	lastPostedAt *time.Time
+}
+
+func (m restrictedMessages) PostMessage(ctx context.Context, msg *store.Message, minInterval time.Duration) error {
+	if m.lastPostedAt != nil && time.Since(*m.lastPostedAt) < minInterval {
+		return store.ErrSlowMode
+	}
+	return m.CreateMessage(ctx, msg)
+}
+
+func postAsMember(t *testing.T, members restrictedChat, messages restrictedMessages, content string) *httptest.ResponseRecorder {
+	t.Helper()
+	registry := commands.NewRegistry(nil, config.Default().Commands)
+	h := NewMessageHandler(messages, members, memFilters{}, nil, webhooks.NewPublisher(nopQueue{}), registry, config.Default().Limits, metrics.Nop{})
+
+	r := chi.NewRouter()
+	r.Post("/chats/{chatID}/messages", h.HandleCreateMessage)
+	body, _ := json.Marshal(map[string]string{"content": content})
+	req := httptest.NewRequest("POST", "/chats/7/messages", strings.NewReader(string(body)))
+	req = middleware.SetUser(req, &store.User{ID: 3, Username: "alice"})
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, req)
+	return rec
+}
+
+// Incoming webhooks are set up by chat admins and keep posting to chats
+// where members can't: announcement channels, slow mode and posting mutes
+// are all about members.
+func TestIncomingWebhookIgnoresPostingRestrictions(t *testing.T) {
+	now := time.Now()
+	justPosted := now.Add(-time.Second)
+	mutedUntil := now.Add(time.Hour)
+
+	tests := []struct {
+		name   string
+		state  store.PostingState
+		status int
+	}{
+		{name: "admins only", state: store.PostingState{Role: store.MEMBER, Settings: store.ChatSettings{AdminsOnly: true}, Now: now}, status: http.StatusForbidden},
+		{name: "slow mode", state: store.PostingState{Role: store.MEMBER, Settings: store.ChatSettings{SlowModeSeconds: 60}, LastPostedAt: &justPosted, Now: now}, status: http.StatusTooManyRequests},
+		{name: "muted", state: store.PostingState{Role: store.MEMBER, PostingMutedUntil: &mutedUntil, Now: now}, status: http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			messages := restrictedMessages{memMessages: &memMessages{}, lastPostedAt: tt.state.LastPostedAt}
+
+			// the restriction is in place for the chat's members
+			rec := postAsMember(t, restrictedChat{state: tt.state}, messages, "me too")
+			if rec.Code != tt.status {
+				t.Fatalf("member post: status %d, want %d: %s", rec.Code, tt.status, rec.Body)
+			}
+
+			rec = postIncomingWebhook(t, memFilters{}, messages, `{"content":"release 1.2 is out"}`)
+			if rec.Code != http.StatusCreated {
+				t.Fatalf("webhook post: status %d: %s", rec.Code, rec.Body)
+			}
+			if len(messages.created) != 1 || messages.created[0].WebhookID == nil {
+				t.Errorf("stored %d messages, want the webhook's message", len(messages.created))
+			}
+		})
+	}
+}
@@ -0,0 +1,219 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/Abhishek-B-R/chat-app-golang/internals/apierror"
+	"github.com/Abhishek-B-R/chat-app-golang/internals/logging"
+	"github.com/Abhishek-B-R/chat-app-golang/internals/middleware"
+	"github.com/Abhishek-B-R/chat-app-golang/internals/store"
+	"github.com/Abhishek-B-R/chat-app-golang/internals/tokens"
+	"github.com/Abhishek-B-R/chat-app-golang/internals/utils"
+	"github.com/Abhishek-B-R/chat-app-golang/internals/validate"
+	"github.com/Abhishek-B-R/chat-app-golang/internals/webhooks"
+	"github.com/go-chi/chi"
+)
+
+type createInviteRequest struct {
+	Role store.ChatGroupRole `json:"role"`
+	MaxUses *int `json:"max_uses"`
+	ExpiresAt *time.Time `json:"expires_at"`
+}
+
+// maxInviteUses caps max_uses, larger groups can use an unlimited invite.
+const maxInviteUses = 10000
+
+// InviteHandler serves invite links to group chats: chat admins manage them,
+// anyone signed in can look at one and join through it.
+type InviteHandler struct {
+	inviteStore store.ChatInviteStore
+	chatStore store.ChatStore
+	auditStore store.AuditStore
+	webhooks *webhooks.Publisher
+}
+
+func NewInviteHandler(inviteStore store.ChatInviteStore, chatStore store.ChatStore, auditStore store.AuditStore, publisher *webhooks.Publisher) *InviteHandler {
+	return &InviteHandler{
+		inviteStore: inviteStore,
+		chatStore: chatStore,
+		auditStore: auditStore,
+		webhooks: publisher,
+	}
+}
+
+func (ih *InviteHandler) HandleCreateInvite(w http.ResponseWriter, r *http.Request) {
+	authenticatedUser, ok := middleware.GetUser(r)
+	if !ok {
+		apierror.Write(w, r, apierror.Unauthorized("authentication required"))
+		return
+	}
+
+	chatID, err := utils.ReadParam(r, "chatID")
+	if err != nil {
+		apierror.Write(w, r, apierror.BadRequest("invalid chat id"))
+		return
+	}
+
+	var req createInviteRequest
+	err = validate.DecodeJSON(r, &req)
+	if err != nil {
+		apierror.Write(w, r, err)
+		return
+	}
+
+	if req.Role == "" {
+		req.Role = store.MEMBER
+	}
+	var v validate.Validator
+	v.Check(req.Role == store.MEMBER || req.Role == store.ADMIN, "role", "role must be member or admin")
+	v.Check(req.MaxUses == nil || (*req.MaxUses > 0 && *req.MaxUses <= maxInviteUses), "max_uses", fmt.Sprintf("max_uses must be between 1 and %d", maxInviteUses))
+	v.Check(req.ExpiresAt == nil || req.ExpiresAt.After(time.Now()), "expires_at", "expires_at must be in the future")
+	if err := v.Err(); err != nil {
+		apierror.Write(w, r, err)
+		return
+	}
+
+	chat, err := ih.chatStore.GetChatByID(r.Context(), chatID)
+	if err == nil && chat == nil {
+		err = store.ErrNotFound
+	}
+	if err != nil {
+		apierror.Write(w, r, apierror.FromStore(err, "chat"))
+		return
+	}
+	if !chat.IsGroup {
+		apierror.Write(w, r, apierror.Unprocessable("only group chats have invite links"))
+		return
+	}
+
+	code, err := tokens.GenerateInviteCode()
+	if err != nil {
+		logging.FromContext(r.Context()).Error("generating invite code", "error", err)
+		apierror.Write(w, r, apierror.Internal("internal server error"))
+		return
+	}
+
+	invite := &store.ChatInvite{
+		ChatID: chatID,
+		Code: code,
+		Role: req.Role,
+		MaxUses: req.MaxUses,
+		ExpiresAt: req.ExpiresAt,
+		CreatedBy: &authenticatedUser.ID,
+	}
+	err = ih.inviteStore.CreateInvite(r.Context(), invite)
+	if err != nil {
+		logging.FromContext(r.Context()).Error("createInvite", "error", err)
+		apierror.Write(w, r, apierror.Internal("failed to create invite"))
+		return
+	}
+
+	entry := auditEntry(store.AuditInviteCreated, store.AuditTargetInvite, invite.ID)
+	entry.ChatID = &chatID
+	entry.After = auditValue(utils.Envelope{"role":invite.Role, "max_uses":invite.MaxUses, "expires_at":invite.ExpiresAt})
+	audit(r, ih.auditStore, entry)
+
+	utils.WriteJSON(w, http.StatusCreated, utils.Envelope{"invite":invite, "path":"/invites/" + invite.Code})
+}
+
+func (ih *InviteHandler) HandleGetInvites(w http.ResponseWriter, r *http.Request) {
+	chatID, err := utils.ReadParam(r, "chatID")
+	if err != nil {
+		apierror.Write(w, r, apierror.BadRequest("invalid chat id"))
+		return
+	}
+
+	invites, err := ih.inviteStore.GetChatInvites(r.Context(), chatID)
+	if err != nil {
+		logging.FromContext(r.Context()).Error("getChatInvites", "error", err)
+		apierror.Write(w, r, apierror.Internal("failed to get invites"))
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"invites":invites})
+}
+
+func (ih *InviteHandler) HandleRevokeInvite(w http.ResponseWriter, r *http.Request) {
+	chatID, err := utils.ReadParam(r, "chatID")
+	inviteID, err2 := utils.ReadParam(r, "inviteID")
+	if err != nil || err2 != nil {
+		apierror.Write(w, r, apierror.BadRequest("invalid request sent"))
+		return
+	}
+
+	invite, err := ih.inviteStore.RevokeInvite(r.Context(), chatID, inviteID)
+	if errors.Is(err, store.ErrNotFound) {
+		apierror.Write(w, r, apierror.NotFound("invite not found or already revoked"))
+		return
+	}
+	if err != nil {
+		logging.FromContext(r.Context()).Error("revokeInvite", "error", err)
+		apierror.Write(w, r, apierror.Internal("failed to revoke invite"))
+		return
+	}
+
+	entry := auditEntry(store.AuditInviteRevoked, store.AuditTargetInvite, invite.ID)
+	entry.ChatID = &chatID
+	entry.Before = auditValue(utils.Envelope{"uses":invite.Uses})
+	audit(r, ih.auditStore, entry)
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// HandlePreviewInvite shows the chat behind an invite code to anyone signed
+// in, member or not.
+func (ih *InviteHandler) HandlePreviewInvite(w http.ResponseWriter, r *http.Request) {
+	preview, err := ih.inviteStore.PreviewInvite(r.Context(), chi.URLParam(r, "code"))
+	if err != nil {
+		apierror.Write(w, r, inviteError(err))
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"invite":preview})
+}
+
+// HandleJoinInvite adds the caller to the chat behind an invite code with
+// the invite's role.
+func (ih *InviteHandler) HandleJoinInvite(w http.ResponseWriter, r *http.Request) {
+	authenticatedUser, ok := middleware.GetUser(r)
+	if !ok {
+		apierror.Write(w, r, apierror.Unauthorized("authentication required"))
+		return
+	}
+
+	invite, sysMsg, err := ih.inviteStore.RedeemInvite(r.Context(), chi.URLParam(r, "code"), authenticatedUser.ID)
+	if errors.Is(err, store.ErrConflict) {
+		apierror.Write(w, r, apierror.Conflict("you are already a member of this chat"))
+		return
+	}
+	if err != nil {
+		apierror.Write(w, r, inviteError(err))
+		return
+	}
+	ih.webhooks.Publish(r.Context(), invite.ChatID, webhooks.EventMemberAdded, utils.Envelope{"user_id":authenticatedUser.ID, "role":invite.Role})
+	publishSystemMessage(r, ih.webhooks, sysMsg)
+
+	// the joining user is the actor, the invite says who let them in
+	entry := auditEntry(store.AuditMemberJoined, store.AuditTargetUser, authenticatedUser.ID)
+	entry.ChatID = &invite.ChatID
+	entry.After = auditValue(utils.Envelope{"role":invite.Role, "invite_id":invite.ID, "invite_created_by":invite.CreatedBy})
+	audit(r, ih.auditStore, entry)
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"chat_id":invite.ChatID, "role":invite.Role})
+}
+
+// inviteError is the response for an invite code that can't be used.
+func inviteError(err error) *apierror.Error {
+	switch {
+	case errors.Is(err, store.ErrNotFound):
+		return apierror.NotFound("invite not found or revoked")
+	case errors.Is(err, store.ErrInviteExpired):
+		return apierror.New(http.StatusGone, apierror.CodeInviteExpired, "this invite has expired")
+	case errors.Is(err, store.ErrInviteUsedUp):
+		return apierror.New(http.StatusGone, apierror.CodeInviteUsedUp, "this invite has reached its maximum number of uses")
+	}
+	return apierror.FromStore(err, "invite")
+}
@@ -0,0 +1,265 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Abhishek-B-R/chat-app-golang/internals/apierror"
+	"github.com/Abhishek-B-R/chat-app-golang/internals/middleware"
+	"github.com/Abhishek-B-R/chat-app-golang/internals/store"
+	"github.com/Abhishek-B-R/chat-app-golang/internals/webhooks"
+	"github.com/go-chi/chi"
+)
+
+func TestInviteErrorCodes(t *testing.T) {
+	for err, want := range map[error]apierror.Code{
+		store.ErrNotFound: apierror.CodeNotFound,
+		store.ErrInviteExpired: apierror.CodeInviteExpired,
+		store.ErrInviteUsedUp: apierror.CodeInviteUsedUp,
+	} {
+		got := inviteError(err)
+		if got.Code != want {
+			t.Errorf("%v: code %s, want %s", err, got.Code, want)
+		}
+		if want != apierror.CodeNotFound && got.Status != http.StatusGone {
+			t.Errorf("%v: status %d, want 410", err, got.Status)
+		}
+	}
+}
+
+// memInvites redeems invites to one chat the way the Postgres store does:
+// checked and counted under a lock, so concurrent joins can't go over
+// max_uses, and with a member.joined system message.
+type memInvites struct {
+	store.ChatInviteStore
+
+	mu      sync.Mutex
+	invites map[string]*store.ChatInvite
+	members map[int64]store.ChatGroupRole
+}
+
+func newMemInvites() *memInvites {
+	return &memInvites{invites: map[string]*store.ChatInvite{}, members: map[int64]store.ChatGroupRole{}}
+}
+
+func (m *memInvites) CreateInvite(ctx context.Context, invite *store.ChatInvite) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	invite.ID = int64(len(m.invites) + 1)
+	m.invites[invite.Code] = invite
+	return nil
+}
+
+func (m *memInvites) RedeemInvite(ctx context.Context, code string, userID int64) (*store.ChatInvite, *store.Message, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	invite, ok := m.invites[code]
+	switch {
+	case !ok || invite.RevokedAt != nil:
+		return nil, nil, store.ErrNotFound
+	case invite.ExpiresAt != nil && !invite.ExpiresAt.After(time.Now()):
+		return nil, nil, store.ErrInviteExpired
+	case invite.MaxUses != nil && invite.Uses >= *invite.MaxUses:
+		return nil, nil, store.ErrInviteUsedUp
+	}
+	if _, ok := m.members[userID]; ok {
+		return nil, nil, store.ErrConflict
+	}
+
+	m.members[userID] = invite.Role
+	invite.Uses++
+	msg := &store.Message{ChatID: invite.ChatID, Type: store.MessageTypeSystem, Event: &store.SystemEvent{Kind: store.SystemMemberJoined, ActorID: &userID, TargetID: &userID, Role: &invite.Role, InviteID: &invite.ID}}
+	redeemed := *invite
+	return &redeemed, msg, nil
+}
+
+// groupChat is a single group chat.
+type groupChat struct {
+	store.ChatStore
+}
+
+func (groupChat) GetChatByID(ctx context.Context, chatID int64) (*store.Chat, error) {
+	return &store.Chat{ChatID: chatID, IsGroup: true}, nil
+}
+
+// recordedQueue keeps the webhook events handlers publish.
+type recordedQueue struct {
+	store.WebhookStore
+
+	mu     sync.Mutex
+	events []recordedEvent
+}
+
+type recordedEvent struct {
+	eventType string
+	payload   []byte
+}
+
+func (q *recordedQueue) EnqueueEvent(ctx context.Context, chatID int64, eventType string, payload []byte) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.events = append(q.events, recordedEvent{eventType, payload})
+	return nil
+}
+
+type inviteTest struct {
+	invites  *memInvites
+	queue    *recordedQueue
+	auditLog *recordedAudit
+	router   chi.Router
+}
+
+func newInviteTest() *inviteTest {
+	it := &inviteTest{invites: newMemInvites(), queue: &recordedQueue{}, auditLog: &recordedAudit{}}
+	h := NewInviteHandler(it.invites, groupChat{}, it.auditLog, webhooks.NewPublisher(it.queue))
+
+	it.router = chi.NewRouter()
+	it.router.Post("/chats/{chatID}/invites", h.HandleCreateInvite)
+	it.router.Post("/invites/{code}", h.HandleJoinInvite)
+	return it
+}
+
+func (it *inviteTest) do(t *testing.T, userID int64, path, body string) *httptest.ResponseRecorder {
+	t.Helper()
+	req := httptest.NewRequest("POST", path, strings.NewReader(body))
+	req = middleware.SetUser(req, &store.User{ID: userID, Username: fmt.Sprintf("user%d", userID)})
+	rec := httptest.NewRecorder()
+	it.router.ServeHTTP(rec, req)
+	return rec
+}
+
+// createInvite creates an invite as the chat's owner and returns its code.
+func (it *inviteTest) createInvite(t *testing.T, body string) string {
+	t.Helper()
+	rec := it.do(t, 1, "/chats/7/invites", body)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("creating invite %s: status %d: %s", body, rec.Code, rec.Body)
+	}
+	var res struct {
+		Invite store.ChatInvite `json:"invite"`
+	}
+	json.NewDecoder(rec.Body).Decode(&res)
+	return res.Invite.Code
+}
+
+func TestJoinInviteWithItsRole(t *testing.T) {
+	it := newInviteTest()
+
+	code := it.createInvite(t, `{}`)
+	rec := it.do(t, 10, "/invites/"+code, "")
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `"role": "member"`) {
+		t.Fatalf("joining: status %d: %s", rec.Code, rec.Body)
+	}
+	if it.invites.members[10] != store.MEMBER {
+		t.Errorf("joined as %q, want member by default", it.invites.members[10])
+	}
+
+	code = it.createInvite(t, `{"role":"admin"}`)
+	rec = it.do(t, 11, "/invites/"+code, "")
+	if rec.Code != http.StatusOK || it.invites.members[11] != store.ADMIN {
+		t.Errorf("joining through an admin invite: status %d, role %q", rec.Code, it.invites.members[11])
+	}
+
+	rec = it.do(t, 11, "/invites/"+code, "")
+	if rec.Code != http.StatusConflict {
+		t.Errorf("joining twice: status %d: %s", rec.Code, rec.Body)
+	}
+	rec = it.do(t, 12, "/invites/nope", "")
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("unknown code: status %d: %s", rec.Code, rec.Body)
+	}
+}
+
+func TestJoinInvitePostsAndAuditsTheJoin(t *testing.T) {
+	it := newInviteTest()
+	code := it.createInvite(t, `{}`)
+	it.queue.events = nil
+	it.auditLog.entries = nil
+
+	rec := it.do(t, 10, "/invites/"+code, "")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("joining: status %d: %s", rec.Code, rec.Body)
+	}
+
+	var joined bool
+	for _, e := range it.queue.events {
+		if e.eventType != webhooks.EventMessageCreated {
+			continue
+		}
+		var payload struct {
+			Data store.Message `json:"data"`
+		}
+		json.Unmarshal(e.payload, &payload)
+		if msg := payload.Data; msg.Type == store.MessageTypeSystem && msg.Event != nil && msg.Event.Kind == store.SystemMemberJoined && *msg.Event.TargetID == 10 {
+			joined = true
+		}
+	}
+	if !joined {
+		t.Errorf("no member.joined system message published: %d events", len(it.queue.events))
+	}
+
+	if len(it.auditLog.entries) != 1 {
+		t.Fatalf("%d audit entries, want the join", len(it.auditLog.entries))
+	}
+	entry := it.auditLog.entries[0]
+	if entry.Action != store.AuditMemberJoined || *entry.TargetID != 10 || *entry.ChatID != 7 || !strings.Contains(string(entry.After), `"invite_created_by":1`) {
+		t.Errorf("audit entry %+v, after %s", entry, entry.After)
+	}
+}
+
+func TestJoinExpiredInvite(t *testing.T) {
+	it := newInviteTest()
+	expiresAt := time.Now().Add(time.Hour).UTC().Format(time.RFC3339)
+	code := it.createInvite(t, `{"expires_at":"`+expiresAt+`"}`)
+
+	// the hour passes
+	past := time.Now().Add(-time.Minute)
+	it.invites.invites[code].ExpiresAt = &past
+
+	rec := it.do(t, 10, "/invites/"+code, "")
+	if rec.Code != http.StatusGone || !strings.Contains(rec.Body.String(), "invite_expired") {
+		t.Errorf("joining an expired invite: status %d: %s", rec.Code, rec.Body)
+	}
+	if _, ok := it.invites.members[10]; ok {
+		t.Error("joined through an expired invite")
+	}
+}
+
+func TestJoinInviteMaxUsesUnderConcurrentJoins(t *testing.T) {
+	it := newInviteTest()
+	code := it.createInvite(t, `{"max_uses":3}`)
+
+	var wg sync.WaitGroup
+	statuses := make([]int, 20)
+	bodies := make([]string, 20)
+	for i := range statuses {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			rec := it.do(t, int64(100+i), "/invites/"+code, "")
+			statuses[i], bodies[i] = rec.Code, rec.Body.String()
+		}(i)
+	}
+	wg.Wait()
+
+	joined := 0
+	for i, status := range statuses {
+		switch {
+		case status == http.StatusOK:
+			joined++
+		case status != http.StatusGone || !strings.Contains(bodies[i], "invite_used_up"):
+			t.Errorf("join %d: status %d: %s", i, status, bodies[i])
+		}
+	}
+	if joined != 3 || len(it.invites.members) != 3 || it.invites.invites[code].Uses != 3 {
+		t.Errorf("%d joined, %d members, %d uses, want 3 of each", joined, len(it.invites.members), it.invites.invites[code].Uses)
+	}
+}
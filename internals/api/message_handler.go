@@ -1,73 +1,254 @@
 package api
 
 import (
-	"encoding/json"
-	"log"
+	"errors"
+	"fmt"
+	"math"
 	"net/http"
 	"strings"
+	"time"
 
+	"github.com/Abhishek-B-R/chat-app-golang/internals/apierror"
+	"github.com/Abhishek-B-R/chat-app-golang/internals/commands"
+	"github.com/Abhishek-B-R/chat-app-golang/internals/config"
+	"github.com/Abhishek-B-R/chat-app-golang/internals/logging"
+	"github.com/Abhishek-B-R/chat-app-golang/internals/metrics"
 	"github.com/Abhishek-B-R/chat-app-golang/internals/middleware"
 	"github.com/Abhishek-B-R/chat-app-golang/internals/store"
 	"github.com/Abhishek-B-R/chat-app-golang/internals/utils"
+	"github.com/Abhishek-B-R/chat-app-golang/internals/validate"
+	"github.com/Abhishek-B-R/chat-app-golang/internals/webhooks"
 )
 
+// createMessageRequest is everything a user can set on a new message, the
+// rest is filled in by the server
+type createMessageRequest struct {
+	Content *string `json:"content"`
+	Attachments []store.MessageAttachment `json:"attachments"`
+}
+
 type MessageHandler struct {
 	store store.MessageStore
-	logger *log.Logger
+	chatMemberStore store.ChatMemberStore
+	filterStore store.ContentFilterStore
+	auditStore store.AuditStore
+	webhooks *webhooks.Publisher
+	commands *commands.Registry
+	limits config.LimitsConfig
+	metrics metrics.Recorder
 }
 
-func NewMessageHandler(store store.MessageStore, logger *log.Logger) *MessageHandler {
+func NewMessageHandler(store store.MessageStore, chatMemberStore store.ChatMemberStore, filterStore store.ContentFilterStore, auditStore store.AuditStore, publisher *webhooks.Publisher, registry *commands.Registry, limits config.LimitsConfig, recorder metrics.Recorder) *MessageHandler {
 	return &MessageHandler{
 		store: store,
-		logger: logger,
+		chatMemberStore: chatMemberStore,
+		filterStore: filterStore,
+		auditStore: auditStore,
+		webhooks: publisher,
+		commands: registry,
+		limits: limits,
+		metrics: recorder,
 	}
 }
 
 func (mh *MessageHandler) HandleCreateMessage(w http.ResponseWriter, r *http.Request) {
-	var msg store.Message
-	err := json.NewDecoder(r.Body).Decode(&msg)
-	chatID, err2 := utils.ReadParam(r, "chatID")
-	if err != nil || err2 != nil {
-		mh.logger.Printf("ERROR: decodingCreateMessage: %v %v\n", err, err2)
-		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error":"invalid request sent"})
+	chatID, err := utils.ReadParam(r, "chatID")
+	if err != nil {
+		apierror.Write(w, r, apierror.BadRequest("invalid chat id"))
+		return
+	}
+
+	var req createMessageRequest
+	err = validate.DecodeJSON(r, &req)
+	if err != nil {
+		apierror.Write(w, r, err)
 		return
 	}
 
 	authenticatedUser, ok := middleware.GetUser(r)
 	if !ok {
-		utils.WriteJSON(w, http.StatusUnauthorized, utils.Envelope{"error":"authentication required"})
+		apierror.Write(w, r, apierror.Unauthorized("authentication required"))
+		return
+	}
+
+	msg := store.Message{
+		ChatID: chatID,
+		SenderID: &authenticatedUser.ID,
+		Content: req.Content,
+		Attachments: req.Attachments,
+	}
+
+	var v validate.Validator
+	v.Message(msg.Content, msg.Attachments, mh.limits)
+	if err := v.Err(); err != nil {
+		apierror.Write(w, r, err)
+		return
+	}
+
+	if !filterContent(w, r, mh.filterStore, mh.metrics, chatID, msg.Content) {
+		return
+	}
+	minInterval, ok := mh.allowPosting(w, r, chatID, authenticatedUser.ID)
+	if !ok {
 		return
 	}
 
-	msg.ChatID = chatID
-	msg.SenderID = &authenticatedUser.ID
+	msg.Type = store.MessageTypeText
 
-	err = mh.store.CreateMessage(r.Context(), &msg)
+	if msg.Content != nil && len(msg.Attachments) == 0 {
+		if name, args, ok := commands.Parse(*msg.Content); ok {
+			mh.handleCommand(w, r, &msg, authenticatedUser, name, args, minInterval)
+			return
+		}
+		content := commands.Unescape(*msg.Content)
+		msg.Content = &content
+	}
+
+	err = mh.store.PostMessage(r.Context(), &msg, minInterval)
+	if errors.Is(err, store.ErrSlowMode) {
+		now := time.Now()
+		writeSlowMode(w, r, now, now.Add(minInterval))
+		return
+	}
+	if errors.Is(err, store.ErrNotFound) {
+		// the only foreign key the insert writes is the chat's
+		apierror.Write(w, r, apierror.FromStore(err, "chat"))
+		return
+	}
 	if err != nil {
-		mh.logger.Printf("ERROR: createMessage: %v\n", err)
-		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error":"failed to create message"})
+		logging.FromContext(r.Context()).Error("createMessage", "error", err)
+		apierror.Write(w, r, apierror.Internal("failed to create message"))
 		return
 	}
+	mh.metrics.MessageCreated(metrics.SourceUser)
+	mh.webhooks.Publish(r.Context(), msg.ChatID, webhooks.EventMessageCreated, msg)
 
 	utils.WriteJSON(w, http.StatusCreated, utils.Envelope{"msg":"created message"})
 }
 
+// allowPosting enforces the chat's posting restrictions on members (owners
+// and admins are exempt) and returns the slow mode interval the message has
+// to be posted with. Slow mode is only checked here so a command is not run
+// for nothing; PostMessage records the post once the message is stored. It
+// writes the error response itself when it returns false.
+func (mh *MessageHandler) allowPosting(w http.ResponseWriter, r *http.Request, chatID, userID int64) (time.Duration, bool) {
+	state, err := mh.chatMemberStore.GetPostingState(r.Context(), chatID, userID)
+	if errors.Is(err, store.ErrNotFound) {
+		apierror.Write(w, r, apierror.Forbidden("you are not a member of this chat").WithCode(apierror.CodeNotChatMember))
+		return 0, false
+	}
+	if err != nil {
+		logging.FromContext(r.Context()).Error("getPostingState", "error", err)
+		apierror.Write(w, r, apierror.Internal("internal server error"))
+		return 0, false
+	}
+
+	if state.Role != store.MEMBER {
+		return 0, true
+	}
+	if state.Settings.AdminsOnly {
+		apierror.Write(w, r, apierror.Forbidden("only admins can post in this chat").WithCode(apierror.CodeAdminsOnly))
+		return 0, false
+	}
+	if until := state.PostingMutedUntil; until != nil && until.After(state.Now) {
+		apierror.Write(w, r, apierror.Forbidden("you are muted in this chat until " + until.UTC().Format(time.RFC3339)).WithCode(apierror.CodeMutedInChat).WithRetryAt(*until))
+		return 0, false
+	}
+
+	minInterval := time.Duration(state.Settings.SlowModeSeconds) * time.Second
+	if state.LastPostedAt != nil {
+		if retryAt := state.LastPostedAt.Add(minInterval); retryAt.After(state.Now) {
+			writeSlowMode(w, r, state.Now, retryAt)
+			return 0, false
+		}
+	}
+	return minInterval, true
+}
+
+func writeSlowMode(w http.ResponseWriter, r *http.Request, now, retryAt time.Time) {
+	wait := int(math.Ceil(retryAt.Sub(now).Seconds()))
+	apierror.Write(w, r, apierror.New(http.StatusTooManyRequests, apierror.CodeSlowMode, fmt.Sprintf("slow mode is on, you can post again in %d seconds", max(wait, 1))).WithRetryAt(retryAt))
+}
+
+// handleCommand runs a slash command instead of storing the message.
+// Ephemeral responses go back to the caller only; anything else is posted
+// to the chat as the caller's message.
+func (mh *MessageHandler) handleCommand(w http.ResponseWriter, r *http.Request, msg *store.Message, user *store.User, name, args string, minInterval time.Duration) {
+	resp, err := mh.commands.Execute(r.Context(), &commands.Invocation{
+		ChatID: msg.ChatID,
+		User: user,
+		Name: name,
+		Args: args,
+	})
+	if err != nil {
+		logging.FromContext(r.Context()).Error("running command", "command", name, "error", err)
+		apierror.Write(w, r, apierror.BadGateway("command /" + name + " failed"))
+		return
+	}
+
+	if resp.Ephemeral || resp.Text == "" {
+		utils.WriteJSON(w, http.StatusOK, utils.Envelope{"ephemeral":resp})
+		return
+	}
+
+	msg.Type = store.MessageTypeText
+	msg.Content = &resp.Text
+
+	// the bot's text is held to the same limits as a user's message
+	var v validate.Validator
+	v.Message(msg.Content, msg.Attachments, mh.limits)
+	if err := v.Err(); err != nil {
+		logging.FromContext(r.Context()).Warn("command response rejected", "command", name, "error", err)
+		apierror.Write(w, r, apierror.BadGateway("command /" + name + " returned a message that can't be posted"))
+		return
+	}
+	if !filterContent(w, r, mh.filterStore, mh.metrics, msg.ChatID, msg.Content) {
+		return
+	}
+
+	err = mh.store.PostMessage(r.Context(), msg, minInterval)
+	if errors.Is(err, store.ErrSlowMode) {
+		now := time.Now()
+		writeSlowMode(w, r, now, now.Add(minInterval))
+		return
+	}
+	if errors.Is(err, store.ErrNotFound) {
+		// the only foreign key the insert writes is the chat's
+		apierror.Write(w, r, apierror.FromStore(err, "chat"))
+		return
+	}
+	if err != nil {
+		logging.FromContext(r.Context()).Error("createMessage", "error", err)
+		apierror.Write(w, r, apierror.Internal("failed to create message"))
+		return
+	}
+	mh.metrics.MessageCreated(metrics.SourceCommand)
+	mh.webhooks.Publish(r.Context(), msg.ChatID, webhooks.EventMessageCreated, msg)
+
+	utils.WriteJSON(w, http.StatusCreated, utils.Envelope{"msg":"created message", "message":msg})
+}
+
 func (mh *MessageHandler) HandleGetMessage(w http.ResponseWriter, r *http.Request) {
 	msgID, err := utils.ReadParam(r, "msgID")
 	if err != nil {
-		mh.logger.Printf("ERROR: decodingGetMessage: %v\n", err)
-		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error":"invalid request sent"})
+		logging.FromContext(r.Context()).Error("decodingGetMessage", "error", err)
+		apierror.Write(w, r, apierror.BadRequest("invalid request sent"))
+		return
+	}
+
+	user, ok := middleware.GetUser(r)
+	if !ok {
+		apierror.Write(w, r, apierror.Unauthorized("authentication required"))
 		return
 	}
 
-	message, err := mh.store.GetMessage(r.Context(), msgID)
+	message, err := mh.store.GetMessageForViewer(r.Context(), msgID, user.ID)
 	if err != nil {
-		mh.logger.Printf("ERROR: getMessage: %v\n", err)
-		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error":"failed to get message"})
+		apierror.Write(w, r, apierror.FromStore(err, "message"))
 		return
 	}
 
-	utils.WriteJSON(w, http.StatusCreated, utils.Envelope{"message":message})
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"message":message})
 }
 
 func (mh *MessageHandler) HandleGetChatMessages(w http.ResponseWriter, r *http.Request) {
@@ -76,15 +257,21 @@ func (mh *MessageHandler) HandleGetChatMessages(w http.ResponseWriter, r *http.R
 	offset, err3 := utils.ReadParam(r, "offset")
 
 	if err != nil || err2 != nil || err3 != nil {
-		mh.logger.Printf("ERROR: decodingGetChatMessages: %v %v\n", err, err2)
-		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error":"invalid request sent"})
+		logging.FromContext(r.Context()).Error("decodingGetChatMessages", "error", errors.Join(err, err2, err3))
+		apierror.Write(w, r, apierror.BadRequest("invalid request sent"))
+		return
+	}
+
+	user, ok := middleware.GetUser(r)
+	if !ok {
+		apierror.Write(w, r, apierror.Unauthorized("authentication required"))
 		return
 	}
 
-	messages, err := mh.store.GetChatMessages(r.Context(), chatID, limit, offset)
+	messages, err := mh.store.GetChatMessages(r.Context(), chatID, user.ID, limit, offset)
 	if err != nil {
-		mh.logger.Printf("ERROR: getChatMessages: %v\n",err)
-		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error":"failed to get chat messages"})
+		logging.FromContext(r.Context()).Error("getChatMessages", "error", err)
+		apierror.Write(w, r, apierror.Internal("failed to get chat messages"))
 		return
 	}
 
@@ -94,48 +281,52 @@ func (mh *MessageHandler) HandleGetChatMessages(w http.ResponseWriter, r *http.R
 func (mh *MessageHandler) HandleUpdateMessage(w http.ResponseWriter, r *http.Request) {
 	msgID, err := utils.ReadParam(r, "msgID")
 	if err != nil {
-		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid msgID"})
+		apierror.Write(w, r, apierror.BadRequest("invalid msgID"))
 		return
 	}
 
 	var req struct {
 		Content string `json:"content"`
 	}
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		mh.logger.Printf("ERROR: decodingUpdateMessage: %v\n", err)
-		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid request body"})
+	if err := validate.DecodeJSON(r, &req); err != nil {
+		apierror.Write(w, r, err)
 		return
 	}
 
 	req.Content = strings.TrimSpace(req.Content)
-	if req.Content == "" {
-		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "content cannot be empty"})
+	var v validate.Validator
+	v.Message(&req.Content, nil, mh.limits)
+	if err := v.Err(); err != nil {
+		apierror.Write(w, r, err)
 		return
 	}
 
 	user, ok := middleware.GetUser(r)
 	if !ok {
-		utils.WriteJSON(w, http.StatusUnauthorized, utils.Envelope{"error": "authentication required"})
+		apierror.Write(w, r, apierror.Unauthorized("authentication required"))
 		return
 	}
 
 	originalMsg, err := mh.store.GetMessage(r.Context(), msgID)
 	if err != nil {
-		utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "message not found"})
+		apierror.Write(w, r, apierror.FromStore(err, "message"))
 		return
 	}
 
 	if originalMsg.SenderID == nil || user.ID != *originalMsg.SenderID {
-		utils.WriteJSON(w, http.StatusForbidden, utils.Envelope{"error": "not allowed to update this message"})
+		apierror.Write(w, r, apierror.Forbidden("not allowed to update this message"))
+		return
+	}
+	if !filterContent(w, r, mh.filterStore, mh.metrics, originalMsg.ChatID, &req.Content) {
 		return
 	}
 	originalMsg.Content = &req.Content
 
 	if err := mh.store.UpdateMessage(r.Context(), originalMsg); err != nil {
-		mh.logger.Printf("ERROR: updateMessage: %v\n", err)
-		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "failed to update message"})
+		apierror.Write(w, r, apierror.FromStore(err, "message"))
 		return
 	}
+	mh.webhooks.Publish(r.Context(), originalMsg.ChatID, webhooks.EventMessageUpdated, originalMsg)
 
 	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"message": originalMsg})
 }
@@ -144,39 +335,182 @@ func (mh *MessageHandler) HandleUpdateMessage(w http.ResponseWriter, r *http.Req
 func (mh *MessageHandler) HandleDeleteMessage(w http.ResponseWriter, r *http.Request){
 	id, err := utils.ReadParam(r, "msgID")
 	if err != nil {
-		mh.logger.Printf("ERROR: decodingDeleteMessage: %v\n", err)
-		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error":"invalid request sent"})
+		logging.FromContext(r.Context()).Error("decodingDeleteMessage", "error", err)
+		apierror.Write(w, r, apierror.BadRequest("invalid request sent"))
 		return
 	}
 
+	user, ok := middleware.GetUser(r)
+	if !ok {
+		apierror.Write(w, r, apierror.Unauthorized("authentication required"))
+		return
+	}
+	msg := middleware.GetMessageMembership(r)
+
+	// anyone can delete their own messages, only chat admins someone else's
+	own := msg.SenderID != nil && *msg.SenderID == user.ID
+	if !own {
+		role, err := mh.chatMemberStore.GetUserRole(r.Context(), msg.ChatID, user.ID)
+		if err != nil && !errors.Is(err, store.ErrNotFound) {
+			logging.FromContext(r.Context()).Error("getUserRole", "error", err)
+			apierror.Write(w, r, apierror.Internal("failed to delete message"))
+			return
+		}
+		if role != string(store.OWNER) && role != string(store.ADMIN) {
+			apierror.Write(w, r, apierror.Forbidden("only chat admins can delete other members' messages").WithCode(apierror.CodeAdminsOnly))
+			return
+		}
+	}
+
 	err = mh.store.DeleteMessage(r.Context(), id)
 	if err != nil {
-		mh.logger.Printf("ERROR: deleteMessage: %v\n",err)
-		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error":"failed to delete message"})
+		logging.FromContext(r.Context()).Error("deleteMessage", "error", err)
+		apierror.Write(w, r, apierror.Internal("failed to delete message"))
 		return
 	}
+	mh.webhooks.Publish(r.Context(), msg.ChatID, webhooks.EventMessageDeleted, utils.Envelope{"id":id})
+
+	// deleting your own message is not worth auditing, deleting someone
+	// else's is
+	if !own {
+		entry := auditEntry(store.AuditMessageDeleted, store.AuditTargetMessage, id)
+		entry.ChatID = &msg.ChatID
+		entry.Before = auditValue(msg)
+		audit(r, mh.auditStore, entry)
+	}
 
 	w.WriteHeader(http.StatusNoContent)
 }
 
+// HandleGetPinnedMessages lists the chat's pinned messages, the latest pin
+// first.
+func (mh *MessageHandler) HandleGetPinnedMessages(w http.ResponseWriter, r *http.Request) {
+	chatID, err := utils.ReadParam(r, "chatID")
+	if err != nil {
+		apierror.Write(w, r, apierror.BadRequest("invalid chat id"))
+		return
+	}
+
+	user, ok := middleware.GetUser(r)
+	if !ok {
+		apierror.Write(w, r, apierror.Unauthorized("authentication required"))
+		return
+	}
+
+	msgs, err := mh.store.GetPinnedMessages(r.Context(), chatID, user.ID)
+	if err != nil {
+		logging.FromContext(r.Context()).Error("getPinnedMessages", "error", err)
+		apierror.Write(w, r, apierror.Internal("failed to get pinned messages"))
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"messages":msgs})
+}
+
+// HandlePinMessage pins the message for everyone in the chat and posts a
+// system message about it. Only chat admins can pin.
+func (mh *MessageHandler) HandlePinMessage(w http.ResponseWriter, r *http.Request) {
+	msg, user, ok := mh.pinnableMessage(w, r)
+	if !ok {
+		return
+	}
+	if msg.PinnedAt != nil {
+		utils.WriteJSON(w, http.StatusOK, utils.Envelope{"message":msg})
+		return
+	}
+
+	sysMsg, err := mh.store.PinMessage(r.Context(), msg.ID, user.ID, systemEvent(store.SystemMessagePinned, user.ID, msg.ID))
+	if errors.Is(err, store.ErrNotFound) {
+		// deleted or pinned since the middleware loaded it
+		apierror.Write(w, r, apierror.Conflict("the message was changed, try again"))
+		return
+	}
+	if err != nil {
+		logging.FromContext(r.Context()).Error("pinMessage", "error", err)
+		apierror.Write(w, r, apierror.Internal("failed to pin message"))
+		return
+	}
+	publishSystemMessage(r, mh.webhooks, sysMsg)
+
+	now := sysMsg.CreatedAt
+	msg.PinnedAt = &now
+	msg.PinnedBy = &user.ID
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"message":msg})
+}
+
+// HandleUnpinMessage unpins the message and posts a system message about it.
+// Only chat admins can unpin.
+func (mh *MessageHandler) HandleUnpinMessage(w http.ResponseWriter, r *http.Request) {
+	msg, user, ok := mh.pinnableMessage(w, r)
+	if !ok {
+		return
+	}
+	if msg.PinnedAt == nil {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	sysMsg, err := mh.store.UnpinMessage(r.Context(), msg.ID, systemEvent(store.SystemMessageUnpinned, user.ID, msg.ID))
+	if err != nil && !errors.Is(err, store.ErrNotFound) {
+		logging.FromContext(r.Context()).Error("unpinMessage", "error", err)
+		apierror.Write(w, r, apierror.Internal("failed to unpin message"))
+		return
+	}
+	publishSystemMessage(r, mh.webhooks, sysMsg)
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// pinnableMessage loads the message of a pin or unpin request and checks
+// that the caller is an admin of its chat and that the message can be
+// pinned. It writes the error response itself when it returns false.
+func (mh *MessageHandler) pinnableMessage(w http.ResponseWriter, r *http.Request) (*store.Message, *store.User, bool) {
+	user, ok := middleware.GetUser(r)
+	if !ok {
+		apierror.Write(w, r, apierror.Unauthorized("authentication required"))
+		return nil, nil, false
+	}
+	msg := middleware.GetMessageMembership(r)
+
+	role, err := mh.chatMemberStore.GetUserRole(r.Context(), msg.ChatID, user.ID)
+	if err != nil {
+		apierror.Write(w, r, apierror.FromStore(err, "chat member"))
+		return nil, nil, false
+	}
+	if role != string(store.OWNER) && role != string(store.ADMIN) {
+		apierror.Write(w, r, apierror.Forbidden("only chat admins can pin messages"))
+		return nil, nil, false
+	}
+
+	if msg.DeletedAt != nil {
+		apierror.Write(w, r, apierror.NotFound("message not found"))
+		return nil, nil, false
+	}
+	if msg.Type == store.MessageTypeSystem {
+		apierror.Write(w, r, apierror.Unprocessable("system messages can't be pinned"))
+		return nil, nil, false
+	}
+	return msg, user, true
+}
+
 func (mh *MessageHandler) HandleGetUnreadCount(w http.ResponseWriter, r *http.Request){
 	chatID, err := utils.ReadParam(r, "chatID")
 	if err != nil {
-		mh.logger.Printf("ERROR: decodingGetUnreadCount: %v\n",err)
-		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error":"invalid request sent"})
+		logging.FromContext(r.Context()).Error("decodingGetUnreadCount", "error", err)
+		apierror.Write(w, r, apierror.BadRequest("invalid request sent"))
 		return
 	}
 
 	authenticatedUser, ok := middleware.GetUser(r)
 	if !ok {
-		utils.WriteJSON(w, http.StatusUnauthorized, utils.Envelope{"error":"authentication required"})
+		apierror.Write(w, r, apierror.Unauthorized("authentication required"))
 		return
 	}
 
 	count, err := mh.store.GetUnreadCount(r.Context(), chatID, authenticatedUser.ID)
 	if err != nil {
-		mh.logger.Printf("ERROR: getUnreadCount: %v\n",err)
-		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error":"failed to retrieve unread count"})
+		logging.FromContext(r.Context()).Error("getUnreadCount", "error", err)
+		apierror.Write(w, r, apierror.Internal("failed to retrieve unread count"))
 		return
 	}
 
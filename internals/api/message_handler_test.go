@@ -0,0 +1,126 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/Abhishek-B-R/chat-app-golang/internals/commands"
+	"github.com/Abhishek-B-R/chat-app-golang/internals/config"
+	"github.com/Abhishek-B-R/chat-app-golang/internals/metrics"
+	"github.com/Abhishek-B-R/chat-app-golang/internals/middleware"
+	"github.com/Abhishek-B-R/chat-app-golang/internals/store"
+	"github.com/Abhishek-B-R/chat-app-golang/internals/webhooks"
+	"github.com/go-chi/chi"
+)
+
+func TestCreateMessageOnlyTakesContentAndAttachments(t *testing.T) {
+	registry := commands.NewRegistry(nil, config.Default().Commands)
+	messages := &slowMessages{}
+	h := NewMessageHandler(messages, slowChat{}, memFilters{}, nil, webhooks.NewPublisher(nopQueue{}), registry, config.Default().Limits, metrics.Nop{})
+	r := chi.NewRouter()
+	r.Post("/chats/{chatID}/messages", h.HandleCreateMessage)
+
+	for _, body := range []string{
+		`{"content":"hi","sender_id":1}`,
+		`{"content":"hi","pinned_at":"2024-01-01T00:00:00Z"}`,
+		`{"content":"hi","webhook_id":2,"display_name":"someone else"}`,
+		`{"content":"hi","type":"system"}`,
+		`{"content":"hi","reply_to_message_id":5}`,
+	} {
+		req := httptest.NewRequest("POST", "/chats/7/messages", strings.NewReader(body))
+		req = middleware.SetUser(req, &store.User{ID: 3, Username: "alice"})
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, req)
+		if rec.Code != http.StatusUnprocessableEntity || !strings.Contains(rec.Body.String(), "unknown field") {
+			t.Errorf("%s: status %d: %s", body, rec.Code, rec.Body)
+		}
+	}
+	if len(messages.created) != 0 {
+		t.Errorf("stored %d messages with server-set fields", len(messages.created))
+	}
+
+	req := httptest.NewRequest("POST", "/chats/7/messages", strings.NewReader(`{"content":"hi","attachments":[{"type":"image","url":"https://example.com/a.png"}]}`))
+	req = middleware.SetUser(req, &store.User{ID: 3, Username: "alice"})
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, req)
+	if rec.Code != http.StatusCreated || len(messages.created) != 1 {
+		t.Fatalf("content and attachments: status %d: %s", rec.Code, rec.Body)
+	}
+	if msg := messages.created[0]; *msg.SenderID != 3 || msg.ChatID != 7 || msg.Type != store.MessageTypeText || len(msg.Attachments) != 1 {
+		t.Errorf("stored %+v", msg)
+	}
+}
+
+// deletableMessages soft deletes messages by id.
+type deletableMessages struct {
+	store.MessageStore
+	deleted map[int64]bool
+}
+
+func (m deletableMessages) DeleteMessage(ctx context.Context, id int64) error {
+	m.deleted[id] = true
+	return nil
+}
+
+type recordedAudit struct {
+	store.AuditStore
+	entries []*store.AuditEntry
+}
+
+func (m *recordedAudit) RecordAudit(ctx context.Context, entry *store.AuditEntry) error {
+	m.entries = append(m.entries, entry)
+	return nil
+}
+
+func deleteMessage(t *testing.T, messages deletableMessages, members memRoles, auditLog *recordedAudit, callerID int64, msg *store.Message) *httptest.ResponseRecorder {
+	t.Helper()
+	h := NewMessageHandler(messages, members, memFilters{}, auditLog, webhooks.NewPublisher(nopQueue{}), nil, config.Default().Limits, metrics.Nop{})
+
+	r := chi.NewRouter()
+	r.Delete("/messages/{msgID}", h.HandleDeleteMessage)
+	req := httptest.NewRequest("DELETE", fmt.Sprintf("/messages/%d", msg.ID), nil)
+	req = middleware.SetUser(req, &store.User{ID: callerID, Username: "caller"})
+	req = middleware.SetMessageMembership(req, msg)
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestOnlyAdminsDeleteOthersMessages(t *testing.T) {
+	members := memRoles{roles: map[int64]store.ChatGroupRole{1: store.OWNER, 2: store.ADMIN, 3: store.MEMBER, 4: store.MEMBER}}
+	messages := deletableMessages{deleted: map[int64]bool{}}
+	auditLog := &recordedAudit{}
+	byMember := func(id, senderID int64) *store.Message {
+		return &store.Message{ID: id, ChatID: 7, SenderID: &senderID, Type: store.MessageTypeText}
+	}
+
+	rec := deleteMessage(t, messages, members, auditLog, 3, byMember(10, 4))
+	if rec.Code != http.StatusForbidden || !strings.Contains(rec.Body.String(), "admins_only") {
+		t.Errorf("member deleting another member's message: status %d: %s", rec.Code, rec.Body)
+	}
+	if messages.deleted[10] {
+		t.Error("member deleted another member's message")
+	}
+
+	rec = deleteMessage(t, messages, members, auditLog, 3, byMember(11, 3))
+	if rec.Code != http.StatusNoContent || !messages.deleted[11] {
+		t.Errorf("member deleting their own message: status %d: %s", rec.Code, rec.Body)
+	}
+	if len(auditLog.entries) != 0 {
+		t.Errorf("deleting your own message was audited: %+v", auditLog.entries)
+	}
+
+	for callerID, msgID := range map[int64]int64{1: 12, 2: 13} {
+		rec = deleteMessage(t, messages, members, auditLog, callerID, byMember(msgID, 4))
+		if rec.Code != http.StatusNoContent || !messages.deleted[msgID] {
+			t.Errorf("%s deleting a member's message: status %d: %s", members.roles[callerID], rec.Code, rec.Body)
+		}
+	}
+	if len(auditLog.entries) != 2 || auditLog.entries[0].Action != store.AuditMessageDeleted {
+		t.Errorf("admin deletes were not audited: %+v", auditLog.entries)
+	}
+}
@@ -0,0 +1,267 @@
+package api
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/Abhishek-B-R/chat-app-golang/internals/apierror"
+	"github.com/Abhishek-B-R/chat-app-golang/internals/config"
+	"github.com/Abhishek-B-R/chat-app-golang/internals/logging"
+	"github.com/Abhishek-B-R/chat-app-golang/internals/metrics"
+	"github.com/Abhishek-B-R/chat-app-golang/internals/oidc"
+	"github.com/Abhishek-B-R/chat-app-golang/internals/store"
+	"github.com/Abhishek-B-R/chat-app-golang/internals/utils"
+	"github.com/Abhishek-B-R/chat-app-golang/internals/validate"
+	"github.com/go-chi/chi"
+	"golang.org/x/oauth2"
+)
+
+var (
+	errIdentityNoEmail = errors.New("identity has no email")
+	errIdentityEmailTaken = errors.New("email belongs to another account")
+)
+
+type OIDCHandler struct {
+	providers map[string]*oidc.Provider
+	identityStore store.IdentityStore
+	userStore store.UserStore
+	tokenStore store.TokenStore
+	auditStore store.AuditStore
+	tokenTTL time.Duration
+	stateTTL time.Duration
+	metrics metrics.Recorder
+}
+
+func NewOIDCHandler(providers []*oidc.Provider, identityStore store.IdentityStore, userStore store.UserStore, tokenStore store.TokenStore, auditStore store.AuditStore, auth config.AuthConfig, recorder metrics.Recorder) *OIDCHandler {
+	byName := make(map[string]*oidc.Provider, len(providers))
+	for _, p := range providers {
+		byName[p.Name] = p
+	}
+
+	return &OIDCHandler{
+		providers: byName,
+		identityStore: identityStore,
+		userStore: userStore,
+		tokenStore: tokenStore,
+		auditStore: auditStore,
+		tokenTTL: auth.TokenTTL,
+		stateTTL: auth.OIDCStateTTL,
+		metrics: recorder,
+	}
+}
+
+func (oh *OIDCHandler) HandleLogin(w http.ResponseWriter, r *http.Request) {
+	provider, ok := oh.providers[chi.URLParam(r, "provider")]
+	if !ok {
+		apierror.Write(w, r, apierror.NotFound("unknown identity provider"))
+		return
+	}
+
+	state, err := randomString()
+	if err != nil {
+		logging.FromContext(r.Context()).Error("generating oidc state", "error", err)
+		apierror.Write(w, r, apierror.Internal("internal server error"))
+		return
+	}
+	nonce, err := randomString()
+	if err != nil {
+		logging.FromContext(r.Context()).Error("generating oidc nonce", "error", err)
+		apierror.Write(w, r, apierror.Internal("internal server error"))
+		return
+	}
+
+	authReq := &store.OIDCAuthRequest{
+		State: state,
+		Provider: provider.Name,
+		CodeVerifier: oauth2.GenerateVerifier(),
+		Nonce: nonce,
+		ExpiresAt: time.Now().Add(oh.stateTTL),
+	}
+
+	err = oh.identityStore.SaveAuthRequest(r.Context(), authReq)
+	if err != nil {
+		logging.FromContext(r.Context()).Error("saveAuthRequest", "error", err)
+		apierror.Write(w, r, apierror.Internal("internal server error"))
+		return
+	}
+
+	http.Redirect(w, r, provider.AuthCodeURL(authReq.State, authReq.Nonce, authReq.CodeVerifier), http.StatusFound)
+}
+
+func (oh *OIDCHandler) HandleCallback(w http.ResponseWriter, r *http.Request) {
+	provider, ok := oh.providers[chi.URLParam(r, "provider")]
+	if !ok {
+		apierror.Write(w, r, apierror.NotFound("unknown identity provider"))
+		return
+	}
+
+	query := r.URL.Query()
+	if errParam := query.Get("error"); errParam != "" {
+		logging.FromContext(r.Context()).Error("oidc provider returned error", "provider", provider.Name, "error", errParam, "description", query.Get("error_description"))
+		oh.metrics.Login(metrics.LoginOIDC, metrics.LoginFailure)
+		apierror.Write(w, r, apierror.Unauthorized("sign-in was not completed"))
+		return
+	}
+
+	code := query.Get("code")
+	state := query.Get("state")
+	if code == "" || state == "" {
+		apierror.Write(w, r, apierror.BadRequest("missing code or state"))
+		return
+	}
+
+	authReq, err := oh.identityStore.ConsumeAuthRequest(r.Context(), state)
+	if err != nil {
+		logging.FromContext(r.Context()).Error("consumeAuthRequest", "error", err)
+		apierror.Write(w, r, apierror.Internal("internal server error"))
+		return
+	}
+	if authReq == nil || authReq.Provider != provider.Name {
+		oh.metrics.Login(metrics.LoginOIDC, metrics.LoginFailure)
+		apierror.Write(w, r, apierror.Unauthorized("invalid or expired state"))
+		return
+	}
+
+	claims, err := provider.Exchange(r.Context(), code, authReq.CodeVerifier, authReq.Nonce)
+	if err != nil {
+		logging.FromContext(r.Context()).Error("oidc exchange", "error", err)
+		oh.metrics.Login(metrics.LoginOIDC, metrics.LoginFailure)
+		apierror.Write(w, r, apierror.Unauthorized("could not verify identity"))
+		return
+	}
+
+	user, err := oh.resolveUser(r, claims)
+	if err != nil {
+		oh.metrics.Login(metrics.LoginOIDC, metrics.LoginFailure)
+	}
+	switch {
+	case errors.Is(err, errIdentityNoEmail):
+		apierror.Write(w, r, apierror.Unprocessable("identity provider did not share an email address"))
+		return
+	case errors.Is(err, errIdentityEmailTaken):
+		apierror.Write(w, r, apierror.Conflict("an account with this email already exists, sign in with your password"))
+		return
+	case err != nil:
+		logging.FromContext(r.Context()).Error("resolving oidc user", "error", err)
+		apierror.Write(w, r, apierror.Internal("internal server error"))
+		return
+	}
+
+	if user.Suspended() {
+		oh.metrics.Login(metrics.LoginOIDC, metrics.LoginFailure)
+		auditLogin(r, oh.auditStore, store.AuditUserLoginFailed, user.ID, utils.Envelope{"method":"oidc", "provider":provider.Name, "reason":"suspended"})
+		apierror.Write(w, r, apierror.Forbidden("this account is suspended").WithCode(apierror.CodeAccountSuspended))
+		return
+	}
+
+	token, err := oh.tokenStore.CreateNewToken(r.Context(), user.ID, oh.tokenTTL)
+	if err != nil {
+		logging.FromContext(r.Context()).Error("Creating token", "error", err)
+		apierror.Write(w, r, apierror.Internal("internal server error"))
+		return
+	}
+
+	oh.metrics.Login(metrics.LoginOIDC, metrics.LoginSuccess)
+	auditLogin(r, oh.auditStore, store.AuditUserLogin, user.ID, utils.Envelope{"method":"oidc", "provider":provider.Name})
+
+	utils.WriteJSON(w, http.StatusCreated, utils.Envelope{"auth_token":token, "user":user})
+}
+
+// resolveUser finds the account linked to the external identity, links it to
+// an existing account with the same verified email, or provisions a new one.
+func (oh *OIDCHandler) resolveUser(r *http.Request, claims *oidc.Claims) (*store.User, error) {
+	user, err := oh.identityStore.GetUserByIdentity(r.Context(), claims.Issuer, claims.Subject)
+	if err != nil || user != nil {
+		return user, err
+	}
+
+	if claims.Email == "" {
+		return nil, errIdentityNoEmail
+	}
+
+	identity := &store.UserIdentity{
+		Issuer: claims.Issuer,
+		Subject: claims.Subject,
+		Email: &claims.Email,
+	}
+
+	existing, err := oh.userStore.GetUserByEmail(r.Context(), claims.Email)
+	if err != nil && !errors.Is(err, store.ErrNotFound) {
+		return nil, err
+	}
+	if existing != nil {
+		// only trust the provider's email when it says it verified it
+		if !claims.EmailVerified {
+			return nil, errIdentityEmailTaken
+		}
+		identity.UserID = existing.ID
+		return existing, oh.identityStore.LinkIdentity(r.Context(), identity)
+	}
+
+	user = &store.User{
+		Username: usernameFromClaims(claims),
+		Email: claims.Email,
+	}
+	if claims.Picture != "" {
+		user.AvatarURL = &claims.Picture
+	}
+
+	err = oh.identityStore.CreateUserWithIdentity(r.Context(), user, identity)
+	if err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// usernameFromClaims derives a username from the preferred username or the
+// email's local part. Names the validator would reject, such as reserved or
+// too short ones, get a "-user" suffix so provisioning never stores a
+// username a user could not have picked at sign up.
+func usernameFromClaims(claims *oidc.Claims) string {
+	base := claims.PreferredUsername
+	if base == "" {
+		base, _, _ = strings.Cut(claims.Email, "@")
+	}
+
+	var b strings.Builder
+	for _, c := range strings.ToLower(base) {
+		// usernames start with a letter or digit
+		if b.Len() == 0 && (c == '_' || c == '.' || c == '-') {
+			continue
+		}
+		if (c >= 'a' && c <= 'z') || (c >= '0' && c <= '9') || c == '_' || c == '.' || c == '-' {
+			b.WriteRune(c)
+		}
+		if b.Len() >= 40 {
+			break
+		}
+	}
+
+	username := b.String()
+	if validUsername(username) {
+		return username
+	}
+	if username != "" && validUsername(username+"-user") {
+		return username + "-user"
+	}
+	return "user"
+}
+
+func validUsername(username string) bool {
+	v := validate.Validator{}
+	v.Username("username", username)
+	return v.Valid()
+}
+
+func randomString() (string, error) {
+	b := make([]byte, 32)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
@@ -0,0 +1,419 @@
+package api
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Abhishek-B-R/chat-app-golang/internals/config"
+	"github.com/Abhishek-B-R/chat-app-golang/internals/metrics"
+	"github.com/Abhishek-B-R/chat-app-golang/internals/oidc"
+	"github.com/Abhishek-B-R/chat-app-golang/internals/store"
+	"github.com/Abhishek-B-R/chat-app-golang/internals/tokens"
+	"github.com/go-chi/chi"
+)
+
+// testIssuer is an OpenID provider serving discovery, its signing key and a
+// token endpoint that enforces PKCE. Codes are handed out by authorize
+// instead of a login page.
+type testIssuer struct {
+	*httptest.Server
+	key *rsa.PrivateKey
+
+	mu    sync.Mutex
+	codes map[string]issuedCode
+}
+
+type issuedCode struct {
+	challenge string
+	nonce     string
+	claims    map[string]any
+}
+
+func newTestIssuer(t *testing.T) *testIssuer {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	iss := &testIssuer{key: key, codes: map[string]issuedCode{}}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		writeTestJSON(w, http.StatusOK, map[string]any{
+			"issuer": iss.URL,
+			"authorization_endpoint": iss.URL + "/authorize",
+			"token_endpoint": iss.URL + "/token",
+			"jwks_uri": iss.URL + "/jwks",
+			"response_types_supported": []string{"code"},
+			"subject_types_supported": []string{"public"},
+			"id_token_signing_alg_values_supported": []string{"RS256"},
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		writeTestJSON(w, http.StatusOK, map[string]any{"keys": []map[string]any{{
+			"kty": "RSA",
+			"alg": "RS256",
+			"use": "sig",
+			"kid": "test",
+			"n": base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			"e": base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		}}})
+	})
+	mux.HandleFunc("/token", iss.handleToken)
+
+	iss.Server = httptest.NewServer(mux)
+	t.Cleanup(iss.Close)
+	return iss
+}
+
+// authorize plays the user signing in: it takes the URL the login handler
+// redirected to and returns a code for claims, bound to the PKCE challenge.
+func (iss *testIssuer) authorize(t *testing.T, location string, claims map[string]any) (code, state string) {
+	t.Helper()
+	u, err := url.Parse(location)
+	if err != nil {
+		t.Fatal(err)
+	}
+	q := u.Query()
+	if q.Get("code_challenge_method") != "S256" || q.Get("code_challenge") == "" {
+		t.Fatalf("login did not use PKCE: %s", location)
+	}
+
+	code = base64.RawURLEncoding.EncodeToString(big.NewInt(time.Now().UnixNano()).Bytes())
+	iss.mu.Lock()
+	iss.codes[code] = issuedCode{challenge: q.Get("code_challenge"), nonce: q.Get("nonce"), claims: claims}
+	iss.mu.Unlock()
+	return code, q.Get("state")
+}
+
+func (iss *testIssuer) handleToken(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	iss.mu.Lock()
+	issued, ok := iss.codes[r.PostForm.Get("code")]
+	delete(iss.codes, r.PostForm.Get("code"))
+	iss.mu.Unlock()
+
+	sum := sha256.Sum256([]byte(r.PostForm.Get("code_verifier")))
+	if !ok || base64.RawURLEncoding.EncodeToString(sum[:]) != issued.challenge {
+		writeTestJSON(w, http.StatusBadRequest, map[string]any{"error": "invalid_grant"})
+		return
+	}
+
+	claims := map[string]any{
+		"iss": iss.URL,
+		"aud": "chat-app",
+		"iat": time.Now().Unix(),
+		"exp": time.Now().Add(time.Hour).Unix(),
+		"nonce": issued.nonce,
+	}
+	for k, v := range issued.claims {
+		claims[k] = v
+	}
+
+	writeTestJSON(w, http.StatusOK, map[string]any{
+		"access_token": "access",
+		"token_type": "Bearer",
+		"expires_in": 3600,
+		"id_token": iss.sign(claims),
+	})
+}
+
+func (iss *testIssuer) sign(claims map[string]any) string {
+	header, _ := json.Marshal(map[string]any{"alg": "RS256", "kid": "test", "typ": "JWT"})
+	payload, _ := json.Marshal(claims)
+	signed := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+
+	digest := sha256.Sum256([]byte(signed))
+	sig, err := rsa.SignPKCS1v15(rand.Reader, iss.key, crypto.SHA256, digest[:])
+	if err != nil {
+		panic(err)
+	}
+	return signed + "." + base64.RawURLEncoding.EncodeToString(sig)
+}
+
+func writeTestJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+// memAccounts keeps users, linked identities and pending sign-ins in memory.
+type memAccounts struct {
+	store.UserStore
+	store.IdentityStore
+
+	mu         sync.Mutex
+	users      map[int64]*store.User
+	identities map[string]int64
+	requests   map[string]*store.OIDCAuthRequest
+}
+
+func newMemAccounts() *memAccounts {
+	return &memAccounts{
+		users: map[int64]*store.User{},
+		identities: map[string]int64{},
+		requests: map[string]*store.OIDCAuthRequest{},
+	}
+}
+
+func (m *memAccounts) addUser(user *store.User) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	user.ID = int64(len(m.users) + 1)
+	m.users[user.ID] = user
+}
+
+func (m *memAccounts) GetUserByEmail(ctx context.Context, email string) (*store.User, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, u := range m.users {
+		if u.Email == email {
+			return u, nil
+		}
+	}
+	return nil, store.ErrNotFound
+}
+
+func (m *memAccounts) GetUserByIdentity(ctx context.Context, issuer, subject string) (*store.User, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	id, ok := m.identities[issuer+" "+subject]
+	if !ok {
+		return nil, nil
+	}
+	return m.users[id], nil
+}
+
+func (m *memAccounts) LinkIdentity(ctx context.Context, identity *store.UserIdentity) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.identities[identity.Issuer+" "+identity.Subject] = identity.UserID
+	return nil
+}
+
+func (m *memAccounts) CreateUserWithIdentity(ctx context.Context, user *store.User, identity *store.UserIdentity) error {
+	m.addUser(user)
+	identity.UserID = user.ID
+	return m.LinkIdentity(ctx, identity)
+}
+
+func (m *memAccounts) SaveAuthRequest(ctx context.Context, req *store.OIDCAuthRequest) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.requests[req.State] = req
+	return nil
+}
+
+func (m *memAccounts) ConsumeAuthRequest(ctx context.Context, state string) (*store.OIDCAuthRequest, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	req := m.requests[state]
+	delete(m.requests, state)
+	return req, nil
+}
+
+type memTokens struct {
+	store.TokenStore
+}
+
+func (memTokens) CreateNewToken(ctx context.Context, userID int64, ttl time.Duration) (*tokens.Token, error) {
+	return &tokens.Token{UserID: userID, Plaintext: "token", ExpiresAt: time.Now().Add(ttl)}, nil
+}
+
+type memAudit struct {
+	store.AuditStore
+}
+
+func (memAudit) RecordAudit(ctx context.Context, entry *store.AuditEntry) error {
+	return nil
+}
+
+type oidcTest struct {
+	issuer   *testIssuer
+	accounts *memAccounts
+	router   chi.Router
+}
+
+func newOIDCTest(t *testing.T) *oidcTest {
+	t.Helper()
+	issuer := newTestIssuer(t)
+	provider, err := oidc.NewProvider(context.Background(), config.OIDCProvider{
+		Name: "test",
+		IssuerURL: issuer.URL,
+		ClientID: "chat-app",
+		ClientSecret: "secret",
+		RedirectURL: "http://localhost/auth/oidc/test/callback",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	accounts := newMemAccounts()
+	auth := config.AuthConfig{TokenTTL: time.Hour, OIDCStateTTL: time.Minute}
+	h := NewOIDCHandler([]*oidc.Provider{provider}, accounts, accounts, memTokens{}, memAudit{}, auth, metrics.Nop{})
+
+	r := chi.NewRouter()
+	r.Get("/auth/oidc/{provider}/login", h.HandleLogin)
+	r.Get("/auth/oidc/{provider}/callback", h.HandleCallback)
+	return &oidcTest{issuer: issuer, accounts: accounts, router: r}
+}
+
+// signIn runs the login redirect, the provider and the callback and returns
+// the callback's response.
+func (ot *oidcTest) signIn(t *testing.T, claims map[string]any) *httptest.ResponseRecorder {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	ot.router.ServeHTTP(rec, httptest.NewRequest("GET", "/auth/oidc/test/login", nil))
+	if rec.Code != http.StatusFound {
+		t.Fatalf("login: status %d: %s", rec.Code, rec.Body)
+	}
+
+	code, state := ot.issuer.authorize(t, rec.Header().Get("Location"), claims)
+	return ot.callback(code, state)
+}
+
+func (ot *oidcTest) callback(code, state string) *httptest.ResponseRecorder {
+	rec := httptest.NewRecorder()
+	target := "/auth/oidc/test/callback?" + url.Values{"code": {code}, "state": {state}}.Encode()
+	ot.router.ServeHTTP(rec, httptest.NewRequest("GET", target, nil))
+	return rec
+}
+
+func signedInUser(t *testing.T, rec *httptest.ResponseRecorder) *store.User {
+	t.Helper()
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("callback: status %d: %s", rec.Code, rec.Body)
+	}
+	var body struct {
+		AuthToken *tokens.Token `json:"auth_token"`
+		User      *store.User   `json:"user"`
+	}
+	err := json.Unmarshal(rec.Body.Bytes(), &body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if body.AuthToken == nil || body.AuthToken.Plaintext == "" {
+		t.Fatalf("callback returned no token: %s", rec.Body)
+	}
+	return body.User
+}
+
+func TestOIDCProvisionsNewUser(t *testing.T) {
+	ot := newOIDCTest(t)
+	claims := map[string]any{
+		"sub": "alice-sub",
+		"email": "alice@example.com",
+		"email_verified": true,
+		"preferred_username": "Alice",
+		"picture": "https://example.com/alice.png",
+	}
+
+	user := signedInUser(t, ot.signIn(t, claims))
+	if user.Username != "alice" || user.Email != "alice@example.com" {
+		t.Errorf("provisioned %q <%s>, want alice <alice@example.com>", user.Username, user.Email)
+	}
+	if user.AvatarURL == nil || *user.AvatarURL != "https://example.com/alice.png" {
+		t.Errorf("avatar = %v, want the picture claim", user.AvatarURL)
+	}
+
+	// the next sign-in finds the linked identity instead of provisioning
+	again := signedInUser(t, ot.signIn(t, claims))
+	if again.ID != user.ID || len(ot.accounts.users) != 1 {
+		t.Errorf("second sign-in returned user %d with %d users, want user %d only", again.ID, len(ot.accounts.users), user.ID)
+	}
+}
+
+func TestOIDCLinksVerifiedEmail(t *testing.T) {
+	ot := newOIDCTest(t)
+	existing := &store.User{Username: "bob", Email: "bob@example.com"}
+	ot.accounts.addUser(existing)
+
+	rec := ot.signIn(t, map[string]any{"sub": "bob-sub", "email": "bob@example.com", "email_verified": false})
+	if rec.Code != http.StatusConflict {
+		t.Fatalf("unverified email: status %d, want %d: %s", rec.Code, http.StatusConflict, rec.Body)
+	}
+	if len(ot.accounts.identities) != 0 {
+		t.Fatal("unverified email was linked")
+	}
+
+	user := signedInUser(t, ot.signIn(t, map[string]any{"sub": "bob-sub", "email": "bob@example.com", "email_verified": true}))
+	if user.ID != existing.ID || len(ot.accounts.users) != 1 {
+		t.Errorf("signed in as user %d with %d users, want existing user %d", user.ID, len(ot.accounts.users), existing.ID)
+	}
+}
+
+func TestOIDCRequiresEmail(t *testing.T) {
+	ot := newOIDCTest(t)
+	rec := ot.signIn(t, map[string]any{"sub": "anon"})
+	if rec.Code != http.StatusUnprocessableEntity {
+		t.Errorf("status %d, want %d: %s", rec.Code, http.StatusUnprocessableEntity, rec.Body)
+	}
+}
+
+func TestOIDCCallbackChecksPKCEAndState(t *testing.T) {
+	ot := newOIDCTest(t)
+	claims := map[string]any{"sub": "carol-sub", "email": "carol@example.com", "email_verified": true}
+
+	rec := httptest.NewRecorder()
+	ot.router.ServeHTTP(rec, httptest.NewRequest("GET", "/auth/oidc/test/login", nil))
+	code, state := ot.issuer.authorize(t, rec.Header().Get("Location"), claims)
+
+	// a verifier that does not match the challenge is refused by the issuer
+	ot.accounts.requests[state].CodeVerifier = "not-the-verifier-used-for-the-challenge-0123"
+	rec = ot.callback(code, state)
+	if rec.Code != http.StatusUnauthorized {
+		t.Fatalf("wrong verifier: status %d, want %d: %s", rec.Code, http.StatusUnauthorized, rec.Body)
+	}
+
+	// and the state was consumed, so it cannot be replayed
+	rec = ot.callback(code, state)
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("replayed state: status %d, want %d: %s", rec.Code, http.StatusUnauthorized, rec.Body)
+	}
+	if len(ot.accounts.users) != 0 {
+		t.Errorf("failed sign-ins provisioned %d users", len(ot.accounts.users))
+	}
+}
+
+func TestUsernameFromClaims(t *testing.T) {
+	tests := []struct {
+		claims oidc.Claims
+		want   string
+	}{
+		{oidc.Claims{PreferredUsername: "Alice.Smith"}, "alice.smith"},
+		{oidc.Claims{Email: "bob+chat@example.com"}, "bobchat"},
+		{oidc.Claims{PreferredUsername: "admin"}, "admin-user"},
+		{oidc.Claims{PreferredUsername: "jo"}, "jo-user"},
+		{oidc.Claims{PreferredUsername: "-.dash"}, "dash"},
+		{oidc.Claims{PreferredUsername: "._"}, "user"},
+		{oidc.Claims{PreferredUsername: "Ünïcode"}, "ncode"},
+		{oidc.Claims{}, "user"},
+	}
+
+	for _, tt := range tests {
+		got := usernameFromClaims(&tt.claims)
+		if got != tt.want {
+			t.Errorf("usernameFromClaims(%+v) = %q, want %q", tt.claims, got, tt.want)
+		}
+		if !validUsername(got) {
+			t.Errorf("usernameFromClaims(%+v) = %q, which is not a valid username", tt.claims, got)
+		}
+	}
+}
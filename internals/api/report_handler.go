@@ -0,0 +1,365 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/Abhishek-B-R/chat-app-golang/internals/apierror"
+	"github.com/Abhishek-B-R/chat-app-golang/internals/logging"
+	"github.com/Abhishek-B-R/chat-app-golang/internals/middleware"
+	"github.com/Abhishek-B-R/chat-app-golang/internals/store"
+	"github.com/Abhishek-B-R/chat-app-golang/internals/utils"
+	"github.com/Abhishek-B-R/chat-app-golang/internals/validate"
+	"github.com/Abhishek-B-R/chat-app-golang/internals/webhooks"
+)
+
+// Moderator actions a platform admin can take when resolving a report.
+const (
+	ActionDeleteMessage  = "delete_message"
+	ActionSuspendUser    = "suspend_user"
+	ActionRemoveFromChat = "remove_from_chat"
+)
+
+const maxReportDetailsLength = 1000
+
+type createReportRequest struct {
+	Reason store.ReportReason `json:"reason"`
+	Details string `json:"details"`
+}
+
+type resolveReportRequest struct {
+	Status store.ReportStatus `json:"status"`
+	Actions []string `json:"actions"`
+	Note string `json:"note"`
+}
+
+type ReportHandler struct {
+	reportStore store.ReportStore
+	messageStore store.MessageStore
+	userStore store.UserStore
+	chatMemberStore store.ChatMemberStore
+	tokenStore store.TokenStore
+	auditStore store.AuditStore
+	webhooks *webhooks.Publisher
+}
+
+func NewReportHandler(reportStore store.ReportStore, messageStore store.MessageStore, userStore store.UserStore, chatMemberStore store.ChatMemberStore, tokenStore store.TokenStore, auditStore store.AuditStore, publisher *webhooks.Publisher) *ReportHandler {
+	return &ReportHandler{
+		reportStore: reportStore,
+		messageStore: messageStore,
+		userStore: userStore,
+		chatMemberStore: chatMemberStore,
+		tokenStore: tokenStore,
+		auditStore: auditStore,
+		webhooks: publisher,
+	}
+}
+
+// HandleReportMessage reports the message loaded by RequireAccess, keeping a
+// copy of it so the evidence survives edits and deletes.
+func (rh *ReportHandler) HandleReportMessage(w http.ResponseWriter, r *http.Request) {
+	authenticatedUser, ok := middleware.GetUser(r)
+	if !ok {
+		apierror.Write(w, r, apierror.Unauthorized("authentication required"))
+		return
+	}
+	msg := middleware.GetMessageMembership(r)
+
+	req, ok := decodeReport(w, r)
+	if !ok {
+		return
+	}
+
+	if msg.SenderID != nil && *msg.SenderID == authenticatedUser.ID {
+		apierror.Write(w, r, apierror.Unprocessable("you can't report your own message"))
+		return
+	}
+
+	snapshot, err := json.Marshal(msg)
+	if err != nil {
+		logging.FromContext(r.Context()).Error("snapshotting reported message", "error", err)
+		apierror.Write(w, r, apierror.Internal("internal server error"))
+		return
+	}
+
+	report := &store.Report{
+		Kind: store.ReportKindMessage,
+		ReporterID: &authenticatedUser.ID,
+		ReportedUserID: msg.SenderID,
+		MessageID: &msg.ID,
+		ChatID: &msg.ChatID,
+		Reason: req.Reason,
+		MessageSnapshot: snapshot,
+	}
+	if req.Details != "" {
+		report.Details = &req.Details
+	}
+
+	rh.createReport(w, r, report, "you already reported this message")
+}
+
+func (rh *ReportHandler) HandleReportUser(w http.ResponseWriter, r *http.Request) {
+	authenticatedUser, ok := middleware.GetUser(r)
+	if !ok {
+		apierror.Write(w, r, apierror.Unauthorized("authentication required"))
+		return
+	}
+
+	userID, err := utils.ReadParam(r, "userID")
+	if err != nil {
+		apierror.Write(w, r, apierror.BadRequest("invalid user id"))
+		return
+	}
+
+	req, ok := decodeReport(w, r)
+	if !ok {
+		return
+	}
+
+	if userID == authenticatedUser.ID {
+		apierror.Write(w, r, apierror.Unprocessable("you can't report yourself"))
+		return
+	}
+
+	report := &store.Report{
+		Kind: store.ReportKindUser,
+		ReporterID: &authenticatedUser.ID,
+		ReportedUserID: &userID,
+		Reason: req.Reason,
+	}
+	if req.Details != "" {
+		report.Details = &req.Details
+	}
+
+	rh.createReport(w, r, report, "you already reported this user")
+}
+
+func decodeReport(w http.ResponseWriter, r *http.Request) (*createReportRequest, bool) {
+	var req createReportRequest
+	err := validate.DecodeJSON(r, &req)
+	if err != nil {
+		apierror.Write(w, r, err)
+		return nil, false
+	}
+
+	req.Details = strings.TrimSpace(req.Details)
+	reasons := make([]string, len(store.ReportReasons))
+	for i, reason := range store.ReportReasons {
+		reasons[i] = string(reason)
+	}
+
+	var v validate.Validator
+	v.Check(store.ValidReportReason(req.Reason), "reason", "must be one of: " + strings.Join(reasons, ", "))
+	v.Check(utf8.RuneCountInString(req.Details) <= maxReportDetailsLength, "details", "cannot be longer than 1000 characters")
+	if err := v.Err(); err != nil {
+		apierror.Write(w, r, err)
+		return nil, false
+	}
+	return &req, true
+}
+
+func (rh *ReportHandler) createReport(w http.ResponseWriter, r *http.Request, report *store.Report, duplicate string) {
+	err := rh.reportStore.CreateReport(r.Context(), report)
+	if errors.Is(err, store.ErrConflict) {
+		apierror.Write(w, r, apierror.Conflict(duplicate))
+		return
+	}
+	if errors.Is(err, store.ErrNotFound) {
+		apierror.Write(w, r, apierror.NotFound("user not found"))
+		return
+	}
+	if err != nil {
+		logging.FromContext(r.Context()).Error("createReport", "error", err)
+		apierror.Write(w, r, apierror.Internal("failed to create report"))
+		return
+	}
+
+	// reporters only learn that the report was received, not what it holds
+	utils.WriteJSON(w, http.StatusCreated, utils.Envelope{"report":utils.Envelope{"id":report.ID, "status":report.Status, "created_at":report.CreatedAt}})
+}
+
+// HandleGetReports is the moderation queue, ?status=open by default.
+func (rh *ReportHandler) HandleGetReports(w http.ResponseWriter, r *http.Request) {
+	status := store.ReportStatus(r.URL.Query().Get("status"))
+	if status == "" {
+		status = store.ReportOpen
+	}
+	if status != store.ReportOpen && status != store.ReportActioned && status != store.ReportDismissed {
+		apierror.Write(w, r, apierror.BadRequest("status must be open, actioned or dismissed"))
+		return
+	}
+
+	limit, offset := readPage(r)
+
+	reports, err := rh.reportStore.GetReports(r.Context(), status, limit, offset)
+	if err != nil {
+		logging.FromContext(r.Context()).Error("getReports", "error", err)
+		apierror.Write(w, r, apierror.Internal("failed to get reports"))
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"reports":reports})
+}
+
+func (rh *ReportHandler) HandleGetReport(w http.ResponseWriter, r *http.Request) {
+	reportID, err := utils.ReadParam(r, "reportID")
+	if err != nil {
+		apierror.Write(w, r, apierror.BadRequest("invalid report id"))
+		return
+	}
+
+	report, err := rh.reportStore.GetReport(r.Context(), reportID)
+	if err != nil {
+		apierror.Write(w, r, apierror.FromStore(err, "report"))
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"report":report})
+}
+
+// HandleResolveReport closes a report as dismissed, or as actioned after
+// carrying out the requested moderator actions. Actions are idempotent, so
+// a failure part way can be retried.
+func (rh *ReportHandler) HandleResolveReport(w http.ResponseWriter, r *http.Request) {
+	moderator, ok := middleware.GetUser(r)
+	if !ok {
+		apierror.Write(w, r, apierror.Unauthorized("authentication required"))
+		return
+	}
+
+	reportID, err := utils.ReadParam(r, "reportID")
+	if err != nil {
+		apierror.Write(w, r, apierror.BadRequest("invalid report id"))
+		return
+	}
+
+	var req resolveReportRequest
+	err = validate.DecodeJSON(r, &req)
+	if err != nil {
+		apierror.Write(w, r, err)
+		return
+	}
+
+	report, err := rh.reportStore.GetReport(r.Context(), reportID)
+	if err != nil {
+		apierror.Write(w, r, apierror.FromStore(err, "report"))
+		return
+	}
+	if report.Status != store.ReportOpen {
+		apierror.Write(w, r, apierror.Conflict("report is already " + string(report.Status)))
+		return
+	}
+
+	var v validate.Validator
+	v.Check(req.Status == store.ReportActioned || req.Status == store.ReportDismissed, "status", "must be actioned or dismissed")
+	v.Check(req.Status != store.ReportActioned || len(req.Actions) > 0, "actions", "at least one action is required to action a report")
+	v.Check(req.Status != store.ReportDismissed || len(req.Actions) == 0, "actions", "a dismissed report takes no actions")
+	for _, action := range req.Actions {
+		switch action {
+		case ActionDeleteMessage:
+			v.Check(report.MessageID != nil, "actions", "delete_message needs a message report")
+		case ActionSuspendUser:
+			v.Check(report.ReportedUserID != nil, "actions", "suspend_user needs a reported user")
+		case ActionRemoveFromChat:
+			v.Check(report.ChatID != nil && report.ReportedUserID != nil, "actions", "remove_from_chat needs a message report from a user")
+		default:
+			v.Check(false, "actions", "unknown action " + action + ", expected one of: delete_message, suspend_user, remove_from_chat")
+		}
+	}
+	if err := v.Err(); err != nil {
+		apierror.Write(w, r, err)
+		return
+	}
+
+	for _, action := range req.Actions {
+		if !rh.runAction(w, r, action, report, moderator) {
+			return
+		}
+	}
+
+	report.Status = req.Status
+	report.Actions = req.Actions
+	report.ResolvedBy = &moderator.ID
+	if note := strings.TrimSpace(req.Note); note != "" {
+		report.ResolutionNote = &note
+	}
+
+	err = rh.reportStore.ResolveReport(r.Context(), report)
+	if errors.Is(err, store.ErrConflict) {
+		apierror.Write(w, r, apierror.Conflict("report was resolved by someone else"))
+		return
+	}
+	if err != nil {
+		logging.FromContext(r.Context()).Error("resolveReport", "error", err)
+		apierror.Write(w, r, apierror.Internal("failed to resolve report"))
+		return
+	}
+
+	entry := auditEntry(store.AuditReportResolved, store.AuditTargetReport, report.ID)
+	entry.ChatID = report.ChatID
+	entry.Before = auditValue(utils.Envelope{"status":store.ReportOpen})
+	entry.After = auditValue(utils.Envelope{"status":report.Status, "actions":report.Actions, "resolution_note":report.ResolutionNote})
+	audit(r, rh.auditStore, entry)
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"report":report})
+}
+
+// runAction carries out one moderator action. It writes the error response
+// itself when it returns false.
+func (rh *ReportHandler) runAction(w http.ResponseWriter, r *http.Request, action string, report *store.Report, moderator *store.User) bool {
+	var err error
+	switch action {
+	case ActionDeleteMessage:
+		err = rh.messageStore.DeleteMessage(r.Context(), *report.MessageID)
+		if err == nil && report.ChatID != nil {
+			rh.webhooks.Publish(r.Context(), *report.ChatID, webhooks.EventMessageDeleted, utils.Envelope{"id":*report.MessageID})
+		}
+
+	case ActionSuspendUser:
+		var user *store.User
+		user, err = rh.userStore.GetUserByID(r.Context(), *report.ReportedUserID)
+		if err == nil && user.IsAdmin {
+			apierror.Write(w, r, apierror.Forbidden("platform administrators can't be suspended"))
+			return false
+		}
+		if err == nil {
+			err = rh.userStore.SuspendUser(r.Context(), user.ID)
+		}
+		if err == nil {
+			// sessions stop working right away; API keys are refused by Authenticate
+			err = rh.tokenStore.DeleteAllTokensForUser(r.Context(), user.ID)
+		}
+
+	case ActionRemoveFromChat:
+		// the same handoff as leaving, so taking out the owner doesn't leave
+		// the chat without one
+		var res *store.LeaveResult
+		res, err = rh.chatMemberStore.LeaveChat(r.Context(), *report.ChatID, *report.ReportedUserID, systemEvent(store.SystemMemberRemoved, moderator.ID, *report.ReportedUserID))
+		if errors.Is(err, store.ErrNotFound) {
+			// already gone
+			err = nil
+		} else if err == nil && !res.ChatDeleted {
+			rh.webhooks.Publish(r.Context(), *report.ChatID, webhooks.EventMemberRemoved, utils.Envelope{"user_id":*report.ReportedUserID})
+			if res.NewOwnerID != nil {
+				rh.webhooks.Publish(r.Context(), *report.ChatID, webhooks.EventMemberUpdated, utils.Envelope{"user_id":*res.NewOwnerID, "role":store.OWNER})
+			}
+			for _, msg := range res.Messages {
+				publishSystemMessage(r, rh.webhooks, msg)
+			}
+		}
+	}
+
+	if errors.Is(err, store.ErrNotFound) {
+		apierror.Write(w, r, apierror.NotFound(action + ": the reported user or message no longer exists"))
+		return false
+	}
+	if err != nil {
+		logging.FromContext(r.Context()).Error("moderator action failed", "action", action, "report_id", report.ID, "moderator_id", moderator.ID, "error", err)
+		apierror.Write(w, r, apierror.Internal("failed to " + strings.ReplaceAll(action, "_", " ")))
+		return false
+	}
+	return true
+}
@@ -0,0 +1,85 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/Abhishek-B-R/chat-app-golang/internals/middleware"
+	"github.com/Abhishek-B-R/chat-app-golang/internals/store"
+	"github.com/Abhishek-B-R/chat-app-golang/internals/webhooks"
+	"github.com/go-chi/chi"
+)
+
+type memReports struct {
+	store.ReportStore
+	report *store.Report
+}
+
+func (m memReports) GetReport(ctx context.Context, reportID int64) (*store.Report, error) {
+	return m.report, nil
+}
+
+func (m memReports) ResolveReport(ctx context.Context, report *store.Report) error {
+	return nil
+}
+
+// handoffChat leaves a chat like the Postgres store does: with no owner
+// left, the first admin takes over. RemoveMember is not implemented, so a
+// moderator can't take anyone out around the handoff.
+type handoffChat struct {
+	store.ChatMemberStore
+	roles map[int64]store.ChatGroupRole
+	event *store.SystemEvent
+}
+
+func (m *handoffChat) LeaveChat(ctx context.Context, chatID, userID int64, event *store.SystemEvent) (*store.LeaveResult, error) {
+	role, ok := m.roles[userID]
+	if !ok {
+		return nil, store.ErrNotFound
+	}
+	delete(m.roles, userID)
+	m.event = event
+
+	res := &store.LeaveResult{Role: role}
+	if role == store.OWNER {
+		for id, r := range m.roles {
+			if r == store.ADMIN {
+				m.roles[id] = store.OWNER
+				res.NewOwnerID = &id
+				res.NewOwnerPreviousRole = r
+				break
+			}
+		}
+	}
+	return res, nil
+}
+
+func TestModeratorRemovingTheOwnerHandsOwnershipOn(t *testing.T) {
+	chatID, ownerID := int64(7), int64(1)
+	members := &handoffChat{roles: map[int64]store.ChatGroupRole{ownerID: store.OWNER, 2: store.ADMIN, 3: store.MEMBER}}
+	reports := memReports{report: &store.Report{ID: 5, Kind: store.ReportKindMessage, ReportedUserID: &ownerID, MessageID: new(int64), ChatID: &chatID, Status: store.ReportOpen}}
+	h := NewReportHandler(reports, nil, nil, members, nil, memAudit{}, webhooks.NewPublisher(nopQueue{}))
+
+	r := chi.NewRouter()
+	r.Post("/moderation/reports/{reportID}/resolve", h.HandleResolveReport)
+	req := httptest.NewRequest("POST", "/moderation/reports/5/resolve", strings.NewReader(`{"status":"actioned","actions":["remove_from_chat"]}`))
+	req = middleware.SetUser(req, &store.User{ID: 100, Username: "moderator", IsAdmin: true})
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", rec.Code, rec.Body)
+	}
+	if _, ok := members.roles[ownerID]; ok {
+		t.Error("owner is still in the chat")
+	}
+	if members.roles[2] != store.OWNER {
+		t.Errorf("chat has no owner left: %v", members.roles)
+	}
+	if members.event == nil || members.event.Kind != store.SystemMemberRemoved || *members.event.ActorID != 100 {
+		t.Errorf("system event %+v, want member.removed by the moderator", members.event)
+	}
+}
@@ -0,0 +1,97 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Abhishek-B-R/chat-app-golang/internals/commands"
+	"github.com/Abhishek-B-R/chat-app-golang/internals/config"
+	"github.com/Abhishek-B-R/chat-app-golang/internals/metrics"
+	"github.com/Abhishek-B-R/chat-app-golang/internals/middleware"
+	"github.com/Abhishek-B-R/chat-app-golang/internals/store"
+	"github.com/Abhishek-B-R/chat-app-golang/internals/webhooks"
+	"github.com/go-chi/chi"
+)
+
+// slowChat is a member's posting state in a chat with a minute of slow mode.
+type slowChat struct {
+	store.ChatMemberStore
+	lastPostedAt *time.Time
+}
+
+func (m slowChat) GetPostingState(ctx context.Context, chatID, userID int64) (*store.PostingState, error) {
+	return &store.PostingState{Role: store.MEMBER, Settings: store.ChatSettings{SlowModeSeconds: 60}, LastPostedAt: m.lastPostedAt, Now: time.Now()}, nil
+}
+
+// slowMessages records the interval messages are posted with and refuses
+// them when told to, like a concurrent post would make the store do.
+type slowMessages struct {
+	memMessages
+	refuse bool
+	minInterval time.Duration
+}
+
+func (m *slowMessages) PostMessage(ctx context.Context, msg *store.Message, minInterval time.Duration) error {
+	m.minInterval = minInterval
+	if m.refuse {
+		return store.ErrSlowMode
+	}
+	return m.CreateMessage(ctx, msg)
+}
+
+func postInSlowChat(t *testing.T, members slowChat, messages *slowMessages, content string) *httptest.ResponseRecorder {
+	t.Helper()
+	registry := commands.NewRegistry(nil, config.Default().Commands)
+	h := NewMessageHandler(messages, members, memFilters{}, nil, webhooks.NewPublisher(nopQueue{}), registry, config.Default().Limits, metrics.Nop{})
+
+	r := chi.NewRouter()
+	r.Post("/chats/{chatID}/messages", h.HandleCreateMessage)
+	body, _ := json.Marshal(map[string]string{"content": content})
+	req := httptest.NewRequest("POST", "/chats/7/messages", strings.NewReader(string(body)))
+	req = middleware.SetUser(req, &store.User{ID: 3, Username: "alice"})
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestSlowModeIsRecordedWithTheMessage(t *testing.T) {
+	messages := &slowMessages{}
+	rec := postInSlowChat(t, slowChat{}, messages, "hello")
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("first post: status %d: %s", rec.Code, rec.Body)
+	}
+	if messages.minInterval != time.Minute {
+		t.Errorf("posted with interval %s, want the chat's slow mode", messages.minInterval)
+	}
+
+	// an ephemeral response posts nothing, so it doesn't count for slow mode
+	messages = &slowMessages{}
+	rec = postInSlowChat(t, slowChat{}, messages, "/poll")
+	if rec.Code != http.StatusOK || messages.minInterval != 0 || len(messages.created) != 0 {
+		t.Errorf("/poll usage: status %d, posted with interval %s", rec.Code, messages.minInterval)
+	}
+}
+
+func TestSlowModeRefusesEarlyPosts(t *testing.T) {
+	lastPost := time.Now().Add(-10 * time.Second)
+	messages := &slowMessages{}
+	rec := postInSlowChat(t, slowChat{lastPostedAt: &lastPost}, messages, "/roll")
+	if rec.Code != http.StatusTooManyRequests || !strings.Contains(rec.Body.String(), "slow_mode") {
+		t.Errorf("post 10s after the last one: status %d: %s", rec.Code, rec.Body)
+	}
+	if len(messages.created) != 0 {
+		t.Error("message was stored during slow mode")
+	}
+
+	// the store has the final say when two posts race past the check
+	messages = &slowMessages{refuse: true}
+	rec = postInSlowChat(t, slowChat{}, messages, "hello")
+	if rec.Code != http.StatusTooManyRequests || !strings.Contains(rec.Body.String(), "slow_mode") {
+		t.Errorf("post refused by the store: status %d: %s", rec.Code, rec.Body)
+	}
+}
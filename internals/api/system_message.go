@@ -0,0 +1,28 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/Abhishek-B-R/chat-app-golang/internals/store"
+	"github.com/Abhishek-B-R/chat-app-golang/internals/webhooks"
+)
+
+// systemEvent is the payload of the system message reporting that actorID
+// did kind to targetID.
+func systemEvent(kind store.SystemEventKind, actorID, targetID int64) *store.SystemEvent {
+	return &store.SystemEvent{
+		Kind: kind,
+		ActorID: &actorID,
+		TargetID: &targetID,
+	}
+}
+
+// publishSystemMessage delivers a system message the store posted along with
+// a change to the chat's webhook subscribers, like any other new message.
+// msg may be nil when no system message was posted.
+func publishSystemMessage(r *http.Request, publisher *webhooks.Publisher, msg *store.Message) {
+	if msg == nil {
+		return
+	}
+	publisher.Publish(r.Context(), msg.ChatID, webhooks.EventMessageCreated, msg)
+}
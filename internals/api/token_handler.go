@@ -1,68 +1,101 @@
 package api
 
 import (
-	"encoding/json"
-	"fmt"
-	"log"
+	"errors"
 	"net/http"
+	"strings"
 	"time"
 
+	"github.com/Abhishek-B-R/chat-app-golang/internals/apierror"
+	"github.com/Abhishek-B-R/chat-app-golang/internals/config"
+	"github.com/Abhishek-B-R/chat-app-golang/internals/logging"
+	"github.com/Abhishek-B-R/chat-app-golang/internals/metrics"
 	"github.com/Abhishek-B-R/chat-app-golang/internals/store"
 	"github.com/Abhishek-B-R/chat-app-golang/internals/utils"
+	"github.com/Abhishek-B-R/chat-app-golang/internals/validate"
 )
 
 type TokenHandler struct{
 	tokenStore store.TokenStore
 	userStore store.UserStore
-	logger *log.Logger
+	auditStore store.AuditStore
+	tokenTTL time.Duration
+	metrics metrics.Recorder
 }
 
 type createTokenRequest struct{
 	UserName string `json:"username"`
+	Email string `json:"email"`
 	Password string `json:"password"`
 }
 
-func NewTokenHandler(tokenStore store.TokenStore, userStore store.UserStore, logger *log.Logger) *TokenHandler{
-	return &TokenHandler{tokenStore: tokenStore, userStore: userStore, logger: logger}
+func NewTokenHandler(tokenStore store.TokenStore, userStore store.UserStore, auditStore store.AuditStore, auth config.AuthConfig, recorder metrics.Recorder) *TokenHandler{
+	return &TokenHandler{tokenStore: tokenStore, userStore: userStore, auditStore: auditStore, tokenTTL: auth.TokenTTL, metrics: recorder}
 }
 
 func (th *TokenHandler) HandleCreateToken(w http.ResponseWriter, r *http.Request){
 	defer r.Body.Close()
 	var req createTokenRequest
-	err := json.NewDecoder(r.Body).Decode(&req)
-
+	err := validate.DecodeJSON(r, &req)
 	if err != nil {
-		th.logger.Printf("ERROR: createTokenRequest: %v", err)
-		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error":"invalid request payload"})
+		apierror.Write(w, r, err)
 		return
 	}
 
-	user, err := th.userStore.GetUserByUsername(r.Context(), req.UserName)
-	if err != nil || user == nil {
-		th.logger.Printf("ERROR: GetUserByUsername: %v", err)
-		utils.WriteJSON(w, http.StatusUnauthorized, utils.Envelope{"error":"internal server error"})
+	// the username field also accepts an email so clients can keep a single login input
+	var user *store.User
+	if req.Email != "" || strings.Contains(req.UserName, "@") {
+		email := req.Email
+		if email == "" {
+			email = req.UserName
+		}
+		user, err = th.userStore.GetUserByEmail(r.Context(), strings.TrimSpace(email))
+	} else {
+		user, err = th.userStore.GetUserByUsername(r.Context(), req.UserName)
+	}
+	if err != nil && !errors.Is(err, store.ErrNotFound) {
+		logging.FromContext(r.Context()).Error("looking up login user", "error", err)
+		apierror.Write(w, r, apierror.Internal("internal server error"))
+		return
+	}
+	if user == nil {
+		th.metrics.Login(metrics.LoginPassword, metrics.LoginFailure)
+		apierror.Write(w, r, apierror.Unauthorized("invalid credentials").WithCode(apierror.CodeInvalidCredentials))
 		return
 	}
 
 	passwordsDoMatch, err := user.PasswordHash.Matches(req.Password)
 	if err != nil {
-		th.logger.Printf("ERROR: PasswordHash.Matches %v",err)
-		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error":"internal server error"})
+		logging.FromContext(r.Context()).Error("PasswordHash.Matches", "error", err)
+		apierror.Write(w, r, apierror.Internal("internal server error"))
 		return
 	}
 
 	if !passwordsDoMatch {
-		fmt.Println()
-		utils.WriteJSON(w, http.StatusUnauthorized, utils.Envelope{"error":"invalid credentials"})
+		th.metrics.Login(metrics.LoginPassword, metrics.LoginFailure)
+		logging.FromContext(r.Context()).Info("login failed", "user_id", user.ID, "reason", "invalid password")
+		auditLogin(r, th.auditStore, store.AuditUserLoginFailed, user.ID, utils.Envelope{"method":"password", "reason":"invalid password"})
+		apierror.Write(w, r, apierror.Unauthorized("invalid credentials").WithCode(apierror.CodeInvalidCredentials))
 		return
 	}
 
-	token, err := th.tokenStore.CreateNewToken(r.Context(), user.ID, 24*time.Hour)
+	if user.Suspended() {
+		th.metrics.Login(metrics.LoginPassword, metrics.LoginFailure)
+		logging.FromContext(r.Context()).Info("login failed", "user_id", user.ID, "reason", "suspended")
+		auditLogin(r, th.auditStore, store.AuditUserLoginFailed, user.ID, utils.Envelope{"method":"password", "reason":"suspended"})
+		apierror.Write(w, r, apierror.Forbidden("this account is suspended").WithCode(apierror.CodeAccountSuspended))
+		return
+	}
+
+	token, err := th.tokenStore.CreateNewToken(r.Context(), user.ID, th.tokenTTL)
 	if err != nil {
-		th.logger.Printf("ERROR: Creating token %v",err)
-		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error":"internal server error"})
+		logging.FromContext(r.Context()).Error("Creating token", "error", err)
+		apierror.Write(w, r, apierror.Internal("internal server error"))
 		return
 	}
 
+	th.metrics.Login(metrics.LoginPassword, metrics.LoginSuccess)
+	auditLogin(r, th.auditStore, store.AuditUserLogin, user.ID, utils.Envelope{"method":"password"})
+
 	utils.WriteJSON(w, http.StatusCreated, utils.Envelope{"auth_token":token})
 }
\ No newline at end of file
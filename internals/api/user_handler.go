@@ -1,16 +1,17 @@
 package api
 
 import (
-	"encoding/json"
 	"errors"
-	"log"
 	"net/http"
-	"regexp"
 	"strings"
 
+	"github.com/Abhishek-B-R/chat-app-golang/internals/apierror"
+	"github.com/Abhishek-B-R/chat-app-golang/internals/config"
+	"github.com/Abhishek-B-R/chat-app-golang/internals/logging"
 	"github.com/Abhishek-B-R/chat-app-golang/internals/middleware"
 	"github.com/Abhishek-B-R/chat-app-golang/internals/store"
 	"github.com/Abhishek-B-R/chat-app-golang/internals/utils"
+	"github.com/Abhishek-B-R/chat-app-golang/internals/validate"
 	"github.com/go-chi/chi"
 )
 
@@ -24,48 +25,37 @@ type registeredUserRequest struct{
 
 type UserHandler struct {
 	userStore store.UserStore
-	logger *log.Logger
+	blockStore store.BlockStore
+	auditStore store.AuditStore
+	bcryptCost int
 }
 
-func NewUserHandler(userStore store.UserStore, logger *log.Logger) *UserHandler {
+func NewUserHandler(userStore store.UserStore, blockStore store.BlockStore, auditStore store.AuditStore, auth config.AuthConfig) *UserHandler {
 	return &UserHandler{
 		userStore: userStore,
-		logger: logger,
+		blockStore: blockStore,
+		auditStore: auditStore,
+		bcryptCost: auth.BcryptCost,
 	}
 }
 
 func (uh *UserHandler) HandleCreateUser(w http.ResponseWriter, r *http.Request) {
 	var req registeredUserRequest
-	err := json.NewDecoder(r.Body).Decode(&req)
+	err := validate.DecodeJSON(r, &req)
 	if err != nil {
-		uh.logger.Printf("ERROR: decodingCreateUser: %v\n", err)
-		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error":"invalid request sent"})
+		apierror.Write(w, r, err)
 		return
 	}
 
-	if req.Username == "" {
-		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "username cannot be empty"})
-		return
-	}
-
-	if len(req.Username) > 50 {
-		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "username too long"})
-		return
-	}
-	
 	//lowercase the username
 	req.Username = strings.ToLower(req.Username)
 
-	err = utils.ValidateEmail(req.Email)
-	if err != nil {
-		uh.logger.Printf("ERROR: invalid email: %v",err)
-		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error":"invalid email data"})
-		return
-	}
-
-	err = uh.validateRegisterRequest(&req)
-	if err != nil {
-		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+	var v validate.Validator
+	v.Username("username", req.Username)
+	v.Email("email", req.Email)
+	v.Password("password", req.Password)
+	if err := v.Err(); err != nil {
+		apierror.Write(w, r, err)
 		return
 	}
 
@@ -81,17 +71,21 @@ func (uh *UserHandler) HandleCreateUser(w http.ResponseWriter, r *http.Request)
 		user.AvatarURL = &req.AvatarURL
 	}
 
-	err = user.PasswordHash.Set(req.Password)
+	err = user.PasswordHash.Set(req.Password, uh.bcryptCost)
 	if err != nil {
-		uh.logger.Printf("ERROR: hashing password: %v\n",err)
-		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error":"internal server error"})
+		logging.FromContext(r.Context()).Error("hashing password", "error", err)
+		apierror.Write(w, r, apierror.Internal("internal server error"))
 		return
 	}
 
 	err = uh.userStore.CreateUser(r.Context(), user)
+	if errors.Is(err, store.ErrConflict) {
+		apierror.Write(w, r, apierror.Conflict("username or email is already taken"))
+		return
+	}
 	if err != nil {
-		uh.logger.Printf("ERROR: registering user %v",err)
-		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error":"internal server error"})
+		logging.FromContext(r.Context()).Error("registering user", "error", err)
+		apierror.Write(w, r, apierror.Internal("internal server error"))
 		return
 	}
 	
@@ -101,33 +95,44 @@ func (uh *UserHandler) HandleCreateUser(w http.ResponseWriter, r *http.Request)
 func (uh *UserHandler) HandleGetUserByID(w http.ResponseWriter, r *http.Request) {
 	userID, err := utils.ReadParam(r, "userID")
 	if err != nil {
-		uh.logger.Printf("ERROR: decodingGetUserByID: %v\n", err)
-		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error":"invalid request sent"})
+		logging.FromContext(r.Context()).Error("decodingGetUserByID", "error", err)
+		apierror.Write(w, r, apierror.BadRequest("invalid request sent"))
 		return
 	}
 
 	user, err := uh.userStore.GetUserByID(r.Context(), userID)
 	if err != nil {
-		uh.logger.Printf("ERROR: getUserByID: %v\n", err)
-		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error":"failed to get user by id"})
+		apierror.Write(w, r, apierror.FromStore(err, "user"))
 		return
 	}
 
+	// users who blocked the caller don't show them when they were last seen
+	if viewer, ok := middleware.GetUser(r); ok && viewer.ID != user.ID {
+		blocked, err := uh.blockStore.HasBlocked(r.Context(), user.ID, viewer.ID)
+		if err != nil {
+			logging.FromContext(r.Context()).Error("hasBlocked", "error", err)
+			apierror.Write(w, r, apierror.Internal("internal server error"))
+			return
+		}
+		if blocked {
+			user.LastSeenAt = nil
+		}
+	}
+
 	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"user":user})
 }
 
 func (uh *UserHandler) HandlerGetUserByEmail(w http.ResponseWriter, r *http.Request) {
 	email := chi.URLParam(r, "email")
 	if email == "" {
-		uh.logger.Printf("ERROR: decodingGetUserByEmail: Invalid email field")
-		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error":"invalid request sent"})
+		logging.FromContext(r.Context()).Error("decodingGetUserByEmail: Invalid email field")
+		apierror.Write(w, r, apierror.BadRequest("invalid request sent"))
 		return
 	}
 
 	user, err := uh.userStore.GetUserByEmail(r.Context(), email)
 	if err != nil {
-		uh.logger.Printf("ERROR: getUserByEmail: %v\n", err)
-		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error":"failed to get user by email"})
+		apierror.Write(w, r, apierror.FromStore(err, "user"))
 		return
 	}
 
@@ -140,15 +145,14 @@ func (uh *UserHandler) HandleGetUserByUsername(w http.ResponseWriter, r *http.Re
 	username = strings.ToLower(username)
 	
 	if username == "" {
-		uh.logger.Printf("ERROR: decodingGetUserByUsername: Invalid username field")
-		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error":"invalid request sent"})
+		logging.FromContext(r.Context()).Error("decodingGetUserByUsername: Invalid username field")
+		apierror.Write(w, r, apierror.BadRequest("invalid request sent"))
 		return
 	}
 
 	user, err := uh.userStore.GetUserByUsername(r.Context(), username)
 	if err != nil {
-		uh.logger.Printf("ERROR: getUserByUsername: %v\n", err)
-		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error":"failed to get user by username"})
+		apierror.Write(w, r, apierror.FromStore(err, "user"))
 		return
 	}
 
@@ -158,15 +162,15 @@ func (uh *UserHandler) HandleGetUserByUsername(w http.ResponseWriter, r *http.Re
 func (uh *UserHandler) HandleUpdateLastSeen(w http.ResponseWriter, r *http.Request) {
 	authenticatedUser, ok := middleware.GetUser(r)
 	if !ok {
-		uh.logger.Printf("ERROR: user not found in context")
-		utils.WriteJSON(w, http.StatusUnauthorized, utils.Envelope{"error":"authentication required"})
+		logging.FromContext(r.Context()).Error("user not found in context")
+		apierror.Write(w, r, apierror.Unauthorized("authentication required"))
 		return
 	}
 
 	err := uh.userStore.UpdateLastSeen(r.Context(), authenticatedUser.ID)
 	if err != nil {
-		uh.logger.Printf("ERROR: updateLastSeen: %v\n", err)
-		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error":"failed to update last seen"})
+		logging.FromContext(r.Context()).Error("updateLastSeen", "error", err)
+		apierror.Write(w, r, apierror.Internal("failed to update last seen"))
 		return
 	}
 
@@ -176,8 +180,8 @@ func (uh *UserHandler) HandleUpdateLastSeen(w http.ResponseWriter, r *http.Reque
 func (uh *UserHandler) HandleUpdateUser(w http.ResponseWriter, r *http.Request) {
 	authenticatedUser, ok := middleware.GetUser(r)
 	if !ok {
-		uh.logger.Printf("ERROR: user not found in context")
-		utils.WriteJSON(w, http.StatusUnauthorized, utils.Envelope{"error":"authentication required"})
+		logging.FromContext(r.Context()).Error("user not found in context")
+		apierror.Write(w, r, apierror.Unauthorized("authentication required"))
 		return
 	}
 
@@ -189,27 +193,19 @@ func (uh *UserHandler) HandleUpdateUser(w http.ResponseWriter, r *http.Request)
 	}
 
 
-	err := json.NewDecoder(r.Body).Decode(&updateReq)
+	err := validate.DecodeJSON(r, &updateReq)
 	if err != nil {
-		uh.logger.Printf("ERROR: decoding update request: %v", err)
-		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid request body"})
+		apierror.Write(w, r, err)
 		return
 	}
 
-	if updateReq.Username == "" {
-		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "username cannot be empty"})
-		return
-	}
-
-	if len(updateReq.Username) > 50 {
-		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "username too long"})
-		return
-	}
+	updateReq.Username = strings.ToLower(updateReq.Username)
 
-	err = utils.ValidateEmail(updateReq.Email)
-	if err != nil {
-		uh.logger.Printf("ERROR: invalid email: %v",err)
-		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid email"})
+	var v validate.Validator
+	v.Username("username", updateReq.Username)
+	v.Email("email", updateReq.Email)
+	if err := v.Err(); err != nil {
+		apierror.Write(w, r, err)
 		return
 	}
 
@@ -222,9 +218,13 @@ func (uh *UserHandler) HandleUpdateUser(w http.ResponseWriter, r *http.Request)
 	}
 
 	err = uh.userStore.UpdateUser(r.Context(), updatedUser)
+	if errors.Is(err, store.ErrConflict) {
+		apierror.Write(w, r, apierror.Conflict("username or email is already taken"))
+		return
+	}
 	if err != nil {
-		uh.logger.Printf("ERROR: updating user credentials : %v",err)
-		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error":"internal server error"})
+		logging.FromContext(r.Context()).Error("updating user credentials", "error", err)
+		apierror.Write(w, r, apierror.Internal("internal server error"))
 		return
 	}
 
@@ -234,37 +234,38 @@ func (uh *UserHandler) HandleUpdateUser(w http.ResponseWriter, r *http.Request)
 func (uh *UserHandler) HandleUpdateUserPassword(w http.ResponseWriter, r *http.Request){
 	authenticatedUser, ok := middleware.GetUser(r)
 	if !ok {
-		uh.logger.Printf("ERROR: user not found in context")
-		utils.WriteJSON(w, http.StatusUnauthorized, utils.Envelope{"error":"authentication required"})
+		logging.FromContext(r.Context()).Error("user not found in context")
+		apierror.Write(w, r, apierror.Unauthorized("authentication required"))
 		return
 	}
 	
 	var password struct{
 		Password string `json:"password"`
 	}
-	err := json.NewDecoder(r.Body).Decode(&password)
-	if err != nil{
-		uh.logger.Printf("ERROR: handleUpdateUserPassword: %v",err)
-		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error":"invalid credentials sent"})
+	err := validate.DecodeJSON(r, &password)
+	if err != nil {
+		apierror.Write(w, r, err)
 		return
 	}
 
-	if password.Password == "" {
-		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error":"password cannot be empty"})
-		return
-	}
-	if len(password.Password) < 8 {
-		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error":"password too short"})
+	var v validate.Validator
+	v.Password("password", password.Password)
+	if err := v.Err(); err != nil {
+		apierror.Write(w, r, err)
 		return
 	}
 
 	err = uh.userStore.UpdateUserPassword(r.Context(), password.Password, authenticatedUser.ID)
 	if err != nil {
-		uh.logger.Printf("ERROR: updating user password: %v",err)
-		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error":"internal server error"})
+		logging.FromContext(r.Context()).Error("updating user password", "error", err)
+		apierror.Write(w, r, apierror.Internal("internal server error"))
 		return
 	}
 
+	entry := auditEntry(store.AuditUserPasswordChanged, store.AuditTargetUser, authenticatedUser.ID)
+	entry.After = auditValue(utils.Envelope{"sessions_revoked":true})
+	audit(r, uh.auditStore, entry)
+
 	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"msg":"updated password of this user, your tokens are been revoked, please authenticate again to continue"})
 }
 
@@ -272,41 +273,16 @@ func (uh *UserHandler) HandleUpdateUserPassword(w http.ResponseWriter, r *http.R
 func (uh *UserHandler) HandleGetCurrentUser(w http.ResponseWriter, r *http.Request) {
 	authenticatedUser, ok := middleware.GetUser(r)
 	if !ok {
-		utils.WriteJSON(w, http.StatusUnauthorized, utils.Envelope{"error":"authentication required"})
+		apierror.Write(w, r, apierror.Unauthorized("authentication required"))
 		return
 	}
 
 	user, err := uh.userStore.GetCurrentUser(r.Context(), authenticatedUser.ID)
 	if err != nil {
-		uh.logger.Printf("ERROR: handleGetCurrentUser: %v",err)
-		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error":"unable to fetch user"})
+		logging.FromContext(r.Context()).Error("handleGetCurrentUser", "error", err)
+		apierror.Write(w, r, apierror.Internal("unable to fetch user"))
 		return
 	}
 
 	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"user":user})
 }
-
-func (h *UserHandler) validateRegisterRequest(req *registeredUserRequest) error {
-	if req.Username == "" {
-		return errors.New("username is required")
-	}
-
-	if len(req.Username) > 50 {
-		return errors.New("Username cannot be greater than 50 characters")
-	}
-
-	if req.Email == "" {
-		return errors.New("email is required")
-	}
-
-	emailRegex := regexp.MustCompile(`^[a-zA-Z0-9._%+-]+@[a-zA-Z0-9.-]+\.[a-zA-Z]{2,}$`)
-	if !emailRegex.MatchString(req.Email) {
-		return errors.New("invalid email format")
-	}
-
-	if req.Password == "" {
-		return errors.New("password is required")
-	}
-
-	return nil
-}
\ No newline at end of file
@@ -0,0 +1,46 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/Abhishek-B-R/chat-app-golang/internals/middleware"
+	"github.com/Abhishek-B-R/chat-app-golang/internals/store"
+)
+
+// Handlers are shared by every API version; the types below keep the
+// response shapes a version promised when a later one changes them.
+
+// chatV1 sends last_message_at as unix seconds, which is what /v1 clients
+// parse. From v2 on it is an RFC 3339 timestamp like every other time.
+type chatV1 struct {
+	*store.Chat
+	LastMessageAt *int64 `json:"last_message_at"`
+}
+
+func toChatV1(chat *store.Chat) chatV1 {
+	v1 := chatV1{Chat: chat}
+	if chat.LastMessageAt != nil {
+		unix := chat.LastMessageAt.Unix()
+		v1.LastMessageAt = &unix
+	}
+	return v1
+}
+
+func presentChat(r *http.Request, chat *store.Chat) any {
+	if chat == nil || middleware.GetAPIVersion(r) >= 2 {
+		return chat
+	}
+	return toChatV1(chat)
+}
+
+func presentChats(r *http.Request, chats *[]store.Chat) any {
+	if chats == nil || middleware.GetAPIVersion(r) >= 2 {
+		return chats
+	}
+
+	out := make([]any, len(*chats))
+	for i := range *chats {
+		out[i] = presentChat(r, &(*chats)[i])
+	}
+	return out
+}
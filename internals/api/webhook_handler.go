@@ -0,0 +1,158 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/Abhishek-B-R/chat-app-golang/internals/apierror"
+	"github.com/Abhishek-B-R/chat-app-golang/internals/logging"
+	"github.com/Abhishek-B-R/chat-app-golang/internals/middleware"
+	"github.com/Abhishek-B-R/chat-app-golang/internals/store"
+	"github.com/Abhishek-B-R/chat-app-golang/internals/utils"
+	"github.com/Abhishek-B-R/chat-app-golang/internals/validate"
+	"github.com/Abhishek-B-R/chat-app-golang/internals/webhooks"
+)
+
+type createWebhookRequest struct {
+	URL string `json:"url"`
+	Secret string `json:"secret"`
+	Events []string `json:"events"`
+}
+
+type WebhookHandler struct {
+	webhookStore store.WebhookStore
+}
+
+func NewWebhookHandler(webhookStore store.WebhookStore) *WebhookHandler {
+	return &WebhookHandler{
+		webhookStore: webhookStore,
+	}
+}
+
+func (wh *WebhookHandler) HandleCreateWebhook(w http.ResponseWriter, r *http.Request) {
+	authenticatedUser, ok := middleware.GetUser(r)
+	if !ok {
+		apierror.Write(w, r, apierror.Unauthorized("authentication required"))
+		return
+	}
+
+	chatID, err := utils.ReadParam(r, "chatID")
+	if err != nil {
+		apierror.Write(w, r, apierror.BadRequest("invalid chat id"))
+		return
+	}
+
+	var req createWebhookRequest
+	err = validate.DecodeJSON(r, &req)
+	if err != nil {
+		apierror.Write(w, r, err)
+		return
+	}
+
+	target, err := webhooks.CheckURL(r.Context(), req.URL)
+	if err != nil {
+		apierror.Write(w, r, apierror.BadRequest(err.Error()))
+		return
+	}
+
+	if len(req.Events) == 0 {
+		apierror.Write(w, r, apierror.Validation(apierror.FieldError{Field: "events", Message: "at least one event is required, one of: " + strings.Join(webhooks.Events, ", ")}))
+		return
+	}
+	for _, event := range req.Events {
+		if !webhooks.ValidEvent(event) {
+			apierror.Write(w, r, apierror.Validation(apierror.FieldError{Field: "events", Message: "unknown event " + event + ", expected one of: " + strings.Join(webhooks.Events, ", ")}))
+			return
+		}
+	}
+
+	if req.Secret == "" {
+		req.Secret, err = webhooks.GenerateSecret()
+		if err != nil {
+			logging.FromContext(r.Context()).Error("generating webhook secret", "error", err)
+			apierror.Write(w, r, apierror.Internal("internal server error"))
+			return
+		}
+	}
+
+	hook := &store.Webhook{
+		ChatID: chatID,
+		URL: target.String(),
+		Secret: req.Secret,
+		Events: req.Events,
+		CreatedBy: &authenticatedUser.ID,
+	}
+
+	err = wh.webhookStore.CreateWebhook(r.Context(), hook)
+	if err != nil {
+		logging.FromContext(r.Context()).Error("createWebhook", "error", err)
+		apierror.Write(w, r, apierror.Internal("failed to create webhook"))
+		return
+	}
+
+	// the secret is only returned once, receivers need it to verify signatures
+	utils.WriteJSON(w, http.StatusCreated, utils.Envelope{"webhook":hook, "secret":hook.Secret})
+}
+
+func (wh *WebhookHandler) HandleGetWebhooks(w http.ResponseWriter, r *http.Request) {
+	chatID, err := utils.ReadParam(r, "chatID")
+	if err != nil {
+		apierror.Write(w, r, apierror.BadRequest("invalid chat id"))
+		return
+	}
+
+	hooks, err := wh.webhookStore.GetChatWebhooks(r.Context(), chatID)
+	if err != nil {
+		logging.FromContext(r.Context()).Error("getChatWebhooks", "error", err)
+		apierror.Write(w, r, apierror.Internal("failed to get webhooks"))
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"webhooks":hooks})
+}
+
+func (wh *WebhookHandler) HandleDeleteWebhook(w http.ResponseWriter, r *http.Request) {
+	chatID, err := utils.ReadParam(r, "chatID")
+	webhookID, err2 := utils.ReadParam(r, "webhookID")
+	if err != nil || err2 != nil {
+		apierror.Write(w, r, apierror.BadRequest("invalid request sent"))
+		return
+	}
+
+	err = wh.webhookStore.DeleteWebhook(r.Context(), chatID, webhookID)
+	if errors.Is(err, store.ErrNotFound) {
+		apierror.Write(w, r, apierror.NotFound("webhook not found"))
+		return
+	}
+	if err != nil {
+		logging.FromContext(r.Context()).Error("deleteWebhook", "error", err)
+		apierror.Write(w, r, apierror.Internal("failed to delete webhook"))
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (wh *WebhookHandler) HandleGetDeliveries(w http.ResponseWriter, r *http.Request) {
+	chatID, err := utils.ReadParam(r, "chatID")
+	webhookID, err2 := utils.ReadParam(r, "webhookID")
+	if err != nil || err2 != nil {
+		apierror.Write(w, r, apierror.BadRequest("invalid request sent"))
+		return
+	}
+
+	limit, err := utils.ReadQueryParamInt64(r, "limit")
+	if err != nil || limit <= 0 || limit > 200 {
+		limit = 50
+	}
+
+	deliveries, err := wh.webhookStore.GetWebhookDeliveries(r.Context(), chatID, webhookID, limit)
+	if err != nil {
+		logging.FromContext(r.Context()).Error("getWebhookDeliveries", "error", err)
+		apierror.Write(w, r, apierror.Internal("failed to get webhook deliveries"))
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"deliveries":deliveries})
+}
@@ -0,0 +1,217 @@
+package apierror
+
+import (
+	"encoding/json"
+	"errors"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/Abhishek-B-R/chat-app-golang/internals/logging"
+	"github.com/Abhishek-B-R/chat-app-golang/internals/store"
+)
+
+// Code is a stable, machine-readable error identifier. Clients should branch
+// on the code, never on the detail text.
+type Code string
+
+const (
+	CodeBadRequest         Code = "bad_request"
+	CodeValidationFailed   Code = "validation_failed"
+	CodeUnauthorized       Code = "unauthorized"
+	CodeInvalidCredentials Code = "invalid_credentials"
+	CodeAccountSuspended   Code = "account_suspended"
+	CodeForbidden          Code = "forbidden"
+	CodeNotChatMember      Code = "not_chat_member"
+	CodeBlocked            Code = "blocked"
+	CodeNotFound           Code = "not_found"
+	CodeConflict           Code = "conflict"
+	CodePayloadTooLarge    Code = "payload_too_large"
+	CodeUnprocessable      Code = "unprocessable"
+	CodeRateLimited        Code = "rate_limited"
+	CodeSlowMode           Code = "slow_mode"
+	CodeAdminsOnly         Code = "admins_only"
+	CodeMutedInChat        Code = "muted_in_chat"
+	CodeContentRejected    Code = "content_rejected"
+	CodeInviteExpired      Code = "invite_expired"
+	CodeInviteUsedUp       Code = "invite_used_up"
+	CodeInternal           Code = "internal"
+	CodeUpstreamFailed     Code = "upstream_failed"
+)
+
+const ContentType = "application/problem+json"
+
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// Error is an error that knows how it should be reported to the client.
+type Error struct {
+	Status int
+	Code   Code
+	Detail string
+	Fields []FieldError
+	// RetryAt tells the client when the request may succeed, e.g. when a
+	// mute ends.
+	RetryAt *time.Time
+	// Rule is the content filter rule that rejected a message.
+	Rule *Rule
+	// Err is the underlying cause. It is logged for server errors and never
+	// sent to the client.
+	Err error
+}
+
+func (e *Error) Error() string {
+	if e.Err != nil {
+		return e.Detail + ": " + e.Err.Error()
+	}
+	return e.Detail
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// WithRetryAt sets when the client may try again.
+func (e *Error) WithRetryAt(t time.Time) *Error {
+	e.RetryAt = &t
+	return e
+}
+
+// Rule identifies a content filter rule. Scope is "chat" or "global".
+type Rule struct {
+	ID    int64  `json:"id"`
+	Name  string `json:"name"`
+	Kind  string `json:"kind"`
+	Scope string `json:"scope"`
+}
+
+// WithRule names the content filter rule behind the error.
+func (e *Error) WithRule(rule Rule) *Error {
+	e.Rule = &rule
+	return e
+}
+
+// WithCode replaces the generic code for the status with a more specific one.
+func (e *Error) WithCode(code Code) *Error {
+	e.Code = code
+	return e
+}
+
+func New(status int, code Code, detail string) *Error {
+	return &Error{Status: status, Code: code, Detail: detail}
+}
+
+func BadRequest(detail string) *Error {
+	return New(http.StatusBadRequest, CodeBadRequest, detail)
+}
+
+func Unauthorized(detail string) *Error {
+	return New(http.StatusUnauthorized, CodeUnauthorized, detail)
+}
+
+func Forbidden(detail string) *Error {
+	return New(http.StatusForbidden, CodeForbidden, detail)
+}
+
+func NotFound(detail string) *Error {
+	return New(http.StatusNotFound, CodeNotFound, detail)
+}
+
+func Conflict(detail string) *Error {
+	return New(http.StatusConflict, CodeConflict, detail)
+}
+
+func PayloadTooLarge(detail string) *Error {
+	return New(http.StatusRequestEntityTooLarge, CodePayloadTooLarge, detail)
+}
+
+func Unprocessable(detail string) *Error {
+	return New(http.StatusUnprocessableEntity, CodeUnprocessable, detail)
+}
+
+func TooManyRequests(detail string) *Error {
+	return New(http.StatusTooManyRequests, CodeRateLimited, detail)
+}
+
+func BadGateway(detail string) *Error {
+	return New(http.StatusBadGateway, CodeUpstreamFailed, detail)
+}
+
+func Internal(detail string) *Error {
+	return New(http.StatusInternalServerError, CodeInternal, detail)
+}
+
+// Validation reports the request fields that failed validation.
+func Validation(fields ...FieldError) *Error {
+	e := New(http.StatusUnprocessableEntity, CodeValidationFailed, "the request has invalid fields")
+	e.Fields = fields
+	return e
+}
+
+// FromStore maps the store's sentinel errors to a response about resource,
+// e.g. "chat": store.ErrNotFound becomes 404 "chat not found". Any other
+// error is an internal error.
+func FromStore(err error, resource string) *Error {
+	switch {
+	case errors.Is(err, store.ErrNotFound):
+		return NotFound(resource + " not found")
+	case errors.Is(err, store.ErrConflict):
+		return Conflict(resource + " already exists")
+	case errors.Is(err, store.ErrForbidden):
+		return Forbidden("not allowed to access this " + resource)
+	default:
+		e := Internal("internal server error")
+		e.Err = err
+		return e
+	}
+}
+
+type problem struct {
+	Type      string       `json:"type"`
+	Title     string       `json:"title"`
+	Status    int          `json:"status"`
+	Detail    string       `json:"detail,omitempty"`
+	Instance  string       `json:"instance,omitempty"`
+	Code      Code         `json:"code"`
+	RequestID string       `json:"request_id,omitempty"`
+	Errors    []FieldError `json:"errors,omitempty"`
+	RetryAt   *time.Time   `json:"retry_at,omitempty"`
+	Rule      *Rule        `json:"rule,omitempty"`
+}
+
+// Write sends err as an RFC 7807 problem document. Errors that are not an
+// *Error go through FromStore.
+func Write(w http.ResponseWriter, r *http.Request, err error) {
+	var e *Error
+	if !errors.As(err, &e) {
+		e = FromStore(err, "resource")
+	}
+	if e.Status >= http.StatusInternalServerError && e.Err != nil {
+		logging.FromContext(r.Context()).Error(e.Detail, "error", e.Err)
+	}
+
+	body, _ := json.MarshalIndent(problem{
+		Type:      "about:blank",
+		Title:     http.StatusText(e.Status),
+		Status:    e.Status,
+		Detail:    e.Detail,
+		Instance:  r.URL.Path,
+		Code:      e.Code,
+		RequestID: w.Header().Get("X-Request-ID"),
+		Errors:    e.Fields,
+		RetryAt:   e.RetryAt,
+		Rule:      e.Rule,
+	}, "", " ")
+
+	if e.RetryAt != nil {
+		retryAfter := int(math.Ceil(time.Until(*e.RetryAt).Seconds()))
+		w.Header().Set("Retry-After", strconv.Itoa(max(retryAfter, 1)))
+	}
+
+	w.Header().Set("Content-Type", ContentType)
+	w.WriteHeader(e.Status)
+	w.Write(append(body, '\n'))
+}
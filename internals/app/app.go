@@ -1,34 +1,82 @@
 package app
 
 import (
+	"context"
 	"database/sql"
+	"errors"
 	"fmt"
-	"log"
+	"log/slog"
 	"net/http"
 	"os"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/Abhishek-B-R/chat-app-golang/internals/api"
+	"github.com/Abhishek-B-R/chat-app-golang/internals/commands"
+	"github.com/Abhishek-B-R/chat-app-golang/internals/config"
+	"github.com/Abhishek-B-R/chat-app-golang/internals/health"
+	"github.com/Abhishek-B-R/chat-app-golang/internals/logging"
+	"github.com/Abhishek-B-R/chat-app-golang/internals/metrics"
 	"github.com/Abhishek-B-R/chat-app-golang/internals/middleware"
+	"github.com/Abhishek-B-R/chat-app-golang/internals/oidc"
+	"github.com/Abhishek-B-R/chat-app-golang/internals/ratelimit"
 	"github.com/Abhishek-B-R/chat-app-golang/internals/store"
+	"github.com/Abhishek-B-R/chat-app-golang/internals/tracing"
+	"github.com/Abhishek-B-R/chat-app-golang/internals/utils"
+	"github.com/Abhishek-B-R/chat-app-golang/internals/webhooks"
 	"github.com/Abhishek-B-R/chat-app-golang/migrations"
 )
 
 type Application struct{
-	Logger *log.Logger
+	Config *config.Config
+	Logger *slog.Logger
 	ChatHandler *api.ChatHandler
 	MessageHandler *api.MessageHandler
 	ChatMemberHandler *api.ChatMemberHandler
 	UserHandler *api.UserHandler
 	TokenHandler *api.TokenHandler
+	OIDCHandler *api.OIDCHandler
+	BotHandler *api.BotHandler
+	BlockHandler *api.BlockHandler
+	ReportHandler *api.ReportHandler
+	FilterHandler *api.FilterHandler
+	AdminHandler *api.AdminHandler
+	WebhookHandler *api.WebhookHandler
+	IncomingWebhookHandler *api.IncomingWebhookHandler
+	InviteHandler *api.InviteHandler
+	CommandHandler *api.CommandHandler
+
+	WebhookWorker *webhooks.Worker
 	
 	UserMiddleware middleware.UserMiddleware
 	ChatMiddleware middleware.ChatMiddleware
 	MessageMiddleware middleware.MessageMiddleware
+	RequestMiddleware middleware.RequestMiddleware
+	MetricsMiddleware middleware.MetricsMiddleware
+	RateLimitMiddleware middleware.RateLimitMiddleware
+	Metrics metrics.Recorder
 	DB *sql.DB
+	Readiness *health.Checker
+
+	schemaVersion int64
+	shutdownTracing func(context.Context) error
+	ready atomic.Bool
+	stopWorkers context.CancelFunc
+	workers sync.WaitGroup
 }
 
-func NewApplication() (*Application, error){
-	pgDB, err := store.Open()
+func NewApplication(cfg *config.Config) (*Application, error){
+	logger := logging.New(os.Stdout, cfg.Log)
+	// anything logging outside of a request, libraries included, gets the same output
+	slog.SetDefault(logger)
+
+	shutdownTracing, err := tracing.Setup(context.Background(), cfg.Tracing)
+	if err != nil {
+		return nil, err
+	}
+
+	pgDB, err := store.Open(cfg.Database, logger)
 	if err != nil {
 		return nil, err
 	}
@@ -38,40 +86,216 @@ func NewApplication() (*Application, error){
 		panic(err)
 	}
 
-	logger := log.New(os.Stdout, "", log.Ldate|log.Ltime)
+	schemaVersion, err := store.LatestMigration(migrations.FS, ".")
+	if err != nil {
+		return nil, err
+	}
 
 	chatStore := store.NewPostgresChatStore(pgDB)
 	messageStore := store.NewPostgresMessageStore(pgDB)
 	chatMemberStore := store.NewPostgresChatMemberStore(pgDB)
-	userStore := store.NewPostgresUserStore(pgDB)
+	userStore := store.NewPostgresUserStore(pgDB, cfg.Auth.BcryptCost)
 	tokenStore := store.NewPostgresTokenStore(pgDB)
+	identityStore := store.NewPostgresIdentityStore(pgDB)
+	apiKeyStore := store.NewPostgresAPIKeyStore(pgDB)
+	webhookStore := store.NewPostgresWebhookStore(pgDB)
+	incomingWebhookStore := store.NewPostgresIncomingWebhookStore(pgDB)
+	chatInviteStore := store.NewPostgresChatInviteStore(pgDB)
+	commandStore := store.NewPostgresCommandStore(pgDB)
+	blockStore := store.NewPostgresBlockStore(pgDB)
+	reportStore := store.NewPostgresReportStore(pgDB)
+	contentFilterStore := store.NewPostgresContentFilterStore(pgDB)
+	auditStore := store.NewPostgresAuditStore(pgDB)
+
+	if len(cfg.Auth.AdminUserIDs) > 0 {
+		granted, err := userStore.GrantAdmin(context.Background(), cfg.Auth.AdminUserIDs)
+		if err != nil {
+			return nil, fmt.Errorf("granting auth.admin_user_ids: %w", err)
+		}
+		logger.Info("granted platform admin", "user_ids", granted)
 
-	chatHandler := api.NewChatHandler(chatStore, logger)
-	messageHandler := api.NewMessageHandler(messageStore, logger)
-	chatMemberHandler := api.NewChatMemberHandler(chatMemberStore, messageStore, logger)
-	userHandler := api.NewUserHandler(userStore, logger)
-	tokenHandler := api.NewTokenHandler(tokenStore, userStore, logger)
+		isGranted := map[int64]bool{}
+		for _, id := range granted {
+			isGranted[id] = true
+		}
+		for _, id := range cfg.Auth.AdminUserIDs {
+			if !isGranted[id] {
+				logger.Warn("auth.admin_user_ids has an id that is not a user or is a bot", "user_id", id)
+			}
+		}
+	}
+
+	var limiter ratelimit.Limiter = ratelimit.NewMemoryLimiter()
+	if cfg.RateLimit.Backend == "postgres" {
+		limiter = ratelimit.NewPostgresLimiter(pgDB)
+	}
 
-	userMiddlewareHandler := middleware.UserMiddleware{UserStore: userStore}
+	var recorder metrics.Recorder = metrics.Nop{}
+	if cfg.Metrics.Enabled {
+		recorder = metrics.NewPrometheus()
+	}
+	recorder.WatchDB(pgDB)
+
+	webhookPublisher := webhooks.NewPublisher(webhookStore)
+	webhookWorker := webhooks.NewWorker(webhookStore, cfg.Webhooks, recorder, logger.With("worker", "webhooks"))
+	commandRegistry := commands.NewRegistry(commandStore, cfg.Commands)
+
+	var providers []*oidc.Provider
+	for _, providerConfig := range cfg.Auth.OIDCProviders {
+		provider, err := oidc.NewProvider(context.Background(), providerConfig)
+		if err != nil {
+			// a provider being down should not keep password logins from working
+			logger.Error("skipping oidc provider", "provider", providerConfig.Name, "error", err)
+			continue
+		}
+		providers = append(providers, provider)
+	}
+
+	chatHandler := api.NewChatHandler(chatStore, auditStore, webhookPublisher)
+	messageHandler := api.NewMessageHandler(messageStore, chatMemberStore, contentFilterStore, auditStore, webhookPublisher, commandRegistry, cfg.Limits, recorder)
+	chatMemberHandler := api.NewChatMemberHandler(chatMemberStore, messageStore, blockStore, auditStore, webhookPublisher)
+	userHandler := api.NewUserHandler(userStore, blockStore, auditStore, cfg.Auth)
+	tokenHandler := api.NewTokenHandler(tokenStore, userStore, auditStore, cfg.Auth, recorder)
+	oidcHandler := api.NewOIDCHandler(providers, identityStore, userStore, tokenStore, auditStore, cfg.Auth, recorder)
+	botHandler := api.NewBotHandler(userStore, apiKeyStore, auditStore)
+	blockHandler := api.NewBlockHandler(blockStore)
+	filterHandler := api.NewFilterHandler(contentFilterStore)
+	adminHandler := api.NewAdminHandler(userStore, tokenStore, chatStore, chatMemberStore, messageStore, auditStore, webhookPublisher)
+	reportHandler := api.NewReportHandler(reportStore, messageStore, userStore, chatMemberStore, tokenStore, auditStore, webhookPublisher)
+	webhookHandler := api.NewWebhookHandler(webhookStore)
+	commandHandler := api.NewCommandHandler(commandStore, commandRegistry)
+	inviteHandler := api.NewInviteHandler(chatInviteStore, chatStore, auditStore, webhookPublisher)
+	incomingWebhookHandler := api.NewIncomingWebhookHandler(incomingWebhookStore, messageStore, contentFilterStore, webhookPublisher, limiter, cfg.Limits, recorder)
+
+	userMiddlewareHandler := middleware.UserMiddleware{UserStore: userStore, APIKeyStore: apiKeyStore}
 	chatMiddlewareHandler := middleware.ChatMiddleware{ChatMemberStore: chatMemberStore}
 	messageMiddlewareHandler := middleware.MessageMiddleware{MessageStore: messageStore, ChatMemberStore: chatMemberStore}
+	requestMiddlewareHandler := middleware.RequestMiddleware{Logger: logger, MaxBodyBytes: cfg.HTTP.MaxBodyBytes, ClientIPHeader: cfg.RateLimit.ClientIPHeader}
+	metricsMiddlewareHandler := middleware.MetricsMiddleware{Metrics: recorder}
+	rateLimitMiddlewareHandler := middleware.RateLimitMiddleware{Limiter: limiter}
 
 	app := &Application{
+		Config: cfg,
 		Logger: logger,
 		ChatHandler: chatHandler,
 		MessageHandler: messageHandler,
 		ChatMemberHandler: chatMemberHandler,
 		UserHandler: userHandler,
 		TokenHandler: tokenHandler,
+		OIDCHandler: oidcHandler,
+		BotHandler: botHandler,
+		BlockHandler: blockHandler,
+		ReportHandler: reportHandler,
+		FilterHandler: filterHandler,
+		AdminHandler: adminHandler,
+		WebhookHandler: webhookHandler,
+		IncomingWebhookHandler: incomingWebhookHandler,
+		InviteHandler: inviteHandler,
+		CommandHandler: commandHandler,
+		WebhookWorker: webhookWorker,
 		UserMiddleware: userMiddlewareHandler,
 		ChatMiddleware: chatMiddlewareHandler,
 		MessageMiddleware: messageMiddlewareHandler,
+		RequestMiddleware: requestMiddlewareHandler,
+		MetricsMiddleware: metricsMiddlewareHandler,
+		RateLimitMiddleware: rateLimitMiddlewareHandler,
+		Metrics: recorder,
 		DB: pgDB,
+		schemaVersion: schemaVersion,
+		shutdownTracing: shutdownTracing,
 	}
+	app.Readiness = health.NewChecker(2*time.Second, app.readinessChecks()...)
 	return app, nil
 }
 
-func (a *Application) HealthCheck(w http.ResponseWriter, r *http.Request) {
-	fmt.Fprintf(w, "Server is working pretty fine")
+// HandleLiveness only tells that the process is up and serving requests.
+func (a *Application) HandleLiveness(w http.ResponseWriter, r *http.Request) {
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"status":health.StatusOK})
+}
+
+func (a *Application) readinessChecks() []health.Check {
+	return []health.Check{
+		{
+			Name: "accepting_traffic",
+			Run: func(ctx context.Context) error {
+				if !a.ready.Load() {
+					return errors.New("server is shutting down")
+				}
+				return nil
+			},
+		},
+		{
+			Name: "database",
+			Run: func(ctx context.Context) error {
+				return a.DB.PingContext(ctx)
+			},
+		},
+		{
+			Name: "migrations",
+			Run: func(ctx context.Context) error {
+				version, err := store.SchemaVersion(ctx, a.DB)
+				if err != nil {
+					return err
+				}
+				// a newer schema is expected during a rolling deploy, when the
+				// new release migrated while this one still serves traffic
+				if version < a.schemaVersion {
+					return fmt.Errorf("database is at version %d, expected at least %d", version, a.schemaVersion)
+				}
+				return nil
+			},
+		},
+		{
+			Name: "webhook_worker",
+			Run: func(ctx context.Context) error {
+				if !a.WebhookWorker.Running() {
+					return errors.New("not running")
+				}
+				return nil
+			},
+		},
+	}
+}
+
+// SetReady controls whether the readiness check reports the server as able to
+// take traffic.
+func (a *Application) SetReady(ready bool) {
+	a.ready.Store(ready)
+}
+
+// StartWorkers runs the background workers until Shutdown.
+func (a *Application) StartWorkers() {
+	ctx, cancel := context.WithCancel(context.Background())
+	a.stopWorkers = cancel
+
+	a.workers.Add(1)
+	go func() {
+		defer a.workers.Done()
+		a.WebhookWorker.Run(ctx)
+	}()
+}
+
+// Shutdown stops the background workers, waiting for them to finish their
+// current work until ctx expires, flushes buffered spans and then closes the
+// database. The HTTP server must already be shut down.
+func (a *Application) Shutdown(ctx context.Context) error {
+	if a.stopWorkers != nil {
+		a.stopWorkers()
+	}
+
+	done := make(chan struct{})
+	go func() {
+		a.workers.Wait()
+		close(done)
+	}()
+
+	var err error
+	select {
+	case <-done:
+	case <-ctx.Done():
+		err = fmt.Errorf("waiting for workers: %w", ctx.Err())
+	}
+
+	return errors.Join(err, a.shutdownTracing(ctx), a.DB.Close())
 }
 
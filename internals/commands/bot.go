@@ -0,0 +1,80 @@
+package commands
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/Abhishek-B-R/chat-app-golang/internals/store"
+	"github.com/Abhishek-B-R/chat-app-golang/internals/webhooks"
+)
+
+// botRequest is POSTed to a command's endpoint, signed like outgoing webhooks.
+type botRequest struct {
+	Command  string `json:"command"`
+	Text     string `json:"text"`
+	ChatID   int64  `json:"chat_id"`
+	UserID   int64  `json:"user_id"`
+	Username string `json:"username"`
+}
+
+// botResponse follows Slack: responses are ephemeral unless
+// response_type is "in_channel".
+type botResponse struct {
+	Text         string `json:"text"`
+	ResponseType string `json:"response_type"`
+}
+
+func (reg *Registry) dispatch(ctx context.Context, cmd *store.ChatCommand, inv *Invocation) (*Response, error) {
+	body, err := json.Marshal(botRequest{
+		Command:  "/" + inv.Name,
+		Text:     inv.Args,
+		ChatID:   inv.ChatID,
+		UserID:   inv.User.ID,
+		Username: inv.User.Username,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, cmd.URL, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	webhooks.SetSignatureHeaders(req.Header, cmd.Secret, time.Now().Unix(), body)
+
+	resp, err := reg.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("command /%s: %w", inv.Name, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return nil, fmt.Errorf("command /%s: endpoint responded with %s", inv.Name, resp.Status)
+	}
+
+	raw, err := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+	if err != nil {
+		return nil, fmt.Errorf("command /%s: reading response: %w", inv.Name, err)
+	}
+	if len(bytes.TrimSpace(raw)) == 0 {
+		// the bot acknowledged without saying anything
+		return &Response{Ephemeral: true}, nil
+	}
+
+	var out botResponse
+	err = json.Unmarshal(raw, &out)
+	if err != nil {
+		return nil, fmt.Errorf("command /%s: decoding response: %w", inv.Name, err)
+	}
+
+	return &Response{
+		Text:      out.Text,
+		Ephemeral: out.ResponseType != "in_channel",
+	}, nil
+}
@@ -0,0 +1,77 @@
+package commands
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/Abhishek-B-R/chat-app-golang/internals/config"
+	"github.com/Abhishek-B-R/chat-app-golang/internals/store"
+	"github.com/Abhishek-B-R/chat-app-golang/internals/webhooks"
+)
+
+func TestBotCommandsOnlyReachPublicAddresses(t *testing.T) {
+	hit := false
+	bot := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hit = true
+	}))
+	defer bot.Close()
+
+	// a command registered before its host started resolving to a private
+	// address is still refused when it runs
+	reg := NewRegistry(memCommands{cmds: []*store.ChatCommand{{Name: "deploy", URL: bot.URL, Secret: "s"}}}, config.Default().Commands)
+	_, err := reg.Execute(t.Context(), &Invocation{ChatID: 7, User: &store.User{ID: 3, Username: "alice"}, Name: "deploy"})
+	if !errors.Is(err, webhooks.ErrPrivateAddress) {
+		t.Errorf("calling a loopback bot: %v, want ErrPrivateAddress", err)
+	}
+	if hit {
+		t.Error("the bot was called")
+	}
+}
+
+func TestBotCommandRequestAndResponse(t *testing.T) {
+	var got botRequest
+	var signed bool
+	responses := []string{`{"text":"deploying","response_type":"in_channel"}`, `{"text":"only you see this"}`, ``}
+	bot := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		ts, _ := strconv.ParseInt(r.Header.Get(webhooks.TimestampHeader), 10, 64)
+		signed = r.Header.Get(webhooks.SignatureHeader) == webhooks.Sign("bot-secret", ts, body)
+		json.Unmarshal(body, &got)
+		io.WriteString(w, responses[0])
+		responses = responses[1:]
+	}))
+	defer bot.Close()
+
+	reg := NewRegistry(memCommands{cmds: []*store.ChatCommand{{Name: "deploy", URL: bot.URL, Secret: "bot-secret"}}}, config.Default().Commands)
+	// the test server is on loopback, which the real client refuses
+	reg.client = bot.Client()
+	inv := &Invocation{ChatID: 7, User: &store.User{ID: 3, Username: "alice"}, Name: "deploy", Args: "prod"}
+
+	res, err := reg.Execute(t.Context(), inv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := (botRequest{Command: "/deploy", Text: "prod", ChatID: 7, UserID: 3, Username: "alice"}); got != want {
+		t.Errorf("bot got %+v, want %+v", got, want)
+	}
+	if !signed {
+		t.Error("request was not signed with the command's secret")
+	}
+	if res.Ephemeral || res.Text != "deploying" {
+		t.Errorf("in_channel response: %+v", res)
+	}
+
+	res, _ = reg.Execute(t.Context(), inv)
+	if !res.Ephemeral || res.Text != "only you see this" {
+		t.Errorf("default response: %+v", res)
+	}
+	res, _ = reg.Execute(t.Context(), inv)
+	if !res.Ephemeral || res.Text != "" {
+		t.Errorf("empty response: %+v", res)
+	}
+}
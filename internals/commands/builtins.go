@@ -0,0 +1,100 @@
+package commands
+
+import (
+	"context"
+	"crypto/rand"
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+func registerBuiltins(reg *Registry) {
+	reg.Register("help", "", "List the commands available in this chat", func(ctx context.Context, inv *Invocation) (*Response, error) {
+		help, err := reg.help(ctx, inv.ChatID)
+		if err != nil {
+			return nil, err
+		}
+		return &Response{Text: help, Ephemeral: true}, nil
+	})
+
+	reg.Register("me", "<action>", "Post an action, e.g. /me waves", func(ctx context.Context, inv *Invocation) (*Response, error) {
+		if inv.Args == "" {
+			return usage(reg, "me"), nil
+		}
+		return &Response{Text: fmt.Sprintf("_%s %s_", inv.User.Username, inv.Args)}, nil
+	})
+
+	reg.Register("shrug", "[message]", `Append ¯\_(ツ)_/¯ to your message`, func(ctx context.Context, inv *Invocation) (*Response, error) {
+		return &Response{Text: strings.TrimSpace(inv.Args + ` ¯\_(ツ)_/¯`)}, nil
+	})
+
+	reg.Register("roll", "[sides]", "Roll a die, 100 sides unless told otherwise", func(ctx context.Context, inv *Invocation) (*Response, error) {
+		sides := int64(100)
+		if inv.Args != "" {
+			n, err := strconv.ParseInt(inv.Args, 10, 64)
+			if err != nil || n < 2 || n > 1000000 {
+				return usage(reg, "roll"), nil
+			}
+			sides = n
+		}
+
+		n, err := rand.Int(rand.Reader, big.NewInt(sides))
+		if err != nil {
+			return nil, err
+		}
+		return &Response{Text: fmt.Sprintf("%s rolled %d (1-%d)", inv.User.Username, n.Int64()+1, sides)}, nil
+	})
+
+	reg.Register("poll", `"question" "option 1" "option 2" ...`, "Start a poll", func(ctx context.Context, inv *Invocation) (*Response, error) {
+		parts := splitQuoted(inv.Args)
+		if len(parts) < 3 {
+			return usage(reg, "poll"), nil
+		}
+
+		var b strings.Builder
+		fmt.Fprintf(&b, "Poll: %s", parts[0])
+		for i, option := range parts[1:] {
+			fmt.Fprintf(&b, "\n%d. %s", i+1, option)
+		}
+		return &Response{Text: b.String()}, nil
+	})
+}
+
+func usage(reg *Registry, name string) *Response {
+	cmd := reg.builtins[name]
+	return &Response{
+		Text:      fmt.Sprintf("Usage: /%s %s", cmd.Name, cmd.Usage),
+		Ephemeral: true,
+	}
+}
+
+// splitQuoted splits on spaces, keeping "quoted phrases" together.
+func splitQuoted(s string) []string {
+	var parts []string
+	var cur strings.Builder
+	inQuotes := false
+
+	flush := func() {
+		if cur.Len() > 0 {
+			parts = append(parts, cur.String())
+			cur.Reset()
+		}
+	}
+
+	for _, c := range s {
+		switch {
+		case c == '"':
+			if inQuotes {
+				flush()
+			}
+			inQuotes = !inQuotes
+		case c == ' ' && !inQuotes:
+			flush()
+		default:
+			cur.WriteRune(c)
+		}
+	}
+	flush()
+	return parts
+}
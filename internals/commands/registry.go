@@ -0,0 +1,175 @@
+package commands
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/Abhishek-B-R/chat-app-golang/internals/config"
+	"github.com/Abhishek-B-R/chat-app-golang/internals/store"
+	"github.com/Abhishek-B-R/chat-app-golang/internals/webhooks"
+)
+
+var namePattern = regexp.MustCompile(`^[a-z0-9_-]{1,32}$`)
+
+// Invocation is a slash command typed by a user in a chat.
+type Invocation struct {
+	ChatID int64
+	User   *store.User
+	Name   string
+	Args   string
+}
+
+type Response struct {
+	Text string `json:"text"`
+	// Ephemeral responses are returned to the invoking user only and never
+	// stored; other responses are posted to the chat as the user's message.
+	Ephemeral bool `json:"ephemeral"`
+}
+
+type HandlerFunc func(ctx context.Context, inv *Invocation) (*Response, error)
+
+type Command struct {
+	Name        string `json:"name"`
+	Usage       string `json:"usage,omitempty"`
+	Description string `json:"description,omitempty"`
+	Builtin     bool   `json:"builtin"`
+
+	handler HandlerFunc
+}
+
+// Registry resolves slash commands, first against the built-in commands and
+// then against the bot endpoints registered for the chat.
+type Registry struct {
+	builtins map[string]*Command
+	store    store.CommandStore
+	client   *http.Client
+}
+
+func NewRegistry(commandStore store.CommandStore, cfg config.CommandsConfig) *Registry {
+	reg := &Registry{
+		builtins: make(map[string]*Command),
+		store:    commandStore,
+		client:   webhooks.NewClient(cfg.BotTimeout),
+	}
+	registerBuiltins(reg)
+	return reg
+}
+
+// Register adds a built-in command.
+func (reg *Registry) Register(name, usage, description string, handler HandlerFunc) {
+	reg.builtins[name] = &Command{
+		Name:        name,
+		Usage:       usage,
+		Description: description,
+		Builtin:     true,
+		handler:     handler,
+	}
+}
+
+func (reg *Registry) IsBuiltin(name string) bool {
+	_, ok := reg.builtins[name]
+	return ok
+}
+
+func ValidName(name string) bool {
+	return namePattern.MatchString(name)
+}
+
+// Parse splits "/name args" into its parts. Text starting with "//" is not
+// a command, so users can still send messages that start with a slash.
+func Parse(content string) (name, args string, ok bool) {
+	content = strings.TrimSpace(content)
+	if !strings.HasPrefix(content, "/") || strings.HasPrefix(content, "//") {
+		return "", "", false
+	}
+
+	name, args, _ = strings.Cut(content[1:], " ")
+	name = strings.ToLower(name)
+	if !ValidName(name) {
+		return "", "", false
+	}
+	return name, strings.TrimSpace(args), true
+}
+
+// Unescape turns a leading "//" back into "/" for messages that are not commands.
+func Unescape(content string) string {
+	if strings.HasPrefix(strings.TrimSpace(content), "//") {
+		return strings.Replace(content, "//", "/", 1)
+	}
+	return content
+}
+
+// List returns the built-in commands followed by the chat's bot commands.
+func (reg *Registry) List(ctx context.Context, chatID int64) ([]Command, error) {
+	var cmds []Command
+	for _, cmd := range reg.builtins {
+		cmds = append(cmds, *cmd)
+	}
+	sort.Slice(cmds, func(i, j int) bool { return cmds[i].Name < cmds[j].Name })
+
+	chatCmds, err := reg.store.GetChatCommands(ctx, chatID)
+	if err != nil {
+		return nil, err
+	}
+	for _, c := range chatCmds {
+		cmd := Command{Name: c.Name}
+		if c.Usage != nil {
+			cmd.Usage = *c.Usage
+		}
+		if c.Description != nil {
+			cmd.Description = *c.Description
+		}
+		cmds = append(cmds, cmd)
+	}
+	return cmds, nil
+}
+
+// Execute runs the command. Unknown commands get an ephemeral response
+// listing what is available instead of an error.
+func (reg *Registry) Execute(ctx context.Context, inv *Invocation) (*Response, error) {
+	if cmd, ok := reg.builtins[inv.Name]; ok {
+		return cmd.handler(ctx, inv)
+	}
+
+	chatCmd, err := reg.store.GetChatCommandByName(ctx, inv.ChatID, inv.Name)
+	if err != nil {
+		return nil, err
+	}
+	if chatCmd != nil {
+		return reg.dispatch(ctx, chatCmd, inv)
+	}
+
+	help, err := reg.help(ctx, inv.ChatID)
+	if err != nil {
+		return nil, err
+	}
+	return &Response{
+		Text:      fmt.Sprintf("Unknown command /%s. %s", inv.Name, help),
+		Ephemeral: true,
+	}, nil
+}
+
+func (reg *Registry) help(ctx context.Context, chatID int64) (string, error) {
+	cmds, err := reg.List(ctx, chatID)
+	if err != nil {
+		return "", err
+	}
+
+	var b strings.Builder
+	b.WriteString("Available commands:")
+	for _, cmd := range cmds {
+		b.WriteString("\n/")
+		b.WriteString(cmd.Name)
+		if cmd.Usage != "" {
+			b.WriteString(" " + cmd.Usage)
+		}
+		if cmd.Description != "" {
+			b.WriteString(" - " + cmd.Description)
+		}
+	}
+	return b.String(), nil
+}
@@ -0,0 +1,174 @@
+package commands
+
+import (
+	"context"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/Abhishek-B-R/chat-app-golang/internals/config"
+	"github.com/Abhishek-B-R/chat-app-golang/internals/store"
+)
+
+// memCommands is one chat's bot commands.
+type memCommands struct {
+	store.CommandStore
+	cmds []*store.ChatCommand
+}
+
+func (m memCommands) GetChatCommands(ctx context.Context, chatID int64) ([]*store.ChatCommand, error) {
+	return m.cmds, nil
+}
+
+func (m memCommands) GetChatCommandByName(ctx context.Context, chatID int64, name string) (*store.ChatCommand, error) {
+	for _, c := range m.cmds {
+		if c.Name == name {
+			return c, nil
+		}
+	}
+	return nil, nil
+}
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		content    string
+		name, args string
+		ok         bool
+	}{
+		{content: "/roll", name: "roll", ok: true},
+		{content: "/roll 20", name: "roll", args: "20", ok: true},
+		{content: "  /ME   waves at everyone  ", name: "me", args: "waves at everyone", ok: true},
+		{content: `/poll "lunch?" "pizza" "sushi"`, name: "poll", args: `"lunch?" "pizza" "sushi"`, ok: true},
+		{content: "/deploy-bot_2 now", name: "deploy-bot_2", args: "now", ok: true},
+		{content: "hello /roll"},
+		{content: "//roll is a command"},
+		{content: "/"},
+		{content: "/ roll"},
+		{content: "/r!ll"},
+		{content: "/" + strings.Repeat("a", 33)},
+		{content: ""},
+	}
+
+	for _, tt := range tests {
+		name, args, ok := Parse(tt.content)
+		if name != tt.name || args != tt.args || ok != tt.ok {
+			t.Errorf("Parse(%q) = %q, %q, %v, want %q, %q, %v", tt.content, name, args, ok, tt.name, tt.args, tt.ok)
+		}
+	}
+}
+
+func TestUnescape(t *testing.T) {
+	for content, want := range map[string]string{
+		"//roll is a command":   "/roll is a command",
+		"  //shrug":             "  /shrug",
+		"a // in the middle":    "a // in the middle",
+		"///three":              "//three",
+		"no slashes":            "no slashes",
+		"/roll stays a command": "/roll stays a command",
+	} {
+		if got := Unescape(content); got != want {
+			t.Errorf("Unescape(%q) = %q, want %q", content, got, want)
+		}
+	}
+}
+
+func execute(t *testing.T, reg *Registry, name, args string) *Response {
+	t.Helper()
+	res, err := reg.Execute(context.Background(), &Invocation{ChatID: 7, User: &store.User{ID: 3, Username: "alice"}, Name: name, Args: args})
+	if err != nil {
+		t.Fatalf("/%s %s: %v", name, args, err)
+	}
+	return res
+}
+
+func TestHelp(t *testing.T) {
+	usage, description := "<env>", "Deploy the app"
+	reg := NewRegistry(memCommands{cmds: []*store.ChatCommand{{Name: "deploy", Usage: &usage, Description: &description}}}, config.Default().Commands)
+
+	res := execute(t, reg, "help", "")
+	if !res.Ephemeral {
+		t.Error("help was posted to the chat")
+	}
+	for _, want := range []string{"/help", "/me <action>", "/poll", "/roll [sides]", "/shrug", "/deploy <env> - Deploy the app"} {
+		if !strings.Contains(res.Text, want) {
+			t.Errorf("help %q does not list %q", res.Text, want)
+		}
+	}
+
+	// unknown commands answer with the same list
+	res = execute(t, reg, "nope", "")
+	if !res.Ephemeral || !strings.HasPrefix(res.Text, "Unknown command /nope.") || !strings.Contains(res.Text, "/deploy") {
+		t.Errorf("unknown command: %+v", res)
+	}
+}
+
+func TestMe(t *testing.T) {
+	reg := NewRegistry(memCommands{}, config.Default().Commands)
+
+	res := execute(t, reg, "me", "waves")
+	if res.Ephemeral || res.Text != "_alice waves_" {
+		t.Errorf("/me waves: %+v", res)
+	}
+
+	res = execute(t, reg, "me", "")
+	if !res.Ephemeral || res.Text != "Usage: /me <action>" {
+		t.Errorf("/me without an action: %+v", res)
+	}
+}
+
+func TestShrug(t *testing.T) {
+	reg := NewRegistry(memCommands{}, config.Default().Commands)
+
+	for args, want := range map[string]string{
+		"":        `¯\_(ツ)_/¯`,
+		"no idea": `no idea ¯\_(ツ)_/¯`,
+	} {
+		res := execute(t, reg, "shrug", args)
+		if res.Ephemeral || res.Text != want {
+			t.Errorf("/shrug %s: %+v, want %q", args, res, want)
+		}
+	}
+}
+
+func TestRoll(t *testing.T) {
+	reg := NewRegistry(memCommands{}, config.Default().Commands)
+	rolled := regexp.MustCompile(`^alice rolled (\d+) \(1-(\d+)\)$`)
+
+	for args, sides := range map[string]int{"": 100, "6": 6, "1000000": 1000000} {
+		for i := 0; i < 20; i++ {
+			res := execute(t, reg, "roll", args)
+			m := rolled.FindStringSubmatch(res.Text)
+			if res.Ephemeral || m == nil || m[2] != strconv.Itoa(sides) {
+				t.Fatalf("/roll %s: %+v", args, res)
+			}
+			if n, _ := strconv.Atoi(m[1]); n < 1 || n > sides {
+				t.Fatalf("/roll %s rolled %d", args, n)
+			}
+		}
+	}
+
+	for _, args := range []string{"1", "0", "-6", "six", "1000001"} {
+		res := execute(t, reg, "roll", args)
+		if !res.Ephemeral || res.Text != "Usage: /roll [sides]" {
+			t.Errorf("/roll %s: %+v", args, res)
+		}
+	}
+}
+
+func TestPoll(t *testing.T) {
+	reg := NewRegistry(memCommands{}, config.Default().Commands)
+
+	res := execute(t, reg, "poll", `"Where to for lunch?" pizza "the sushi place"`)
+	want := "Poll: Where to for lunch?\n1. pizza\n2. the sushi place"
+	if res.Ephemeral || res.Text != want {
+		t.Errorf("poll: %+v, want %q", res, want)
+	}
+
+	for _, args := range []string{"", `"lunch?"`, `"lunch?" pizza`} {
+		res = execute(t, reg, "poll", args)
+		if !res.Ephemeral || !strings.HasPrefix(res.Text, "Usage: /poll") {
+			t.Errorf("/poll %s: %+v", args, res)
+		}
+	}
+}
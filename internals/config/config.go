@@ -0,0 +1,304 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+type Config struct {
+	Log       LogConfig
+	HTTP      HTTPConfig
+	Database  DatabaseConfig
+	Auth      AuthConfig
+	Limits    LimitsConfig
+	RateLimit RateLimitConfig
+	Webhooks  WebhooksConfig
+	Commands  CommandsConfig
+	Metrics   MetricsConfig
+	Tracing   TracingConfig
+}
+
+type LogConfig struct {
+	Level  string
+	Format string
+}
+
+type HTTPConfig struct {
+	Port         int
+	ReadTimeout  time.Duration
+	WriteTimeout time.Duration
+	IdleTimeout  time.Duration
+	// DrainDelay is how long the server keeps serving after it reports
+	// itself unready, so load balancers stop routing to it first.
+	DrainDelay      time.Duration
+	ShutdownTimeout time.Duration
+	// MaxBodyBytes caps every request body; attachments are uploaded
+	// elsewhere and only referenced by URL, so bodies stay small.
+	MaxBodyBytes int64
+	// UnversionedSunset is the date, as YYYY-MM-DD, announced for removing
+	// the routes served without a /v1 prefix.
+	UnversionedSunset string
+}
+
+// Sunset parses UnversionedSunset.
+func (h HTTPConfig) Sunset() (time.Time, error) {
+	return time.Parse(time.DateOnly, h.UnversionedSunset)
+}
+
+type DatabaseConfig struct {
+	Host            string
+	Port            int
+	User            string
+	Password        string
+	Name            string
+	SSLMode         string
+	MaxOpenConns    int
+	MaxIdleConns    int
+	ConnMaxLifetime time.Duration
+	// ConnectTimeout is how long startup keeps retrying while Postgres is
+	// not reachable yet.
+	ConnectTimeout time.Duration
+}
+
+// DSN is the connection string handed to the pgx driver.
+func (d DatabaseConfig) DSN() string {
+	return fmt.Sprintf("host=%s user=%s password=%s dbname=%s port=%d sslmode=%s",
+		d.Host, d.User, d.Password, d.Name, d.Port, d.SSLMode)
+}
+
+type AuthConfig struct {
+	TokenTTL      time.Duration
+	BcryptCost    int
+	OIDCStateTTL  time.Duration
+	OIDCProviders []OIDCProvider
+	// AdminUserIDs are made platform administrators at startup. Taking an
+	// id out of the list does not revoke it.
+	AdminUserIDs []int64
+}
+
+type OIDCProvider struct {
+	Name         string   `json:"name"`
+	IssuerURL    string   `json:"issuer_url"`
+	ClientID     string   `json:"client_id"`
+	ClientSecret string   `json:"client_secret"`
+	RedirectURL  string   `json:"redirect_url"`
+	Scopes       []string `json:"scopes"`
+}
+
+type LimitsConfig struct {
+	MaxMessageLength         int
+	MaxAttachmentsPerMessage int
+	MaxAttachmentBytes       int64
+	IncomingWebhookPerMinute int
+}
+
+// RateLimitConfig sets the request rate limits, per user on authenticated
+// routes and per client IP on the others. A limit of 0 turns it off.
+type RateLimitConfig struct {
+	// Backend is memory, limits per instance, or postgres, limits shared by
+	// every instance using the database.
+	Backend string
+	// ClientIPHeader names the header the load balancer puts the client IP
+	// in, e.g. X-Forwarded-For. The last address in it is used. Empty uses
+	// the address of the connection. The client IP is also logged and kept
+	// in the audit log.
+	ClientIPHeader string
+	// AuthPerMinute covers login, registration and OpenID Connect sign-ins.
+	AuthPerMinute int
+	// APIPerMinute covers every authenticated request.
+	APIPerMinute int
+	// MessagesPerMinute covers posting messages, on top of APIPerMinute.
+	MessagesPerMinute int
+}
+
+type WebhooksConfig struct {
+	PollInterval   time.Duration
+	BatchSize      int
+	MaxAttempts    int
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+	RequestTimeout time.Duration
+}
+
+type CommandsConfig struct {
+	BotTimeout time.Duration
+}
+
+type TracingConfig struct {
+	// Exporter is none, stdout or otlp. The OTLP exporter also honours the
+	// standard OTEL_EXPORTER_OTLP_* variables when no endpoint is set here.
+	Exporter     string
+	OTLPEndpoint string
+	SampleRatio  float64
+	ServiceName  string
+}
+
+type MetricsConfig struct {
+	// Enabled serves Prometheus metrics on /metrics.
+	Enabled bool
+}
+
+func Default() *Config {
+	return &Config{
+		Log: LogConfig{
+			Level:  "info",
+			Format: "json",
+		},
+		HTTP: HTTPConfig{
+			Port:            8080,
+			ReadTimeout:     10 * time.Second,
+			WriteTimeout:    30 * time.Second,
+			IdleTimeout:     time.Minute,
+			DrainDelay:      5 * time.Second,
+			ShutdownTimeout: 30 * time.Second,
+			MaxBodyBytes:    1 << 20,
+			// six months after the /v1 prefix was introduced
+			UnversionedSunset: "2027-04-30",
+		},
+		Database: DatabaseConfig{
+			Host:            "localhost",
+			Port:            5433,
+			User:            "postgres",
+			Password:        "postgres",
+			Name:            "postgres",
+			SSLMode:         "disable",
+			MaxOpenConns:    25,
+			MaxIdleConns:    5,
+			ConnMaxLifetime: 30 * time.Minute,
+			ConnectTimeout:  time.Minute,
+		},
+		Auth: AuthConfig{
+			TokenTTL:     24 * time.Hour,
+			BcryptCost:   12,
+			OIDCStateTTL: 10 * time.Minute,
+		},
+		Limits: LimitsConfig{
+			MaxMessageLength:         4000,
+			MaxAttachmentsPerMessage: 10,
+			MaxAttachmentBytes:       25 << 20,
+			IncomingWebhookPerMinute: 30,
+		},
+		RateLimit: RateLimitConfig{
+			Backend:           "memory",
+			AuthPerMinute:     10,
+			APIPerMinute:      300,
+			MessagesPerMinute: 30,
+		},
+		Webhooks: WebhooksConfig{
+			PollInterval:   2 * time.Second,
+			BatchSize:      20,
+			MaxAttempts:    8,
+			InitialBackoff: 10 * time.Second,
+			MaxBackoff:     time.Hour,
+			RequestTimeout: 10 * time.Second,
+		},
+		Commands: CommandsConfig{
+			BotTimeout: 5 * time.Second,
+		},
+		Metrics: MetricsConfig{
+			Enabled: true,
+		},
+		Tracing: TracingConfig{
+			Exporter:    "none",
+			SampleRatio: 1,
+			ServiceName: "chat-app",
+		},
+	}
+}
+
+// Validate reports every invalid setting at once, naming the environment
+// variable and flag that control it.
+func (c *Config) Validate() error {
+	var errs []error
+	check := func(ok bool, key, format string, args ...interface{}) {
+		if !ok {
+			errs = append(errs, fmt.Errorf("%s (%s, -%s): %s", key, envName(key), flagName(key), fmt.Sprintf(format, args...)))
+		}
+	}
+
+	switch c.Log.Level {
+	case "debug", "info", "warn", "error":
+	default:
+		check(false, "log.level", "must be one of debug, info, warn, error, got %q", c.Log.Level)
+	}
+	check(c.Log.Format == "json" || c.Log.Format == "text", "log.format", "must be json or text, got %q", c.Log.Format)
+
+	check(c.HTTP.Port > 0 && c.HTTP.Port <= 65535, "http.port", "must be between 1 and 65535, got %d", c.HTTP.Port)
+	check(c.HTTP.ReadTimeout > 0, "http.read_timeout", "must be positive, got %s", c.HTTP.ReadTimeout)
+	check(c.HTTP.WriteTimeout > 0, "http.write_timeout", "must be positive, got %s", c.HTTP.WriteTimeout)
+	check(c.HTTP.IdleTimeout > 0, "http.idle_timeout", "must be positive, got %s", c.HTTP.IdleTimeout)
+	check(c.HTTP.DrainDelay >= 0, "http.drain_delay", "cannot be negative, got %s", c.HTTP.DrainDelay)
+	check(c.HTTP.ShutdownTimeout > 0, "http.shutdown_timeout", "must be positive, got %s", c.HTTP.ShutdownTimeout)
+	check(c.HTTP.MaxBodyBytes > 0, "http.max_body_bytes", "must be positive, got %d", c.HTTP.MaxBodyBytes)
+	_, err := c.HTTP.Sunset()
+	check(err == nil, "http.unversioned_sunset", "must be a date like 2027-04-30, got %q", c.HTTP.UnversionedSunset)
+
+	check(c.Database.Host != "", "db.host", "is required")
+	check(c.Database.Port > 0 && c.Database.Port <= 65535, "db.port", "must be between 1 and 65535, got %d", c.Database.Port)
+	check(c.Database.User != "", "db.user", "is required")
+	check(c.Database.Name != "", "db.name", "is required")
+	switch c.Database.SSLMode {
+	case "disable", "allow", "prefer", "require", "verify-ca", "verify-full":
+	default:
+		check(false, "db.sslmode", "must be one of disable, allow, prefer, require, verify-ca, verify-full, got %q", c.Database.SSLMode)
+	}
+	check(c.Database.MaxOpenConns > 0, "db.max_open_conns", "must be positive, got %d", c.Database.MaxOpenConns)
+	check(c.Database.MaxIdleConns >= 0 && c.Database.MaxIdleConns <= c.Database.MaxOpenConns, "db.max_idle_conns", "must be between 0 and db.max_open_conns (%d), got %d", c.Database.MaxOpenConns, c.Database.MaxIdleConns)
+	check(c.Database.ConnMaxLifetime >= 0, "db.conn_max_lifetime", "cannot be negative, got %s", c.Database.ConnMaxLifetime)
+	check(c.Database.ConnectTimeout > 0, "db.connect_timeout", "must be positive, got %s", c.Database.ConnectTimeout)
+
+	check(c.Auth.TokenTTL >= time.Minute, "auth.token_ttl", "must be at least 1m, got %s", c.Auth.TokenTTL)
+	check(c.Auth.BcryptCost >= bcrypt.MinCost && c.Auth.BcryptCost <= bcrypt.MaxCost, "auth.bcrypt_cost", "must be between %d and %d, got %d", bcrypt.MinCost, bcrypt.MaxCost, c.Auth.BcryptCost)
+	check(c.Auth.OIDCStateTTL > 0, "auth.oidc_state_ttl", "must be positive, got %s", c.Auth.OIDCStateTTL)
+	seen := map[string]bool{}
+	for _, p := range c.Auth.OIDCProviders {
+		if p.Name == "" || p.IssuerURL == "" || p.ClientID == "" || p.RedirectURL == "" {
+			errs = append(errs, fmt.Errorf("oidc provider %q: name, issuer_url, client_id and redirect_url are required", p.Name))
+		}
+		if seen[p.Name] {
+			errs = append(errs, fmt.Errorf("oidc provider %q: configured twice", p.Name))
+		}
+		seen[p.Name] = true
+	}
+
+	check(c.Limits.MaxMessageLength > 0, "limits.max_message_length", "must be positive, got %d", c.Limits.MaxMessageLength)
+	check(c.Limits.MaxAttachmentsPerMessage >= 0, "limits.max_attachments_per_message", "cannot be negative, got %d", c.Limits.MaxAttachmentsPerMessage)
+	check(c.Limits.MaxAttachmentBytes > 0, "limits.max_attachment_bytes", "must be positive, got %d", c.Limits.MaxAttachmentBytes)
+	check(c.Limits.IncomingWebhookPerMinute > 0, "limits.incoming_webhook_per_minute", "must be positive, got %d", c.Limits.IncomingWebhookPerMinute)
+
+	check(c.RateLimit.Backend == "memory" || c.RateLimit.Backend == "postgres", "ratelimit.backend", "must be memory or postgres, got %q", c.RateLimit.Backend)
+	check(c.RateLimit.AuthPerMinute >= 0, "ratelimit.auth_per_minute", "cannot be negative, got %d", c.RateLimit.AuthPerMinute)
+	check(c.RateLimit.APIPerMinute >= 0, "ratelimit.api_per_minute", "cannot be negative, got %d", c.RateLimit.APIPerMinute)
+	check(c.RateLimit.MessagesPerMinute >= 0, "ratelimit.messages_per_minute", "cannot be negative, got %d", c.RateLimit.MessagesPerMinute)
+
+	check(c.Webhooks.PollInterval > 0, "webhooks.poll_interval", "must be positive, got %s", c.Webhooks.PollInterval)
+	check(c.Webhooks.BatchSize > 0, "webhooks.batch_size", "must be positive, got %d", c.Webhooks.BatchSize)
+	check(c.Webhooks.MaxAttempts > 0, "webhooks.max_attempts", "must be positive, got %d", c.Webhooks.MaxAttempts)
+	check(c.Webhooks.InitialBackoff > 0, "webhooks.initial_backoff", "must be positive, got %s", c.Webhooks.InitialBackoff)
+	check(c.Webhooks.MaxBackoff >= c.Webhooks.InitialBackoff, "webhooks.max_backoff", "must be at least webhooks.initial_backoff (%s), got %s", c.Webhooks.InitialBackoff, c.Webhooks.MaxBackoff)
+	check(c.Webhooks.RequestTimeout > 0, "webhooks.request_timeout", "must be positive, got %s", c.Webhooks.RequestTimeout)
+
+	check(c.Commands.BotTimeout > 0, "commands.bot_timeout", "must be positive, got %s", c.Commands.BotTimeout)
+
+	switch c.Tracing.Exporter {
+	case "none", "stdout", "otlp":
+	default:
+		check(false, "tracing.exporter", "must be none, stdout or otlp, got %q", c.Tracing.Exporter)
+	}
+	check(c.Tracing.SampleRatio >= 0 && c.Tracing.SampleRatio <= 1, "tracing.sample_ratio", "must be between 0 and 1, got %g", c.Tracing.SampleRatio)
+	check(c.Tracing.ServiceName != "", "tracing.service_name", "is required")
+
+	return errors.Join(errs...)
+}
+
+func envName(key string) string {
+	return strings.ToUpper(strings.NewReplacer(".", "_").Replace(key))
+}
+
+func flagName(key string) string {
+	return strings.NewReplacer(".", "-", "_", "-").Replace(key)
+}
@@ -0,0 +1,387 @@
+package config
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// setting is a single scalar option. Its key is used as-is in the config
+// file ("db.host" is {"db": {"host": ...}}), upper-cased for the environment
+// (DB_HOST) and dashed for flags (-db-host).
+type setting struct {
+	key   string
+	usage string
+	set   func(c *Config, v string) error
+	get   func(c *Config) string
+}
+
+func settings() []setting {
+	return []setting{
+		stringSetting("log.level", "minimum log level: debug, info, warn or error", func(c *Config) *string { return &c.Log.Level }),
+		stringSetting("log.format", "log output format: json or text", func(c *Config) *string { return &c.Log.Format }),
+
+		intSetting("http.port", "port the HTTP server listens on", func(c *Config) *int { return &c.HTTP.Port }),
+		durationSetting("http.read_timeout", "maximum duration for reading a request", func(c *Config) *time.Duration { return &c.HTTP.ReadTimeout }),
+		durationSetting("http.write_timeout", "maximum duration for writing a response", func(c *Config) *time.Duration { return &c.HTTP.WriteTimeout }),
+		durationSetting("http.idle_timeout", "how long idle keep-alive connections stay open", func(c *Config) *time.Duration { return &c.HTTP.IdleTimeout }),
+		durationSetting("http.drain_delay", "how long to keep serving after failing readiness on shutdown", func(c *Config) *time.Duration { return &c.HTTP.DrainDelay }),
+		durationSetting("http.shutdown_timeout", "how long in-flight requests get to finish on shutdown", func(c *Config) *time.Duration { return &c.HTTP.ShutdownTimeout }),
+		int64Setting("http.max_body_bytes", "maximum size of a request body in bytes", func(c *Config) *int64 { return &c.HTTP.MaxBodyBytes }),
+		stringSetting("http.unversioned_sunset", "date (YYYY-MM-DD) announced for removing routes without a version prefix", func(c *Config) *string { return &c.HTTP.UnversionedSunset }),
+
+		stringSetting("db.host", "Postgres host", func(c *Config) *string { return &c.Database.Host }),
+		intSetting("db.port", "Postgres port", func(c *Config) *int { return &c.Database.Port }),
+		stringSetting("db.user", "Postgres user", func(c *Config) *string { return &c.Database.User }),
+		stringSetting("db.password", "Postgres password", func(c *Config) *string { return &c.Database.Password }),
+		stringSetting("db.name", "Postgres database name", func(c *Config) *string { return &c.Database.Name }),
+		stringSetting("db.sslmode", "Postgres sslmode", func(c *Config) *string { return &c.Database.SSLMode }),
+		intSetting("db.max_open_conns", "maximum open database connections", func(c *Config) *int { return &c.Database.MaxOpenConns }),
+		intSetting("db.max_idle_conns", "maximum idle database connections", func(c *Config) *int { return &c.Database.MaxIdleConns }),
+		durationSetting("db.conn_max_lifetime", "maximum lifetime of a database connection, 0 for no limit", func(c *Config) *time.Duration { return &c.Database.ConnMaxLifetime }),
+		durationSetting("db.connect_timeout", "how long to keep retrying the database at startup", func(c *Config) *time.Duration { return &c.Database.ConnectTimeout }),
+
+		durationSetting("auth.token_ttl", "lifetime of login tokens", func(c *Config) *time.Duration { return &c.Auth.TokenTTL }),
+		intSetting("auth.bcrypt_cost", "bcrypt cost for password hashes", func(c *Config) *int { return &c.Auth.BcryptCost }),
+		durationSetting("auth.oidc_state_ttl", "how long an OpenID Connect sign-in may take", func(c *Config) *time.Duration { return &c.Auth.OIDCStateTTL }),
+		int64ListSetting("auth.admin_user_ids", "comma separated ids of the users made platform administrators at startup", func(c *Config) *[]int64 { return &c.Auth.AdminUserIDs }),
+		// moderators became platform administrators, the old key still
+		// grants them so existing config files keep working
+		deprecatedInt64ListSetting("moderation.moderators", "auth.admin_user_ids", func(c *Config) *[]int64 { return &c.Auth.AdminUserIDs }),
+
+		intSetting("limits.max_message_length", "maximum characters in a message", func(c *Config) *int { return &c.Limits.MaxMessageLength }),
+		intSetting("limits.max_attachments_per_message", "maximum attachments on one message", func(c *Config) *int { return &c.Limits.MaxAttachmentsPerMessage }),
+		int64Setting("limits.max_attachment_bytes", "maximum size of one attachment in bytes", func(c *Config) *int64 { return &c.Limits.MaxAttachmentBytes }),
+		intSetting("limits.incoming_webhook_per_minute", "messages a single incoming webhook may post per minute", func(c *Config) *int { return &c.Limits.IncomingWebhookPerMinute }),
+
+		stringSetting("ratelimit.backend", "where rate limit buckets are kept: memory (per instance) or postgres (shared)", func(c *Config) *string { return &c.RateLimit.Backend }),
+		stringSetting("ratelimit.client_ip_header", "header holding the client IP set by the load balancer, empty to use the connection address", func(c *Config) *string { return &c.RateLimit.ClientIPHeader }),
+		intSetting("ratelimit.auth_per_minute", "login and registration attempts per client IP per minute, 0 for no limit", func(c *Config) *int { return &c.RateLimit.AuthPerMinute }),
+		intSetting("ratelimit.api_per_minute", "authenticated requests per user per minute, 0 for no limit", func(c *Config) *int { return &c.RateLimit.APIPerMinute }),
+		intSetting("ratelimit.messages_per_minute", "messages a user may post per minute, 0 for no limit", func(c *Config) *int { return &c.RateLimit.MessagesPerMinute }),
+
+		durationSetting("webhooks.poll_interval", "how often the webhook worker polls for due deliveries", func(c *Config) *time.Duration { return &c.Webhooks.PollInterval }),
+		intSetting("webhooks.batch_size", "deliveries claimed per poll", func(c *Config) *int { return &c.Webhooks.BatchSize }),
+		intSetting("webhooks.max_attempts", "attempts before a delivery is dead-lettered", func(c *Config) *int { return &c.Webhooks.MaxAttempts }),
+		durationSetting("webhooks.initial_backoff", "wait before the first retry, doubled on every attempt", func(c *Config) *time.Duration { return &c.Webhooks.InitialBackoff }),
+		durationSetting("webhooks.max_backoff", "longest wait between retries", func(c *Config) *time.Duration { return &c.Webhooks.MaxBackoff }),
+		durationSetting("webhooks.request_timeout", "timeout for a single delivery", func(c *Config) *time.Duration { return &c.Webhooks.RequestTimeout }),
+
+		durationSetting("commands.bot_timeout", "timeout for calls to slash command bot endpoints", func(c *Config) *time.Duration { return &c.Commands.BotTimeout }),
+
+		boolSetting("metrics.enabled", "serve Prometheus metrics on /metrics", func(c *Config) *bool { return &c.Metrics.Enabled }),
+
+		stringSetting("tracing.exporter", "where to send traces: none, stdout or otlp", func(c *Config) *string { return &c.Tracing.Exporter }),
+		stringSetting("tracing.otlp_endpoint", "OTLP/HTTP collector address, e.g. localhost:4318", func(c *Config) *string { return &c.Tracing.OTLPEndpoint }),
+		floatSetting("tracing.sample_ratio", "fraction of new traces to record, between 0 and 1", func(c *Config) *float64 { return &c.Tracing.SampleRatio }),
+		stringSetting("tracing.service_name", "service.name reported on traces", func(c *Config) *string { return &c.Tracing.ServiceName }),
+	}
+}
+
+// Load builds the configuration from, in increasing order of precedence,
+// the defaults, an optional JSON config file (-config or CONFIG_FILE), the
+// environment and command-line flags, then validates it.
+func Load(args []string) (*Config, error) {
+	cfg := Default()
+	all := settings()
+
+	// flags are parsed first to find the config file, but applied last
+	fs := flag.NewFlagSet("chat-app", flag.ContinueOnError)
+	configFile := fs.String("config", os.Getenv("CONFIG_FILE"), "path to a JSON config file (CONFIG_FILE)")
+	flagValues := map[string]string{}
+	for _, s := range all {
+		s := s
+		fs.Func(flagName(s.key), fmt.Sprintf("%s (%s, default %s)", s.usage, envName(s.key), s.get(cfg)), func(v string) error {
+			flagValues[s.key] = v
+			return s.set(Default(), v)
+		})
+	}
+	err := fs.Parse(args)
+	if err != nil {
+		return nil, err
+	}
+
+	if *configFile != "" {
+		err = loadFile(cfg, all, *configFile)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	for _, s := range all {
+		v, ok := os.LookupEnv(envName(s.key))
+		if !ok {
+			continue
+		}
+		err = s.set(cfg, v)
+		if err != nil {
+			return nil, fmt.Errorf("config: %s: %w", envName(s.key), err)
+		}
+	}
+	providers, err := oidcProvidersFromEnv()
+	if err != nil {
+		return nil, err
+	}
+	if len(providers) > 0 {
+		cfg.Auth.OIDCProviders = providers
+	}
+
+	for _, s := range all {
+		if v, ok := flagValues[s.key]; ok {
+			_ = s.set(cfg, v) // already validated while parsing
+		}
+	}
+
+	err = cfg.Validate()
+	if err != nil {
+		return nil, fmt.Errorf("config: invalid configuration:\n%w", err)
+	}
+	return cfg, nil
+}
+
+func loadFile(cfg *Config, all []setting, path string) error {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("config: %w", err)
+	}
+
+	var doc map[string]interface{}
+	dec := json.NewDecoder(strings.NewReader(string(raw)))
+	dec.UseNumber()
+	err = dec.Decode(&doc)
+	if err != nil {
+		return fmt.Errorf("config: parsing %s: %w", path, err)
+	}
+
+	// OpenID Connect providers are a list and do not fit the flat settings
+	if auth, ok := doc["auth"].(map[string]interface{}); ok {
+		if providers, ok := auth["oidc_providers"]; ok {
+			b, _ := json.Marshal(providers)
+			err = json.Unmarshal(b, &cfg.Auth.OIDCProviders)
+			if err != nil {
+				return fmt.Errorf("config: %s: auth.oidc_providers: %w", path, err)
+			}
+			delete(auth, "oidc_providers")
+		}
+	}
+
+	values := map[string]string{}
+	flatten("", doc, values)
+
+	byKey := make(map[string]setting, len(all))
+	for _, s := range all {
+		byKey[s.key] = s
+	}
+
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		s, ok := byKey[key]
+		if !ok {
+			return fmt.Errorf("config: %s: unknown setting %q", path, key)
+		}
+		err = s.set(cfg, values[key])
+		if err != nil {
+			return fmt.Errorf("config: %s: %s: %w", path, key, err)
+		}
+	}
+	return nil
+}
+
+func flatten(prefix string, node map[string]interface{}, out map[string]string) {
+	for k, v := range node {
+		key := k
+		if prefix != "" {
+			key = prefix + "." + k
+		}
+
+		switch v := v.(type) {
+		case map[string]interface{}:
+			flatten(key, v, out)
+		default:
+			out[key] = fmt.Sprint(v)
+		}
+	}
+}
+
+// oidcProvidersFromEnv reads the providers listed in OIDC_PROVIDERS, e.g.
+// OIDC_PROVIDERS=google,keycloak with OIDC_GOOGLE_ISSUER_URL,
+// OIDC_GOOGLE_CLIENT_ID, OIDC_GOOGLE_CLIENT_SECRET, OIDC_GOOGLE_REDIRECT_URL
+// and an optional space separated OIDC_GOOGLE_SCOPES.
+func oidcProvidersFromEnv() ([]OIDCProvider, error) {
+	var providers []OIDCProvider
+	for _, name := range strings.Split(os.Getenv("OIDC_PROVIDERS"), ",") {
+		name = strings.TrimSpace(strings.ToLower(name))
+		if name == "" {
+			continue
+		}
+
+		prefix := "OIDC_" + strings.ToUpper(name) + "_"
+		p := OIDCProvider{
+			Name:         name,
+			IssuerURL:    os.Getenv(prefix + "ISSUER_URL"),
+			ClientID:     os.Getenv(prefix + "CLIENT_ID"),
+			ClientSecret: os.Getenv(prefix + "CLIENT_SECRET"),
+			RedirectURL:  os.Getenv(prefix + "REDIRECT_URL"),
+			Scopes:       strings.Fields(os.Getenv(prefix + "SCOPES")),
+		}
+
+		if p.IssuerURL == "" || p.ClientID == "" || p.RedirectURL == "" {
+			return nil, fmt.Errorf("config: oidc provider %q needs %sISSUER_URL, %sCLIENT_ID and %sREDIRECT_URL", name, prefix, prefix, prefix)
+		}
+		providers = append(providers, p)
+	}
+	return providers, nil
+}
+
+func stringSetting(key, usage string, field func(c *Config) *string) setting {
+	return setting{
+		key:   key,
+		usage: usage,
+		set:   func(c *Config, v string) error { *field(c) = v; return nil },
+		get:   func(c *Config) string { return strconv.Quote(*field(c)) },
+	}
+}
+
+func intSetting(key, usage string, field func(c *Config) *int) setting {
+	return setting{
+		key:   key,
+		usage: usage,
+		set: func(c *Config, v string) error {
+			n, err := strconv.Atoi(strings.TrimSpace(v))
+			if err != nil {
+				return fmt.Errorf("%q is not a whole number", v)
+			}
+			*field(c) = n
+			return nil
+		},
+		get: func(c *Config) string { return strconv.Itoa(*field(c)) },
+	}
+}
+
+func int64Setting(key, usage string, field func(c *Config) *int64) setting {
+	return setting{
+		key:   key,
+		usage: usage,
+		set: func(c *Config, v string) error {
+			n, err := strconv.ParseInt(strings.TrimSpace(v), 10, 64)
+			if err != nil {
+				return fmt.Errorf("%q is not a whole number", v)
+			}
+			*field(c) = n
+			return nil
+		},
+		get: func(c *Config) string { return strconv.FormatInt(*field(c), 10) },
+	}
+}
+
+// int64ListSetting takes ids separated by commas or spaces; a JSON array in
+// the config file arrives as "[1 2]".
+func int64ListSetting(key, usage string, field func(c *Config) *[]int64) setting {
+	return setting{
+		key:   key,
+		usage: usage,
+		set: func(c *Config, v string) error {
+			ids, err := parseInt64List(v)
+			if err != nil {
+				return err
+			}
+			*field(c) = ids
+			return nil
+		},
+		get: func(c *Config) string {
+			ids := make([]string, len(*field(c)))
+			for i, id := range *field(c) {
+				ids[i] = strconv.FormatInt(id, 10)
+			}
+			return strconv.Quote(strings.Join(ids, ","))
+		},
+	}
+}
+
+// deprecatedInt64ListSetting keeps a renamed list key working. Its ids are
+// added to those of the key that replaced it rather than overriding them.
+func deprecatedInt64ListSetting(key, replacement string, field func(c *Config) *[]int64) setting {
+	return setting{
+		key:   key,
+		usage: "deprecated, use " + replacement,
+		set: func(c *Config, v string) error {
+			ids, err := parseInt64List(v)
+			if err != nil {
+				return err
+			}
+			*field(c) = append(*field(c), ids...)
+			return nil
+		},
+		get: func(c *Config) string { return `""` },
+	}
+}
+
+func parseInt64List(v string) ([]int64, error) {
+	var ids []int64
+	for _, f := range strings.FieldsFunc(v, func(r rune) bool { return r == ',' || r == ' ' || r == '[' || r == ']' }) {
+		n, err := strconv.ParseInt(f, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("%q is not a whole number", f)
+		}
+		ids = append(ids, n)
+	}
+	return ids, nil
+}
+
+func boolSetting(key, usage string, field func(c *Config) *bool) setting {
+	return setting{
+		key:   key,
+		usage: usage,
+		set: func(c *Config, v string) error {
+			b, err := strconv.ParseBool(strings.TrimSpace(v))
+			if err != nil {
+				return fmt.Errorf("%q is not true or false", v)
+			}
+			*field(c) = b
+			return nil
+		},
+		get: func(c *Config) string { return strconv.FormatBool(*field(c)) },
+	}
+}
+
+func floatSetting(key, usage string, field func(c *Config) *float64) setting {
+	return setting{
+		key:   key,
+		usage: usage,
+		set: func(c *Config, v string) error {
+			f, err := strconv.ParseFloat(strings.TrimSpace(v), 64)
+			if err != nil {
+				return fmt.Errorf("%q is not a number", v)
+			}
+			*field(c) = f
+			return nil
+		},
+		get: func(c *Config) string { return strconv.FormatFloat(*field(c), 'g', -1, 64) },
+	}
+}
+
+func durationSetting(key, usage string, field func(c *Config) *time.Duration) setting {
+	return setting{
+		key:   key,
+		usage: usage,
+		set: func(c *Config, v string) error {
+			d, err := time.ParseDuration(strings.TrimSpace(v))
+			if err != nil {
+				return fmt.Errorf("%q is not a duration like 30s or 5m", v)
+			}
+			*field(c) = d
+			return nil
+		},
+		get: func(c *Config) string { return field(c).String() },
+	}
+}
@@ -0,0 +1,219 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func writeConfig(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.json")
+	err := os.WriteFile(path, []byte(content), 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestModeratorsKeyStillGrantsAdmin(t *testing.T) {
+	path := writeConfig(t, `{"auth": {"admin_user_ids": [1, 2]}, "moderation": {"moderators": [3]}}`)
+	cfg, err := Load([]string{"-config", path})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []int64{1, 2, 3}; !reflect.DeepEqual(cfg.Auth.AdminUserIDs, want) {
+		t.Errorf("admin user ids %v, want %v", cfg.Auth.AdminUserIDs, want)
+	}
+
+	t.Setenv("MODERATION_MODERATORS", "4,5")
+	cfg, err = Load(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []int64{4, 5}; !reflect.DeepEqual(cfg.Auth.AdminUserIDs, want) {
+		t.Errorf("admin user ids from the environment %v, want %v", cfg.Auth.AdminUserIDs, want)
+	}
+}
+
+func TestLoadPrecedence(t *testing.T) {
+	tests := []struct {
+		name string
+		file string
+		env  map[string]string
+		args []string
+		port int
+		ttl  time.Duration
+	}{
+		{name: "defaults", port: 8080, ttl: 24 * time.Hour},
+		{name: "file over defaults", file: `{"http": {"port": 9000}, "auth": {"token_ttl": "1h"}}`, port: 9000, ttl: time.Hour},
+		{name: "env over file", file: `{"http": {"port": 9000}, "auth": {"token_ttl": "1h"}}`, env: map[string]string{"HTTP_PORT": "9001"}, port: 9001, ttl: time.Hour},
+		{name: "flags over env", file: `{"http": {"port": 9000}}`, env: map[string]string{"HTTP_PORT": "9001", "AUTH_TOKEN_TTL": "2h"}, args: []string{"-http-port", "9002"}, port: 9002, ttl: 2 * time.Hour},
+		{name: "flags over file", file: `{"auth": {"token_ttl": "1h"}}`, args: []string{"-auth-token-ttl", "3h"}, port: 8080, ttl: 3 * time.Hour},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for k, v := range tt.env {
+				t.Setenv(k, v)
+			}
+			args := tt.args
+			if tt.file != "" {
+				args = append([]string{"-config", writeConfig(t, tt.file)}, args...)
+			}
+
+			cfg, err := Load(args)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if cfg.HTTP.Port != tt.port {
+				t.Errorf("http.port %d, want %d", cfg.HTTP.Port, tt.port)
+			}
+			if cfg.Auth.TokenTTL != tt.ttl {
+				t.Errorf("auth.token_ttl %s, want %s", cfg.Auth.TokenTTL, tt.ttl)
+			}
+		})
+	}
+}
+
+func TestLoadRejectsBadSettings(t *testing.T) {
+	tests := []struct {
+		name    string
+		file    string
+		env     map[string]string
+		args    []string
+		wantErr string
+	}{
+		{name: "unknown key in the file", file: `{"http": {"prot": 9000}}`, wantErr: `unknown setting "http.prot"`},
+		{name: "unknown section in the file", file: `{"moderaton": {"moderators": [1]}}`, wantErr: `unknown setting "moderaton.moderators"`},
+		{name: "unknown flag", args: []string{"-http-prot", "9000"}, wantErr: "http-prot"},
+		{name: "bad duration in the file", file: `{"http": {"read_timeout": "10"}}`, wantErr: "http.read_timeout"},
+		{name: "bad duration in the environment", env: map[string]string{"WEBHOOKS_MAX_BACKOFF": "an hour"}, wantErr: "WEBHOOKS_MAX_BACKOFF"},
+		{name: "bad duration flag", args: []string{"-auth-token-ttl", "1 day"}, wantErr: "auth-token-ttl"},
+		{name: "bad number in the file", file: `{"db": {"port": "five"}}`, wantErr: "db.port"},
+		{name: "bad number in the environment", env: map[string]string{"HTTP_PORT": "80a"}, wantErr: "HTTP_PORT"},
+		{name: "fraction for a whole number", env: map[string]string{"LIMITS_MAX_MESSAGE_LENGTH": "1.5"}, wantErr: "not a whole number"},
+		{name: "bad float", env: map[string]string{"TRACING_SAMPLE_RATIO": "half"}, wantErr: "not a number"},
+		{name: "bad bool", env: map[string]string{"METRICS_ENABLED": "yes please"}, wantErr: "not true or false"},
+		{name: "bad id list", env: map[string]string{"AUTH_ADMIN_USER_IDS": "1,two"}, wantErr: "not a whole number"},
+		{name: "out of range value", args: []string{"-http-port", "70000"}, wantErr: "http.port"},
+		{name: "not JSON", file: `http.port = 9000`, wantErr: "parsing"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for k, v := range tt.env {
+				t.Setenv(k, v)
+			}
+			args := tt.args
+			if tt.file != "" {
+				args = append([]string{"-config", writeConfig(t, tt.file)}, args...)
+			}
+
+			_, err := Load(args)
+			if err == nil {
+				t.Fatal("loaded without an error")
+			}
+			if !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("error %q, want it to mention %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestOIDCProvidersFromEnv(t *testing.T) {
+	tests := []struct {
+		name    string
+		env     map[string]string
+		want    []OIDCProvider
+		wantErr string
+	}{
+		{name: "none"},
+		{
+			name: "one provider",
+			env: map[string]string{
+				"OIDC_PROVIDERS":            "Google",
+				"OIDC_GOOGLE_ISSUER_URL":    "https://accounts.google.com",
+				"OIDC_GOOGLE_CLIENT_ID":     "id",
+				"OIDC_GOOGLE_CLIENT_SECRET": "secret",
+				"OIDC_GOOGLE_REDIRECT_URL":  "https://chat.example.com/auth/oidc/google/callback",
+				"OIDC_GOOGLE_SCOPES":        "openid email",
+			},
+			want: []OIDCProvider{{Name: "google", IssuerURL: "https://accounts.google.com", ClientID: "id", ClientSecret: "secret", RedirectURL: "https://chat.example.com/auth/oidc/google/callback", Scopes: []string{"openid", "email"}}},
+		},
+		{
+			name: "two providers, blanks skipped",
+			env: map[string]string{
+				"OIDC_PROVIDERS":             "google, ,keycloak",
+				"OIDC_GOOGLE_ISSUER_URL":     "https://accounts.google.com",
+				"OIDC_GOOGLE_CLIENT_ID":      "g",
+				"OIDC_GOOGLE_REDIRECT_URL":   "https://chat.example.com/g",
+				"OIDC_KEYCLOAK_ISSUER_URL":   "https://sso.example.com/realms/chat",
+				"OIDC_KEYCLOAK_CLIENT_ID":    "k",
+				"OIDC_KEYCLOAK_REDIRECT_URL": "https://chat.example.com/k",
+			},
+			want: []OIDCProvider{
+				{Name: "google", IssuerURL: "https://accounts.google.com", ClientID: "g", RedirectURL: "https://chat.example.com/g", Scopes: []string{}},
+				{Name: "keycloak", IssuerURL: "https://sso.example.com/realms/chat", ClientID: "k", RedirectURL: "https://chat.example.com/k", Scopes: []string{}},
+			},
+		},
+		{
+			name: "missing client id",
+			env: map[string]string{
+				"OIDC_PROVIDERS":           "google",
+				"OIDC_GOOGLE_ISSUER_URL":   "https://accounts.google.com",
+				"OIDC_GOOGLE_REDIRECT_URL": "https://chat.example.com/g",
+			},
+			wantErr: "OIDC_GOOGLE_CLIENT_ID",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for k, v := range tt.env {
+				t.Setenv(k, v)
+			}
+
+			got, err := oidcProvidersFromEnv()
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("error %v, want it to mention %s", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("providers %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestOIDCProvidersFromEnvReplaceTheFile(t *testing.T) {
+	path := writeConfig(t, `{"auth": {"oidc_providers": [{"name": "gitlab", "issuer_url": "https://gitlab.com", "client_id": "f", "redirect_url": "https://chat.example.com/f"}]}}`)
+
+	cfg, err := Load([]string{"-config", path})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cfg.Auth.OIDCProviders) != 1 || cfg.Auth.OIDCProviders[0].Name != "gitlab" {
+		t.Errorf("providers from the file %+v", cfg.Auth.OIDCProviders)
+	}
+
+	t.Setenv("OIDC_PROVIDERS", "google")
+	t.Setenv("OIDC_GOOGLE_ISSUER_URL", "https://accounts.google.com")
+	t.Setenv("OIDC_GOOGLE_CLIENT_ID", "g")
+	t.Setenv("OIDC_GOOGLE_REDIRECT_URL", "https://chat.example.com/g")
+	cfg, err = Load([]string{"-config", path})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cfg.Auth.OIDCProviders) != 1 || cfg.Auth.OIDCProviders[0].Name != "google" {
+		t.Errorf("providers with OIDC_PROVIDERS set %+v", cfg.Auth.OIDCProviders)
+	}
+}
@@ -0,0 +1,134 @@
+// Package filter runs the content filter rules of a chat over messages.
+// Each rule is a stage of some kind (a word list, a regex, ...) and an
+// action deciding what happens when the stage finds something.
+package filter
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	"github.com/Abhishek-B-R/chat-app-golang/internals/store"
+)
+
+// Stage checks a message. Apply returns the content with the stage's
+// replacements made and whether the stage found anything.
+type Stage interface {
+	Apply(content string) (replaced string, hit bool)
+}
+
+// Factory builds a stage from a rule's config. It rejects configs it can't
+// use, and actions the stage doesn't support, with an error meant for the
+// admin writing the rule.
+type Factory func(config json.RawMessage, action store.FilterAction) (Stage, error)
+
+var factories = map[store.FilterKind]Factory{}
+
+// Register makes a kind of stage available to rules.
+func Register(kind store.FilterKind, factory Factory) {
+	factories[kind] = factory
+}
+
+// Kinds lists the registered kinds of stages.
+func Kinds() []string {
+	kinds := make([]string, 0, len(factories))
+	for kind := range factories {
+		kinds = append(kinds, string(kind))
+	}
+	sort.Strings(kinds)
+	return kinds
+}
+
+func ValidKind(kind store.FilterKind) bool {
+	_, ok := factories[kind]
+	return ok
+}
+
+func ValidAction(action store.FilterAction) bool {
+	return action == store.FilterMatch || action == store.FilterReplace || action == store.FilterReject
+}
+
+// Rule is a content filter ready to run.
+type Rule struct {
+	Filter *store.ContentFilter
+	stage  Stage
+}
+
+// Compile checks a rule's kind, action and config and prepares its stage.
+func Compile(f *store.ContentFilter) (*Rule, error) {
+	factory, ok := factories[f.Kind]
+	if !ok {
+		return nil, fmt.Errorf("unknown kind %q", f.Kind)
+	}
+	if !ValidAction(f.Action) {
+		return nil, fmt.Errorf("unknown action %q", f.Action)
+	}
+
+	stage, err := factory(f.Config, f.Action)
+	if err != nil {
+		return nil, err
+	}
+	return &Rule{Filter: f, stage: stage}, nil
+}
+
+// Pipeline runs rules in order over a message.
+type Pipeline struct {
+	rules []*Rule
+}
+
+func New(filters []*store.ContentFilter) (*Pipeline, error) {
+	p := &Pipeline{}
+	for _, f := range filters {
+		rule, err := Compile(f)
+		if err != nil {
+			return nil, fmt.Errorf("content filter %d: %w", f.ID, err)
+		}
+		p.rules = append(p.rules, rule)
+	}
+	return p, nil
+}
+
+type Result struct {
+	// Content is the message after the replace rules that fired
+	Content string
+	// Hits are the rules that fired, in order
+	Hits []*store.ContentFilter
+	// Rejected is the rule that rejected the message, if any. The pipeline
+	// stops at the first rejection.
+	Rejected *store.ContentFilter
+}
+
+func (p *Pipeline) Run(content string) *Result {
+	res := &Result{Content: content}
+	for _, rule := range p.rules {
+		replaced, hit := rule.stage.Apply(res.Content)
+		if !hit {
+			continue
+		}
+		res.Hits = append(res.Hits, rule.Filter)
+
+		switch rule.Filter.Action {
+		case store.FilterReject:
+			res.Rejected = rule.Filter
+			return res
+		case store.FilterReplace:
+			res.Content = replaced
+		}
+	}
+	return res
+}
+
+// decodeConfig decodes a rule's config into dst, refusing unknown fields so
+// typos in a rule don't go unnoticed.
+func decodeConfig(config json.RawMessage, dst any) error {
+	if len(config) == 0 {
+		config = json.RawMessage(`{}`)
+	}
+	dec := json.NewDecoder(bytes.NewReader(config))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(dst); err != nil {
+		return fmt.Errorf("invalid config: %w", err)
+	}
+	return nil
+}
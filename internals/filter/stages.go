@@ -0,0 +1,271 @@
+package filter
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/Abhishek-B-R/chat-app-golang/internals/store"
+)
+
+const (
+	maxWords          = 500
+	maxWordLength     = 64
+	maxPatternLength  = 512
+	maxDomains        = 500
+	maxReplacementLen = 64
+	maxMentions       = 100
+
+	linkReplacement = "[link removed]"
+)
+
+var (
+	linkPattern    = regexp.MustCompile(`(?i)\b(?:https?://|www\.)[^\s<>"']+`)
+	mentionPattern = regexp.MustCompile(`(?i)(?:^|[^\w@])@[a-z0-9][a-z0-9_.-]*`)
+)
+
+func init() {
+	Register(store.FilterWords, newWordStage)
+	Register(store.FilterRegex, newRegexStage)
+	Register(store.FilterDomains, newDomainStage)
+	Register(store.FilterMentions, newMentionStage)
+}
+
+func checkReplacement(replacement string, action store.FilterAction) error {
+	if utf8.RuneCountInString(replacement) > maxReplacementLen {
+		return fmt.Errorf("replacement cannot be longer than %d characters", maxReplacementLen)
+	}
+	if replacement != "" && action != store.FilterReplace {
+		return errors.New("replacement is only used by the replace action")
+	}
+	return nil
+}
+
+// replace swaps the matches in content for replacement, or masks each of
+// their characters with * when replacement is empty.
+func replace(content string, matches [][]int, replacement string) string {
+	var b strings.Builder
+	last := 0
+	for _, m := range matches {
+		b.WriteString(content[last:m[0]])
+		if replacement == "" {
+			b.WriteString(strings.Repeat("*", utf8.RuneCountInString(content[m[0]:m[1]])))
+		} else {
+			b.WriteString(replacement)
+		}
+		last = m[1]
+	}
+	b.WriteString(content[last:])
+	return b.String()
+}
+
+// wordStage matches whole words from a list, ignoring case: "ass" fires on
+// "Ass!" but not on "class".
+type wordStage struct {
+	pattern     *regexp.Regexp
+	replacement string
+}
+
+func newWordStage(config json.RawMessage, action store.FilterAction) (Stage, error) {
+	var cfg struct {
+		Words       []string `json:"words"`
+		Replacement string   `json:"replacement"`
+	}
+	if err := decodeConfig(config, &cfg); err != nil {
+		return nil, err
+	}
+	if len(cfg.Words) == 0 || len(cfg.Words) > maxWords {
+		return nil, fmt.Errorf("words must list between 1 and %d words", maxWords)
+	}
+	if err := checkReplacement(cfg.Replacement, action); err != nil {
+		return nil, err
+	}
+
+	words := make([]string, 0, len(cfg.Words))
+	for _, word := range cfg.Words {
+		word = strings.TrimSpace(word)
+		if word == "" || utf8.RuneCountInString(word) > maxWordLength {
+			return nil, fmt.Errorf("words must be 1 to %d characters", maxWordLength)
+		}
+		words = append(words, regexp.QuoteMeta(word))
+	}
+	// longest first, so "bad word" wins over "bad"
+	sort.Slice(words, func(i, j int) bool { return len(words[i]) > len(words[j]) })
+
+	return &wordStage{
+		pattern:     regexp.MustCompile(`(?i)` + strings.Join(words, "|")),
+		replacement: cfg.Replacement,
+	}, nil
+}
+
+func (s *wordStage) Apply(content string) (string, bool) {
+	var matches [][]int
+	for _, m := range s.pattern.FindAllStringIndex(content, -1) {
+		if isWordBoundary(content, m[0], m[1]) {
+			matches = append(matches, m)
+		}
+	}
+	if len(matches) == 0 {
+		return content, false
+	}
+	return replace(content, matches, s.replacement), true
+}
+
+func isWordBoundary(content string, start, end int) bool {
+	before, _ := utf8.DecodeLastRuneInString(content[:start])
+	after, _ := utf8.DecodeRuneInString(content[end:])
+	return (start == 0 || !isWordRune(before)) && (end == len(content) || !isWordRune(after))
+}
+
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_'
+}
+
+// regexStage matches a regular expression (RE2 syntax), case sensitive
+// unless the pattern starts with (?i).
+type regexStage struct {
+	pattern     *regexp.Regexp
+	replacement string
+}
+
+func newRegexStage(config json.RawMessage, action store.FilterAction) (Stage, error) {
+	var cfg struct {
+		Pattern     string `json:"pattern"`
+		Replacement string `json:"replacement"`
+	}
+	if err := decodeConfig(config, &cfg); err != nil {
+		return nil, err
+	}
+	if cfg.Pattern == "" || len(cfg.Pattern) > maxPatternLength {
+		return nil, fmt.Errorf("pattern must be 1 to %d characters", maxPatternLength)
+	}
+	if err := checkReplacement(cfg.Replacement, action); err != nil {
+		return nil, err
+	}
+
+	pattern, err := regexp.Compile(cfg.Pattern)
+	if err != nil {
+		return nil, fmt.Errorf("invalid pattern: %w", err)
+	}
+	if pattern.MatchString("") {
+		return nil, errors.New("pattern must not match an empty message")
+	}
+
+	return &regexStage{pattern: pattern, replacement: cfg.Replacement}, nil
+}
+
+func (s *regexStage) Apply(content string) (string, bool) {
+	matches := s.pattern.FindAllStringIndex(content, -1)
+	if len(matches) == 0 {
+		return content, false
+	}
+	return replace(content, matches, s.replacement), true
+}
+
+// domainStage checks the links in a message. In deny mode it fires on links
+// to the listed domains, in allow mode on links to any other domain. A
+// domain covers its subdomains.
+type domainStage struct {
+	allow       bool
+	domains     []string
+	replacement string
+}
+
+func newDomainStage(config json.RawMessage, action store.FilterAction) (Stage, error) {
+	var cfg struct {
+		Mode        string   `json:"mode"`
+		Domains     []string `json:"domains"`
+		Replacement string   `json:"replacement"`
+	}
+	if err := decodeConfig(config, &cfg); err != nil {
+		return nil, err
+	}
+	if cfg.Mode != "allow" && cfg.Mode != "deny" {
+		return nil, errors.New("mode must be allow or deny")
+	}
+	if len(cfg.Domains) > maxDomains || (cfg.Mode == "deny" && len(cfg.Domains) == 0) {
+		return nil, fmt.Errorf("domains must list between 1 and %d domains", maxDomains)
+	}
+	if err := checkReplacement(cfg.Replacement, action); err != nil {
+		return nil, err
+	}
+
+	s := &domainStage{allow: cfg.Mode == "allow", replacement: cfg.Replacement}
+	if s.replacement == "" {
+		s.replacement = linkReplacement
+	}
+	for _, domain := range cfg.Domains {
+		domain = strings.TrimPrefix(strings.ToLower(strings.TrimSpace(domain)), "*.")
+		domain = strings.Trim(domain, ".")
+		if domain == "" || strings.ContainsAny(domain, "/:@ ") {
+			return nil, fmt.Errorf("%q is not a domain name", domain)
+		}
+		s.domains = append(s.domains, domain)
+	}
+	return s, nil
+}
+
+func (s *domainStage) Apply(content string) (string, bool) {
+	var matches [][]int
+	for _, m := range linkPattern.FindAllStringIndex(content, -1) {
+		if s.listed(linkHost(content[m[0]:m[1]])) != s.allow {
+			matches = append(matches, m)
+		}
+	}
+	if len(matches) == 0 {
+		return content, false
+	}
+	return replace(content, matches, s.replacement), true
+}
+
+func (s *domainStage) listed(host string) bool {
+	for _, domain := range s.domains {
+		if host == domain || strings.HasSuffix(host, "."+domain) {
+			return true
+		}
+	}
+	return false
+}
+
+func linkHost(link string) string {
+	if !strings.Contains(link, "://") {
+		link = "http://" + link
+	}
+	u, err := url.Parse(link)
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSuffix(strings.ToLower(u.Hostname()), ".")
+}
+
+// mentionStage fires when a message mentions more than max users, to stop
+// mass mention spam. It can't replace anything.
+type mentionStage struct {
+	max int
+}
+
+func newMentionStage(config json.RawMessage, action store.FilterAction) (Stage, error) {
+	var cfg struct {
+		Max *int `json:"max"`
+	}
+	if err := decodeConfig(config, &cfg); err != nil {
+		return nil, err
+	}
+	if cfg.Max == nil || *cfg.Max < 0 || *cfg.Max > maxMentions {
+		return nil, fmt.Errorf("max must be between 0 and %d", maxMentions)
+	}
+	if action == store.FilterReplace {
+		return nil, errors.New("mentions rules can only match or reject")
+	}
+	return &mentionStage{max: *cfg.Max}, nil
+}
+
+func (s *mentionStage) Apply(content string) (string, bool) {
+	return content, len(mentionPattern.FindAllStringIndex(content, -1)) > s.max
+}
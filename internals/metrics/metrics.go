@@ -0,0 +1,57 @@
+package metrics
+
+import (
+	"database/sql"
+	"net/http"
+	"time"
+)
+
+// Message sources for MessageCreated.
+const (
+	SourceUser            = "user"
+	SourceCommand         = "command"
+	SourceIncomingWebhook = "incoming_webhook"
+)
+
+// Login methods and results for Login.
+const (
+	LoginPassword = "password"
+	LoginOIDC     = "oidc"
+
+	LoginSuccess = "success"
+	LoginFailure = "failure"
+)
+
+// Recorder is what the rest of the app reports to. It is kept small so
+// handlers and workers do not depend on a particular metrics library.
+type Recorder interface {
+	HTTPRequest(method, route string, status int, duration time.Duration)
+	// ConnectionOpened and ConnectionClosed track open client connections.
+	ConnectionOpened()
+	ConnectionClosed()
+	MessageCreated(source string)
+	Login(method, result string)
+	// ContentFiltered counts content filter rules firing on messages, by
+	// the rule's kind and action.
+	ContentFiltered(kind, action string)
+	// JobOutcome counts the results of background work, e.g. job "webhook"
+	// with outcome "delivered", "retrying" or "dead".
+	JobOutcome(job, outcome string)
+	// WatchDB exports the connection pool statistics of db.
+	WatchDB(db *sql.DB)
+	// Handler serves the metrics for scraping.
+	Handler() http.Handler
+}
+
+// Nop discards everything, for when metrics are turned off.
+type Nop struct{}
+
+func (Nop) HTTPRequest(method, route string, status int, duration time.Duration) {}
+func (Nop) ConnectionOpened()                                                     {}
+func (Nop) ConnectionClosed()                                                     {}
+func (Nop) MessageCreated(source string)                                          {}
+func (Nop) Login(method, result string)                                           {}
+func (Nop) ContentFiltered(kind, action string)                                   {}
+func (Nop) JobOutcome(job, outcome string)                                        {}
+func (Nop) WatchDB(db *sql.DB)                                                    {}
+func (Nop) Handler() http.Handler                                                 { return http.NotFoundHandler() }
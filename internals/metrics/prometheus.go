@@ -0,0 +1,120 @@
+package metrics
+
+import (
+	"database/sql"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "chat"
+
+type Prometheus struct {
+	registry *prometheus.Registry
+
+	httpRequests    *prometheus.CounterVec
+	httpDuration    *prometheus.HistogramVec
+	openConnections prometheus.Gauge
+	messagesCreated *prometheus.CounterVec
+	logins          *prometheus.CounterVec
+	filtered        *prometheus.CounterVec
+	jobs            *prometheus.CounterVec
+}
+
+func NewPrometheus() *Prometheus {
+	p := &Prometheus{
+		registry: prometheus.NewRegistry(),
+		httpRequests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "http_requests_total",
+			Help:      "HTTP requests by method, route pattern and status code.",
+		}, []string{"method", "route", "status"}),
+		httpDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "http_request_duration_seconds",
+			Help:      "HTTP request latency by method, route pattern and status code.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"method", "route", "status"}),
+		openConnections: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "http_open_connections",
+			Help:      "Client connections currently open to the HTTP server.",
+		}),
+		messagesCreated: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "messages_created_total",
+			Help:      "Messages stored, by where they came from.",
+		}, []string{"source"}),
+		logins: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "logins_total",
+			Help:      "Login attempts by method and result.",
+		}, []string{"method", "result"}),
+		filtered: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "content_filter_hits_total",
+			Help:      "Content filter rules that fired on a message, by kind and action.",
+		}, []string{"kind", "action"}),
+		jobs: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "jobs_total",
+			Help:      "Background job runs by job and outcome.",
+		}, []string{"job", "outcome"}),
+	}
+
+	p.registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		p.httpRequests,
+		p.httpDuration,
+		p.openConnections,
+		p.messagesCreated,
+		p.logins,
+		p.filtered,
+		p.jobs,
+	)
+	return p
+}
+
+func (p *Prometheus) HTTPRequest(method, route string, status int, duration time.Duration) {
+	code := strconv.Itoa(status)
+	p.httpRequests.WithLabelValues(method, route, code).Inc()
+	p.httpDuration.WithLabelValues(method, route, code).Observe(duration.Seconds())
+}
+
+func (p *Prometheus) ConnectionOpened() {
+	p.openConnections.Inc()
+}
+
+func (p *Prometheus) ConnectionClosed() {
+	p.openConnections.Dec()
+}
+
+func (p *Prometheus) MessageCreated(source string) {
+	p.messagesCreated.WithLabelValues(source).Inc()
+}
+
+func (p *Prometheus) Login(method, result string) {
+	p.logins.WithLabelValues(method, result).Inc()
+}
+
+func (p *Prometheus) ContentFiltered(kind, action string) {
+	p.filtered.WithLabelValues(kind, action).Inc()
+}
+
+func (p *Prometheus) JobOutcome(job, outcome string) {
+	p.jobs.WithLabelValues(job, outcome).Inc()
+}
+
+// WatchDB exports db.Stats() as go_sql_* metrics on every scrape.
+func (p *Prometheus) WatchDB(db *sql.DB) {
+	p.registry.MustRegister(collectors.NewDBStatsCollector(db, "postgres"))
+}
+
+func (p *Prometheus) Handler() http.Handler {
+	return promhttp.HandlerFor(p.registry, promhttp.HandlerOpts{Registry: p.registry})
+}
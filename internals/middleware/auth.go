@@ -2,22 +2,27 @@ package middleware
 
 import (
 	"context"
-	"fmt"
 	"net/http"
 	"strings"
 
+	"github.com/Abhishek-B-R/chat-app-golang/internals/apierror"
+	"github.com/Abhishek-B-R/chat-app-golang/internals/logging"
 	"github.com/Abhishek-B-R/chat-app-golang/internals/store"
-	"github.com/Abhishek-B-R/chat-app-golang/internals/utils"
+	"github.com/Abhishek-B-R/chat-app-golang/internals/tokens"
+	"github.com/Abhishek-B-R/chat-app-golang/internals/tracing"
 )
 
 type UserMiddleware struct{
 	UserStore store.UserStore
+	APIKeyStore store.APIKeyStore
 }
 
 type contextKey string
 const UserContextKey = contextKey("user")
+const APIKeyContextKey = contextKey("api_key")
 
 func SetUser(r *http.Request, user *store.User) *http.Request {
+	logging.With(r.Context(), "user_id", user.ID)
 	ctx := context.WithValue(r.Context(), UserContextKey, user)
 	return r.WithContext(ctx)
 }
@@ -27,33 +32,126 @@ func GetUser(r *http.Request) (*store.User, bool) {
 	return user, ok && user != nil
 }
 
+func SetAPIKey(r *http.Request, key *store.APIKey) *http.Request {
+	logging.With(r.Context(), "api_key_id", key.ID)
+	ctx := context.WithValue(r.Context(), APIKeyContextKey, key)
+	return r.WithContext(ctx)
+}
+
+// GetAPIKey returns the API key the request was authenticated with, if the
+// caller is a bot rather than a logged in user.
+func GetAPIKey(r *http.Request) (*store.APIKey, bool) {
+	key, ok := r.Context().Value(APIKeyContextKey).(*store.APIKey)
+	return key, ok && key != nil
+}
+
 func (um *UserMiddleware) Authenticate(next http.Handler) http.Handler{
 	return http.HandlerFunc(func (w http.ResponseWriter, r *http.Request){
 		// in this anonymous fn, we can interject any incoming requests to our server
 
+		spanCtx, span := tracing.Start(r.Context(), "middleware.Authenticate")
+		defer span.End()
+
 		w.Header().Add("Vary","Authorization")
 		authHeader := r.Header.Get("Authorization")
 
 		if authHeader == "" {
-			utils.WriteJSON(w, http.StatusUnauthorized, utils.Envelope{"error":"missing authorization header"})
+			apierror.Write(w, r, apierror.Unauthorized("missing authorization header"))
 			return
 		}
 
 		parts := strings.Fields(authHeader)
 		if len(parts) != 2 || parts[0] != "Bearer" {
-			utils.WriteJSON(w, http.StatusUnauthorized, utils.Envelope{"error":"invalid authorization header"})
+			apierror.Write(w, r, apierror.Unauthorized("invalid authorization header"))
 			return
 		}
 		token := parts[1]
 
-		user, err := um.UserStore.GetUserToken(r.Context(), token)
+		// bot API keys travel in the same header and are told apart by their prefix
+		if strings.HasPrefix(token, tokens.APIKeyPrefix) {
+			user, key, err := um.APIKeyStore.GetUserByAPIKey(spanCtx, token)
+			if err != nil {
+				logging.FromContext(r.Context()).Error("getUserByAPIKey", "error", err)
+			}
+			if err != nil || user == nil {
+				apierror.Write(w, r, apierror.Unauthorized("invalid, expired or revoked api key"))
+				return
+			}
+			if user.Suspended() {
+				apierror.Write(w, r, accountSuspended())
+				return
+			}
+
+			span.End()
+			r = SetUser(r, user)
+			r = SetAPIKey(r, key)
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		user, err := um.UserStore.GetUserToken(spanCtx, token)
 		if err != nil {
-			fmt.Println(err)
-			utils.WriteJSON(w, http.StatusUnauthorized, utils.Envelope{"error":"invalid or expired token"})
+			logging.FromContext(r.Context()).Error("getUserToken", "error", err)
+		}
+		if err != nil || user == nil {
+			apierror.Write(w, r, apierror.Unauthorized("invalid or expired token"))
+			return
+		}
+		if user.Suspended() {
+			apierror.Write(w, r, accountSuspended())
 			return
 		}
 
+		span.End()
 		r = SetUser(r, user)
 		next.ServeHTTP(w, r)
 	})
-}
\ No newline at end of file
+}
+
+func accountSuspended() *apierror.Error {
+	return apierror.Forbidden("this account is suspended").WithCode(apierror.CodeAccountSuspended)
+}
+
+// RequirePlatformAdmin lets only platform administrators through. It must
+// run after Authenticate, and API keys never pass: bots can't be admins.
+func (um *UserMiddleware) RequirePlatformAdmin(next http.Handler) http.Handler {
+	return http.HandlerFunc(func (w http.ResponseWriter, r *http.Request){
+		user, ok := GetUser(r)
+		if !ok {
+			apierror.Write(w, r, apierror.Unauthorized("signin to continue"))
+			return
+		}
+		if _, isAPIKey := GetAPIKey(r); isAPIKey || !user.IsAdmin {
+			apierror.Write(w, r, apierror.Forbidden("only platform administrators can do this"))
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// RequireScope lets API key requests through only when the key carries scope.
+// Requests made with a user's session token are not affected.
+func (um *UserMiddleware) RequireScope(scope string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func (w http.ResponseWriter, r *http.Request){
+			key, ok := GetAPIKey(r)
+			if ok && !key.HasScope(scope) {
+				apierror.Write(w, r, apierror.Forbidden("api key is missing the " + scope + " scope"))
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// RequireSession rejects API key requests on routes that only a logged in
+// user may call.
+func (um *UserMiddleware) RequireSession(next http.Handler) http.Handler {
+	return http.HandlerFunc(func (w http.ResponseWriter, r *http.Request){
+		if _, ok := GetAPIKey(r); ok {
+			apierror.Write(w, r, apierror.Forbidden("this endpoint cannot be used with an api key"))
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -2,9 +2,13 @@ package middleware
 
 import (
 	"context"
+	"errors"
 	"net/http"
 
+	"github.com/Abhishek-B-R/chat-app-golang/internals/apierror"
+	"github.com/Abhishek-B-R/chat-app-golang/internals/logging"
 	"github.com/Abhishek-B-R/chat-app-golang/internals/store"
+	"github.com/Abhishek-B-R/chat-app-golang/internals/tracing"
 	"github.com/Abhishek-B-R/chat-app-golang/internals/utils"
 )
 
@@ -27,25 +31,75 @@ func GetChatMembership(r *http.Request) (*store.ChatMember, bool) {
 
 func (cm *ChatMiddleware) RequireMembership(next http.Handler) http.Handler{
 	return http.HandlerFunc(func (w http.ResponseWriter, r *http.Request){
+		// the span covers the check only, the handler is not nested in it
+		spanCtx, span := tracing.Start(r.Context(), "middleware.RequireMembership")
+		defer span.End()
+
 		user, ok := GetUser(r)
 		if !ok {
-			utils.WriteJSON(w, http.StatusUnauthorized, utils.Envelope{"error":"signin to continue"})
+			apierror.Write(w, r, apierror.Unauthorized("signin to continue"))
 			return
 		}
 
 		chatID, err := utils.ReadParam(r,"chatID")
 		if err != nil {
-			utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid chat ID"})
+			apierror.Write(w, r, apierror.BadRequest("invalid chat ID"))
+			return
+		}
+
+		if key, ok := GetAPIKey(r); ok && !key.AllowsChat(chatID) {
+			apierror.Write(w, r, apierror.Forbidden("api key is not allowed in this chat"))
 			return
 		}
 
-		isMember, err := cm.ChatMemberStore.IsMember(r.Context(), chatID, user.ID)
-		if err != nil || !isMember {
-			utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error":"you are not a member of this chat"})
+		isMember, err := cm.ChatMemberStore.IsMember(spanCtx, chatID, user.ID)
+		if err != nil {
+			logging.FromContext(r.Context()).Error("isMember", "error", err)
+			apierror.Write(w, r, apierror.Internal("internal server error"))
+			return
+		}
+		if !isMember {
+			apierror.Write(w, r, apierror.Forbidden("you are not a member of this chat").WithCode(apierror.CodeNotChatMember))
 			return
 		}
+		span.End()
 
 		ctx := context.WithValue(r.Context(), "chatID", chatID)
 		next.ServeHTTP(w, r.WithContext(ctx))
 	})
-}
\ No newline at end of file
+}
+
+// RequireAdmin lets only the chat's owners and admins through. It is meant
+// to be used after RequireMembership.
+func (cm *ChatMiddleware) RequireAdmin(next http.Handler) http.Handler{
+	return http.HandlerFunc(func (w http.ResponseWriter, r *http.Request){
+		spanCtx, span := tracing.Start(r.Context(), "middleware.RequireAdmin")
+		defer span.End()
+
+		user, ok := GetUser(r)
+		if !ok {
+			apierror.Write(w, r, apierror.Unauthorized("signin to continue"))
+			return
+		}
+
+		chatID, err := utils.ReadParam(r,"chatID")
+		if err != nil {
+			apierror.Write(w, r, apierror.BadRequest("invalid chat ID"))
+			return
+		}
+
+		role, err := cm.ChatMemberStore.GetUserRole(spanCtx, chatID, user.ID)
+		if err != nil && !errors.Is(err, store.ErrNotFound) {
+			logging.FromContext(r.Context()).Error("getUserRole", "error", err)
+			apierror.Write(w, r, apierror.Internal("internal server error"))
+			return
+		}
+		if role != string(store.OWNER) && role != string(store.ADMIN) {
+			apierror.Write(w, r, apierror.Forbidden("only chat admins can do this"))
+			return
+		}
+		span.End()
+
+		next.ServeHTTP(w, r)
+	})
+}
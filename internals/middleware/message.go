@@ -4,7 +4,10 @@ import (
 	"context"
 	"net/http"
 
+	"github.com/Abhishek-B-R/chat-app-golang/internals/apierror"
+	"github.com/Abhishek-B-R/chat-app-golang/internals/logging"
 	"github.com/Abhishek-B-R/chat-app-golang/internals/store"
+	"github.com/Abhishek-B-R/chat-app-golang/internals/tracing"
 	"github.com/Abhishek-B-R/chat-app-golang/internals/utils"
 )
 
@@ -31,32 +34,45 @@ func GetMessageMembership(r *http.Request) *store.Message {
 
 func (mm *MessageMiddleware) RequireAccess(next http.Handler) http.Handler {
 	return http.HandlerFunc(func (w http.ResponseWriter, r *http.Request){
+		spanCtx, span := tracing.Start(r.Context(), "middleware.RequireAccess")
+		defer span.End()
+
 		user, ok := GetUser(r)
-		
+
 		if !ok {
-			utils.WriteJSON(w, http.StatusUnauthorized, utils.Envelope{"error":"signin to continue"})
+			apierror.Write(w, r, apierror.Unauthorized("signin to continue"))
 			return
 		}
 
 		messageID, err := utils.ReadParam(r, "msgID")
 		if err != nil {
-			utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid message ID"})
+			apierror.Write(w, r, apierror.BadRequest("invalid message ID"))
 			return
 		}
 
-		msg, err := mm.MessageStore.GetMessage(r.Context(), messageID)
+		msg, err := mm.MessageStore.GetMessage(spanCtx, messageID)
 		if err != nil {
-			utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "message not found"})
+			apierror.Write(w, r, apierror.FromStore(err, "message"))
+			return
+		}
+
+		if key, ok := GetAPIKey(r); ok && !key.AllowsChat(msg.ChatID) {
+			apierror.Write(w, r, apierror.Forbidden("access denied"))
 			return
 		}
 
-		isMember, err := mm.ChatMemberStore.IsMember(r.Context(), msg.ChatID, user.ID)
-		if err != nil || !isMember {
-			utils.WriteJSON(w, http.StatusForbidden, utils.Envelope{"error":"access denied"})
+		isMember, err := mm.ChatMemberStore.IsMember(spanCtx, msg.ChatID, user.ID)
+		if err != nil {
+			logging.FromContext(r.Context()).Error("isMember", "error", err)
+			apierror.Write(w, r, apierror.Internal("internal server error"))
+			return
+		}
+		if !isMember {
+			apierror.Write(w, r, apierror.Forbidden("access denied").WithCode(apierror.CodeNotChatMember))
 			return
 		}
+		span.End()
 
-		ctx := context.WithValue(r.Context(),"message",msg)
-		next.ServeHTTP(w, r.WithContext(ctx))
+		next.ServeHTTP(w, SetMessageMembership(r, msg))
 	})
 }
\ No newline at end of file
@@ -0,0 +1,31 @@
+package middleware
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/Abhishek-B-R/chat-app-golang/internals/metrics"
+	"github.com/go-chi/chi"
+)
+
+type MetricsMiddleware struct {
+	Metrics metrics.Recorder
+}
+
+// Instrument records every request under its chi route pattern, so
+// /chats/1 and /chats/2 end up in the same series.
+func (mm *MetricsMiddleware) Instrument(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		sw := &statusWriter{ResponseWriter: w, status: http.StatusOK}
+
+		next.ServeHTTP(sw, r)
+
+		route := chi.RouteContext(r.Context()).RoutePattern()
+		if route == "" {
+			// unmatched paths are unbounded, keep them out of the labels
+			route = "unmatched"
+		}
+		mm.Metrics.HTTPRequest(r.Method, route, sw.status, time.Since(start))
+	})
+}
@@ -0,0 +1,53 @@
+package middleware
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/Abhishek-B-R/chat-app-golang/internals/apierror"
+	"github.com/Abhishek-B-R/chat-app-golang/internals/logging"
+	"github.com/Abhishek-B-R/chat-app-golang/internals/ratelimit"
+)
+
+type RateLimitMiddleware struct {
+	Limiter ratelimit.Limiter
+}
+
+// PerMinute limits the routes it wraps to limit requests a minute for each
+// authenticated user, or each client IP before authentication. name keeps
+// the buckets of different route groups apart. A limit of 0 or less lets
+// everything through. The client IP is the one resolved by RequestID.
+//
+// When the limiter fails the request is let through, a broken limiter
+// should not take the API down with it.
+func (rl *RateLimitMiddleware) PerMinute(name string, limit int) func(http.Handler) http.Handler {
+	rule := ratelimit.Rule{Limit: limit, Period: time.Minute}
+
+	return func(next http.Handler) http.Handler {
+		if limit <= 0 {
+			return next
+		}
+
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			key := fmt.Sprintf("%s:ip:%s", name, GetClientIP(r))
+			if user, ok := GetUser(r); ok {
+				key = fmt.Sprintf("%s:user:%d", name, user.ID)
+			}
+
+			res, err := rl.Limiter.Allow(r.Context(), key, rule)
+			if err != nil {
+				logging.FromContext(r.Context()).Error("rate limiting request", "bucket", name, "error", err)
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			res.WriteHeaders(w.Header(), rule)
+			if !res.Allowed {
+				apierror.Write(w, r, apierror.TooManyRequests("rate limit exceeded"))
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
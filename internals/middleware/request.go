@@ -0,0 +1,165 @@
+package middleware
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/Abhishek-B-R/chat-app-golang/internals/apierror"
+	"github.com/Abhishek-B-R/chat-app-golang/internals/logging"
+	"github.com/go-chi/chi"
+)
+
+const RequestIDHeader = "X-Request-ID"
+
+const requestIDContextKey = contextKey("request_id")
+const clientIPContextKey = contextKey("client_ip")
+
+type RequestMiddleware struct {
+	Logger       *slog.Logger
+	MaxBodyBytes int64
+	// ClientIPHeader is the header the load balancer puts the client IP in,
+	// empty to use the address of the connection.
+	ClientIPHeader string
+}
+
+// GetRequestID returns the ID assigned to the request by RequestID.
+func GetRequestID(r *http.Request) string {
+	id, _ := r.Context().Value(requestIDContextKey).(string)
+	return id
+}
+
+// GetClientIP returns the client IP resolved by RequestID.
+func GetClientIP(r *http.Request) string {
+	ip, _ := r.Context().Value(clientIPContextKey).(string)
+	return ip
+}
+
+// RequestID takes the caller's X-Request-ID, or makes one up, echoes it in
+// the response and attaches a logger tagged with it to the request context.
+// It also resolves the client IP for GetClientIP.
+func (rm *RequestMiddleware) RequestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(RequestIDHeader)
+		if !validRequestID(id) {
+			id = newRequestID()
+		}
+		w.Header().Set(RequestIDHeader, id)
+
+		ctx := context.WithValue(r.Context(), requestIDContextKey, id)
+		ctx = context.WithValue(ctx, clientIPContextKey, rm.clientIP(r))
+		ctx = logging.NewContext(ctx, rm.Logger.With("request_id", id))
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// LimitBody stops reading request bodies after MaxBodyBytes. Decoding a
+// larger body fails with *http.MaxBytesError.
+func (rm *RequestMiddleware) LimitBody(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.ContentLength > rm.MaxBodyBytes {
+			apierror.Write(w, r, apierror.PayloadTooLarge(fmt.Sprintf("request body cannot be larger than %d bytes", rm.MaxBodyBytes)))
+			return
+		}
+		r.Body = http.MaxBytesReader(w, r.Body, rm.MaxBodyBytes)
+		next.ServeHTTP(w, r)
+	})
+}
+
+// AccessLog writes one line per request once it has been served. It must run
+// inside RequestID.
+func (rm *RequestMiddleware) AccessLog(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		sw := &statusWriter{ResponseWriter: w, status: http.StatusOK}
+
+		defer func() {
+			// the pattern is only complete once routing is done
+			route := chi.RouteContext(r.Context()).RoutePattern()
+			level := slog.LevelInfo
+			if sw.status >= http.StatusInternalServerError {
+				level = slog.LevelError
+			}
+
+			logging.FromContext(r.Context()).Log(r.Context(), level, "request",
+				"method", r.Method,
+				"route", route,
+				"status", sw.status,
+				"bytes", sw.bytes,
+				"duration_ms", float64(time.Since(start).Microseconds())/1000,
+				"remote_addr", r.RemoteAddr,
+				"client_ip", GetClientIP(r),
+			)
+		}()
+
+		next.ServeHTTP(sw, r)
+	})
+}
+
+type statusWriter struct {
+	http.ResponseWriter
+	status      int
+	bytes       int
+	wroteHeader bool
+}
+
+func (sw *statusWriter) WriteHeader(status int) {
+	if !sw.wroteHeader {
+		sw.status = status
+		sw.wroteHeader = true
+	}
+	sw.ResponseWriter.WriteHeader(status)
+}
+
+func (sw *statusWriter) Write(b []byte) (int, error) {
+	sw.wroteHeader = true
+	n, err := sw.ResponseWriter.Write(b)
+	sw.bytes += n
+	return n, err
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer.
+func (sw *statusWriter) Unwrap() http.ResponseWriter {
+	return sw.ResponseWriter
+}
+
+func (rm *RequestMiddleware) clientIP(r *http.Request) string {
+	if rm.ClientIPHeader != "" {
+		// proxies append to X-Forwarded-For, only the last entry was added
+		// by our own load balancer, the ones before it are client supplied
+		values := strings.Split(strings.Join(r.Header.Values(rm.ClientIPHeader), ","), ",")
+		if ip := strings.TrimSpace(values[len(values)-1]); ip != "" {
+			return ip
+		}
+	}
+
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+func validRequestID(id string) bool {
+	if id == "" || len(id) > 128 {
+		return false
+	}
+	for _, c := range id {
+		if c < 0x21 || c > 0x7e {
+			return false
+		}
+	}
+	return true
+}
+
+func newRequestID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,48 @@
+package middleware
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+const APIVersionContextKey = contextKey("api_version")
+
+// APIVersion tags requests with the version of the API they came in on, so
+// handlers shared between versions can shape their responses.
+func APIVersion(version int) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx := context.WithValue(r.Context(), APIVersionContextKey, version)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// GetAPIVersion returns the version set by APIVersion, 1 for routes mounted
+// without one.
+func GetAPIVersion(r *http.Request) int {
+	version, ok := r.Context().Value(APIVersionContextKey).(int)
+	if !ok {
+		return 1
+	}
+	return version
+}
+
+// Deprecated marks responses as coming from a deprecated route (RFC 9745)
+// that stops working at sunset (RFC 8594), and links to the same path under
+// successorPrefix.
+func Deprecated(since, sunset time.Time, successorPrefix string) func(http.Handler) http.Handler {
+	deprecation := fmt.Sprintf("@%d", since.Unix())
+	sunsetHeader := sunset.UTC().Format(http.TimeFormat)
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Deprecation", deprecation)
+			w.Header().Set("Sunset", sunsetHeader)
+			w.Header().Add("Link", fmt.Sprintf(`<%s%s>; rel="successor-version"`, successorPrefix, r.URL.Path))
+			next.ServeHTTP(w, r)
+		})
+	}
+}
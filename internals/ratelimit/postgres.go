@@ -0,0 +1,96 @@
+package ratelimit
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+)
+
+// PostgresLimiter keeps buckets in the rate_limit_buckets table so every
+// instance behind the load balancer shares the same limits. Buckets are
+// refilled with the database clock, instances don't need synced clocks.
+type PostgresLimiter struct {
+	db *sql.DB
+
+	mu        sync.Mutex
+	lastSweep time.Time
+}
+
+func NewPostgresLimiter(db *sql.DB) *PostgresLimiter {
+	return &PostgresLimiter{
+		db:        db,
+		lastSweep: time.Now(),
+	}
+}
+
+func (pl *PostgresLimiter) Allow(ctx context.Context, key string, rule Rule) (Result, error) {
+	pl.sweep(ctx)
+
+	tx, err := pl.db.BeginTx(ctx, nil)
+	if err != nil {
+		return Result{}, err
+	}
+	defer tx.Rollback()
+
+	// a missing bucket is a full one; the insert also gives the row lock
+	// below something to wait on when two instances race for a new key
+	_, err = tx.ExecContext(ctx, `
+	INSERT INTO rate_limit_buckets (key, tokens, updated_at)
+	VALUES ($1, $2, NOW())
+	ON CONFLICT (key) DO NOTHING
+	`, key, float64(rule.Limit))
+	if err != nil {
+		return Result{}, err
+	}
+
+	var tokens, elapsed float64
+	err = tx.QueryRowContext(ctx, `
+	SELECT tokens, EXTRACT(EPOCH FROM NOW() - updated_at)
+	FROM rate_limit_buckets
+	WHERE key = $1
+	FOR UPDATE
+	`, key).Scan(&tokens, &elapsed)
+	if err != nil {
+		return Result{}, err
+	}
+
+	rate := rule.refillPerSecond()
+	tokens = math.Min(float64(rule.Limit), tokens+math.Max(elapsed, 0)*rate)
+	res := take(&tokens, rule, rate)
+
+	_, err = tx.ExecContext(ctx, `
+	UPDATE rate_limit_buckets
+	SET tokens = $2, updated_at = NOW()
+	WHERE key = $1
+	`, key, tokens)
+	if err != nil {
+		return Result{}, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return Result{}, fmt.Errorf("committing rate limit bucket: %w", err)
+	}
+	return res, nil
+}
+
+// sweep deletes buckets that have not been touched for a while, at most
+// once a minute per instance.
+func (pl *PostgresLimiter) sweep(ctx context.Context) {
+	pl.mu.Lock()
+	if time.Since(pl.lastSweep) < time.Minute {
+		pl.mu.Unlock()
+		return
+	}
+	pl.lastSweep = time.Now()
+	pl.mu.Unlock()
+
+	// losing a sweep only leaves full buckets around for longer
+	_, _ = pl.db.ExecContext(ctx, `
+	DELETE FROM rate_limit_buckets
+	WHERE updated_at < NOW() - INTERVAL '1 hour'
+	`)
+}
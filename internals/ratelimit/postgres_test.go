@@ -0,0 +1,130 @@
+package ratelimit
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// bucketsDB is a database/sql driver that plays the rate_limit_buckets
+// table, so the limiter's queries can be checked without Postgres.
+// Every bucket was last updated elapsed seconds ago.
+type bucketsDB struct {
+	mu      sync.Mutex
+	tokens  map[string]float64
+	elapsed float64
+	inserts []driver.NamedValue
+}
+
+func (db *bucketsDB) Open(name string) (driver.Conn, error) { return bucketsConn{db}, nil }
+
+type bucketsConn struct{ db *bucketsDB }
+
+func (c bucketsConn) Prepare(query string) (driver.Stmt, error) { return nil, driver.ErrSkip }
+func (c bucketsConn) Close() error                              { return nil }
+func (c bucketsConn) Begin() (driver.Tx, error)                 { return c, nil }
+func (c bucketsConn) Commit() error                             { return nil }
+func (c bucketsConn) Rollback() error                           { return nil }
+
+func (c bucketsConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	c.db.mu.Lock()
+	defer c.db.mu.Unlock()
+
+	key := args[0].Value.(string)
+	switch {
+	case strings.Contains(query, "INSERT INTO rate_limit_buckets"):
+		c.db.inserts = append(c.db.inserts, args...)
+		if _, ok := c.db.tokens[key]; !ok {
+			c.db.tokens[key] = args[1].Value.(float64)
+		}
+	case strings.Contains(query, "UPDATE rate_limit_buckets"):
+		c.db.tokens[key] = args[1].Value.(float64)
+	}
+	return driver.RowsAffected(1), nil
+}
+
+func (c bucketsConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	c.db.mu.Lock()
+	defer c.db.mu.Unlock()
+	return &bucketRow{values: []driver.Value{c.db.tokens[args[0].Value.(string)], c.db.elapsed}}, nil
+}
+
+type bucketRow struct {
+	values []driver.Value
+	done   bool
+}
+
+func (r *bucketRow) Columns() []string { return []string{"tokens", "elapsed"} }
+func (r *bucketRow) Close() error      { return nil }
+func (r *bucketRow) Next(dest []driver.Value) error {
+	if r.done {
+		return io.EOF
+	}
+	r.done = true
+	copy(dest, r.values)
+	return nil
+}
+
+func newBucketsDB(t *testing.T) (*bucketsDB, *sql.DB) {
+	t.Helper()
+	fake := &bucketsDB{tokens: map[string]float64{}}
+	db := sql.OpenDB(connector{fake})
+	t.Cleanup(func() { db.Close() })
+	return fake, db
+}
+
+type connector struct{ db *bucketsDB }
+
+func (c connector) Connect(ctx context.Context) (driver.Conn, error) { return c.db.Open("") }
+func (c connector) Driver() driver.Driver                            { return c.db }
+
+func TestPostgresLimiterBuckets(t *testing.T) {
+	fake, db := newBucketsDB(t)
+	pl := NewPostgresLimiter(db)
+	rule := Rule{Limit: 2, Period: time.Minute}
+
+	for i := 0; i < 2; i++ {
+		res, err := pl.Allow(context.Background(), "messages:user:3", rule)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !res.Allowed || res.Limit != 2 || res.Remaining != 1-i {
+			t.Errorf("request %d: %+v", i+1, res)
+		}
+	}
+
+	// a new bucket starts out full with the rule's limit
+	if len(fake.inserts) < 2 || fake.inserts[0].Value != "messages:user:3" || fake.inserts[1].Value != float64(2) {
+		t.Errorf("bucket inserted with %v, want the key and a full bucket", fake.inserts)
+	}
+
+	res, _ := pl.Allow(context.Background(), "messages:user:3", rule)
+	if res.Allowed || res.RetryAfter <= 29*time.Second || res.RetryAfter > 30*time.Second {
+		t.Errorf("over the limit: %+v", res)
+	}
+	if fake.tokens["messages:user:3"] != 0 {
+		t.Errorf("%v tokens stored, want 0", fake.tokens["messages:user:3"])
+	}
+
+	res, _ = pl.Allow(context.Background(), "messages:user:4", rule)
+	if !res.Allowed {
+		t.Error("another user's bucket was spent")
+	}
+
+	// the database clock refills the bucket: 30s is one token at 2 a minute
+	fake.elapsed = 31
+	res, _ = pl.Allow(context.Background(), "messages:user:3", rule)
+	if !res.Allowed || res.Remaining != 0 {
+		t.Errorf("after 31s: %+v", res)
+	}
+	fake.elapsed = 3600
+	res, _ = pl.Allow(context.Background(), "messages:user:3", rule)
+	if !res.Allowed || res.Remaining != 1 {
+		t.Errorf("after an hour: %+v", res)
+	}
+}
@@ -0,0 +1,126 @@
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Rule allows Limit requests per Period, refilled continuously (token
+// bucket), so short bursts up to Limit are fine.
+type Rule struct {
+	Limit  int
+	Period time.Duration
+}
+
+func (r Rule) refillPerSecond() float64 {
+	return float64(r.Limit) / r.Period.Seconds()
+}
+
+type Result struct {
+	Allowed   bool
+	Limit     int
+	Remaining int
+	// RetryAfter is how long until the next request is allowed, zero when allowed
+	RetryAfter time.Duration
+	// ResetAfter is how long until the bucket is full again
+	ResetAfter time.Duration
+}
+
+type Limiter interface {
+	Allow(ctx context.Context, key string, rule Rule) (Result, error)
+}
+
+type bucket struct {
+	tokens  float64
+	updated time.Time
+}
+
+// MemoryLimiter keeps buckets in process memory. Limits are per instance.
+type MemoryLimiter struct {
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	lastSweep time.Time
+}
+
+func NewMemoryLimiter() *MemoryLimiter {
+	return &MemoryLimiter{
+		buckets:   make(map[string]*bucket),
+		lastSweep: time.Now(),
+	}
+}
+
+func (ml *MemoryLimiter) Allow(ctx context.Context, key string, rule Rule) (Result, error) {
+	ml.mu.Lock()
+	defer ml.mu.Unlock()
+
+	now := time.Now()
+	ml.sweep(now)
+
+	b, ok := ml.buckets[key]
+	if !ok {
+		b = &bucket{tokens: float64(rule.Limit), updated: now}
+		ml.buckets[key] = b
+	}
+
+	rate := rule.refillPerSecond()
+	b.tokens = math.Min(float64(rule.Limit), b.tokens+now.Sub(b.updated).Seconds()*rate)
+	b.updated = now
+
+	return take(&b.tokens, rule, rate), nil
+}
+
+// sweep drops buckets that have not been touched for a while; a missing
+// bucket is the same as a full one.
+func (ml *MemoryLimiter) sweep(now time.Time) {
+	if now.Sub(ml.lastSweep) < time.Minute {
+		return
+	}
+	ml.lastSweep = now
+
+	for key, b := range ml.buckets {
+		if now.Sub(b.updated) > time.Hour {
+			delete(ml.buckets, key)
+		}
+	}
+}
+
+// take spends one token from a bucket that has already been refilled.
+func take(tokens *float64, rule Rule, rate float64) Result {
+	res := Result{Limit: rule.Limit}
+
+	if *tokens >= 1 {
+		*tokens--
+		res.Allowed = true
+	} else {
+		res.RetryAfter = seconds((1 - *tokens) / rate)
+	}
+
+	res.Remaining = int(*tokens)
+	res.ResetAfter = seconds((float64(rule.Limit) - *tokens) / rate)
+	return res
+}
+
+func seconds(s float64) time.Duration {
+	return time.Duration(s * float64(time.Second))
+}
+
+// WriteHeaders sets the RateLimit-* headers (draft-ietf-httpapi-ratelimit-headers)
+// describing res, plus Retry-After when the request was refused.
+func (res Result) WriteHeaders(h http.Header, rule Rule) {
+	h.Set("RateLimit-Policy", fmt.Sprintf("%d;w=%d", rule.Limit, ceilSeconds(rule.Period)))
+	h.Set("RateLimit-Limit", strconv.Itoa(res.Limit))
+	h.Set("RateLimit-Remaining", strconv.Itoa(res.Remaining))
+	h.Set("RateLimit-Reset", strconv.Itoa(ceilSeconds(res.ResetAfter)))
+	if !res.Allowed {
+		h.Set("Retry-After", strconv.Itoa(ceilSeconds(res.RetryAfter)))
+	}
+}
+
+func ceilSeconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
@@ -0,0 +1,98 @@
+package ratelimit
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestMemoryLimiterAllowsABurstUpToTheLimit(t *testing.T) {
+	ml := NewMemoryLimiter()
+	rule := Rule{Limit: 3, Period: time.Minute}
+
+	for i := 0; i < 3; i++ {
+		res, err := ml.Allow(context.Background(), "api:user:1", rule)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !res.Allowed || res.Remaining != 2-i || res.Limit != 3 {
+			t.Errorf("request %d: %+v", i+1, res)
+		}
+	}
+
+	res, _ := ml.Allow(context.Background(), "api:user:1", rule)
+	if res.Allowed {
+		t.Fatal("fourth request in the burst was allowed")
+	}
+	// a token comes back every 20s
+	if res.RetryAfter <= 19*time.Second || res.RetryAfter > 20*time.Second {
+		t.Errorf("retry after %s, want about 20s", res.RetryAfter)
+	}
+	if res.ResetAfter <= 59*time.Second || res.ResetAfter > time.Minute {
+		t.Errorf("reset after %s, want about a minute", res.ResetAfter)
+	}
+
+	// buckets are per key
+	res, _ = ml.Allow(context.Background(), "api:user:2", rule)
+	if !res.Allowed {
+		t.Error("another user's bucket was spent")
+	}
+}
+
+func TestMemoryLimiterRefills(t *testing.T) {
+	ml := NewMemoryLimiter()
+	rule := Rule{Limit: 3, Period: time.Minute}
+	for i := 0; i < 4; i++ {
+		ml.Allow(context.Background(), "auth:ip:10.0.0.1", rule)
+	}
+
+	// 20s is one token at 3 a minute
+	ml.buckets["auth:ip:10.0.0.1"].updated = time.Now().Add(-21 * time.Second)
+	res, _ := ml.Allow(context.Background(), "auth:ip:10.0.0.1", rule)
+	if !res.Allowed || res.Remaining != 0 {
+		t.Errorf("after 21s: %+v", res)
+	}
+	res, _ = ml.Allow(context.Background(), "auth:ip:10.0.0.1", rule)
+	if res.Allowed {
+		t.Error("two requests allowed for one refilled token")
+	}
+
+	// an idle bucket fills up to the limit and no further
+	ml.buckets["auth:ip:10.0.0.1"].updated = time.Now().Add(-time.Hour)
+	res, _ = ml.Allow(context.Background(), "auth:ip:10.0.0.1", rule)
+	if !res.Allowed || res.Remaining != 2 {
+		t.Errorf("after an hour: %+v", res)
+	}
+}
+
+func TestMemoryLimiterSweepsIdleBuckets(t *testing.T) {
+	ml := NewMemoryLimiter()
+	rule := Rule{Limit: 1, Period: time.Minute}
+	ml.Allow(context.Background(), "old", rule)
+	ml.buckets["old"].updated = time.Now().Add(-2 * time.Hour)
+	ml.lastSweep = time.Now().Add(-2 * time.Minute)
+
+	ml.Allow(context.Background(), "new", rule)
+	if _, ok := ml.buckets["old"]; ok {
+		t.Error("idle bucket was kept")
+	}
+}
+
+func TestWriteHeaders(t *testing.T) {
+	rule := Rule{Limit: 30, Period: time.Minute}
+	h := http.Header{}
+	Result{Allowed: false, Limit: 30, RetryAfter: 1500 * time.Millisecond, ResetAfter: time.Minute}.WriteHeaders(h, rule)
+
+	for name, want := range map[string]string{
+		"RateLimit-Policy":    "30;w=60",
+		"RateLimit-Limit":     "30",
+		"RateLimit-Remaining": "0",
+		"RateLimit-Reset":     "60",
+		"Retry-After":         "2",
+	} {
+		if got := h.Get(name); got != want {
+			t.Errorf("%s: %q, want %q", name, got, want)
+		}
+	}
+}
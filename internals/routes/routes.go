@@ -1,74 +1,262 @@
 package routes
 
 import (
+	"time"
+
 	"github.com/Abhishek-B-R/chat-app-golang/internals/app"
+	"github.com/Abhishek-B-R/chat-app-golang/internals/middleware"
+	"github.com/Abhishek-B-R/chat-app-golang/internals/tokens"
+	"github.com/Abhishek-B-R/chat-app-golang/openapi"
 	"github.com/go-chi/chi"
 )
 
 func SetupRoutes(app *app.Application) *chi.Mux{
 	r := chi.NewRouter()
+	r.Use(app.RequestMiddleware.RequestID)
+	r.Use(app.RequestMiddleware.Trace)
+	r.Use(app.RequestMiddleware.AccessLog)
+	r.Use(app.MetricsMiddleware.Instrument)
+	r.Use(app.RequestMiddleware.LimitBody)
+
+	r.Get("/healthz",app.HandleLiveness)
+	r.Get("/readyz",app.Readiness.Handler)
+	// kept for load balancers still configured with the old path
+	r.Get("/health",app.Readiness.Handler)
+	if app.Config.Metrics.Enabled {
+		r.Method("GET", "/metrics", app.Metrics.Handler())
+	}
+	r.Get("/openapi.json",openapi.Handler)
+
+	// Incoming webhooks authenticate with the secret token in the URL. The
+	// URLs are pasted into other services, so they stay unversioned.
+	r.Post("/hooks/{token}",app.IncomingWebhookHandler.HandlePostMessage)
+
+	r.Route("/v1", apiRoutes(app, 1))
+	r.Route("/v2", apiRoutes(app, 2))
 
-	r.Get("/health",app.HealthCheck)
-	r.Post("/auth/login",app.TokenHandler.HandleCreateToken)
-	r.Post("/auth/register",app.UserHandler.HandleCreateUser)
+	// The API used to live at the root; those paths keep serving v1 until
+	// the sunset date so clients have time to move to /v1
+	sunset, err := app.Config.HTTP.Sunset()
+	if err != nil {
+		panic(err)
+	}
+	r.Group(func(r chi.Router) {
+		r.Use(middleware.Deprecated(unversionedDeprecatedAt, sunset, "/v1"))
+		apiRoutes(app, 1)(r)
+	})
+
+	return r
+}
 
-	r.Group(func (r chi.Router){
-		r.Use(app.UserMiddleware.Authenticate)
+// unversionedDeprecatedAt is when the /v1 prefix was introduced.
+var unversionedDeprecatedAt = time.Date(2026, time.October, 19, 0, 0, 0, 0, time.UTC)
 
-		r.Put("/auth/password-reset",app.UserHandler.HandleUpdateUserPassword)
-		r.Route("/users", func (r chi.Router){
-			r.Get("/me", app.UserHandler.HandleGetCurrentUser)
-			r.Put("/me", app.UserHandler.HandleUpdateUser)
-			r.Put("/me/last-seen", app.UserHandler.HandleUpdateLastSeen)
+// apiRoutes registers the API for one version. Versions share handlers;
+// a handler that needs to answer differently checks
+// middleware.GetAPIVersion.
+func apiRoutes(app *app.Application, version int) func(r chi.Router) {
+	return func(r chi.Router) {
+		r.Use(middleware.APIVersion(version))
 
-			r.Get("/search/{username}", app.UserHandler.HandleGetUserByUsername)
-			r.Get("/{userID}", app.UserHandler.HandleGetUserByID)
+		// Limits are per user once authenticated, per client IP before. The
+		// bucket names don't include the version, /v1 and /v2 share limits.
+		limits := app.Config.RateLimit
+		r.Group(func(r chi.Router) {
+			r.Use(app.RateLimitMiddleware.PerMinute("auth", limits.AuthPerMinute))
+
+			r.Post("/auth/login",app.TokenHandler.HandleCreateToken)
+			r.Post("/auth/register",app.UserHandler.HandleCreateUser)
+			r.Get("/auth/oidc/{provider}/login",app.OIDCHandler.HandleLogin)
+			r.Get("/auth/oidc/{provider}/callback",app.OIDCHandler.HandleCallback)
 		})
 
-		r.Route("/chats", func(r chi.Router) {
-			r.Get("/", app.ChatHandler.HandleGetUserChats)
-			r.Post("/", app.ChatHandler.HandleCreateChat)
-
-			r.Route("/{chatID}", func(r chi.Router) {
-				// Middleware: Verify user is member of this chat
-				r.Use(app.ChatMiddleware.RequireMembership)
-
-				// Chat details
-				r.Get("/", app.ChatHandler.HandleGetChatByID)
-				r.Put("/", app.ChatHandler.HandleUpdateChat)
-				r.Delete("/", app.ChatHandler.HandleDeleteChat)
-
-				// Chat members management
-				r.Route("/members", func(r chi.Router) {
-					r.Get("/", app.ChatMemberHandler.HandleGetChatMembers)
-					r.Post("/", app.ChatMemberHandler.HandleAddMember)
-					r.Delete("/{userID}", app.ChatMemberHandler.HandleRemoveMember)
-					r.Get("/{userID}/role", app.ChatMemberHandler.HandleGetUserRole)
-					r.Put("/update", app.ChatMemberHandler.HandleUpdateLastRead)
-				})
+		r.Group(func (r chi.Router){
+			r.Use(app.UserMiddleware.Authenticate)
+			r.Use(app.RateLimitMiddleware.PerMinute("api", limits.APIPerMinute))
+			postMessages := app.RateLimitMiddleware.PerMinute("messages", limits.MessagesPerMinute)
 
-				// Messages in this chats
-				r.Route("/messages", func(r chi.Router) {
-					r.Get("/{offset}/{limit}", app.MessageHandler.HandleGetChatMessages)
-					r.Post("/", app.MessageHandler.HandleCreateMessage)
-					r.Get("/unread", app.MessageHandler.HandleGetUnreadCount) 
-				})
+			// API keys only reach the routes that name the scope they need,
+			// everything else requires a user's session token
+			session := app.UserMiddleware.RequireSession
+			readMessages := app.UserMiddleware.RequireScope(tokens.ScopeMessagesRead)
+			writeMessages := app.UserMiddleware.RequireScope(tokens.ScopeMessagesWrite)
+			manageMembers := app.UserMiddleware.RequireScope(tokens.ScopeMembersManage)
+
+			r.With(session).Put("/auth/password-reset",app.UserHandler.HandleUpdateUserPassword)
+			r.Route("/users", func (r chi.Router){
+				r.Use(session)
+
+				r.Get("/me", app.UserHandler.HandleGetCurrentUser)
+				r.Put("/me", app.UserHandler.HandleUpdateUser)
+				r.Put("/me/last-seen", app.UserHandler.HandleUpdateLastSeen)
+
+				r.Get("/me/blocks", app.BlockHandler.HandleGetBlocks)
+				r.Put("/me/blocks/{userID}", app.BlockHandler.HandleBlockUser)
+				r.Delete("/me/blocks/{userID}", app.BlockHandler.HandleUnblockUser)
 
-				// Chat member actions (for current user)
-				r.Put("/read", app.ChatMemberHandler.HandleUpdateLastRead)
-				r.Put("/mute", app.ChatMemberHandler.HandleMuteChat)
-				r.Put("/unmute", app.ChatMemberHandler.HandleUnMuteChat)
+				r.Get("/search/{username}", app.UserHandler.HandleGetUserByUsername)
+				r.Get("/{userID}", app.UserHandler.HandleGetUserByID)
+				r.Post("/{userID}/report", app.ReportHandler.HandleReportUser)
+			})
+
+			// Moderation tools for platform administrators: the abuse report queue
+			// and the global content filters
+			r.Route("/moderation", func(r chi.Router) {
+				r.Use(session, app.UserMiddleware.RequirePlatformAdmin)
+
+				r.Get("/reports", app.ReportHandler.HandleGetReports)
+				r.Get("/reports/{reportID}", app.ReportHandler.HandleGetReport)
+				r.Post("/reports/{reportID}/resolve", app.ReportHandler.HandleResolveReport)
+
+				// content filters applied to every chat
+				r.Get("/filters", app.FilterHandler.HandleGetGlobalFilters)
+				r.Post("/filters", app.FilterHandler.HandleCreateGlobalFilter)
+				r.Delete("/filters/{filterID}", app.FilterHandler.HandleDeleteGlobalFilter)
+			})
+
+			// Platform administration: any account and any chat, whether or not
+			// the admin is a member. Changes land in the audit log.
+			r.Route("/admin", func(r chi.Router) {
+				r.Use(session, app.UserMiddleware.RequirePlatformAdmin)
+
+				r.Get("/users", app.AdminHandler.HandleSearchUsers)
+				r.Get("/users/{userID}", app.AdminHandler.HandleGetUser)
+				r.Post("/users/{userID}/suspend", app.AdminHandler.HandleSuspendUser)
+				r.Post("/users/{userID}/reactivate", app.AdminHandler.HandleReactivateUser)
+				r.Delete("/users/{userID}/sessions", app.AdminHandler.HandleRevokeSessions)
+
+				r.Get("/chats/{chatID}", app.AdminHandler.HandleGetChat)
+				r.Delete("/chats/{chatID}", app.AdminHandler.HandleDeleteChat)
+				r.Get("/chats/{chatID}/members", app.AdminHandler.HandleGetChatMembers)
+				r.Get("/chats/{chatID}/messages", app.AdminHandler.HandleGetChatMessages)
+				r.Delete("/messages/{msgID}", app.AdminHandler.HandleDeleteMessage)
+
+				r.Get("/audit-log", app.AdminHandler.HandleGetAuditLog)
+			})
+
+			// Bot accounts and their API keys, managed by the bot's owner
+			r.Route("/bots", func(r chi.Router) {
+				r.Use(session)
+
+				r.Get("/", app.BotHandler.HandleGetBots)
+				r.Post("/", app.BotHandler.HandleCreateBot)
+				r.Get("/{botID}/keys", app.BotHandler.HandleGetAPIKeys)
+				r.Post("/{botID}/keys", app.BotHandler.HandleCreateAPIKey)
+				r.Delete("/{botID}/keys/{keyID}", app.BotHandler.HandleRevokeAPIKey)
 			})
-		})
 
-		// MESSAGE ROUTES (Individual message operations)
-		r.Route("/messages/{msgID}", func(r chi.Router) {
-			r.Use(app.MessageMiddleware.RequireAccess)
+			// Invite links: anyone signed in can look at one and join
+			r.Route("/invites/{code}", func(r chi.Router) {
+				r.Use(session)
 
-			r.Get("/", app.MessageHandler.HandleGetMessage)
-			r.Put("/", app.MessageHandler.HandleUpdateMessage)
-			r.Delete("/", app.MessageHandler.HandleDeleteMessage)
+				r.Get("/", app.InviteHandler.HandlePreviewInvite)
+				r.Post("/join", app.InviteHandler.HandleJoinInvite)
+			})
+
+			r.Route("/chats", func(r chi.Router) {
+				r.With(readMessages).Get("/", app.ChatHandler.HandleGetUserChats)
+				r.With(session).Post("/", app.ChatHandler.HandleCreateChat)
+
+				r.Route("/{chatID}", func(r chi.Router) {
+					// Middleware: Verify user is member of this chat
+					r.Use(app.ChatMiddleware.RequireMembership)
+
+					// Chat details
+					r.With(readMessages).Get("/", app.ChatHandler.HandleGetChatByID)
+					r.With(session).Put("/", app.ChatHandler.HandleUpdateChat)
+					r.With(session).Delete("/", app.ChatHandler.HandleDeleteChat)
+					r.With(session, app.ChatMiddleware.RequireAdmin).Put("/settings", app.ChatHandler.HandleUpdateChatSettings)
+					r.With(session, app.ChatMiddleware.RequireAdmin).Get("/audit-log", app.ChatHandler.HandleGetChatAuditLog)
+
+					// Chat members management
+					r.Route("/members", func(r chi.Router) {
+						r.With(readMessages).Get("/", app.ChatMemberHandler.HandleGetChatMembers)
+						r.With(manageMembers).Post("/", app.ChatMemberHandler.HandleAddMember)
+						r.With(manageMembers).Delete("/{userID}", app.ChatMemberHandler.HandleRemoveMember)
+						r.With(readMessages).Get("/{userID}/role", app.ChatMemberHandler.HandleGetUserRole)
+						r.With(readMessages).Put("/update", app.ChatMemberHandler.HandleUpdateLastRead)
+						r.With(manageMembers, app.ChatMiddleware.RequireAdmin).Put("/{userID}/posting-mute", app.ChatMemberHandler.HandleMutePosting)
+						r.With(manageMembers, app.ChatMiddleware.RequireAdmin).Delete("/{userID}/posting-mute", app.ChatMemberHandler.HandleUnmutePosting)
+						r.With(manageMembers, app.ChatMiddleware.RequireAdmin).Put("/{userID}/role", app.ChatMemberHandler.HandleUpdateMemberRole)
+					})
+
+					// Messages in this chats
+					r.Route("/messages", func(r chi.Router) {
+						r.With(readMessages).Get("/{offset}/{limit}", app.MessageHandler.HandleGetChatMessages)
+						r.With(writeMessages, postMessages).Post("/", app.MessageHandler.HandleCreateMessage)
+						r.With(readMessages).Get("/unread", app.MessageHandler.HandleGetUnreadCount) 
+						r.With(readMessages).Get("/pinned", app.MessageHandler.HandleGetPinnedMessages)
+					})
+
+					// Outgoing webhook subscriptions, managed by chat admins
+					r.Route("/webhooks", func(r chi.Router) {
+						r.Use(session, app.ChatMiddleware.RequireAdmin)
+
+						r.Get("/", app.WebhookHandler.HandleGetWebhooks)
+						r.Post("/", app.WebhookHandler.HandleCreateWebhook)
+						r.Delete("/{webhookID}", app.WebhookHandler.HandleDeleteWebhook)
+						r.Get("/{webhookID}/deliveries", app.WebhookHandler.HandleGetDeliveries)
+					})
+
+					// Content filters run on every message posted or edited
+					r.Route("/filters", func(r chi.Router) {
+						r.Use(session, app.ChatMiddleware.RequireAdmin)
+
+						r.Get("/", app.FilterHandler.HandleGetChatFilters)
+						r.Post("/", app.FilterHandler.HandleCreateChatFilter)
+						r.Delete("/{filterID}", app.FilterHandler.HandleDeleteChatFilter)
+					})
+
+					// Invite links to group chats, managed by chat admins
+					r.Route("/invites", func(r chi.Router) {
+						r.Use(session, app.ChatMiddleware.RequireAdmin)
+
+						r.Get("/", app.InviteHandler.HandleGetInvites)
+						r.Post("/", app.InviteHandler.HandleCreateInvite)
+						r.Delete("/{inviteID}", app.InviteHandler.HandleRevokeInvite)
+					})
+
+					r.Route("/incoming-webhooks", func(r chi.Router) {
+						r.Use(session, app.ChatMiddleware.RequireAdmin)
+
+						r.Get("/", app.IncomingWebhookHandler.HandleGetIncomingWebhooks)
+						r.Post("/", app.IncomingWebhookHandler.HandleCreateIncomingWebhook)
+						r.Delete("/{hookID}", app.IncomingWebhookHandler.HandleDeleteIncomingWebhook)
+					})
+
+					// Slash commands: everyone can see what is available,
+					// admins register and remove bot commands
+					r.Route("/commands", func(r chi.Router) {
+						r.With(readMessages).Get("/", app.CommandHandler.HandleGetCommands)
+
+						r.Group(func(r chi.Router) {
+							r.Use(session, app.ChatMiddleware.RequireAdmin)
+
+							r.Get("/registered", app.CommandHandler.HandleGetChatCommands)
+							r.Post("/", app.CommandHandler.HandleCreateCommand)
+							r.Delete("/{commandID}", app.CommandHandler.HandleDeleteCommand)
+						})
+					})
+
+					// Chat member actions (for current user)
+					r.With(readMessages).Put("/read", app.ChatMemberHandler.HandleUpdateLastRead)
+					r.With(session).Put("/mute", app.ChatMemberHandler.HandleMuteChat)
+					r.With(session).Put("/unmute", app.ChatMemberHandler.HandleUnMuteChat)
+					r.With(session).Post("/leave", app.ChatMemberHandler.HandleLeaveChat)
+				})
+			})
+
+			// MESSAGE ROUTES (Individual message operations)
+			r.Route("/messages/{msgID}", func(r chi.Router) {
+				r.Use(app.MessageMiddleware.RequireAccess)
+
+				r.With(readMessages).Get("/", app.MessageHandler.HandleGetMessage)
+				r.With(writeMessages).Put("/", app.MessageHandler.HandleUpdateMessage)
+				r.With(writeMessages).Delete("/", app.MessageHandler.HandleDeleteMessage)
+				r.With(writeMessages).Put("/pin", app.MessageHandler.HandlePinMessage)
+				r.With(writeMessages).Delete("/pin", app.MessageHandler.HandleUnpinMessage)
+				r.With(session).Post("/report", app.ReportHandler.HandleReportMessage)
+			})
 		})
-	})
-	return r
-}
\ No newline at end of file
+	}
+}
@@ -0,0 +1,206 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/Abhishek-B-R/chat-app-golang/internals/tokens"
+	"github.com/jackc/pgtype"
+)
+
+type APIKey struct {
+	ID         int64      `json:"id"`
+	UserID     int64      `json:"bot_id"`
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix"`
+	Scopes     []string   `json:"scopes"`
+	ChatIDs    []int64    `json:"chat_ids,omitempty"`
+	CreatedBy  *int64     `json:"created_by,omitempty"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+	ExpiresAt  *time.Time `json:"expires_at,omitempty"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+func (k *APIKey) HasScope(scope string) bool {
+	for _, s := range k.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// AllowsChat reports whether the key may be used in chatID. Keys without a
+// chat restriction work in every chat the bot is a member of.
+func (k *APIKey) AllowsChat(chatID int64) bool {
+	if len(k.ChatIDs) == 0 {
+		return true
+	}
+	for _, id := range k.ChatIDs {
+		if id == chatID {
+			return true
+		}
+	}
+	return false
+}
+
+type PostgresAPIKeyStore struct {
+	db *sql.DB
+}
+
+func NewPostgresAPIKeyStore(db *sql.DB) *PostgresAPIKeyStore {
+	return &PostgresAPIKeyStore{db: db}
+}
+
+type APIKeyStore interface {
+	CreateAPIKey(ctx context.Context, key *APIKey, token *tokens.Token) error
+	GetAPIKeysForUser(ctx context.Context, userID int64) ([]*APIKey, error)
+	RevokeAPIKey(ctx context.Context, userID, keyID int64) error
+	GetUserByAPIKey(ctx context.Context, plaintext string) (*User, *APIKey, error)
+}
+
+func (pg *PostgresAPIKeyStore) CreateAPIKey(ctx context.Context, key *APIKey, token *tokens.Token) error {
+	query := `
+		INSERT INTO api_keys (user_id, name, key_prefix, key_hash, scopes, chat_ids, created_by, expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		RETURNING id, created_at
+	`
+
+	key.Prefix = token.Plaintext[:len(tokens.APIKeyPrefix)+6]
+
+	var chatIDs interface{}
+	if len(key.ChatIDs) > 0 {
+		chatIDs = key.ChatIDs
+	}
+
+	return pg.db.QueryRowContext(ctx, query, key.UserID, key.Name, key.Prefix, token.Hash, key.Scopes, chatIDs, key.CreatedBy, key.ExpiresAt).Scan(&key.ID, &key.CreatedAt)
+}
+
+func (pg *PostgresAPIKeyStore) GetAPIKeysForUser(ctx context.Context, userID int64) ([]*APIKey, error) {
+	query := `
+		SELECT id, user_id, name, key_prefix, scopes, chat_ids, created_by, last_used_at, expires_at, revoked_at, created_at
+		FROM api_keys
+		WHERE user_id = $1
+		ORDER BY created_at DESC
+	`
+
+	rows, err := pg.db.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var keys []*APIKey
+	for rows.Next() {
+		var key APIKey
+		var scopes pgtype.TextArray
+		var chatIDs pgtype.Int8Array
+		err := rows.Scan(&key.ID, &key.UserID, &key.Name, &key.Prefix, &scopes, &chatIDs, &key.CreatedBy, &key.LastUsedAt, &key.ExpiresAt, &key.RevokedAt, &key.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		if err := assignArrays(&key, &scopes, &chatIDs); err != nil {
+			return nil, err
+		}
+		keys = append(keys, &key)
+	}
+
+	return keys, rows.Err()
+}
+
+func (pg *PostgresAPIKeyStore) RevokeAPIKey(ctx context.Context, userID, keyID int64) error {
+	query := `
+		UPDATE api_keys
+		SET revoked_at = NOW()
+		WHERE id = $1 AND user_id = $2 AND revoked_at IS NULL
+	`
+
+	results, err := pg.db.ExecContext(ctx, query, keyID, userID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := results.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return sql.ErrNoRows
+	}
+
+	return nil
+}
+
+// GetUserByAPIKey resolves a plaintext key to its bot user and records its
+// use. Revoked and expired keys resolve to nil, nil.
+func (pg *PostgresAPIKeyStore) GetUserByAPIKey(ctx context.Context, plaintext string) (*User, *APIKey, error) {
+	query := `
+		WITH k AS (
+			UPDATE api_keys
+			SET last_used_at = NOW()
+			WHERE key_hash = $1
+			AND revoked_at IS NULL
+			AND (expires_at IS NULL OR expires_at > NOW())
+			RETURNING id, user_id, name, key_prefix, scopes, chat_ids, created_by, last_used_at, expires_at, created_at
+		)
+		SELECT
+			k.id, k.user_id, k.name, k.key_prefix, k.scopes, k.chat_ids, k.created_by, k.last_used_at, k.expires_at, k.created_at,
+			u.id, u.username, u.email, u.avatar_url, u.bio, u.is_bot, u.bot_owner_id, u.is_admin, u.suspended_at, u.last_seen_at, u.created_at, u.updated_at
+		FROM k
+		INNER JOIN users u ON u.id = k.user_id
+	`
+
+	var key APIKey
+	var scopes pgtype.TextArray
+	var chatIDs pgtype.Int8Array
+	user := &User{}
+
+	err := pg.db.QueryRowContext(ctx, query, tokens.Hash(plaintext)).Scan(
+		&key.ID,
+		&key.UserID,
+		&key.Name,
+		&key.Prefix,
+		&scopes,
+		&chatIDs,
+		&key.CreatedBy,
+		&key.LastUsedAt,
+		&key.ExpiresAt,
+		&key.CreatedAt,
+		&user.ID,
+		&user.Username,
+		&user.Email,
+		&user.AvatarURL,
+		&user.Bio,
+		&user.IsBot,
+		&user.BotOwnerID,
+		&user.IsAdmin,
+		&user.SuspendedAt,
+		&user.LastSeenAt,
+		&user.CreatedAt,
+		&user.UpdatedAt,
+	)
+	if err == sql.ErrNoRows {
+		return nil, nil, nil
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if err := assignArrays(&key, &scopes, &chatIDs); err != nil {
+		return nil, nil, err
+	}
+	return user, &key, nil
+}
+
+func assignArrays(key *APIKey, scopes *pgtype.TextArray, chatIDs *pgtype.Int8Array) error {
+	err := scopes.AssignTo(&key.Scopes)
+	if err != nil {
+		return err
+	}
+	if chatIDs.Status == pgtype.Present {
+		return chatIDs.AssignTo(&key.ChatIDs)
+	}
+	return nil
+}
@@ -0,0 +1,150 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"time"
+)
+
+// Audit log actions, named <target>.<what happened>.
+const (
+	AuditUserLogin            = "user.login"
+	AuditUserLoginFailed      = "user.login_failed"
+	AuditUserPasswordChanged  = "user.password_changed"
+	AuditUserSuspended        = "user.suspended"
+	AuditUserReactivated      = "user.reactivated"
+	AuditUserSessionsRevoked  = "user.sessions_revoked"
+	AuditAPIKeyRevoked        = "api_key.revoked"
+	AuditChatUpdated          = "chat.updated"
+	AuditChatSettingsUpdated  = "chat.settings_updated"
+	AuditChatDeleted          = "chat.deleted"
+	AuditInviteCreated        = "invite.created"
+	AuditInviteRevoked        = "invite.revoked"
+	AuditMemberAdded          = "member.added"
+	AuditMemberJoined         = "member.joined"
+	AuditMemberRemoved        = "member.removed"
+	AuditMemberLeft           = "member.left"
+	AuditMemberRoleChanged    = "member.role_changed"
+	AuditMemberPostingMuted   = "member.posting_muted"
+	AuditMemberPostingUnmuted = "member.posting_unmuted"
+	AuditMessageDeleted       = "message.deleted"
+	AuditReportResolved       = "report.resolved"
+)
+
+// Audit log target types.
+const (
+	AuditTargetUser    = "user"
+	AuditTargetChat    = "chat"
+	AuditTargetMessage = "message"
+	AuditTargetReport  = "report"
+	AuditTargetAPIKey  = "api_key"
+	AuditTargetInvite  = "invite"
+)
+
+// AuditEntry records one action: who did it, to what, in which chat, the
+// state before and after and the request it came with.
+type AuditEntry struct {
+	ID         int64           `json:"id"`
+	ActorID    *int64          `json:"actor_id"`
+	Action     string          `json:"action"`
+	TargetType *string         `json:"target_type,omitempty"`
+	TargetID   *int64          `json:"target_id,omitempty"`
+	ChatID     *int64          `json:"chat_id,omitempty"`
+	Before     json.RawMessage `json:"before,omitempty"`
+	After      json.RawMessage `json:"after,omitempty"`
+	RequestID  *string         `json:"request_id,omitempty"`
+	IP         *string         `json:"ip,omitempty"`
+	UserAgent  *string         `json:"user_agent,omitempty"`
+	CreatedAt  time.Time       `json:"created_at"`
+}
+
+// AuditQuery narrows GetAuditLog down; nil and empty fields match
+// everything.
+type AuditQuery struct {
+	ActorID    *int64
+	ChatID     *int64
+	TargetType string
+	TargetID   *int64
+	Action     string
+	Limit      int64
+	Offset     int64
+}
+
+type PostgresAuditStore struct {
+	db *sql.DB
+}
+
+func NewPostgresAuditStore(db *sql.DB) *PostgresAuditStore {
+	return &PostgresAuditStore{db: db}
+}
+
+type AuditStore interface {
+	RecordAudit(ctx context.Context, entry *AuditEntry) error
+	// GetAuditLog returns matching entries, newest first.
+	GetAuditLog(ctx context.Context, query AuditQuery) ([]*AuditEntry, error)
+}
+
+func (pg *PostgresAuditStore) RecordAudit(ctx context.Context, entry *AuditEntry) error {
+	query := `
+		INSERT INTO audit_log (actor_id, action, target_type, target_id, chat_id, before, after, request_id, ip, user_agent)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+		RETURNING id, created_at
+	`
+
+	return pg.db.QueryRowContext(ctx, query,
+		entry.ActorID,
+		entry.Action,
+		entry.TargetType,
+		entry.TargetID,
+		entry.ChatID,
+		jsonb(entry.Before),
+		jsonb(entry.After),
+		entry.RequestID,
+		entry.IP,
+		entry.UserAgent,
+	).Scan(&entry.ID, &entry.CreatedAt)
+}
+
+// jsonb passes an empty document as NULL instead of invalid JSON.
+func jsonb(doc json.RawMessage) []byte {
+	if len(doc) == 0 {
+		return nil
+	}
+	return doc
+}
+
+func (pg *PostgresAuditStore) GetAuditLog(ctx context.Context, q AuditQuery) ([]*AuditEntry, error) {
+	query := `
+		SELECT id, actor_id, action, target_type, target_id, chat_id, before, after, request_id, ip, user_agent, created_at
+		FROM audit_log
+		WHERE ($1::BIGINT IS NULL OR actor_id = $1)
+		AND ($2::BIGINT IS NULL OR chat_id = $2)
+		AND ($3 = '' OR target_type = $3)
+		AND ($4::BIGINT IS NULL OR target_id = $4)
+		AND ($5 = '' OR action = $5)
+		ORDER BY created_at DESC, id DESC
+		LIMIT $6 OFFSET $7
+	`
+
+	rows, err := pg.db.QueryContext(ctx, query, q.ActorID, q.ChatID, q.TargetType, q.TargetID, q.Action, q.Limit, q.Offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	entries := []*AuditEntry{}
+	for rows.Next() {
+		var e AuditEntry
+		var before, after []byte
+		err := rows.Scan(&e.ID, &e.ActorID, &e.Action, &e.TargetType, &e.TargetID, &e.ChatID, &before, &after, &e.RequestID, &e.IP, &e.UserAgent, &e.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		e.Before = before
+		e.After = after
+		entries = append(entries, &e)
+	}
+
+	return entries, rows.Err()
+}
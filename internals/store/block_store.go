@@ -0,0 +1,107 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+// Block is a user the caller has blocked.
+type Block struct {
+	UserID    int64     `json:"user_id"`
+	Username  string    `json:"username"`
+	AvatarURL *string   `json:"avatar_url"`
+	BlockedAt time.Time `json:"blocked_at"`
+}
+
+type PostgresBlockStore struct {
+	db *sql.DB
+}
+
+func NewPostgresBlockStore(db *sql.DB) *PostgresBlockStore {
+	return &PostgresBlockStore{db: db}
+}
+
+type BlockStore interface {
+	BlockUser(ctx context.Context, blockerID, blockedID int64) error
+	UnblockUser(ctx context.Context, blockerID, blockedID int64) error
+	GetBlockedUsers(ctx context.Context, blockerID int64) ([]*Block, error)
+	HasBlocked(ctx context.Context, blockerID, blockedID int64) (bool, error)
+}
+
+// BlockUser is idempotent, blocking someone twice is not an error. It
+// returns ErrNotFound when the user to block does not exist.
+func (pg *PostgresBlockStore) BlockUser(ctx context.Context, blockerID, blockedID int64) error {
+	query := `
+		INSERT INTO user_blocks (blocker_id, blocked_id)
+		VALUES ($1, $2)
+		ON CONFLICT (blocker_id, blocked_id) DO NOTHING
+	`
+
+	_, err := pg.db.ExecContext(ctx, query, blockerID, blockedID)
+	if err != nil {
+		return classify(err)
+	}
+	return nil
+}
+
+func (pg *PostgresBlockStore) UnblockUser(ctx context.Context, blockerID, blockedID int64) error {
+	query := `
+		DELETE FROM user_blocks
+		WHERE blocker_id = $1 AND blocked_id = $2
+	`
+
+	result, err := pg.db.ExecContext(ctx, query, blockerID, blockedID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+func (pg *PostgresBlockStore) GetBlockedUsers(ctx context.Context, blockerID int64) ([]*Block, error) {
+	query := `
+		SELECT u.id, u.username, u.avatar_url, b.created_at
+		FROM user_blocks b
+		JOIN users u ON u.id = b.blocked_id
+		WHERE b.blocker_id = $1
+		ORDER BY b.created_at DESC
+	`
+
+	rows, err := pg.db.QueryContext(ctx, query, blockerID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	blocks := []*Block{}
+	for rows.Next() {
+		block := &Block{}
+		err = rows.Scan(&block.UserID, &block.Username, &block.AvatarURL, &block.BlockedAt)
+		if err != nil {
+			return nil, err
+		}
+		blocks = append(blocks, block)
+	}
+	return blocks, rows.Err()
+}
+
+func (pg *PostgresBlockStore) HasBlocked(ctx context.Context, blockerID, blockedID int64) (bool, error) {
+	query := `
+		SELECT EXISTS (
+			SELECT 1 FROM user_blocks
+			WHERE blocker_id = $1 AND blocked_id = $2
+		)
+	`
+
+	var blocked bool
+	err := pg.db.QueryRowContext(ctx, query, blockerID, blockedID).Scan(&blocked)
+	return blocked, err
+}
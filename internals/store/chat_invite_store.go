@@ -0,0 +1,232 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+// ChatInvite is a shareable link that lets anyone signed in join a group
+// chat with Role.
+type ChatInvite struct {
+	ID        int64         `json:"id"`
+	ChatID    int64         `json:"chat_id"`
+	Code      string        `json:"code"`
+	Role      ChatGroupRole `json:"role"`
+	// MaxUses is nil for an invite that can be used any number of times
+	MaxUses   *int          `json:"max_uses"`
+	Uses      int           `json:"uses"`
+	ExpiresAt *time.Time    `json:"expires_at"`
+	RevokedAt *time.Time    `json:"revoked_at,omitempty"`
+	CreatedBy *int64        `json:"created_by,omitempty"`
+	CreatedAt time.Time     `json:"created_at"`
+}
+
+// usable returns nil when the invite can be redeemed at now, the database
+// clock. Revoked invites are not found.
+func (i *ChatInvite) usable(now time.Time) error {
+	switch {
+	case i.RevokedAt != nil:
+		return ErrNotFound
+	case i.ExpiresAt != nil && !i.ExpiresAt.After(now):
+		return ErrInviteExpired
+	case i.MaxUses != nil && i.Uses >= *i.MaxUses:
+		return ErrInviteUsedUp
+	}
+	return nil
+}
+
+// InvitePreview is what someone holding an invite code may see of the chat
+// before joining it.
+type InvitePreview struct {
+	ChatID      int64         `json:"chat_id"`
+	Name        *string       `json:"name"`
+	MemberCount int64         `json:"member_count"`
+	Role        ChatGroupRole `json:"role"`
+	ExpiresAt   *time.Time    `json:"expires_at"`
+}
+
+type PostgresChatInviteStore struct {
+	db *sql.DB
+}
+
+func NewPostgresChatInviteStore(db *sql.DB) *PostgresChatInviteStore {
+	return &PostgresChatInviteStore{db: db}
+}
+
+type ChatInviteStore interface {
+	CreateInvite(ctx context.Context, invite *ChatInvite) error
+	GetChatInvites(ctx context.Context, chatID int64) ([]*ChatInvite, error)
+	RevokeInvite(ctx context.Context, chatID, inviteID int64) (*ChatInvite, error)
+	PreviewInvite(ctx context.Context, code string) (*InvitePreview, error)
+	RedeemInvite(ctx context.Context, code string, userID int64) (*ChatInvite, *Message, error)
+}
+
+func (pg *PostgresChatInviteStore) CreateInvite(ctx context.Context, invite *ChatInvite) error {
+	query := `
+		INSERT INTO chat_invites (chat_id, code, role, max_uses, expires_at, created_by)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING id, uses, created_at
+	`
+
+	err := pg.db.QueryRowContext(ctx, query, invite.ChatID, invite.Code, invite.Role, invite.MaxUses, invite.ExpiresAt, invite.CreatedBy).Scan(&invite.ID, &invite.Uses, &invite.CreatedAt)
+	return classify(err)
+}
+
+// GetChatInvites returns all of the chat's invites, revoked, expired and used
+// up ones included, newest first.
+func (pg *PostgresChatInviteStore) GetChatInvites(ctx context.Context, chatID int64) ([]*ChatInvite, error) {
+	query := `
+		SELECT id, chat_id, code, role, max_uses, uses, expires_at, revoked_at, created_by, created_at
+		FROM chat_invites
+		WHERE chat_id = $1
+		ORDER BY created_at DESC
+	`
+
+	rows, err := pg.db.QueryContext(ctx, query, chatID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	invites := []*ChatInvite{}
+	for rows.Next() {
+		var invite ChatInvite
+		err := rows.Scan(&invite.ID, &invite.ChatID, &invite.Code, &invite.Role, &invite.MaxUses, &invite.Uses, &invite.ExpiresAt, &invite.RevokedAt, &invite.CreatedBy, &invite.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		invites = append(invites, &invite)
+	}
+
+	return invites, rows.Err()
+}
+
+// RevokeInvite returns the revoked invite, or ErrNotFound when the chat has
+// no such invite or it is already revoked.
+func (pg *PostgresChatInviteStore) RevokeInvite(ctx context.Context, chatID, inviteID int64) (*ChatInvite, error) {
+	query := `
+		UPDATE chat_invites
+		SET revoked_at = NOW()
+		WHERE id = $1 AND chat_id = $2 AND revoked_at IS NULL
+		RETURNING id, chat_id, code, role, max_uses, uses, expires_at, revoked_at, created_by, created_at
+	`
+
+	var invite ChatInvite
+	err := pg.db.QueryRowContext(ctx, query, inviteID, chatID).Scan(&invite.ID, &invite.ChatID, &invite.Code, &invite.Role, &invite.MaxUses, &invite.Uses, &invite.ExpiresAt, &invite.RevokedAt, &invite.CreatedBy, &invite.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &invite, nil
+}
+
+// PreviewInvite returns ErrNotFound for unknown and revoked codes, and
+// ErrInviteExpired or ErrInviteUsedUp for invites that can't be used anymore.
+func (pg *PostgresChatInviteStore) PreviewInvite(ctx context.Context, code string) (*InvitePreview, error) {
+	query := `
+		SELECT
+			i.chat_id,
+			i.role,
+			i.max_uses,
+			i.uses,
+			i.expires_at,
+			i.revoked_at,
+			c.name,
+			(SELECT COUNT(*) FROM chat_members cm WHERE cm.chat_id = i.chat_id),
+			NOW()
+		FROM chat_invites i
+		JOIN chats c ON c.id = i.chat_id
+		WHERE i.code = $1
+	`
+
+	var invite ChatInvite
+	var preview InvitePreview
+	var now time.Time
+	err := pg.db.QueryRowContext(ctx, query, code).Scan(
+		&invite.ChatID,
+		&invite.Role,
+		&invite.MaxUses,
+		&invite.Uses,
+		&invite.ExpiresAt,
+		&invite.RevokedAt,
+		&preview.Name,
+		&preview.MemberCount,
+		&now,
+	)
+	if err != nil {
+		return nil, err
+	}
+	if err := invite.usable(now); err != nil {
+		return nil, err
+	}
+
+	preview.ChatID = invite.ChatID
+	preview.Role = invite.Role
+	preview.ExpiresAt = invite.ExpiresAt
+	return &preview, nil
+}
+
+// RedeemInvite adds the user to the invite's chat, counts the use and posts
+// a member.joined system message, all in one transaction. Besides the
+// errors of PreviewInvite it returns ErrConflict when the user already is a
+// member.
+func (pg *PostgresChatInviteStore) RedeemInvite(ctx context.Context, code string, userID int64) (*ChatInvite, *Message, error) {
+	tx, err := pg.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
+
+	// the row lock keeps concurrent joins from going over max_uses
+	q1 := `
+		SELECT id, chat_id, code, role, max_uses, uses, expires_at, revoked_at, created_by, created_at, NOW()
+		FROM chat_invites
+		WHERE code = $1
+		FOR UPDATE
+	`
+
+	var invite ChatInvite
+	var now time.Time
+	err = tx.QueryRowContext(ctx, q1, code).Scan(&invite.ID, &invite.ChatID, &invite.Code, &invite.Role, &invite.MaxUses, &invite.Uses, &invite.ExpiresAt, &invite.RevokedAt, &invite.CreatedBy, &invite.CreatedAt, &now)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := invite.usable(now); err != nil {
+		return nil, nil, err
+	}
+
+	q2 := `
+		INSERT INTO chat_members (user_id, chat_id, role, muted)
+		VALUES ($1, $2, $3, $4)
+	`
+	_, err = tx.ExecContext(ctx, q2, userID, invite.ChatID, invite.Role, false)
+	if err != nil {
+		return nil, nil, classify(err)
+	}
+
+	q3 := `
+		UPDATE chat_invites
+		SET uses = uses + 1
+		WHERE id = $1
+		RETURNING uses
+	`
+	err = tx.QueryRowContext(ctx, q3, invite.ID).Scan(&invite.Uses)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	msg, err := insertSystemMessage(ctx, tx, invite.ChatID, &SystemEvent{
+		Kind: SystemMemberJoined,
+		ActorID: &userID,
+		TargetID: &userID,
+		Role: &invite.Role,
+		InviteID: &invite.ID,
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return &invite, msg, tx.Commit()
+}
@@ -0,0 +1,34 @@
+package store
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestInviteUsable(t *testing.T) {
+	now := time.Now()
+	before, after := now.Add(-time.Minute), now.Add(time.Minute)
+	three := 3
+
+	tests := []struct {
+		name   string
+		invite ChatInvite
+		want   error
+	}{
+		{name: "unlimited", invite: ChatInvite{Uses: 500}},
+		{name: "not expired yet", invite: ChatInvite{ExpiresAt: &after}},
+		{name: "expired", invite: ChatInvite{ExpiresAt: &before}, want: ErrInviteExpired},
+		{name: "expiring right now", invite: ChatInvite{ExpiresAt: &now}, want: ErrInviteExpired},
+		{name: "uses left", invite: ChatInvite{MaxUses: &three, Uses: 2}},
+		{name: "used up", invite: ChatInvite{MaxUses: &three, Uses: 3}, want: ErrInviteUsedUp},
+		{name: "revoked", invite: ChatInvite{RevokedAt: &before, ExpiresAt: &before}, want: ErrNotFound},
+		{name: "expired and used up", invite: ChatInvite{ExpiresAt: &before, MaxUses: &three, Uses: 3}, want: ErrInviteExpired},
+	}
+
+	for _, tt := range tests {
+		if err := tt.invite.usable(now); !errors.Is(err, tt.want) {
+			t.Errorf("%s: %v, want %v", tt.name, err, tt.want)
+		}
+	}
+}
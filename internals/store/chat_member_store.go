@@ -3,9 +3,10 @@ package store
 import (
 	"context"
 	"database/sql"
-	"fmt"
 	"strings"
 	"time"
+
+	"github.com/Abhishek-B-R/chat-app-golang/internals/logging"
 )
 
 
@@ -34,6 +35,29 @@ type ChatMemberWithUser struct {
 	Username      string    `json:"username"`
 	Email         string    `json:"email,omitempty"`
 	ProfilePicURL string    `json:"profilePicUrl,omitempty"`
+	PostingMutedUntil *time.Time `json:"postingMutedUntil,omitempty"`
+}
+
+// PostingState is what decides whether a member may post in a chat.
+type PostingState struct {
+	Role ChatGroupRole
+	Settings ChatSettings
+	PostingMutedUntil *time.Time
+	LastPostedAt *time.Time
+	// Now is the database clock, the times above are compared against it
+	Now time.Time
+}
+
+// LeaveResult is what happened to the chat when a member left it.
+type LeaveResult struct {
+	Role ChatGroupRole
+	// NewOwnerID is the member promoted because no owner was left
+	NewOwnerID *int64
+	NewOwnerPreviousRole ChatGroupRole
+	// ChatDeleted is set when the last member left
+	ChatDeleted bool
+	// Messages are the system messages posted, oldest first
+	Messages []*Message
 }
 
 type PostgresChatMemberStore struct{
@@ -47,58 +71,209 @@ func NewPostgresChatMemberStore(db *sql.DB) *PostgresChatMemberStore{
 }
 
 type ChatMemberStore interface {
-	AddMember(ctx context.Context, chatID, userID int64, role string) error
-    RemoveMember(ctx context.Context, chatID, userID int64) error
+	AddMember(ctx context.Context, chatID, userID int64, role string, event *SystemEvent) (*Message, error)
+    RemoveMember(ctx context.Context, chatID, userID int64, event *SystemEvent) (*Message, error)
+	// LeaveChat takes the user out of the chat without leaving it ownerless.
+	// event is the system message to post, nil for the user leaving.
+	LeaveChat(ctx context.Context, chatID, userID int64, event *SystemEvent) (*LeaveResult, error)
     GetChatMembers(ctx context.Context, chatID int64) ([]*ChatMemberWithUser, error)
     GetUserRole(ctx context.Context, chatID, userID int64) (string, error)
+	UpdateMemberRole(ctx context.Context, chatID, userID int64, role ChatGroupRole, event *SystemEvent) (*Message, error)
     IsMember(ctx context.Context, chatID, userID int64) (bool, error)
     UpdateLastRead(ctx context.Context, chatID, userID, messageID int64) error
 	MuteChat(ctx context.Context, userID, chatID int64) error
 	UnMuteChat(ctx context.Context, userID, chatID int64) error
+	GetPostingState(ctx context.Context, chatID, userID int64) (*PostingState, error)
+	SetPostingMute(ctx context.Context, chatID, userID int64, until *time.Time) error
 }
 
-func (pg *PostgresChatMemberStore) AddMember(ctx context.Context, chatID, userID int64, role string) error {
+// AddMember adds the user to the chat and posts event, when not nil, in the
+// same transaction. It returns the system message.
+func (pg *PostgresChatMemberStore) AddMember(ctx context.Context, chatID, userID int64, role string, event *SystemEvent) (*Message, error) {
 	role = strings.TrimSpace(strings.ToLower(role))
 
 	switch role {
 	case "owner", "admin", "member":
 	default:
-		fmt.Printf("WARN: invalid role: %q", role)
+		logging.FromContext(ctx).Warn("invalid role, adding as member", "role", role)
 		role = "member"
 	}
 
+	tx, err := pg.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
+
 	query := `
 		INSERT INTO chat_members (user_id, chat_id, role, muted)
 		VALUES ($1, $2, $3, $4)
 	`
 
-	_, err := pg.db.ExecContext(ctx, query, userID, chatID, role, false)
+	_, err = tx.ExecContext(ctx, query, userID, chatID, role, false)
 	if err != nil {
-		return err
+		return nil, classify(err)
 	}
-	return nil
+
+	msg, err := insertSystemMessage(ctx, tx, chatID, event)
+	if err != nil {
+		return nil, err
+	}
+	return msg, tx.Commit()
 }
 
-func (pg *PostgresChatMemberStore) RemoveMember(ctx context.Context, chatID, userID int64) error {
+// RemoveMember removes the user from the chat and posts event, when not nil,
+// in the same transaction. It returns the system message.
+func (pg *PostgresChatMemberStore) RemoveMember(ctx context.Context, chatID, userID int64, event *SystemEvent) (*Message, error) {
+	tx, err := pg.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
+
 	query := `
 		DELETE FROM chat_members 
 		WHERE chat_id = $1 AND user_id = $2
 	`
 
-	results, err := pg.db.ExecContext(ctx, query, chatID, userID)
+	results, err := tx.ExecContext(ctx, query, chatID, userID)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	rowsAffected, err := results.RowsAffected()
 	if err != nil {
-		return err
+		return nil, err
 	}
 	if rowsAffected == 0 {
-		return sql.ErrNoRows
+		return nil, sql.ErrNoRows
 	}
 
-	return nil
+	msg, err := insertSystemMessage(ctx, tx, chatID, event)
+	if err != nil {
+		return nil, err
+	}
+	return msg, tx.Commit()
+}
+
+// LeaveChat removes the user from the chat in one transaction. When no owner
+// is left, the longest-standing admin, or member if there is no admin,
+// becomes the owner; when the last member leaves, the chat is deleted. It
+// posts event, or member.left when nil, and returns sql.ErrNoRows when the
+// user is not a member.
+func (pg *PostgresChatMemberStore) LeaveChat(ctx context.Context, chatID, userID int64, event *SystemEvent) (*LeaveResult, error) {
+	tx, err := pg.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
+
+	// concurrent leaves of the same chat queue up here, so two last owners
+	// can't both leave without a successor
+	q1 := `
+		SELECT id FROM chats
+		WHERE id = $1
+		FOR UPDATE
+	`
+	err = tx.QueryRowContext(ctx, q1, chatID).Scan(&chatID)
+	if err != nil {
+		return nil, err
+	}
+
+	res := &LeaveResult{}
+	q2 := `
+		DELETE FROM chat_members
+		WHERE chat_id = $1 AND user_id = $2
+		RETURNING role
+	`
+	err = tx.QueryRowContext(ctx, q2, chatID, userID).Scan(&res.Role)
+	if err != nil {
+		return nil, err
+	}
+
+	var remaining, owners int
+	q3 := `
+		SELECT COUNT(*), COUNT(*) FILTER (WHERE role = 'owner')
+		FROM chat_members
+		WHERE chat_id = $1
+	`
+	err = tx.QueryRowContext(ctx, q3, chatID).Scan(&remaining, &owners)
+	if err != nil {
+		return nil, err
+	}
+
+	if remaining == 0 {
+		q4 := `
+			DELETE FROM chats
+			WHERE id = $1
+		`
+		_, err = tx.ExecContext(ctx, q4, chatID)
+		if err != nil {
+			return nil, err
+		}
+		res.ChatDeleted = true
+		return res, tx.Commit()
+	}
+
+	if event == nil {
+		event = &SystemEvent{
+			Kind: SystemMemberLeft,
+			ActorID: &userID,
+			TargetID: &userID,
+		}
+	}
+	msg, err := insertSystemMessage(ctx, tx, chatID, event)
+	if err != nil {
+		return nil, err
+	}
+	res.Messages = append(res.Messages, msg)
+
+	// chats created before creators became owners may have none left
+	// either, so this does not depend on the leaver's role
+	if owners == 0 {
+		var newOwnerID int64
+		q5 := `
+			SELECT user_id, role FROM chat_members
+			WHERE chat_id = $1
+			ORDER BY role = 'admin' DESC, joined_at ASC, user_id ASC
+			LIMIT 1
+		`
+		err = tx.QueryRowContext(ctx, q5, chatID).Scan(&newOwnerID, &res.NewOwnerPreviousRole)
+		if err != nil {
+			return nil, err
+		}
+
+		q6 := `
+			UPDATE chat_members
+			SET role = 'owner'
+			WHERE chat_id = $1 AND user_id = $2
+		`
+		_, err = tx.ExecContext(ctx, q6, chatID, newOwnerID)
+		if err != nil {
+			return nil, err
+		}
+		res.NewOwnerID = &newOwnerID
+
+		// the promotion is the server's doing, so it has no actor
+		owner := OWNER
+		msg, err := insertSystemMessage(ctx, tx, chatID, &SystemEvent{
+			Kind: SystemMemberRoleChanged,
+			TargetID: &newOwnerID,
+			Role: &owner,
+		})
+		if err != nil {
+			return nil, err
+		}
+		res.Messages = append(res.Messages, msg)
+	}
+
+	return res, tx.Commit()
 }
 
 func (pg *PostgresChatMemberStore) GetChatMembers(ctx context.Context, chatID int64) ([]*ChatMemberWithUser, error) {
@@ -110,7 +285,8 @@ func (pg *PostgresChatMemberStore) GetChatMembers(ctx context.Context, chatID in
 			cm.joined_at,
 			u.username,
 			u.email,
-			u.avatar_url  -- if you have this
+			u.avatar_url,  -- if you have this
+			CASE WHEN cm.posting_muted_until > NOW() THEN cm.posting_muted_until END
 		FROM chat_members cm
 		JOIN users u ON cm.user_id = u.id
 		WHERE cm.chat_id = $1
@@ -134,6 +310,7 @@ func (pg *PostgresChatMemberStore) GetChatMembers(ctx context.Context, chatID in
 			&member.Username,
 			&member.Email,   
 			&member.ProfilePicURL,
+			&member.PostingMutedUntil,
 		)
 		if err != nil {
 			return nil, err
@@ -155,10 +332,47 @@ func (pg *PostgresChatMemberStore) GetUserRole(ctx context.Context, chatID, user
 	if err != nil {
 		return "",err
 	}
-	fmt.Println(role)
 	return role, nil
 }
 
+// UpdateMemberRole changes the member's role and posts event, when not nil,
+// in the same transaction. It returns the system message, or sql.ErrNoRows
+// when the user is not a member.
+func (pg *PostgresChatMemberStore) UpdateMemberRole(ctx context.Context, chatID, userID int64, role ChatGroupRole, event *SystemEvent) (*Message, error) {
+	tx, err := pg.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
+
+	query := `
+		UPDATE chat_members
+		SET role = $1
+		WHERE chat_id = $2 AND user_id = $3
+	`
+
+	results, err := tx.ExecContext(ctx, query, role, chatID, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	rowsAffected, err := results.RowsAffected()
+	if err != nil {
+		return nil, err
+	}
+	if rowsAffected == 0 {
+		return nil, sql.ErrNoRows
+	}
+
+	msg, err := insertSystemMessage(ctx, tx, chatID, event)
+	if err != nil {
+		return nil, err
+	}
+	return msg, tx.Commit()
+}
+
 func (pg *PostgresChatMemberStore) IsMember(ctx context.Context, chatID, userID int64) (bool, error) {
 	role := ""
 	query := `
@@ -200,7 +414,7 @@ func (pg *PostgresChatMemberStore) MuteChat(ctx context.Context, userID, chatID
 		WHERE user_id = $1 AND chat_id = $2
 	`
 
-	_, err := pg.db.Exec(query, userID, chatID)
+	_, err := pg.db.ExecContext(ctx, query, userID, chatID)
 	return err
 }
 
@@ -211,6 +425,54 @@ func (pg *PostgresChatMemberStore) UnMuteChat(ctx context.Context, userID, chatI
 		WHERE user_id = $1 AND chat_id = $2
 	`
 
-	_, err := pg.db.Exec(query, userID, chatID)
+	_, err := pg.db.ExecContext(ctx, query, userID, chatID)
 	return err
-}
\ No newline at end of file
+}
+
+// GetPostingState returns sql.ErrNoRows when the user is not a member.
+func (pg *PostgresChatMemberStore) GetPostingState(ctx context.Context, chatID, userID int64) (*PostingState, error) {
+	var state PostingState
+	query := `
+		SELECT cm.role, c.slow_mode_seconds, c.admins_only, cm.posting_muted_until, cm.last_posted_at, NOW()
+		FROM chat_members cm
+		JOIN chats c ON c.id = cm.chat_id
+		WHERE cm.chat_id = $1 AND cm.user_id = $2
+	`
+
+	err := pg.db.QueryRowContext(ctx, query, chatID, userID).Scan(
+		&state.Role,
+		&state.Settings.SlowModeSeconds,
+		&state.Settings.AdminsOnly,
+		&state.PostingMutedUntil,
+		&state.LastPostedAt,
+		&state.Now,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &state, nil
+}
+
+// SetPostingMute keeps the member from posting until the given time, nil
+// lifts the mute. It returns sql.ErrNoRows when the user is not a member.
+func (pg *PostgresChatMemberStore) SetPostingMute(ctx context.Context, chatID, userID int64, until *time.Time) error {
+	query := `
+		UPDATE chat_members
+		SET posting_muted_until = $1
+		WHERE chat_id = $2 AND user_id = $3
+	`
+
+	result, err := pg.db.ExecContext(ctx, query, until, chatID, userID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
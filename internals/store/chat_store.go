@@ -11,11 +11,21 @@ type Chat struct {
 	IsGroup bool `json:"is_group"`
 	Name *string `json:"name"`
 	CreatedBy int64 `json:"created_by"`
-	LastMessageAt *int64 `json:"last_message_at"`
+	LastMessageAt *time.Time `json:"last_message_at"`
+	Settings ChatSettings `json:"settings"`
 	CreatedAt time.Time `json:"created_at"`
 	UpdatedAt time.Time `json:"updated_at"`
 }
 
+// ChatSettings restrict posting in a chat. Owners and admins are exempt.
+type ChatSettings struct {
+	// SlowModeSeconds is the minimum wait between two messages of the same
+	// member, 0 turns slow mode off.
+	SlowModeSeconds int `json:"slow_mode_seconds"`
+	// AdminsOnly makes the chat an announcement channel only admins post in.
+	AdminsOnly bool `json:"admins_only"`
+}
+
 type PostgresChatStore struct {
 	db *sql.DB
 }
@@ -28,12 +38,13 @@ type ChatStore interface {
 	CreateChat(ctx context.Context, chat *Chat, userID int64) (*Chat, error)
 	GetUserChats(ctx context.Context, userID int64) (*[]Chat, error)
 	GetChatByID(ctx context.Context, chatID int64) (*Chat, error)
-	UpdateChat(ctx context.Context, chat *Chat, chatID int64) error
+	UpdateChat(ctx context.Context, chat *Chat, chatID int64, event *SystemEvent) (*Message, error)
+	UpdateChatSettings(ctx context.Context, chatID int64, settings ChatSettings) error
 	DeleteChat(ctx context.Context, chatID int64) error
 }
 
 func (pg *PostgresChatStore) CreateChat(ctx context.Context, chat *Chat, userID int64) (*Chat, error) {
-	tx, err := pg.db.Begin()
+	tx, err := pg.db.BeginTx(ctx, nil)
 	defer func() {
 		_ = tx.Rollback()
 	}()
@@ -43,11 +54,11 @@ func (pg *PostgresChatStore) CreateChat(ctx context.Context, chat *Chat, userID
 	}
 
 	q1 := `
-		INSERT INTO chats (is_group, name, created_by)
-		VALUES ($1, $2, $3)
+		INSERT INTO chats (is_group, name, created_by, slow_mode_seconds, admins_only)
+		VALUES ($1, $2, $3, $4, $5)
 		RETURNING id
 	`
-	err = tx.QueryRowContext(ctx, q1, chat.IsGroup, chat.Name, userID).Scan(&chat.ChatID)
+	err = tx.QueryRowContext(ctx, q1, chat.IsGroup, chat.Name, userID, chat.Settings.SlowModeSeconds, chat.Settings.AdminsOnly).Scan(&chat.ChatID)
 	if err != nil {
 		return nil, err
 	}
@@ -56,16 +67,29 @@ func (pg *PostgresChatStore) CreateChat(ctx context.Context, chat *Chat, userID
 		INSERT INTO chat_members (user_id, chat_id, role, muted)
 		VALUES ($1, $2, $3, $4)
 	`
-	_, err = tx.ExecContext(ctx, q2, userID, chat.ChatID, "admin", false)
+	_, err = tx.ExecContext(ctx, q2, userID, chat.ChatID, OWNER, false)
 	if err != nil {
 		return nil, err
 	}
 
-	tx.Commit()
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
+	}
 	return chat, nil
 }
 
-func (pg *PostgresChatStore) UpdateChat(ctx context.Context, chat *Chat, chatID int64) error {
+// UpdateChat renames the chat and posts event, when not nil, in the same
+// transaction. It returns the system message.
+func (pg *PostgresChatStore) UpdateChat(ctx context.Context, chat *Chat, chatID int64, event *SystemEvent) (*Message, error) {
+	tx, err := pg.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
+
 	query := `
 		UPDATE chats
 		SET name = $1, updated_at = NOW()
@@ -73,8 +97,38 @@ func (pg *PostgresChatStore) UpdateChat(ctx context.Context, chat *Chat, chatID
 		RETURNING id
 	`
 
-	err := pg.db.QueryRowContext(ctx, query, chat.Name, chatID).Scan(&chat.ChatID)
-	return err
+	err = tx.QueryRowContext(ctx, query, chat.Name, chatID).Scan(&chat.ChatID)
+	if err != nil {
+		return nil, err
+	}
+
+	msg, err := insertSystemMessage(ctx, tx, chatID, event)
+	if err != nil {
+		return nil, err
+	}
+	return msg, tx.Commit()
+}
+
+func (pg *PostgresChatStore) UpdateChatSettings(ctx context.Context, chatID int64, settings ChatSettings) error {
+	query := `
+		UPDATE chats
+		SET slow_mode_seconds = $1, admins_only = $2, updated_at = NOW()
+		WHERE id = $3
+	`
+
+	result, err := pg.db.ExecContext(ctx, query, settings.SlowModeSeconds, settings.AdminsOnly, chatID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
 }
 
 func (pg *PostgresChatStore) DeleteChat(ctx context.Context, chatID int64) error {
@@ -102,7 +156,7 @@ func (pg *PostgresChatStore) DeleteChat(ctx context.Context, chatID int64) error
 func (pg *PostgresChatStore) GetChatByID(ctx context.Context, chatID int64) (*Chat, error) {
 	var chat Chat
 	query := `
-		SELECT id, is_group, name, created_by, last_message_at, created_at, updated_at
+		SELECT id, is_group, name, created_by, last_message_at, slow_mode_seconds, admins_only, created_at, updated_at
 		FROM chats
 		WHERE id = $1
 	`
@@ -113,6 +167,8 @@ func (pg *PostgresChatStore) GetChatByID(ctx context.Context, chatID int64) (*Ch
 		&chat.Name, 
 		&chat.CreatedBy, 
 		&chat.LastMessageAt, 
+		&chat.Settings.SlowModeSeconds,
+		&chat.Settings.AdminsOnly,
 		&chat.CreatedAt, 
 		&chat.UpdatedAt,
 	)
@@ -136,6 +192,8 @@ func (pg *PostgresChatStore) GetUserChats(ctx context.Context, userID int64) (*[
 			c.name, 
 			c.created_by, 
 			c.last_message_at, 
+			c.slow_mode_seconds,
+			c.admins_only,
 			c.created_at, 
 			c.updated_at
 		FROM chats c
@@ -158,6 +216,8 @@ func (pg *PostgresChatStore) GetUserChats(ctx context.Context, userID int64) (*[
 			&chat.Name, 
 			&chat.CreatedBy, 
 			&chat.LastMessageAt, 
+			&chat.Settings.SlowModeSeconds,
+			&chat.Settings.AdminsOnly,
 			&chat.CreatedAt, 
 			&chat.UpdatedAt,
 		)
@@ -0,0 +1,113 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+type ChatCommand struct {
+	ID          int64     `json:"id"`
+	ChatID      int64     `json:"chat_id"`
+	Name        string    `json:"name"`
+	URL         string    `json:"url"`
+	Secret      string    `json:"-"`
+	Description *string   `json:"description,omitempty"`
+	Usage       *string   `json:"usage,omitempty"`
+	CreatedBy   *int64    `json:"created_by,omitempty"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+type PostgresCommandStore struct {
+	db *sql.DB
+}
+
+func NewPostgresCommandStore(db *sql.DB) *PostgresCommandStore {
+	return &PostgresCommandStore{db: db}
+}
+
+type CommandStore interface {
+	CreateChatCommand(ctx context.Context, cmd *ChatCommand) error
+	GetChatCommands(ctx context.Context, chatID int64) ([]*ChatCommand, error)
+	GetChatCommandByName(ctx context.Context, chatID int64, name string) (*ChatCommand, error)
+	DeleteChatCommand(ctx context.Context, chatID, commandID int64) error
+}
+
+func (pg *PostgresCommandStore) CreateChatCommand(ctx context.Context, cmd *ChatCommand) error {
+	query := `
+		INSERT INTO chat_commands (chat_id, name, url, secret, description, usage, created_by)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		RETURNING id, created_at
+	`
+
+	err := pg.db.QueryRowContext(ctx, query, cmd.ChatID, cmd.Name, cmd.URL, cmd.Secret, cmd.Description, cmd.Usage, cmd.CreatedBy).Scan(&cmd.ID, &cmd.CreatedAt)
+	return classify(err)
+}
+
+func (pg *PostgresCommandStore) GetChatCommands(ctx context.Context, chatID int64) ([]*ChatCommand, error) {
+	query := `
+		SELECT id, chat_id, name, url, secret, description, usage, created_by, created_at
+		FROM chat_commands
+		WHERE chat_id = $1
+		ORDER BY name ASC
+	`
+
+	rows, err := pg.db.QueryContext(ctx, query, chatID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var cmds []*ChatCommand
+	for rows.Next() {
+		var cmd ChatCommand
+		err := rows.Scan(&cmd.ID, &cmd.ChatID, &cmd.Name, &cmd.URL, &cmd.Secret, &cmd.Description, &cmd.Usage, &cmd.CreatedBy, &cmd.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		cmds = append(cmds, &cmd)
+	}
+
+	return cmds, rows.Err()
+}
+
+// GetChatCommandByName returns nil, nil when the chat has no such command.
+func (pg *PostgresCommandStore) GetChatCommandByName(ctx context.Context, chatID int64, name string) (*ChatCommand, error) {
+	query := `
+		SELECT id, chat_id, name, url, secret, description, usage, created_by, created_at
+		FROM chat_commands
+		WHERE chat_id = $1 AND name = $2
+	`
+
+	var cmd ChatCommand
+	err := pg.db.QueryRowContext(ctx, query, chatID, name).Scan(&cmd.ID, &cmd.ChatID, &cmd.Name, &cmd.URL, &cmd.Secret, &cmd.Description, &cmd.Usage, &cmd.CreatedBy, &cmd.CreatedAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &cmd, nil
+}
+
+func (pg *PostgresCommandStore) DeleteChatCommand(ctx context.Context, chatID, commandID int64) error {
+	query := `
+		DELETE FROM chat_commands
+		WHERE id = $1 AND chat_id = $2
+	`
+
+	results, err := pg.db.ExecContext(ctx, query, commandID, chatID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := results.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return sql.ErrNoRows
+	}
+
+	return nil
+}
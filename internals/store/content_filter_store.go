@@ -0,0 +1,140 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"time"
+)
+
+type FilterKind string
+type FilterAction string
+
+const (
+	FilterWords    FilterKind = "words"
+	FilterRegex    FilterKind = "regex"
+	FilterDomains  FilterKind = "domains"
+	FilterMentions FilterKind = "mentions"
+)
+
+const (
+	// FilterMatch lets the message through and only records the hit.
+	FilterMatch   FilterAction = "match"
+	FilterReplace FilterAction = "replace"
+	FilterReject  FilterAction = "reject"
+)
+
+// ContentFilter is one rule of the message filter pipeline. ChatID is nil
+// for global rules, which apply to every chat.
+type ContentFilter struct {
+	ID        int64           `json:"id"`
+	ChatID    *int64          `json:"chat_id"`
+	Name      string          `json:"name"`
+	Kind      FilterKind      `json:"kind"`
+	Action    FilterAction    `json:"action"`
+	Config    json.RawMessage `json:"config"`
+	CreatedBy *int64          `json:"created_by,omitempty"`
+	CreatedAt time.Time       `json:"created_at"`
+}
+
+// Global reports whether the rule applies to every chat.
+func (f *ContentFilter) Global() bool {
+	return f.ChatID == nil
+}
+
+type PostgresContentFilterStore struct {
+	db *sql.DB
+}
+
+func NewPostgresContentFilterStore(db *sql.DB) *PostgresContentFilterStore {
+	return &PostgresContentFilterStore{db: db}
+}
+
+type ContentFilterStore interface {
+	CreateFilter(ctx context.Context, filter *ContentFilter) error
+	// GetFilters lists the rules of one chat, or the global rules when
+	// chatID is nil.
+	GetFilters(ctx context.Context, chatID *int64) ([]*ContentFilter, error)
+	// GetFiltersForChat returns every rule that applies to messages in the
+	// chat: the global rules first, then the chat's own.
+	GetFiltersForChat(ctx context.Context, chatID int64) ([]*ContentFilter, error)
+	DeleteFilter(ctx context.Context, chatID *int64, filterID int64) error
+}
+
+func (pg *PostgresContentFilterStore) CreateFilter(ctx context.Context, filter *ContentFilter) error {
+	query := `
+		INSERT INTO content_filters (chat_id, name, kind, action, config, created_by)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING id, created_at
+	`
+
+	err := pg.db.QueryRowContext(ctx, query, filter.ChatID, filter.Name, filter.Kind, filter.Action, []byte(filter.Config), filter.CreatedBy).Scan(&filter.ID, &filter.CreatedAt)
+	return classify(err)
+}
+
+func (pg *PostgresContentFilterStore) GetFilters(ctx context.Context, chatID *int64) ([]*ContentFilter, error) {
+	query := `
+		SELECT id, chat_id, name, kind, action, config, created_by, created_at
+		FROM content_filters
+		WHERE chat_id IS NOT DISTINCT FROM $1
+		ORDER BY id ASC
+	`
+
+	return pg.queryFilters(ctx, query, chatID)
+}
+
+func (pg *PostgresContentFilterStore) GetFiltersForChat(ctx context.Context, chatID int64) ([]*ContentFilter, error) {
+	query := `
+		SELECT id, chat_id, name, kind, action, config, created_by, created_at
+		FROM content_filters
+		WHERE chat_id IS NULL OR chat_id = $1
+		ORDER BY chat_id IS NOT NULL, id ASC
+	`
+
+	return pg.queryFilters(ctx, query, chatID)
+}
+
+func (pg *PostgresContentFilterStore) queryFilters(ctx context.Context, query string, args ...any) ([]*ContentFilter, error) {
+	rows, err := pg.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	filters := []*ContentFilter{}
+	for rows.Next() {
+		var f ContentFilter
+		var config []byte
+		err := rows.Scan(&f.ID, &f.ChatID, &f.Name, &f.Kind, &f.Action, &config, &f.CreatedBy, &f.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		f.Config = config
+		filters = append(filters, &f)
+	}
+
+	return filters, rows.Err()
+}
+
+// DeleteFilter only deletes the rule from the given chat, or from the
+// global rules when chatID is nil, so chat admins can't remove global rules.
+func (pg *PostgresContentFilterStore) DeleteFilter(ctx context.Context, chatID *int64, filterID int64) error {
+	query := `
+		DELETE FROM content_filters
+		WHERE id = $1 AND chat_id IS NOT DISTINCT FROM $2
+	`
+
+	result, err := pg.db.ExecContext(ctx, query, filterID, chatID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
@@ -1,24 +1,78 @@
 package store
 
 import (
+	"context"
 	"database/sql"
+	"database/sql/driver"
 	"fmt"
 	"io/fs"
+	"log/slog"
+	"path"
+	"time"
 
+	"github.com/Abhishek-B-R/chat-app-golang/internals/config"
+	"github.com/XSAM/otelsql"
 	_ "github.com/jackc/pgx/v4/stdlib"
 	"github.com/pressly/goose/v3"
+	"go.opentelemetry.io/otel/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
 )
 
-func Open() (*sql.DB, error) {
-	db, err := sql.Open("pgx", "host=localhost user=postgres password=postgres dbname=postgres port=5433 sslmode=disable")
+func Open(cfg config.DatabaseConfig, logger *slog.Logger) (*sql.DB, error) {
+	// every query made with a context that carries a span gets its own
+	// child span; queries outside of a trace, like the webhook worker
+	// polling, are not traced so they do not each start a new trace
+	db, err := otelsql.Open("pgx", cfg.DSN(),
+		otelsql.WithAttributes(semconv.DBSystemPostgreSQL, semconv.DBNamespace(cfg.Name)),
+		otelsql.WithSpanOptions(otelsql.SpanOptions{
+			OmitConnResetSession: true,
+			OmitRows: true,
+			SpanFilter: func(ctx context.Context, method otelsql.Method, query string, args []driver.NamedValue) bool {
+				return trace.SpanFromContext(ctx).SpanContext().IsValid()
+			},
+		}),
+	)
 	if err != nil {
 		return nil, fmt.Errorf("db: open %w", err)
 	}
 
-	fmt.Println("Connected to database...")
+	db.SetMaxOpenConns(cfg.MaxOpenConns)
+	db.SetMaxIdleConns(cfg.MaxIdleConns)
+	db.SetConnMaxLifetime(cfg.ConnMaxLifetime)
+
+	err = waitForDB(db, cfg.ConnectTimeout, logger)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	logger.Info("connected to database", "host", cfg.Host, "port", cfg.Port, "name", cfg.Name)
 	return db, nil
 }
 
+// waitForDB pings the database with exponential backoff, as Postgres often
+// comes up after the app when both are started together.
+func waitForDB(db *sql.DB, timeout time.Duration, logger *slog.Logger) error {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	backoff := 250 * time.Millisecond
+	for {
+		err := db.PingContext(ctx)
+		if err == nil {
+			return nil
+		}
+
+		logger.Warn("database not reachable yet", "retry_in", backoff.String(), "error", err)
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("db: not reachable after %s: %w", timeout, err)
+		case <-time.After(backoff):
+		}
+		backoff = min(2*backoff, 5*time.Second)
+	}
+}
+
 func MigrateFS(db *sql.DB, migrationsFS fs.FS, dir string) error {
 	goose.SetBaseFS(migrationsFS)
 	defer func(){
@@ -37,4 +91,28 @@ func Migrate(db *sql.DB, dir string) error {
 		return fmt.Errorf("goose up: %w",err)
 	}
 	return nil
+}
+
+// LatestMigration is the highest goose version among the migrations in
+// migrationsFS, i.e. the version a fully migrated database reports.
+func LatestMigration(migrationsFS fs.FS, dir string) (int64, error) {
+	names, err := fs.Glob(migrationsFS, path.Join(dir, "*.sql"))
+	if err != nil {
+		return 0, err
+	}
+
+	var latest int64
+	for _, name := range names {
+		version, err := goose.NumericComponent(name)
+		if err != nil {
+			return 0, fmt.Errorf("migration %s: %w", name, err)
+		}
+		latest = max(latest, version)
+	}
+	return latest, nil
+}
+
+// SchemaVersion is the goose version the database is currently at.
+func SchemaVersion(ctx context.Context, db *sql.DB) (int64, error) {
+	return goose.GetDBVersionContext(ctx, db)
 }
\ No newline at end of file
@@ -0,0 +1,48 @@
+package store
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/jackc/pgconn"
+)
+
+var (
+	// ErrNotFound is sql.ErrNoRows under a name that does not tie callers to
+	// database/sql; lookups and deletes already return it.
+	ErrNotFound = sql.ErrNoRows
+	// ErrConflict means a unique constraint rejected the write.
+	ErrConflict = errors.New("store: conflict")
+	// ErrForbidden means the row exists but the caller may not change it.
+	ErrForbidden = errors.New("store: forbidden")
+	// ErrInviteExpired means the invite's expiry has passed.
+	ErrInviteExpired = errors.New("store: invite expired")
+	// ErrInviteUsedUp means the invite reached its maximum number of uses.
+	ErrInviteUsedUp = errors.New("store: invite used up")
+	// ErrSlowMode means the member posted too recently in a slow mode chat.
+	ErrSlowMode = errors.New("store: slow mode")
+)
+
+const (
+	pgUniqueViolation     = "23505"
+	pgForeignKeyViolation = "23503"
+)
+
+// classify turns Postgres constraint errors into the store's sentinel
+// errors, keeping the constraint name for logs.
+func classify(err error) error {
+	var pgErr *pgconn.PgError
+	if !errors.As(err, &pgErr) {
+		return err
+	}
+
+	switch pgErr.Code {
+	case pgUniqueViolation:
+		return fmt.Errorf("%w: %s", ErrConflict, pgErr.ConstraintName)
+	case pgForeignKeyViolation:
+		// the row being referenced, a chat or a user, does not exist
+		return fmt.Errorf("%w: %s", ErrNotFound, pgErr.ConstraintName)
+	}
+	return err
+}
@@ -0,0 +1,216 @@
+package store
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"errors"
+	"fmt"
+	"math/big"
+	"time"
+
+	"github.com/jackc/pgconn"
+)
+
+type UserIdentity struct {
+	ID          int64      `json:"id"`
+	UserID      int64      `json:"user_id"`
+	Issuer      string     `json:"issuer"`
+	Subject     string     `json:"subject"`
+	Email       *string    `json:"email,omitempty"`
+	LastLoginAt *time.Time `json:"last_login_at,omitempty"`
+	CreatedAt   time.Time  `json:"created_at"`
+}
+
+// OIDCAuthRequest is a pending authorization code flow, kept server side so
+// the callback can be served by any instance.
+type OIDCAuthRequest struct {
+	State        string
+	Provider     string
+	CodeVerifier string
+	Nonce        string
+	ExpiresAt    time.Time
+}
+
+type PostgresIdentityStore struct {
+	db *sql.DB
+}
+
+func NewPostgresIdentityStore(db *sql.DB) *PostgresIdentityStore {
+	return &PostgresIdentityStore{db: db}
+}
+
+type IdentityStore interface {
+	GetUserByIdentity(ctx context.Context, issuer, subject string) (*User, error)
+	LinkIdentity(ctx context.Context, identity *UserIdentity) error
+	CreateUserWithIdentity(ctx context.Context, user *User, identity *UserIdentity) error
+	SaveAuthRequest(ctx context.Context, req *OIDCAuthRequest) error
+	ConsumeAuthRequest(ctx context.Context, state string) (*OIDCAuthRequest, error)
+}
+
+// GetUserByIdentity returns the user linked to the external account and
+// records the login. It returns nil, nil when the identity is not linked yet.
+func (pg *PostgresIdentityStore) GetUserByIdentity(ctx context.Context, issuer, subject string) (*User, error) {
+	query := `
+		UPDATE user_identities ui
+		SET last_login_at = NOW()
+		FROM users u
+		WHERE ui.user_id = u.id AND ui.issuer = $1 AND ui.subject = $2
+		RETURNING u.id, u.username, u.email, u.avatar_url, u.bio, u.is_admin, u.suspended_at, u.created_at, u.last_seen_at, u.updated_at
+	`
+
+	var user User
+	err := pg.db.QueryRowContext(ctx, query, issuer, subject).Scan(&user.ID, &user.Username, &user.Email, &user.AvatarURL, &user.Bio, &user.IsAdmin, &user.SuspendedAt, &user.CreatedAt, &user.LastSeenAt, &user.UpdatedAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+func (pg *PostgresIdentityStore) LinkIdentity(ctx context.Context, identity *UserIdentity) error {
+	query := `
+		INSERT INTO user_identities (user_id, issuer, subject, email, last_login_at)
+		VALUES ($1, $2, $3, $4, NOW())
+		RETURNING id, created_at
+	`
+
+	err := pg.db.QueryRowContext(ctx, query, identity.UserID, identity.Issuer, identity.Subject, identity.Email).Scan(&identity.ID, &identity.CreatedAt)
+	return classify(err)
+}
+
+// usernameAttempts bounds how often provisioning retries when a concurrent
+// sign up takes the username it picked.
+const usernameAttempts = 5
+
+// usernameMaxLength is the length of users.username, which is also what
+// validate.UsernameMaxLength allows at sign up.
+const usernameMaxLength = 50
+
+// CreateUserWithIdentity provisions a password-less account for a new
+// external identity. user.Username is used as the base of the username and
+// gets a numeric suffix when it is already taken.
+func (pg *PostgresIdentityStore) CreateUserWithIdentity(ctx context.Context, user *User, identity *UserIdentity) error {
+	base := user.Username
+	for attempt := 1; ; attempt++ {
+		err := pg.createUserWithIdentity(ctx, base, user, identity)
+
+		// another sign up inserted the free username between our check and
+		// our insert; the next attempt sees it and picks another suffix
+		var pgErr *pgconn.PgError
+		if attempt < usernameAttempts && errors.As(err, &pgErr) && pgErr.Code == pgUniqueViolation && (pgErr.ConstraintName == "users_username_key" || pgErr.ConstraintName == "users_username_lower_key") {
+			continue
+		}
+		return classify(err)
+	}
+}
+
+func (pg *PostgresIdentityStore) createUserWithIdentity(ctx context.Context, base string, user *User, identity *UserIdentity) error {
+	tx, err := pg.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
+
+	username, err := uniqueUsername(ctx, tx, base)
+	if err != nil {
+		return err
+	}
+	user.Username = username
+
+	q1 := `
+		INSERT INTO users (username, email, password_hash, avatar_url, bio)
+		VALUES ($1, $2, NULL, $3, $4)
+		RETURNING id, created_at
+	`
+	err = tx.QueryRowContext(ctx, q1, user.Username, user.Email, user.AvatarURL, user.Bio).Scan(&user.ID, &user.CreatedAt)
+	if err != nil {
+		return err
+	}
+
+	q2 := `
+		INSERT INTO user_identities (user_id, issuer, subject, email, last_login_at)
+		VALUES ($1, $2, $3, $4, NOW())
+		RETURNING id, created_at
+	`
+	identity.UserID = user.ID
+	err = tx.QueryRowContext(ctx, q2, identity.UserID, identity.Issuer, identity.Subject, identity.Email).Scan(&identity.ID, &identity.CreatedAt)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (pg *PostgresIdentityStore) SaveAuthRequest(ctx context.Context, req *OIDCAuthRequest) error {
+	query := `
+		INSERT INTO oidc_auth_requests (state, provider, code_verifier, nonce, expires_at)
+		VALUES ($1, $2, $3, $4, $5)
+	`
+
+	_, err := pg.db.ExecContext(ctx, query, req.State, req.Provider, req.CodeVerifier, req.Nonce, req.ExpiresAt)
+	return err
+}
+
+// ConsumeAuthRequest deletes and returns the pending flow for state, so a
+// state value can only ever be redeemed once. Expired flows are not returned.
+func (pg *PostgresIdentityStore) ConsumeAuthRequest(ctx context.Context, state string) (*OIDCAuthRequest, error) {
+	query := `
+		DELETE FROM oidc_auth_requests
+		WHERE state = $1
+		RETURNING state, provider, code_verifier, nonce, expires_at
+	`
+
+	var req OIDCAuthRequest
+	err := pg.db.QueryRowContext(ctx, query, state).Scan(&req.State, &req.Provider, &req.CodeVerifier, &req.Nonce, &req.ExpiresAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if time.Now().After(req.ExpiresAt) {
+		return nil, nil
+	}
+	return &req, nil
+}
+
+func uniqueUsername(ctx context.Context, tx *sql.Tx, base string) (string, error) {
+	query := `
+		SELECT EXISTS (SELECT 1 FROM users WHERE LOWER(username) = LOWER($1))
+	`
+
+	candidate := base
+	for i := 1; i <= 20; i++ {
+		var taken bool
+		err := tx.QueryRowContext(ctx, query, candidate).Scan(&taken)
+		if err != nil {
+			return "", err
+		}
+		if !taken {
+			return candidate, nil
+		}
+		candidate = withSuffix(base, fmt.Sprint(i))
+	}
+
+	// fall back to a random suffix for very common names
+	n, err := rand.Int(rand.Reader, big.NewInt(1000000))
+	if err != nil {
+		return "", err
+	}
+	return withSuffix(base, fmt.Sprintf("%06d", n.Int64())), nil
+}
+
+// withSuffix appends suffix to base, shortening base so the result still
+// fits the username column. Bases are ASCII, so cutting bytes is safe.
+func withSuffix(base, suffix string) string {
+	if len(base)+len(suffix) > usernameMaxLength {
+		base = base[:usernameMaxLength-len(suffix)]
+	}
+	return base + suffix
+}
@@ -0,0 +1,23 @@
+package store
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestWithSuffixFitsTheColumn(t *testing.T) {
+	long := strings.Repeat("a", 40) + "-user"
+	for _, suffix := range []string{"1", "20", "000042"} {
+		got := withSuffix(long, suffix)
+		if len(got) > usernameMaxLength {
+			t.Errorf("withSuffix(%q, %q) = %q, %d characters", long, suffix, got, len(got))
+		}
+		if !strings.HasSuffix(got, suffix) {
+			t.Errorf("withSuffix(%q, %q) = %q, lost the suffix", long, suffix, got)
+		}
+	}
+
+	if got := withSuffix("alice", "3"); got != "alice3" {
+		t.Errorf("withSuffix(alice, 3) = %q, want alice3", got)
+	}
+}
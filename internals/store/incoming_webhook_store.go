@@ -0,0 +1,114 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/Abhishek-B-R/chat-app-golang/internals/tokens"
+)
+
+type IncomingWebhook struct {
+	ID         int64      `json:"id"`
+	ChatID     int64      `json:"chat_id"`
+	Name       string     `json:"name"`
+	AvatarURL  *string    `json:"avatar_url,omitempty"`
+	CreatedBy  *int64     `json:"created_by,omitempty"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+type PostgresIncomingWebhookStore struct {
+	db *sql.DB
+}
+
+func NewPostgresIncomingWebhookStore(db *sql.DB) *PostgresIncomingWebhookStore {
+	return &PostgresIncomingWebhookStore{db: db}
+}
+
+type IncomingWebhookStore interface {
+	CreateIncomingWebhook(ctx context.Context, hook *IncomingWebhook, token *tokens.Token) error
+	GetChatIncomingWebhooks(ctx context.Context, chatID int64) ([]*IncomingWebhook, error)
+	DeleteIncomingWebhook(ctx context.Context, chatID, hookID int64) error
+	GetIncomingWebhookByToken(ctx context.Context, plaintext string) (*IncomingWebhook, error)
+}
+
+func (pg *PostgresIncomingWebhookStore) CreateIncomingWebhook(ctx context.Context, hook *IncomingWebhook, token *tokens.Token) error {
+	query := `
+		INSERT INTO incoming_webhooks (chat_id, name, avatar_url, token_hash, created_by)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING id, created_at
+	`
+
+	return pg.db.QueryRowContext(ctx, query, hook.ChatID, hook.Name, hook.AvatarURL, token.Hash, hook.CreatedBy).Scan(&hook.ID, &hook.CreatedAt)
+}
+
+func (pg *PostgresIncomingWebhookStore) GetChatIncomingWebhooks(ctx context.Context, chatID int64) ([]*IncomingWebhook, error) {
+	query := `
+		SELECT id, chat_id, name, avatar_url, created_by, last_used_at, created_at
+		FROM incoming_webhooks
+		WHERE chat_id = $1
+		ORDER BY created_at ASC
+	`
+
+	rows, err := pg.db.QueryContext(ctx, query, chatID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var hooks []*IncomingWebhook
+	for rows.Next() {
+		var hook IncomingWebhook
+		err := rows.Scan(&hook.ID, &hook.ChatID, &hook.Name, &hook.AvatarURL, &hook.CreatedBy, &hook.LastUsedAt, &hook.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		hooks = append(hooks, &hook)
+	}
+
+	return hooks, rows.Err()
+}
+
+func (pg *PostgresIncomingWebhookStore) DeleteIncomingWebhook(ctx context.Context, chatID, hookID int64) error {
+	query := `
+		DELETE FROM incoming_webhooks
+		WHERE id = $1 AND chat_id = $2
+	`
+
+	results, err := pg.db.ExecContext(ctx, query, hookID, chatID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := results.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return sql.ErrNoRows
+	}
+
+	return nil
+}
+
+// GetIncomingWebhookByToken resolves the secret from a webhook URL and
+// records its use. It returns nil, nil for unknown or deleted webhooks.
+func (pg *PostgresIncomingWebhookStore) GetIncomingWebhookByToken(ctx context.Context, plaintext string) (*IncomingWebhook, error) {
+	query := `
+		UPDATE incoming_webhooks
+		SET last_used_at = NOW()
+		WHERE token_hash = $1
+		RETURNING id, chat_id, name, avatar_url, created_by, last_used_at, created_at
+	`
+
+	var hook IncomingWebhook
+	err := pg.db.QueryRowContext(ctx, query, tokens.Hash(plaintext)).Scan(&hook.ID, &hook.ChatID, &hook.Name, &hook.AvatarURL, &hook.CreatedBy, &hook.LastUsedAt, &hook.CreatedAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &hook, nil
+}
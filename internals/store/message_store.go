@@ -4,7 +4,7 @@ import (
 	"context"
 	"database/sql"
 	"encoding/json"
-	"errors"
+	"fmt"
 	"time"
 )
 
@@ -16,6 +16,46 @@ const (
 	MessageTypeSystem MessageType = "system"
 )
 
+// SystemEventKind is the change a system message reports.
+type SystemEventKind string
+
+const (
+	SystemMemberJoined      SystemEventKind = "member.joined"
+	SystemMemberLeft        SystemEventKind = "member.left"
+	SystemMemberRemoved     SystemEventKind = "member.removed"
+	SystemMemberRoleChanged SystemEventKind = "member.role_changed"
+	SystemChatRenamed       SystemEventKind = "chat.renamed"
+	SystemMessagePinned     SystemEventKind = "message.pinned"
+	SystemMessageUnpinned   SystemEventKind = "message.unpinned"
+)
+
+// SystemEvent is the payload of a system message. It is structured rather
+// than text so clients can word it in their own language.
+type SystemEvent struct {
+	Kind SystemEventKind `json:"kind"`
+	// ActorID is the user who made the change, nil when the server did
+	ActorID *int64 `json:"actor_id,omitempty"`
+	// TargetID is the member for member events and the message for pins
+	TargetID *int64 `json:"target_id,omitempty"`
+	// Role is the member's role after joining or a role change
+	Role *ChatGroupRole `json:"role,omitempty"`
+	// Name is the chat's new name after a rename
+	Name *string `json:"name,omitempty"`
+	// InviteID is the invite link a member joined through
+	InviteID *int64 `json:"invite_id,omitempty"`
+}
+
+func (e *SystemEvent) Scan(src any) error {
+	switch v := src.(type) {
+	case []byte:
+		return json.Unmarshal(v, e)
+	case string:
+		return json.Unmarshal([]byte(v), e)
+	default:
+		return fmt.Errorf("cannot scan %T into a system event", src)
+	}
+}
+
 const (
 	AttachmentImage AttachmentType = "image"
 	AttachmentVideo AttachmentType = "video"
@@ -33,11 +73,26 @@ type Message struct {
 
 	ReplyToMessageID  *int64      `json:"reply_to_message_id,omitempty"`
 
+	// set on messages posted by an incoming webhook instead of a user
+	WebhookID         *int64      `json:"webhook_id,omitempty"`
+	DisplayName       *string     `json:"display_name,omitempty"`
+	AvatarURL         *string     `json:"avatar_url,omitempty"`
+
 	EditedAt          *time.Time  `json:"edited_at,omitempty"`
 	DeletedAt         *time.Time  `json:"deleted_at,omitempty"`
 	CreatedAt         time.Time   `json:"created_at"`
 
 	Attachments       []MessageAttachment `json:"attachments,omitempty"`
+
+	// Event is set on system messages, which have no sender or content
+	Event             *SystemEvent `json:"event,omitempty"`
+
+	PinnedAt          *time.Time  `json:"pinned_at,omitempty"`
+	PinnedBy          *int64      `json:"pinned_by,omitempty"`
+
+	// SenderBlocked is set when the reader has blocked the sender; the
+	// content and attachments are withheld
+	SenderBlocked     bool        `json:"sender_blocked,omitempty"`
 }
 
 type MessageAttachment struct {
@@ -63,15 +118,37 @@ func NewPostgresMessageStore(db *sql.DB) *PostgresMessageStore {
 
 type MessageStore interface{
 	CreateMessage(ctx context.Context, msg *Message) error
+	// PostMessage stores a member's message and records it for slow mode in
+	// the same transaction. It returns ErrSlowMode when the sender posted
+	// less than minInterval ago.
+	PostMessage(ctx context.Context, msg *Message, minInterval time.Duration) error
     GetMessage(ctx context.Context, id int64) (*Message, error)
-    GetChatMessages(ctx context.Context, chatID, limit, offset int64) (*[]Message, error)
+	// GetMessageForViewer is GetMessage as viewerID sees it, with the content
+	// withheld when the viewer blocked the sender.
+	GetMessageForViewer(ctx context.Context, id, viewerID int64) (*Message, error)
+    GetChatMessages(ctx context.Context, chatID, viewerID, limit, offset int64) (*[]Message, error)
     UpdateMessage(ctx context.Context, msg *Message) error
     DeleteMessage(ctx context.Context, id int64) error // soft delete
     GetUnreadCount(ctx context.Context, chatID, userID int64) (int64, error)
+	GetPinnedMessages(ctx context.Context, chatID, viewerID int64) ([]Message, error)
+	PinMessage(ctx context.Context, msgID, userID int64, event *SystemEvent) (*Message, error)
+	UnpinMessage(ctx context.Context, msgID int64, event *SystemEvent) (*Message, error)
 }
 
 func (pg *PostgresMessageStore) CreateMessage(ctx context.Context, msg *Message) error {
-	tx, err := pg.db.Begin()
+	return pg.createMessage(ctx, msg, nil)
+}
+
+func (pg *PostgresMessageStore) PostMessage(ctx context.Context, msg *Message, minInterval time.Duration) error {
+	return pg.createMessage(ctx, msg, &minInterval)
+}
+
+// createMessage inserts msg with its attachments. With minInterval set it
+// first records the post for slow mode; doing the check in the update keeps
+// two concurrent posts from both getting through, and a message that is not
+// stored is not counted.
+func (pg *PostgresMessageStore) createMessage(ctx context.Context, msg *Message, minInterval *time.Duration) error {
+	tx, err := pg.db.BeginTx(ctx, nil)
 	if err != nil {
 		return err
 	}
@@ -79,15 +156,36 @@ func (pg *PostgresMessageStore) CreateMessage(ctx context.Context, msg *Message)
 		_ = tx.Rollback()
 	}()
 
+	if minInterval != nil {
+		q0 := `
+			UPDATE chat_members
+			SET last_posted_at = NOW()
+			WHERE chat_id = $1 AND user_id = $2
+			AND (last_posted_at IS NULL OR last_posted_at <= NOW() - make_interval(secs => $3))
+		`
+
+		result, err := tx.ExecContext(ctx, q0, msg.ChatID, msg.SenderID, minInterval.Seconds())
+		if err != nil {
+			return err
+		}
+		rowsAffected, err := result.RowsAffected()
+		if err != nil {
+			return err
+		}
+		if rowsAffected == 0 {
+			return ErrSlowMode
+		}
+	}
+
 	q1 := `
-		INSERT INTO messages (chat_id, sender_id, type, content)
-		VALUES ($1, $2, $3, $4)
+		INSERT INTO messages (chat_id, sender_id, type, content, incoming_webhook_id, display_name, avatar_url)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
 		RETURNING id, created_at
 	`
 
-	err = tx.QueryRowContext(ctx, q1, msg.ChatID, msg.SenderID, msg.Type, msg.Content).Scan(&msg.ID, &msg.CreatedAt)
+	err = tx.QueryRowContext(ctx, q1, msg.ChatID, msg.SenderID, msg.Type, msg.Content, msg.WebhookID, msg.DisplayName, msg.AvatarURL).Scan(&msg.ID, &msg.CreatedAt)
 	if err != nil {
-		return err
+		return classify(err)
 	}
 
 	if len(msg.Attachments) > 0 {
@@ -140,6 +238,12 @@ func (pg *PostgresMessageStore) GetMessage(ctx context.Context, msgID int64) (*M
 			type,
 			content,
 			reply_to_message_id,
+			incoming_webhook_id,
+			display_name,
+			avatar_url,
+			system_event,
+			pinned_at,
+			pinned_by,
 			created_at,
 			edited_at,
 			deleted_at
@@ -153,6 +257,12 @@ func (pg *PostgresMessageStore) GetMessage(ctx context.Context, msgID int64) (*M
 		&msg.Type, 
 		&msg.Content, 
 		&msg.ReplyToMessageID, 
+		&msg.WebhookID,
+		&msg.DisplayName,
+		&msg.AvatarURL,
+		&msg.Event,
+		&msg.PinnedAt,
+		&msg.PinnedBy,
 		&msg.CreatedAt, 
 		&msg.EditedAt,
 		&msg.DeletedAt,
@@ -170,25 +280,61 @@ func (pg *PostgresMessageStore) GetMessage(ctx context.Context, msgID int64) (*M
 	return &msg, nil
 }
 
-func (pg *PostgresMessageStore) GetChatMessages(ctx context.Context, chatID, limit, offset int64) (*[]Message, error) {
+func (pg *PostgresMessageStore) GetMessageForViewer(ctx context.Context, msgID, viewerID int64) (*Message, error) {
+	msg, err := pg.GetMessage(ctx, msgID)
+	if err != nil {
+		return nil, err
+	}
+	if msg.SenderID == nil {
+		return msg, nil
+	}
+
+	q1 := `
+		SELECT EXISTS (
+			SELECT 1 FROM user_blocks
+			WHERE blocker_id = $1 AND blocked_id = $2
+		)
+	`
+	err = pg.db.QueryRowContext(ctx, q1, viewerID, *msg.SenderID).Scan(&msg.SenderBlocked)
+	if err != nil {
+		return nil, err
+	}
+	if msg.SenderBlocked {
+		msg.Content = nil
+		msg.Attachments = nil
+	}
+	return msg, nil
+}
+
+// GetChatMessages returns a page of the chat as viewerID sees it: messages
+// from users the viewer blocked are flagged and their content withheld.
+func (pg *PostgresMessageStore) GetChatMessages(ctx context.Context, chatID, viewerID, limit, offset int64) (*[]Message, error) {
 	q1 := `
 		SELECT
-			id,
-			chat_id,
-			sender_id,
-			type,
-			content,
-			reply_to_message_id,
-			created_at,
-			edited_at,
-			deleted_at
-		FROM messages
-		WHERE chat_id = $1
-		ORDER BY created_at DESC
-		LIMIT $2 OFFSET $3;
+			m.id,
+			m.chat_id,
+			m.sender_id,
+			m.type,
+			m.content,
+			m.reply_to_message_id,
+			m.incoming_webhook_id,
+			m.display_name,
+			m.avatar_url,
+			m.system_event,
+			m.pinned_at,
+			m.pinned_by,
+			m.created_at,
+			m.edited_at,
+			m.deleted_at,
+			ub.blocked_id IS NOT NULL
+		FROM messages m
+		LEFT JOIN user_blocks ub ON ub.blocker_id = $2 AND ub.blocked_id = m.sender_id
+		WHERE m.chat_id = $1
+		ORDER BY m.created_at DESC
+		LIMIT $3 OFFSET $4;
 	`
 
-	rows, err := pg.db.QueryContext(ctx, q1, chatID, limit, offset)
+	rows, err := pg.db.QueryContext(ctx, q1, chatID, viewerID, limit, offset)
 	if err != nil {
 		return nil, err
 	}
@@ -206,9 +352,16 @@ func (pg *PostgresMessageStore) GetChatMessages(ctx context.Context, chatID, lim
 			&m.Type,
 			&m.Content,
 			&m.ReplyToMessageID,
+			&m.WebhookID,
+			&m.DisplayName,
+			&m.AvatarURL,
+			&m.Event,
+			&m.PinnedAt,
+			&m.PinnedBy,
 			&m.CreatedAt,
 			&m.EditedAt,
 			&m.DeletedAt,
+			&m.SenderBlocked,
 		)
 		if err != nil {
 			return nil, err
@@ -246,6 +399,10 @@ func (pg *PostgresMessageStore) GetChatMessages(ctx context.Context, chatID, lim
 			msgs[i].Type = "deleted"
 			msgs[i].Attachments = nil
 		}
+		if msgs[i].SenderBlocked {
+			msgs[i].Content = nil
+			msgs[i].Attachments = nil
+		}
 	}
 	
 	return &msgs, nil
@@ -261,9 +418,10 @@ func (pg *PostgresMessageStore) UpdateMessage(ctx context.Context, msg *Message)
 	`
 
 	err := pg.db.QueryRowContext(ctx, query, msg.Content, msg.ID).Scan(&msg.ID)
-	if err == sql.ErrNoRows {	
-        return errors.New("message not found or already deleted")
-    }
+	if err == sql.ErrNoRows {
+		// deleted messages cannot be edited
+		return ErrNotFound
+	}
 
 	return err
 }
@@ -283,7 +441,7 @@ func (pg *PostgresMessageStore) DeleteMessage(ctx context.Context, msgID int64)
 }
 
 func (pg *PostgresMessageStore) GetUnreadCount(ctx context.Context, chatID, userID int64) (int64, error) {
-	tx, err := pg.db.Begin()
+	tx, err := pg.db.BeginTx(ctx, nil)
 	if err != nil {
 		return 0, err
 	}
@@ -308,6 +466,174 @@ func (pg *PostgresMessageStore) GetUnreadCount(ctx context.Context, chatID, user
 	return UnreadCount, nil
 }
 
+// GetPinnedMessages returns the chat's pinned messages, the latest pin
+// first, as viewerID sees them like GetChatMessages does. Deleted messages
+// are not included.
+func (pg *PostgresMessageStore) GetPinnedMessages(ctx context.Context, chatID, viewerID int64) ([]Message, error) {
+	query := `
+		SELECT
+			m.id,
+			m.chat_id,
+			m.sender_id,
+			m.type,
+			m.content,
+			m.reply_to_message_id,
+			m.incoming_webhook_id,
+			m.display_name,
+			m.avatar_url,
+			m.system_event,
+			m.pinned_at,
+			m.pinned_by,
+			m.created_at,
+			m.edited_at,
+			m.deleted_at,
+			ub.blocked_id IS NOT NULL
+		FROM messages m
+		LEFT JOIN user_blocks ub ON ub.blocker_id = $2 AND ub.blocked_id = m.sender_id
+		WHERE m.chat_id = $1 AND m.pinned_at IS NOT NULL AND m.deleted_at IS NULL
+		ORDER BY m.pinned_at DESC
+	`
+
+	rows, err := pg.db.QueryContext(ctx, query, chatID, viewerID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	msgs := []Message{}
+	var msgIDs []int64
+	for rows.Next() {
+		var m Message
+		err := rows.Scan(
+			&m.ID,
+			&m.ChatID,
+			&m.SenderID,
+			&m.Type,
+			&m.Content,
+			&m.ReplyToMessageID,
+			&m.WebhookID,
+			&m.DisplayName,
+			&m.AvatarURL,
+			&m.Event,
+			&m.PinnedAt,
+			&m.PinnedBy,
+			&m.CreatedAt,
+			&m.EditedAt,
+			&m.DeletedAt,
+			&m.SenderBlocked,
+		)
+		if err != nil {
+			return nil, err
+		}
+		msgs = append(msgs, m)
+		msgIDs = append(msgIDs, m.ID)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(msgIDs) == 0 {
+		return msgs, nil
+	}
+
+	attachments, err := pg.getAttachmentsForMessages(ctx, msgIDs)
+	if err != nil {
+		return nil, err
+	}
+	attMap := make(map[int64][]MessageAttachment)
+	for _, a := range attachments {
+		attMap[a.MessageID] = append(attMap[a.MessageID], a)
+	}
+	for i := range msgs {
+		msgs[i].Attachments = attMap[msgs[i].ID]
+		if msgs[i].SenderBlocked {
+			msgs[i].Content = nil
+			msgs[i].Attachments = nil
+		}
+	}
+	return msgs, nil
+}
+
+// PinMessage pins the message and posts event in the same transaction. It
+// returns the system message, or ErrNotFound when the message is deleted or
+// already pinned.
+func (pg *PostgresMessageStore) PinMessage(ctx context.Context, msgID, userID int64, event *SystemEvent) (*Message, error) {
+	query := `
+		UPDATE messages
+		SET pinned_at = NOW(), pinned_by = $2
+		WHERE id = $1 AND deleted_at IS NULL AND pinned_at IS NULL
+		RETURNING chat_id
+	`
+	return pg.updatePin(ctx, query, event, msgID, userID)
+}
+
+// UnpinMessage unpins the message and posts event in the same transaction.
+// It returns the system message, or ErrNotFound when the message is not
+// pinned.
+func (pg *PostgresMessageStore) UnpinMessage(ctx context.Context, msgID int64, event *SystemEvent) (*Message, error) {
+	query := `
+		UPDATE messages
+		SET pinned_at = NULL, pinned_by = NULL
+		WHERE id = $1 AND pinned_at IS NOT NULL
+		RETURNING chat_id
+	`
+	return pg.updatePin(ctx, query, event, msgID)
+}
+
+func (pg *PostgresMessageStore) updatePin(ctx context.Context, query string, event *SystemEvent, args ...any) (*Message, error) {
+	tx, err := pg.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
+
+	var chatID int64
+	err = tx.QueryRowContext(ctx, query, args...).Scan(&chatID)
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	msg, err := insertSystemMessage(ctx, tx, chatID, event)
+	if err != nil {
+		return nil, err
+	}
+	return msg, tx.Commit()
+}
+
+// insertSystemMessage posts event to the chat inside tx, so the system
+// message exists if and only if the change it reports does. A nil event
+// posts nothing and returns a nil message.
+func insertSystemMessage(ctx context.Context, tx *sql.Tx, chatID int64, event *SystemEvent) (*Message, error) {
+	if event == nil {
+		return nil, nil
+	}
+
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return nil, err
+	}
+
+	msg := &Message{
+		ChatID: chatID,
+		Type: MessageTypeSystem,
+		Event: event,
+	}
+	query := `
+		INSERT INTO messages (chat_id, type, system_event)
+		VALUES ($1, $2, $3)
+		RETURNING id, created_at
+	`
+	err = tx.QueryRowContext(ctx, query, chatID, msg.Type, payload).Scan(&msg.ID, &msg.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return msg, nil
+}
+
 func (pg *PostgresMessageStore) getAttachmentsForMessages(ctx context.Context, messageIDs []int64) ([]MessageAttachment, error) {
 	const q = `
 		SELECT
@@ -0,0 +1,216 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"time"
+
+	"github.com/jackc/pgtype"
+)
+
+type ReportKind string
+type ReportReason string
+type ReportStatus string
+
+const (
+	ReportKindMessage ReportKind = "message"
+	ReportKindUser    ReportKind = "user"
+)
+
+const (
+	ReasonSpam          ReportReason = "spam"
+	ReasonHarassment    ReportReason = "harassment"
+	ReasonHateSpeech    ReportReason = "hate_speech"
+	ReasonViolence      ReportReason = "violence"
+	ReasonSexualContent ReportReason = "sexual_content"
+	ReasonSelfHarm      ReportReason = "self_harm"
+	ReasonImpersonation ReportReason = "impersonation"
+	ReasonOther         ReportReason = "other"
+)
+
+var ReportReasons = []ReportReason{
+	ReasonSpam,
+	ReasonHarassment,
+	ReasonHateSpeech,
+	ReasonViolence,
+	ReasonSexualContent,
+	ReasonSelfHarm,
+	ReasonImpersonation,
+	ReasonOther,
+}
+
+func ValidReportReason(reason ReportReason) bool {
+	for _, r := range ReportReasons {
+		if r == reason {
+			return true
+		}
+	}
+	return false
+}
+
+const (
+	ReportOpen      ReportStatus = "open"
+	ReportActioned  ReportStatus = "actioned"
+	ReportDismissed ReportStatus = "dismissed"
+)
+
+// Report is a complaint about a message or a user, waiting in the
+// moderation queue until a platform admin resolves it.
+type Report struct {
+	ID             int64        `json:"id"`
+	Kind           ReportKind   `json:"kind"`
+	ReporterID     *int64       `json:"reporter_id"`
+	ReportedUserID *int64       `json:"reported_user_id"`
+	MessageID      *int64       `json:"message_id,omitempty"`
+	ChatID         *int64       `json:"chat_id,omitempty"`
+	Reason         ReportReason `json:"reason"`
+	Details        *string      `json:"details,omitempty"`
+	// MessageSnapshot is the reported message as it was when reported
+	MessageSnapshot json.RawMessage `json:"message_snapshot,omitempty"`
+	Status          ReportStatus    `json:"status"`
+	Actions         []string        `json:"actions"`
+	ResolvedBy      *int64          `json:"resolved_by,omitempty"`
+	ResolutionNote  *string         `json:"resolution_note,omitempty"`
+	ResolvedAt      *time.Time      `json:"resolved_at,omitempty"`
+	CreatedAt       time.Time       `json:"created_at"`
+}
+
+type PostgresReportStore struct {
+	db *sql.DB
+}
+
+func NewPostgresReportStore(db *sql.DB) *PostgresReportStore {
+	return &PostgresReportStore{db: db}
+}
+
+type ReportStore interface {
+	CreateReport(ctx context.Context, report *Report) error
+	GetReports(ctx context.Context, status ReportStatus, limit, offset int64) ([]*Report, error)
+	GetReport(ctx context.Context, reportID int64) (*Report, error)
+	ResolveReport(ctx context.Context, report *Report) error
+}
+
+// CreateReport returns ErrConflict when the reporter already has an open
+// report about the same message or user.
+func (pg *PostgresReportStore) CreateReport(ctx context.Context, report *Report) error {
+	query := `
+		INSERT INTO reports (kind, reporter_id, reported_user_id, message_id, chat_id, reason, details, message_snapshot)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		RETURNING id, status, actions, created_at
+	`
+
+	var snapshot []byte
+	if len(report.MessageSnapshot) > 0 {
+		snapshot = report.MessageSnapshot
+	}
+
+	var actions pgtype.TextArray
+	err := pg.db.QueryRowContext(ctx, query, report.Kind, report.ReporterID, report.ReportedUserID, report.MessageID, report.ChatID, report.Reason, report.Details, snapshot).Scan(
+		&report.ID,
+		&report.Status,
+		&actions,
+		&report.CreatedAt,
+	)
+	if err != nil {
+		return classify(err)
+	}
+	return actions.AssignTo(&report.Actions)
+}
+
+const reportColumns = `
+	id, kind, reporter_id, reported_user_id, message_id, chat_id, reason, details, message_snapshot,
+	status, actions, resolved_by, resolution_note, resolved_at, created_at
+`
+
+func scanReport(row interface{ Scan(...any) error }) (*Report, error) {
+	var report Report
+	var snapshot []byte
+	var actions pgtype.TextArray
+	err := row.Scan(
+		&report.ID,
+		&report.Kind,
+		&report.ReporterID,
+		&report.ReportedUserID,
+		&report.MessageID,
+		&report.ChatID,
+		&report.Reason,
+		&report.Details,
+		&snapshot,
+		&report.Status,
+		&actions,
+		&report.ResolvedBy,
+		&report.ResolutionNote,
+		&report.ResolvedAt,
+		&report.CreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	report.MessageSnapshot = snapshot
+	if err := actions.AssignTo(&report.Actions); err != nil {
+		return nil, err
+	}
+	return &report, nil
+}
+
+// GetReports lists reports in the given status, oldest first so the queue
+// is worked in order.
+func (pg *PostgresReportStore) GetReports(ctx context.Context, status ReportStatus, limit, offset int64) ([]*Report, error) {
+	query := `
+		SELECT` + reportColumns + `
+		FROM reports
+		WHERE status = $1
+		ORDER BY created_at ASC
+		LIMIT $2 OFFSET $3
+	`
+
+	rows, err := pg.db.QueryContext(ctx, query, status, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	reports := []*Report{}
+	for rows.Next() {
+		report, err := scanReport(rows)
+		if err != nil {
+			return nil, err
+		}
+		reports = append(reports, report)
+	}
+	return reports, rows.Err()
+}
+
+func (pg *PostgresReportStore) GetReport(ctx context.Context, reportID int64) (*Report, error) {
+	query := `
+		SELECT` + reportColumns + `
+		FROM reports
+		WHERE id = $1
+	`
+
+	return scanReport(pg.db.QueryRowContext(ctx, query, reportID))
+}
+
+// ResolveReport closes an open report with report's Status, Actions,
+// ResolvedBy and ResolutionNote. It returns ErrConflict when the report has
+// already been resolved.
+func (pg *PostgresReportStore) ResolveReport(ctx context.Context, report *Report) error {
+	query := `
+		UPDATE reports
+		SET status = $1, actions = $2, resolved_by = $3, resolution_note = $4, resolved_at = NOW()
+		WHERE id = $5 AND status = 'open'
+		RETURNING resolved_at
+	`
+
+	actions := report.Actions
+	if actions == nil {
+		actions = []string{}
+	}
+
+	err := pg.db.QueryRowContext(ctx, query, report.Status, actions, report.ResolvedBy, report.ResolutionNote, report.ID).Scan(&report.ResolvedAt)
+	if err == sql.ErrNoRows {
+		return ErrConflict
+	}
+	return err
+}
@@ -5,6 +5,7 @@ import (
 	"crypto/sha256"
 	"database/sql"
 	"errors"
+	"strings"
 	"time"
 
 	"golang.org/x/crypto/bcrypt"
@@ -15,8 +16,8 @@ type password struct {
 	hash []byte
 }
 
-func (p *password) Set(plainTextPassword string) error {
-	hash, err := bcrypt.GenerateFromPassword([]byte(plainTextPassword),12)
+func (p *password) Set(plainTextPassword string, cost int) error {
+	hash, err := bcrypt.GenerateFromPassword([]byte(plainTextPassword),cost)
 	if err != nil {
 		return err
 	}
@@ -27,6 +28,11 @@ func (p *password) Set(plainTextPassword string) error {
 }
 
 func (p *password) Matches(plainTextPassword string) (bool,error) {
+	// users provisioned through an identity provider have no local password
+	if len(p.hash) == 0 {
+		return false, nil
+	}
+
 	err := bcrypt.CompareHashAndPassword(p.hash, []byte(plainTextPassword))
 	if err != nil {
 		switch {
@@ -46,6 +52,11 @@ type User struct {
 	PasswordHash password `json:"-"`
 	AvatarURL *string `json:"avatar_url"`
 	Bio *string `json:"bio"`
+	IsBot bool `json:"is_bot"`
+	BotOwnerID *int64 `json:"bot_owner_id,omitempty"`
+	// IsAdmin marks platform administrators, who moderate every chat
+	IsAdmin bool `json:"is_admin"`
+	SuspendedAt *time.Time `json:"suspended_at,omitempty"`
 	LastSeenAt *time.Time `json:"last_seen_at"`
 	CreatedAt time.Time `json:"created_at"`
 	UpdatedAt *time.Time `json:"updated_at"`
@@ -53,11 +64,13 @@ type User struct {
 
 type PostgresUserStore struct {
 	db *sql.DB
+	bcryptCost int
 }
 
-func NewPostgresUserStore(db *sql.DB) *PostgresUserStore{
+func NewPostgresUserStore(db *sql.DB, bcryptCost int) *PostgresUserStore{
 	return &PostgresUserStore{
 		db: db,
+		bcryptCost: bcryptCost,
 	}
 }
 
@@ -69,8 +82,14 @@ type UserStore interface {
     UpdateLastSeen(ctx context.Context, userID int64) error
 	UpdateUser(ctx context.Context, user *User) error
 	UpdateUserPassword(ctx context.Context, password string,userID int64) error
+	SuspendUser(ctx context.Context, userID int64) error
+	ReactivateUser(ctx context.Context, userID int64) error
+	GrantAdmin(ctx context.Context, userIDs []int64) ([]int64, error)
+	SearchUsers(ctx context.Context, search UserSearch) ([]*User, error)
 	GetUserToken(ctx context.Context, plainTextPassword string) (*User, error) 
 	GetCurrentUser(ctx context.Context, userID int64) (*User, error)
+	CreateBot(ctx context.Context, bot *User) error
+	GetBotsByOwner(ctx context.Context, ownerID int64) ([]*User, error)
 }
 
 func (pg *PostgresUserStore) CreateUser(ctx context.Context, user *User) error {
@@ -82,7 +101,7 @@ func (pg *PostgresUserStore) CreateUser(ctx context.Context, user *User) error {
 
 	err := pg.db.QueryRowContext(ctx, query, user.Username, user.Email, user.PasswordHash.hash, user.AvatarURL, user.Bio).Scan(&user.ID, &user.CreatedAt)
 	if err != nil {
-		return err
+		return classify(err)
 	}
 	return nil
 }
@@ -90,11 +109,11 @@ func (pg *PostgresUserStore) CreateUser(ctx context.Context, user *User) error {
 func (pg *PostgresUserStore) GetUserByID(ctx context.Context, id int64) (*User, error) {
 	var user User;
 	query := `
-		SELECT id, username, email, avatar_url, bio, created_at, last_seen_at, updated_at FROM users
+		SELECT id, username, email, avatar_url, bio, is_bot, bot_owner_id, is_admin, suspended_at, created_at, last_seen_at, updated_at FROM users
 		WHERE id = $1
 	`
 
-	err := pg.db.QueryRowContext(ctx, query, id).Scan(&user.ID, &user.Username, &user.Email, &user.AvatarURL, &user.Bio, &user.CreatedAt, &user.LastSeenAt, &user.UpdatedAt)
+	err := pg.db.QueryRowContext(ctx, query, id).Scan(&user.ID, &user.Username, &user.Email, &user.AvatarURL, &user.Bio, &user.IsBot, &user.BotOwnerID, &user.IsAdmin, &user.SuspendedAt, &user.CreatedAt, &user.LastSeenAt, &user.UpdatedAt)
 	if err != nil {
 		return nil, err
 	}
@@ -104,11 +123,11 @@ func (pg *PostgresUserStore) GetUserByID(ctx context.Context, id int64) (*User,
 func (pg *PostgresUserStore) GetUserByEmail(ctx context.Context, email string) (*User, error) {
 	var user User;
 	query := `
-		SELECT id, username, email, avatar_url, bio, created_at, last_seen_at, updated_at FROM users
-		WHERE email = $1
+		SELECT id, username, email, password_hash, avatar_url, bio, is_admin, suspended_at, created_at, last_seen_at, updated_at FROM users
+		WHERE LOWER(email) = LOWER($1)
 	`
 
-	err := pg.db.QueryRowContext(ctx, query, email).Scan(&user.ID, &user.Username, &user.Email, &user.AvatarURL, &user.Bio, &user.CreatedAt, &user.LastSeenAt, &user.UpdatedAt)
+	err := pg.db.QueryRowContext(ctx, query, email).Scan(&user.ID, &user.Username, &user.Email, &user.PasswordHash.hash, &user.AvatarURL, &user.Bio, &user.IsAdmin, &user.SuspendedAt, &user.CreatedAt, &user.LastSeenAt, &user.UpdatedAt)
 	if err != nil {
 		return nil, err
 	}
@@ -118,12 +137,12 @@ func (pg *PostgresUserStore) GetUserByEmail(ctx context.Context, email string) (
 func (pg *PostgresUserStore) GetUserByUsername(ctx context.Context, username string) (*User, error) {
 	var user User;
 	query := `
-		SELECT id, username, email, password_hash, avatar_url, bio, created_at
+		SELECT id, username, email, password_hash, avatar_url, bio, is_bot, is_admin, suspended_at, created_at
 		FROM users
 		WHERE LOWER(username) = LOWER($1);
 	`
 
-	err := pg.db.QueryRowContext(ctx, query, username).Scan(&user.ID, &user.Username, &user.Email, &user.PasswordHash.hash, &user.AvatarURL, &user.Bio, &user.CreatedAt)
+	err := pg.db.QueryRowContext(ctx, query, username).Scan(&user.ID, &user.Username, &user.Email, &user.PasswordHash.hash, &user.AvatarURL, &user.Bio, &user.IsBot, &user.IsAdmin, &user.SuspendedAt, &user.CreatedAt)
 	if err != nil {
 		return nil, err
 	}
@@ -153,11 +172,11 @@ func (pg *PostgresUserStore) UpdateUser(ctx context.Context, user *User) error {
 	`
 
 	_, err := pg.db.ExecContext(ctx, query, user.Username, user.Email, user.AvatarURL, user.Bio, user.ID)
-	return err
+	return classify(err)
 }
 
 func (pg *PostgresUserStore) UpdateUserPassword(ctx context.Context, password string, userID int64) error {
-	tx, err := pg.db.Begin()
+	tx, err := pg.db.BeginTx(ctx, nil)
 	if err != nil {
 		return err
 	}
@@ -176,7 +195,7 @@ func (pg *PostgresUserStore) UpdateUserPassword(ctx context.Context, password st
 		WHERE user_id = $1
 	`
 	
-	hash, err := bcrypt.GenerateFromPassword([]byte(password),12)
+	hash, err := bcrypt.GenerateFromPassword([]byte(password),pg.bcryptCost)
 	if err != nil {
 		return err
 	}
@@ -210,7 +229,7 @@ func (pg *PostgresUserStore) GetUserToken(ctx context.Context, plainTextPassword
 	tokenHash := sha256.Sum256([]byte(plainTextPassword))
 
 	query := `
-		SELECT u.id, u.username, u.email, u.password_hash, u.avatar_url, u.bio, u.last_seen_at, u.created_at, u.updated_at
+		SELECT u.id, u.username, u.email, u.password_hash, u.avatar_url, u.bio, u.is_bot, u.is_admin, u.suspended_at, u.last_seen_at, u.created_at, u.updated_at
 		FROM users u
 		INNER JOIN tokens t ON t.user_id = u.id
 		WHERE t.token_hash = $1 AND t.expires_at > $2
@@ -227,6 +246,9 @@ func (pg *PostgresUserStore) GetUserToken(ctx context.Context, plainTextPassword
 		&user.PasswordHash.hash,
 		&user.AvatarURL,
 		&user.Bio,
+		&user.IsBot,
+		&user.IsAdmin,
+		&user.SuspendedAt,
 		&user.LastSeenAt,
 		&user.CreatedAt,
 		&user.UpdatedAt,
@@ -245,7 +267,7 @@ func (pg *PostgresUserStore) GetUserToken(ctx context.Context, plainTextPassword
 
 func (pg *PostgresUserStore) GetCurrentUser(ctx context.Context, userID int64) (*User, error) {
 	query := `
-		SELECT id, username, email, avatar_url, bio, last_seen_at, created_at, updated_at FROM users
+		SELECT id, username, email, avatar_url, bio, is_bot, last_seen_at, created_at, updated_at FROM users
 		WHERE id = $1
 	`
 
@@ -254,7 +276,7 @@ func (pg *PostgresUserStore) GetCurrentUser(ctx context.Context, userID int64) (
 	var avatar sql.NullString
 	var last_seen_at sql.NullTime
 	var updated_at sql.NullTime
-	err := pg.db.QueryRowContext(ctx, query, userID).Scan(&user.ID, &user.Username, &user.Email, &avatar, &bio, &last_seen_at, &user.CreatedAt, &updated_at)
+	err := pg.db.QueryRowContext(ctx, query, userID).Scan(&user.ID, &user.Username, &user.Email, &avatar, &bio, &user.IsBot, &last_seen_at, &user.CreatedAt, &updated_at)
 	
 	user.AvatarURL = &avatar.String
 	user.Bio = &bio.String
@@ -264,4 +286,166 @@ func (pg *PostgresUserStore) GetCurrentUser(ctx context.Context, userID int64) (
 		return nil, err
 	}
 	return &user, err
-}
\ No newline at end of file
+}
+
+func (u *User) Suspended() bool {
+	return u.SuspendedAt != nil
+}
+
+// SuspendUser locks the account out. Suspending a suspended user keeps the
+// original suspension time. It returns sql.ErrNoRows for unknown users.
+func (pg *PostgresUserStore) SuspendUser(ctx context.Context, userID int64) error {
+	query := `
+		UPDATE users
+		SET suspended_at = COALESCE(suspended_at, NOW())
+		WHERE id = $1
+	`
+
+	result, err := pg.db.ExecContext(ctx, query, userID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// ReactivateUser lifts a suspension. It returns sql.ErrNoRows for unknown
+// users.
+// GrantAdmin makes the users platform administrators and returns the ids
+// that were granted, leaving out unknown users and bots.
+func (pg *PostgresUserStore) GrantAdmin(ctx context.Context, userIDs []int64) ([]int64, error) {
+	query := `
+		UPDATE users
+		SET is_admin = true
+		WHERE id = ANY($1) AND NOT is_bot
+		RETURNING id
+	`
+
+	rows, err := pg.db.QueryContext(ctx, query, userIDs)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var granted []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		granted = append(granted, id)
+	}
+	return granted, rows.Err()
+}
+
+func (pg *PostgresUserStore) ReactivateUser(ctx context.Context, userID int64) error {
+	query := `
+		UPDATE users
+		SET suspended_at = NULL
+		WHERE id = $1
+	`
+
+	result, err := pg.db.ExecContext(ctx, query, userID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// UserSearch narrows SearchUsers down. Query matches part of the username
+// or email, ignoring case; a nil Suspended matches every account.
+type UserSearch struct {
+	Query     string
+	Suspended *bool
+	Limit     int64
+	Offset    int64
+}
+
+// SearchUsers lists accounts for platform administrators, oldest first.
+func (pg *PostgresUserStore) SearchUsers(ctx context.Context, search UserSearch) ([]*User, error) {
+	query := `
+		SELECT id, username, email, avatar_url, bio, is_bot, bot_owner_id, is_admin, suspended_at, created_at, last_seen_at, updated_at FROM users
+		WHERE ($1 = '' OR username ILIKE $1 ESCAPE '\' OR email ILIKE $1 ESCAPE '\')
+		AND ($2::BOOLEAN IS NULL OR (suspended_at IS NOT NULL) = $2)
+		ORDER BY id ASC
+		LIMIT $3 OFFSET $4
+	`
+
+	pattern := ""
+	if search.Query != "" {
+		pattern = "%" + strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(search.Query) + "%"
+	}
+
+	rows, err := pg.db.QueryContext(ctx, query, pattern, search.Suspended, search.Limit, search.Offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	users := []*User{}
+	for rows.Next() {
+		var user User
+		err := rows.Scan(&user.ID, &user.Username, &user.Email, &user.AvatarURL, &user.Bio, &user.IsBot, &user.BotOwnerID, &user.IsAdmin, &user.SuspendedAt, &user.CreatedAt, &user.LastSeenAt, &user.UpdatedAt)
+		if err != nil {
+			return nil, err
+		}
+		users = append(users, &user)
+	}
+
+	return users, rows.Err()
+}
+
+// CreateBot inserts a bot account. Bots have no password and can only
+// authenticate with API keys issued by their owner.
+func (pg *PostgresUserStore) CreateBot(ctx context.Context, bot *User) error {
+	query := `
+	INSERT INTO users (username, email, password_hash, avatar_url, bio, is_bot, bot_owner_id)
+	VALUES ($1, $2, NULL, $3, $4, true, $5)
+	RETURNING id, created_at
+	`
+
+	bot.IsBot = true
+	err := pg.db.QueryRowContext(ctx, query, bot.Username, bot.Email, bot.AvatarURL, bot.Bio, bot.BotOwnerID).Scan(&bot.ID, &bot.CreatedAt)
+	return classify(err)
+}
+
+func (pg *PostgresUserStore) GetBotsByOwner(ctx context.Context, ownerID int64) ([]*User, error) {
+	query := `
+		SELECT id, username, email, avatar_url, bio, is_bot, bot_owner_id, created_at, last_seen_at, updated_at FROM users
+		WHERE bot_owner_id = $1 AND is_bot = true
+		ORDER BY created_at ASC
+	`
+
+	rows, err := pg.db.QueryContext(ctx, query, ownerID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var bots []*User
+	for rows.Next() {
+		var bot User
+		err := rows.Scan(&bot.ID, &bot.Username, &bot.Email, &bot.AvatarURL, &bot.Bio, &bot.IsBot, &bot.BotOwnerID, &bot.CreatedAt, &bot.LastSeenAt, &bot.UpdatedAt)
+		if err != nil {
+			return nil, err
+		}
+		bots = append(bots, &bot)
+	}
+
+	return bots, rows.Err()
+}
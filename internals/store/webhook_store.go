@@ -0,0 +1,239 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"time"
+
+	"github.com/jackc/pgtype"
+)
+
+type DeliveryStatus string
+
+const (
+	DeliveryPending   DeliveryStatus = "pending"
+	DeliveryRetrying  DeliveryStatus = "retrying"
+	DeliveryDelivered DeliveryStatus = "delivered"
+	DeliveryDead      DeliveryStatus = "dead"
+)
+
+type Webhook struct {
+	ID        int64     `json:"id"`
+	ChatID    int64     `json:"chat_id"`
+	URL       string    `json:"url"`
+	Secret    string    `json:"-"`
+	Events    []string  `json:"events"`
+	Active    bool      `json:"active"`
+	CreatedBy *int64    `json:"created_by,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type WebhookDelivery struct {
+	ID             int64           `json:"id"`
+	WebhookID      int64           `json:"webhook_id"`
+	EventType      string          `json:"event_type"`
+	Payload        json.RawMessage `json:"payload"`
+	Status         DeliveryStatus  `json:"status"`
+	Attempts       int             `json:"attempts"`
+	NextAttemptAt  time.Time       `json:"next_attempt_at"`
+	LastStatusCode *int            `json:"last_status_code,omitempty"`
+	LastError      *string         `json:"last_error,omitempty"`
+	DeliveredAt    *time.Time      `json:"delivered_at,omitempty"`
+	CreatedAt      time.Time       `json:"created_at"`
+
+	// set on claimed deliveries only
+	URL    string `json:"-"`
+	Secret string `json:"-"`
+}
+
+type PostgresWebhookStore struct {
+	db *sql.DB
+}
+
+func NewPostgresWebhookStore(db *sql.DB) *PostgresWebhookStore {
+	return &PostgresWebhookStore{db: db}
+}
+
+type WebhookStore interface {
+	CreateWebhook(ctx context.Context, hook *Webhook) error
+	GetChatWebhooks(ctx context.Context, chatID int64) ([]*Webhook, error)
+	DeleteWebhook(ctx context.Context, chatID, webhookID int64) error
+	GetWebhookDeliveries(ctx context.Context, chatID, webhookID, limit int64) ([]*WebhookDelivery, error)
+	EnqueueEvent(ctx context.Context, chatID int64, eventType string, payload []byte) error
+	ClaimDueDeliveries(ctx context.Context, limit int, lease time.Duration) ([]*WebhookDelivery, error)
+	MarkDelivered(ctx context.Context, deliveryID int64, statusCode int) error
+	MarkFailed(ctx context.Context, deliveryID int64, statusCode *int, lastError string, nextAttemptAt *time.Time) error
+}
+
+func (pg *PostgresWebhookStore) CreateWebhook(ctx context.Context, hook *Webhook) error {
+	query := `
+		INSERT INTO webhooks (chat_id, url, secret, events, created_by)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING id, active, created_at
+	`
+
+	return pg.db.QueryRowContext(ctx, query, hook.ChatID, hook.URL, hook.Secret, hook.Events, hook.CreatedBy).Scan(&hook.ID, &hook.Active, &hook.CreatedAt)
+}
+
+func (pg *PostgresWebhookStore) GetChatWebhooks(ctx context.Context, chatID int64) ([]*Webhook, error) {
+	query := `
+		SELECT id, chat_id, url, secret, events, active, created_by, created_at
+		FROM webhooks
+		WHERE chat_id = $1
+		ORDER BY created_at ASC
+	`
+
+	rows, err := pg.db.QueryContext(ctx, query, chatID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var hooks []*Webhook
+	for rows.Next() {
+		var hook Webhook
+		var events pgtype.TextArray
+		err := rows.Scan(&hook.ID, &hook.ChatID, &hook.URL, &hook.Secret, &events, &hook.Active, &hook.CreatedBy, &hook.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		if err := events.AssignTo(&hook.Events); err != nil {
+			return nil, err
+		}
+		hooks = append(hooks, &hook)
+	}
+
+	return hooks, rows.Err()
+}
+
+func (pg *PostgresWebhookStore) DeleteWebhook(ctx context.Context, chatID, webhookID int64) error {
+	query := `
+		DELETE FROM webhooks
+		WHERE id = $1 AND chat_id = $2
+	`
+
+	results, err := pg.db.ExecContext(ctx, query, webhookID, chatID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := results.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return sql.ErrNoRows
+	}
+
+	return nil
+}
+
+func (pg *PostgresWebhookStore) GetWebhookDeliveries(ctx context.Context, chatID, webhookID, limit int64) ([]*WebhookDelivery, error) {
+	query := `
+		SELECT d.id, d.webhook_id, d.event_type, d.payload, d.status, d.attempts, d.next_attempt_at,
+			d.last_status_code, d.last_error, d.delivered_at, d.created_at
+		FROM webhook_deliveries d
+		INNER JOIN webhooks w ON w.id = d.webhook_id
+		WHERE d.webhook_id = $1 AND w.chat_id = $2
+		ORDER BY d.created_at DESC
+		LIMIT $3
+	`
+
+	rows, err := pg.db.QueryContext(ctx, query, webhookID, chatID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var deliveries []*WebhookDelivery
+	for rows.Next() {
+		var d WebhookDelivery
+		err := rows.Scan(&d.ID, &d.WebhookID, &d.EventType, &d.Payload, &d.Status, &d.Attempts, &d.NextAttemptAt, &d.LastStatusCode, &d.LastError, &d.DeliveredAt, &d.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		deliveries = append(deliveries, &d)
+	}
+
+	return deliveries, rows.Err()
+}
+
+// EnqueueEvent queues one delivery for every active subscription in the chat
+// that listens for eventType.
+func (pg *PostgresWebhookStore) EnqueueEvent(ctx context.Context, chatID int64, eventType string, payload []byte) error {
+	query := `
+		INSERT INTO webhook_deliveries (webhook_id, event_type, payload)
+		SELECT id, $2, $3
+		FROM webhooks
+		WHERE chat_id = $1 AND active = true AND $2 = ANY(events)
+	`
+
+	_, err := pg.db.ExecContext(ctx, query, chatID, eventType, payload)
+	return err
+}
+
+// ClaimDueDeliveries picks up to limit due deliveries and pushes their next
+// attempt out by lease, so a worker that dies mid-delivery does not lose
+// them: they become due again once the lease runs out. SKIP LOCKED lets
+// several instances poll the same queue.
+func (pg *PostgresWebhookStore) ClaimDueDeliveries(ctx context.Context, limit int, lease time.Duration) ([]*WebhookDelivery, error) {
+	query := `
+		UPDATE webhook_deliveries d
+		SET attempts = d.attempts + 1, next_attempt_at = NOW() + $2 * INTERVAL '1 millisecond'
+		FROM webhooks w
+		WHERE w.id = d.webhook_id AND d.id IN (
+			SELECT id FROM webhook_deliveries
+			WHERE status IN ('pending', 'retrying') AND next_attempt_at <= NOW()
+			ORDER BY next_attempt_at ASC
+			LIMIT $1
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING d.id, d.webhook_id, d.event_type, d.payload, d.status, d.attempts, d.next_attempt_at, d.created_at, w.url, w.secret
+	`
+
+	rows, err := pg.db.QueryContext(ctx, query, limit, lease.Milliseconds())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var deliveries []*WebhookDelivery
+	for rows.Next() {
+		var d WebhookDelivery
+		err := rows.Scan(&d.ID, &d.WebhookID, &d.EventType, &d.Payload, &d.Status, &d.Attempts, &d.NextAttemptAt, &d.CreatedAt, &d.URL, &d.Secret)
+		if err != nil {
+			return nil, err
+		}
+		deliveries = append(deliveries, &d)
+	}
+
+	return deliveries, rows.Err()
+}
+
+func (pg *PostgresWebhookStore) MarkDelivered(ctx context.Context, deliveryID int64, statusCode int) error {
+	query := `
+		UPDATE webhook_deliveries
+		SET status = 'delivered', last_status_code = $2, last_error = NULL, delivered_at = NOW()
+		WHERE id = $1
+	`
+
+	_, err := pg.db.ExecContext(ctx, query, deliveryID, statusCode)
+	return err
+}
+
+// MarkFailed records a failed attempt. A nil nextAttemptAt moves the
+// delivery to the dead-letter state.
+func (pg *PostgresWebhookStore) MarkFailed(ctx context.Context, deliveryID int64, statusCode *int, lastError string, nextAttemptAt *time.Time) error {
+	query := `
+		UPDATE webhook_deliveries
+		SET status = CASE WHEN $4::timestamptz IS NULL THEN 'dead' ELSE 'retrying' END,
+			last_status_code = $2,
+			last_error = $3,
+			next_attempt_at = COALESCE($4, next_attempt_at)
+		WHERE id = $1
+	`
+
+	_, err := pg.db.ExecContext(ctx, query, deliveryID, statusCode, lastError, nextAttemptAt)
+	return err
+}
@@ -11,6 +11,25 @@ const (
 	ScopeAuth = "authentication"
 )
 
+// API key scopes
+const (
+	ScopeMessagesRead = "messages:read"
+	ScopeMessagesWrite = "messages:write"
+	ScopeMembersManage = "members:manage"
+)
+
+// APIKeyPrefix marks plaintext API keys so they can be told apart from
+// session tokens in the Authorization header and in leaked logs.
+const APIKeyPrefix = "chk_"
+
+func ValidScope(scope string) bool {
+	switch scope {
+	case ScopeMessagesRead, ScopeMessagesWrite, ScopeMembersManage:
+		return true
+	}
+	return false
+}
+
 type Token struct{
 	ID int64 `json:"-"`
 	UserID int64 `json:"-"`
@@ -36,4 +55,41 @@ func GenerateToken(userID int64, ttl time.Duration) (*Token, error){
 	hash := sha256.Sum256([]byte(token.Plaintext))
 	token.Hash = hash[:]
 	return token, nil
-}
\ No newline at end of file
+}
+
+// GenerateAPIKey creates a bot API key. It is hashed the same way as session
+// tokens; expiry is tracked per key by the store instead of on the token.
+func GenerateAPIKey(userID int64) (*Token, error) {
+	token, err := GenerateToken(userID, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	token.Plaintext = APIKeyPrefix + token.Plaintext
+	token.Hash = Hash(token.Plaintext)
+	token.ExpiresAt = time.Time{}
+	return token, nil
+}
+
+func Hash(plaintext string) []byte {
+	hash := sha256.Sum256([]byte(plaintext))
+	return hash[:]
+}
+
+// GenerateSecret returns a random credential that is not tied to a user
+// session, such as the token in an incoming webhook URL. Only the hash should
+// be stored.
+func GenerateSecret() (*Token, error) {
+	return GenerateToken(0, 0)
+}
+
+// GenerateInviteCode returns the code of a chat invite link. Unlike the
+// other credentials it is stored as is, so admins can share it again.
+func GenerateInviteCode() (string, error) {
+	randomBytes := make([]byte, 10)
+	_, err := rand.Read(randomBytes)
+	if err != nil {
+		return "", err
+	}
+	return base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(randomBytes), nil
+}
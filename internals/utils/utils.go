@@ -4,7 +4,6 @@ import (
 	"encoding/json"
 	"errors"
 	"net/http"
-	"regexp"
 	"strconv"
 
 	"github.com/go-chi/chi"
@@ -60,12 +59,3 @@ func ReadQueryParamInt64(r *http.Request, paramName string) (int64, error) {
 
 	return id, nil
 }
-
-
-func ValidateEmail(email string) error {
-	emailRegex := regexp.MustCompile(`^[a-zA-Z0-9._%+-]+@[a-zA-Z0-9.-]+\.[a-zA-Z]{2,}$`)
-	if !emailRegex.MatchString(email) {
-		return errors.New("invalid email format")
-	}
-	return nil
-}
\ No newline at end of file
@@ -0,0 +1,87 @@
+package validate
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"reflect"
+	"strings"
+
+	"github.com/Abhishek-B-R/chat-app-golang/internals/apierror"
+)
+
+// DecodeJSON reads a single JSON object from the request body into dst and
+// rejects fields dst does not have, so typos in a request are reported
+// instead of silently ignored. The error is ready to be passed to
+// apierror.Write.
+func DecodeJSON(r *http.Request, dst any) error {
+	return decode(r, dst, true)
+}
+
+// DecodeJSONAllowUnknown is DecodeJSON for payloads designed by other
+// services, like incoming webhooks in the Slack or Discord format, which
+// carry fields this server has no use for.
+func DecodeJSONAllowUnknown(r *http.Request, dst any) error {
+	return decode(r, dst, false)
+}
+
+func decode(r *http.Request, dst any, strict bool) error {
+	dec := json.NewDecoder(r.Body)
+	if strict {
+		dec.DisallowUnknownFields()
+	}
+
+	err := dec.Decode(dst)
+	if err == nil {
+		// a second value after the object means the body is not one document
+		if dec.Decode(&struct{}{}) != io.EOF {
+			return apierror.BadRequest("request body must contain a single JSON object")
+		}
+		return nil
+	}
+
+	var syntaxErr *json.SyntaxError
+	var typeErr *json.UnmarshalTypeError
+	var maxBytesErr *http.MaxBytesError
+	switch {
+	case errors.As(err, &maxBytesErr):
+		return apierror.PayloadTooLarge(fmt.Sprintf("request body cannot be larger than %d bytes", maxBytesErr.Limit))
+	case errors.Is(err, io.EOF):
+		return apierror.BadRequest("request body cannot be empty")
+	case errors.Is(err, io.ErrUnexpectedEOF):
+		return apierror.BadRequest("request body is not valid JSON")
+	case errors.As(err, &syntaxErr):
+		return apierror.BadRequest(fmt.Sprintf("request body is not valid JSON at offset %d", syntaxErr.Offset))
+	case errors.As(err, &typeErr) && typeErr.Field != "":
+		return apierror.Validation(apierror.FieldError{Field: typeErr.Field, Message: "must be a JSON " + jsonKind(typeErr.Type)})
+	case errors.As(err, &typeErr):
+		return apierror.BadRequest("request body must be a JSON object")
+	case strings.HasPrefix(err.Error(), "json: unknown field "):
+		// encoding/json has no typed error for unknown fields
+		field := strings.Trim(strings.TrimPrefix(err.Error(), "json: unknown field "), `"`)
+		return apierror.Validation(apierror.FieldError{Field: field, Message: "unknown field"})
+	default:
+		return apierror.BadRequest("invalid request body")
+	}
+}
+
+// jsonKind names the JSON type that decodes into t.
+func jsonKind(t reflect.Type) string {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	switch t.Kind() {
+	case reflect.String:
+		return "string"
+	case reflect.Bool:
+		return "boolean"
+	case reflect.Slice, reflect.Array:
+		return "array"
+	case reflect.Struct, reflect.Map:
+		return "object"
+	default:
+		return "number"
+	}
+}
@@ -0,0 +1,124 @@
+package validate
+
+import (
+	"fmt"
+	"net/mail"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/Abhishek-B-R/chat-app-golang/internals/apierror"
+	"github.com/Abhishek-B-R/chat-app-golang/internals/config"
+	"github.com/Abhishek-B-R/chat-app-golang/internals/store"
+)
+
+const (
+	UsernameMinLength = 3
+	UsernameMaxLength = 50
+	PasswordMinLength = 8
+	// bcrypt ignores everything past 72 bytes
+	PasswordMaxLength = 72
+	EmailMaxLength    = 254
+)
+
+var (
+	usernameRegex = regexp.MustCompile(`^[a-z0-9][a-z0-9_.-]*$`)
+	emailRegex    = regexp.MustCompile(`^[a-zA-Z0-9._%+-]+@[a-zA-Z0-9.-]+\.[a-zA-Z]{2,}$`)
+)
+
+// reservedUsernames could be mistaken for the service itself or collide with
+// routes such as /users/me.
+var reservedUsernames = map[string]bool{
+	"admin":         true,
+	"administrator": true,
+	"api":           true,
+	"bot":           true,
+	"me":            true,
+	"moderator":     true,
+	"root":          true,
+	"support":       true,
+	"system":        true,
+}
+
+var validAttachmentTypes = map[store.AttachmentType]bool{
+	store.AttachmentImage: true,
+	store.AttachmentVideo: true,
+	store.AttachmentPDF:   true,
+	store.AttachmentFile:  true,
+}
+
+// Validator collects field errors so a request reports every problem at
+// once instead of one per round trip.
+type Validator struct {
+	fields []apierror.FieldError
+}
+
+// Check records message for field unless ok. Only the first error of each
+// field is kept.
+func (v *Validator) Check(ok bool, field, message string) {
+	if ok || v.has(field) {
+		return
+	}
+	v.fields = append(v.fields, apierror.FieldError{Field: field, Message: message})
+}
+
+func (v *Validator) has(field string) bool {
+	for _, f := range v.fields {
+		if f.Field == field {
+			return true
+		}
+	}
+	return false
+}
+
+func (v *Validator) Valid() bool {
+	return len(v.fields) == 0
+}
+
+// Err is nil when every check passed, otherwise a 422 listing the fields.
+func (v *Validator) Err() error {
+	if v.Valid() {
+		return nil
+	}
+	return apierror.Validation(v.fields...)
+}
+
+// Username expects the name already lowercased.
+func (v *Validator) Username(field, username string) {
+	v.Check(username != "", field, "username is required")
+	v.Check(len(username) >= UsernameMinLength, field, fmt.Sprintf("username must be at least %d characters", UsernameMinLength))
+	v.Check(len(username) <= UsernameMaxLength, field, fmt.Sprintf("username cannot be longer than %d characters", UsernameMaxLength))
+	v.Check(usernameRegex.MatchString(username), field, "username can only contain a-z, 0-9, _, . and - and must start with a letter or digit")
+	v.Check(!reservedUsernames[username], field, "username is reserved")
+}
+
+func (v *Validator) Email(field, email string) {
+	v.Check(email != "", field, "email is required")
+	v.Check(len(email) <= EmailMaxLength, field, fmt.Sprintf("email cannot be longer than %d characters", EmailMaxLength))
+	_, err := mail.ParseAddress(email)
+	v.Check(err == nil && emailRegex.MatchString(email), field, "invalid email format")
+}
+
+func (v *Validator) Password(field, password string) {
+	v.Check(password != "", field, "password is required")
+	v.Check(len(password) >= PasswordMinLength, field, fmt.Sprintf("password must be at least %d characters", PasswordMinLength))
+	v.Check(len(password) <= PasswordMaxLength, field, fmt.Sprintf("password cannot be longer than %d bytes", PasswordMaxLength))
+}
+
+// Message checks the content and attachments of a message a user or an
+// incoming webhook is posting.
+func (v *Validator) Message(content *string, attachments []store.MessageAttachment, limits config.LimitsConfig) {
+	hasContent := content != nil && strings.TrimSpace(*content) != ""
+	v.Check(hasContent || len(attachments) > 0, "content", "a message needs content or attachments")
+	if content != nil {
+		v.Check(utf8.RuneCountInString(*content) <= limits.MaxMessageLength, "content", fmt.Sprintf("content cannot be longer than %d characters", limits.MaxMessageLength))
+	}
+
+	v.Check(len(attachments) <= limits.MaxAttachmentsPerMessage, "attachments", fmt.Sprintf("a message can have at most %d attachments", limits.MaxAttachmentsPerMessage))
+	for i, a := range attachments {
+		field := fmt.Sprintf("attachments[%d]", i)
+		v.Check(a.URL != "", field+".url", "url is required")
+		v.Check(validAttachmentTypes[a.Type], field+".type", "type must be one of image, video, pdf or file")
+		v.Check(a.SizeBytes == nil || *a.SizeBytes <= limits.MaxAttachmentBytes, field+".size_bytes", fmt.Sprintf("attachments can be at most %d bytes", limits.MaxAttachmentBytes))
+	}
+}
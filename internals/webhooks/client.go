@@ -0,0 +1,92 @@
+package webhooks
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"syscall"
+	"time"
+)
+
+// ErrPrivateAddress means a URL resolves to an address inside our own
+// network, which users must not be able to make the server call.
+var ErrPrivateAddress = errors.New("webhooks: destination is not a public address")
+
+// sharedAddressSpace is carrier-grade NAT, not covered by netip's IsPrivate.
+var sharedAddressSpace = netip.MustParsePrefix("100.64.0.0/10")
+
+// NewClient returns the client for requests to user supplied URLs, outgoing
+// webhooks and bot commands. It only connects to public addresses, checked
+// on the address actually dialed so DNS cannot be rebound between a check and
+// the request, and it does not follow redirects: a 3xx is returned as is and
+// counts as a failed delivery.
+func NewClient(timeout time.Duration) *http.Client {
+	dialer := &net.Dialer{
+		Timeout: 10 * time.Second,
+		Control: func(network, address string, c syscall.RawConn) error {
+			addr, err := netip.ParseAddrPort(address)
+			if err != nil || !PublicAddr(addr.Addr()) {
+				return fmt.Errorf("%w: %s", ErrPrivateAddress, address)
+			}
+			return nil
+		},
+	}
+
+	return &http.Client{
+		Timeout: timeout,
+		Transport: &http.Transport{
+			// no proxy: the dialer has to see the receiver's address
+			Proxy: nil,
+			DialContext: dialer.DialContext,
+			TLSHandshakeTimeout: 10 * time.Second,
+			MaxIdleConns: 100,
+			IdleConnTimeout: 90 * time.Second,
+		},
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
+
+// PublicAddr reports whether addr is routable on the internet, as opposed to
+// loopback, private, link-local (which includes cloud metadata services),
+// multicast or unspecified addresses.
+func PublicAddr(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	return addr.IsValid() &&
+		!addr.IsLoopback() &&
+		!addr.IsPrivate() &&
+		!addr.IsLinkLocalUnicast() &&
+		!addr.IsLinkLocalMulticast() &&
+		!addr.IsInterfaceLocalMulticast() &&
+		!addr.IsMulticast() &&
+		!addr.IsUnspecified() &&
+		!sharedAddressSpace.Contains(addr)
+}
+
+// CheckURL parses a URL a user registers as a webhook or bot endpoint. It
+// must be absolute http or https and every address its host resolves to
+// must be public. The client checks again when connecting, this rejects
+// obviously internal targets when they are registered. Errors are meant for
+// the user registering the URL.
+func CheckURL(ctx context.Context, raw string) (*url.URL, error) {
+	target, err := url.Parse(raw)
+	if err != nil || (target.Scheme != "http" && target.Scheme != "https") || target.Hostname() == "" {
+		return nil, errors.New("url must be an absolute http or https url")
+	}
+
+	addrs, err := net.DefaultResolver.LookupNetIP(ctx, "ip", target.Hostname())
+	if err != nil {
+		return nil, fmt.Errorf("url host %s could not be resolved", target.Hostname())
+	}
+	for _, addr := range addrs {
+		if !PublicAddr(addr) {
+			return nil, fmt.Errorf("url must point to a public address, %s resolves to %s", target.Hostname(), addr)
+		}
+	}
+	return target, nil
+}
@@ -0,0 +1,79 @@
+package webhooks
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/Abhishek-B-R/chat-app-golang/internals/logging"
+	"github.com/Abhishek-B-R/chat-app-golang/internals/store"
+)
+
+const (
+	EventMessageCreated = "message.created"
+	EventMessageUpdated = "message.updated"
+	EventMessageDeleted = "message.deleted"
+	EventMemberAdded    = "member.added"
+	EventMemberRemoved  = "member.removed"
+	EventMemberUpdated  = "member.updated"
+	EventChatUpdated    = "chat.updated"
+)
+
+var Events = []string{
+	EventMessageCreated,
+	EventMessageUpdated,
+	EventMessageDeleted,
+	EventMemberAdded,
+	EventMemberRemoved,
+	EventMemberUpdated,
+	EventChatUpdated,
+}
+
+func ValidEvent(event string) bool {
+	for _, e := range Events {
+		if e == event {
+			return true
+		}
+	}
+	return false
+}
+
+// Payload is the JSON body POSTed to subscribers.
+type Payload struct {
+	Event      string      `json:"event"`
+	ChatID     int64       `json:"chat_id"`
+	OccurredAt time.Time   `json:"occurred_at"`
+	Data       interface{} `json:"data"`
+}
+
+// Publisher queues chat events for delivery. The queue lives in Postgres, so
+// an event that was published survives restarts until it is delivered or
+// dead-lettered.
+type Publisher struct {
+	store  store.WebhookStore
+}
+
+func NewPublisher(webhookStore store.WebhookStore) *Publisher {
+	return &Publisher{store: webhookStore}
+}
+
+// Publish queues event for every subscription of the chat. Failures are
+// logged rather than returned: the action that triggered the event has
+// already happened and should not be reported as failed.
+func (p *Publisher) Publish(ctx context.Context, chatID int64, event string, data interface{}) {
+	body, err := json.Marshal(Payload{
+		Event:      event,
+		ChatID:     chatID,
+		OccurredAt: time.Now().UTC(),
+		Data:       data,
+	})
+	if err != nil {
+		logging.FromContext(ctx).Error("encoding webhook event", "event", event, "error", err)
+		return
+	}
+
+	err = p.store.EnqueueEvent(ctx, chatID, event, body)
+	if err != nil {
+		logging.FromContext(ctx).Error("enqueueing webhook event", "event", event, "chat_id", chatID, "error", err)
+	}
+}
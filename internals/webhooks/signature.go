@@ -0,0 +1,42 @@
+package webhooks
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"strconv"
+)
+
+const (
+	SignatureHeader = "X-Webhook-Signature"
+	TimestampHeader = "X-Webhook-Timestamp"
+)
+
+// Sign returns the HMAC-SHA256 of "timestamp.body" keyed by secret, in the
+// "sha256=<hex>" form sent in the X-Webhook-Signature header. Including the
+// timestamp lets receivers reject replayed requests.
+func Sign(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10)))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// SetSignatureHeaders signs body and sets the timestamp and signature
+// headers on an outgoing request.
+func SetSignatureHeaders(h http.Header, secret string, timestamp int64, body []byte) {
+	h.Set(TimestampHeader, strconv.FormatInt(timestamp, 10))
+	h.Set(SignatureHeader, Sign(secret, timestamp, body))
+}
+
+func GenerateSecret() (string, error) {
+	b := make([]byte, 32)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
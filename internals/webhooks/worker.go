@@ -0,0 +1,153 @@
+package webhooks
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"math/rand"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/Abhishek-B-R/chat-app-golang/internals/config"
+	"github.com/Abhishek-B-R/chat-app-golang/internals/metrics"
+	"github.com/Abhishek-B-R/chat-app-golang/internals/store"
+)
+
+// Worker delivers queued webhook events. Several workers, in one or many
+// processes, can share the queue.
+type Worker struct {
+	store   store.WebhookStore
+	client  *http.Client
+	cfg     config.WebhooksConfig
+	logger  *slog.Logger
+	metrics metrics.Recorder
+
+	running atomic.Bool
+}
+
+func NewWorker(webhookStore store.WebhookStore, cfg config.WebhooksConfig, recorder metrics.Recorder, logger *slog.Logger) *Worker {
+	return &Worker{
+		store:   webhookStore,
+		client:  NewClient(cfg.RequestTimeout),
+		cfg:     cfg,
+		logger:  logger,
+		metrics: recorder,
+	}
+}
+
+// Run polls the queue until ctx is cancelled. It returns once the delivery
+// in progress, if any, has finished.
+func (wk *Worker) Run(ctx context.Context) {
+	wk.running.Store(true)
+	defer wk.running.Store(false)
+
+	ticker := time.NewTicker(wk.cfg.PollInterval)
+	defer ticker.Stop()
+
+	for {
+		wk.processBatch(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Running reports whether Run is polling the queue.
+func (wk *Worker) Running() bool {
+	return wk.running.Load()
+}
+
+func (wk *Worker) processBatch(ctx context.Context) {
+	// a claimed delivery is not picked up again until the request had time to finish
+	lease := 2 * wk.cfg.RequestTimeout
+	deliveries, err := wk.store.ClaimDueDeliveries(ctx, wk.cfg.BatchSize, lease)
+	if err != nil {
+		if ctx.Err() == nil {
+			wk.logger.Error("claiming webhook deliveries", "error", err)
+		}
+		return
+	}
+
+	for _, d := range deliveries {
+		// on shutdown the rest of the batch is left to a later lease, but a
+		// delivery that already started is allowed to finish and be recorded
+		if ctx.Err() != nil {
+			return
+		}
+		wk.deliver(context.WithoutCancel(ctx), d)
+	}
+}
+
+func (wk *Worker) deliver(ctx context.Context, d *store.WebhookDelivery) {
+	statusCode, err := wk.send(ctx, d)
+	if err == nil {
+		wk.metrics.JobOutcome("webhook", string(store.DeliveryDelivered))
+		err = wk.store.MarkDelivered(ctx, d.ID, statusCode)
+		if err != nil {
+			wk.logger.Error("marking webhook delivery delivered", "delivery_id", d.ID, "error", err)
+		}
+		return
+	}
+
+	var code *int
+	if statusCode != 0 {
+		code = &statusCode
+	}
+
+	var next *time.Time
+	if d.Attempts < wk.cfg.MaxAttempts {
+		at := time.Now().Add(wk.backoff(d.Attempts))
+		next = &at
+		wk.metrics.JobOutcome("webhook", string(store.DeliveryRetrying))
+	} else {
+		wk.metrics.JobOutcome("webhook", string(store.DeliveryDead))
+		wk.logger.Warn("webhook delivery dead-lettered", "delivery_id", d.ID, "webhook_id", d.WebhookID, "attempts", d.Attempts, "error", err)
+	}
+
+	err = wk.store.MarkFailed(ctx, d.ID, code, err.Error(), next)
+	if err != nil {
+		wk.logger.Error("marking webhook delivery failed", "delivery_id", d.ID, "error", err)
+	}
+}
+
+func (wk *Worker) send(ctx context.Context, d *store.WebhookDelivery) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, d.URL, bytes.NewReader(d.Payload))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Webhook-Event", d.EventType)
+	req.Header.Set("X-Webhook-Delivery", fmt.Sprint(d.ID))
+	SetSignatureHeaders(req.Header, d.Secret, time.Now().Unix(), d.Payload)
+
+	resp, err := wk.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("receiver responded with %s", resp.Status)
+	}
+	return resp.StatusCode, nil
+}
+
+// backoff doubles the wait after every attempt, up to MaxBackoff, with up to
+// 20% jitter so failing receivers are not hit by synchronized retries.
+func (wk *Worker) backoff(attempts int) time.Duration {
+	wait := wk.cfg.InitialBackoff
+	for i := 1; i < attempts && wait < wk.cfg.MaxBackoff; i++ {
+		wait *= 2
+	}
+	if wait > wk.cfg.MaxBackoff {
+		wait = wk.cfg.MaxBackoff
+	}
+	return wait + time.Duration(rand.Int63n(int64(wait)/5+1))
+}
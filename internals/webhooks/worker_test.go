@@ -0,0 +1,304 @@
+package webhooks
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Abhishek-B-R/chat-app-golang/internals/config"
+	"github.com/Abhishek-B-R/chat-app-golang/internals/metrics"
+	"github.com/Abhishek-B-R/chat-app-golang/internals/store"
+)
+
+// memQueue is the delivery log in memory, claimed and updated the way the
+// Postgres store does.
+type memQueue struct {
+	store.WebhookStore
+
+	mu         sync.Mutex
+	deliveries []*store.WebhookDelivery
+}
+
+func (q *memQueue) enqueue(url, secret string, payload string) *store.WebhookDelivery {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	d := &store.WebhookDelivery{
+		ID: int64(len(q.deliveries) + 1),
+		WebhookID: 1,
+		EventType: EventMessageCreated,
+		Payload: []byte(payload),
+		Status: store.DeliveryPending,
+		NextAttemptAt: time.Now(),
+		CreatedAt: time.Now(),
+		URL: url,
+		Secret: secret,
+	}
+	q.deliveries = append(q.deliveries, d)
+	return d
+}
+
+// due makes every retrying delivery due now instead of after its backoff.
+func (q *memQueue) due() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for _, d := range q.deliveries {
+		d.NextAttemptAt = time.Now()
+	}
+}
+
+func (q *memQueue) ClaimDueDeliveries(ctx context.Context, limit int, lease time.Duration) ([]*store.WebhookDelivery, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	var claimed []*store.WebhookDelivery
+	for _, d := range q.deliveries {
+		if len(claimed) == limit {
+			break
+		}
+		if (d.Status == store.DeliveryPending || d.Status == store.DeliveryRetrying) && !d.NextAttemptAt.After(time.Now()) {
+			d.Attempts++
+			d.NextAttemptAt = time.Now().Add(lease)
+			c := *d
+			claimed = append(claimed, &c)
+		}
+	}
+	return claimed, nil
+}
+
+func (q *memQueue) MarkDelivered(ctx context.Context, deliveryID int64, statusCode int) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	d := q.deliveries[deliveryID-1]
+	now := time.Now()
+	d.Status = store.DeliveryDelivered
+	d.LastStatusCode = &statusCode
+	d.DeliveredAt = &now
+	return nil
+}
+
+func (q *memQueue) MarkFailed(ctx context.Context, deliveryID int64, statusCode *int, lastError string, nextAttemptAt *time.Time) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	d := q.deliveries[deliveryID-1]
+	d.Status = store.DeliveryDead
+	if nextAttemptAt != nil {
+		d.Status = store.DeliveryRetrying
+		d.NextAttemptAt = *nextAttemptAt
+	}
+	d.LastStatusCode = statusCode
+	d.LastError = &lastError
+	return nil
+}
+
+func testWorker(q *memQueue) *Worker {
+	cfg := config.Default().Webhooks
+	cfg.MaxAttempts = 3
+	wk := NewWorker(q, cfg, metrics.Nop{}, slog.New(slog.DiscardHandler))
+	// the receivers below listen on loopback, which NewClient refuses
+	wk.client = &http.Client{Timeout: cfg.RequestTimeout}
+	return wk
+}
+
+func TestWorkerSignsDeliveries(t *testing.T) {
+	var got *http.Request
+	var body []byte
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r
+		body, _ = io.ReadAll(r.Body)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer receiver.Close()
+
+	q := &memQueue{}
+	d := q.enqueue(receiver.URL, "s3cret", `{"message":{"id":1}}`)
+	testWorker(q).processBatch(context.Background())
+
+	if got == nil {
+		t.Fatal("receiver was not called")
+	}
+	if got.Header.Get("X-Webhook-Event") != EventMessageCreated || got.Header.Get("X-Webhook-Delivery") != "1" {
+		t.Errorf("event headers = %q, %q", got.Header.Get("X-Webhook-Event"), got.Header.Get("X-Webhook-Delivery"))
+	}
+
+	// verify the way a receiver would: HMAC of "timestamp.body"
+	mac := hmac.New(sha256.New, []byte("s3cret"))
+	mac.Write([]byte(got.Header.Get(TimestampHeader) + "." + string(body)))
+	want := "sha256=" + hex.EncodeToString(mac.Sum(nil))
+	if got.Header.Get(SignatureHeader) != want {
+		t.Errorf("signature = %q, want %q", got.Header.Get(SignatureHeader), want)
+	}
+	ts, err := strconv.ParseInt(got.Header.Get(TimestampHeader), 10, 64)
+	if err != nil || time.Since(time.Unix(ts, 0)) > time.Minute {
+		t.Errorf("timestamp = %q, want the current time", got.Header.Get(TimestampHeader))
+	}
+
+	if d.Status != store.DeliveryDelivered || d.LastStatusCode == nil || *d.LastStatusCode != http.StatusNoContent || d.DeliveredAt == nil {
+		t.Errorf("delivery log: status %s, code %v, delivered at %v", d.Status, d.LastStatusCode, d.DeliveredAt)
+	}
+}
+
+func TestWorkerRetriesThenDeadLetters(t *testing.T) {
+	var calls int
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		http.Error(w, "down for maintenance", http.StatusServiceUnavailable)
+	}))
+	defer receiver.Close()
+
+	q := &memQueue{}
+	d := q.enqueue(receiver.URL, "s3cret", `{}`)
+	wk := testWorker(q)
+
+	for attempt := 1; attempt < wk.cfg.MaxAttempts; attempt++ {
+		before := time.Now()
+		wk.processBatch(context.Background())
+
+		if d.Status != store.DeliveryRetrying || d.Attempts != attempt {
+			t.Fatalf("attempt %d: status %s after %d attempts, want retrying", attempt, d.Status, d.Attempts)
+		}
+		if d.LastStatusCode == nil || *d.LastStatusCode != http.StatusServiceUnavailable || d.LastError == nil {
+			t.Errorf("attempt %d: delivery log has code %v, error %v", attempt, d.LastStatusCode, d.LastError)
+		}
+		if wait := d.NextAttemptAt.Sub(before); wait < wk.backoff(attempt)*5/6 {
+			t.Errorf("attempt %d: retried after %s, want the backoff", attempt, wait)
+		}
+
+		// not due yet, so the next batch leaves it alone
+		wk.processBatch(context.Background())
+		if calls != attempt {
+			t.Fatalf("attempt %d: receiver called %d times before the backoff passed", attempt, calls)
+		}
+		q.due()
+	}
+
+	wk.processBatch(context.Background())
+	if d.Status != store.DeliveryDead || calls != wk.cfg.MaxAttempts {
+		t.Errorf("after %d calls status is %s, want dead after %d", calls, d.Status, wk.cfg.MaxAttempts)
+	}
+
+	q.due()
+	wk.processBatch(context.Background())
+	if calls != wk.cfg.MaxAttempts {
+		t.Errorf("dead delivery was sent again")
+	}
+}
+
+func TestWorkerBackoff(t *testing.T) {
+	wk := testWorker(&memQueue{})
+	wk.cfg.InitialBackoff = time.Second
+	wk.cfg.MaxBackoff = 10 * time.Second
+
+	for attempts, want := range map[int]time.Duration{1: time.Second, 2: 2 * time.Second, 3: 4 * time.Second, 4: 8 * time.Second, 5: 10 * time.Second, 20: 10 * time.Second} {
+		got := wk.backoff(attempts)
+		if got < want || got > want+want/5 {
+			t.Errorf("backoff(%d) = %s, want %s plus up to 20%%", attempts, got, want)
+		}
+	}
+}
+
+func TestClientRefusesPrivateAddresses(t *testing.T) {
+	var calls int
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+	}))
+	defer receiver.Close()
+
+	_, err := NewClient(time.Second).Post(receiver.URL, "application/json", nil)
+	if !errors.Is(err, ErrPrivateAddress) {
+		t.Errorf("posting to %s: err = %v, want ErrPrivateAddress", receiver.URL, err)
+	}
+	if calls != 0 {
+		t.Errorf("receiver on loopback was called")
+	}
+
+	// the worker records the refusal like any failed attempt
+	q := &memQueue{}
+	d := q.enqueue(receiver.URL, "s3cret", `{}`)
+	wk := testWorker(q)
+	wk.client = NewClient(time.Second)
+	wk.processBatch(context.Background())
+	if d.Status != store.DeliveryRetrying || d.LastError == nil || d.LastStatusCode != nil {
+		t.Errorf("delivery log: status %s, code %v, error %v", d.Status, d.LastStatusCode, d.LastError)
+	}
+}
+
+func TestClientDoesNotFollowRedirects(t *testing.T) {
+	var followed bool
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/internal" {
+			followed = true
+			return
+		}
+		http.Redirect(w, r, "/internal", http.StatusTemporaryRedirect)
+	}))
+	defer receiver.Close()
+
+	q := &memQueue{}
+	d := q.enqueue(receiver.URL, "s3cret", `{}`)
+	wk := testWorker(q)
+	wk.client.CheckRedirect = NewClient(time.Second).CheckRedirect
+	wk.processBatch(context.Background())
+
+	if followed {
+		t.Error("redirect was followed")
+	}
+	if d.Status != store.DeliveryRetrying || d.LastStatusCode == nil || *d.LastStatusCode != http.StatusTemporaryRedirect {
+		t.Errorf("delivery log: status %s, code %v, want a failed attempt with 307", d.Status, d.LastStatusCode)
+	}
+}
+
+func TestPublicAddr(t *testing.T) {
+	for addr, want := range map[string]bool{
+		"93.184.216.34": true,
+		"2606:2800:220:1::1": true,
+		"127.0.0.1": false,
+		"::1": false,
+		"10.1.2.3": false,
+		"172.16.0.1": false,
+		"192.168.1.1": false,
+		"169.254.169.254": false,
+		"fe80::1": false,
+		"fd00::1": false,
+		"100.64.0.1": false,
+		"0.0.0.0": false,
+		"::": false,
+		"224.0.0.1": false,
+		"::ffff:127.0.0.1": false,
+		"::ffff:10.0.0.1": false,
+	} {
+		if got := PublicAddr(netip.MustParseAddr(addr)); got != want {
+			t.Errorf("PublicAddr(%s) = %v, want %v", addr, got, want)
+		}
+	}
+}
+
+func TestCheckURL(t *testing.T) {
+	for _, raw := range []string{
+		"ftp://example.com/hook",
+		"/relative",
+		"http://127.0.0.1:8080/hook",
+		"http://[::1]/hook",
+		"http://169.254.169.254/latest/meta-data",
+		"http://10.0.0.5/hook",
+		"http://localhost/hook",
+	} {
+		if _, err := CheckURL(context.Background(), raw); err == nil {
+			t.Errorf("CheckURL(%q) accepted the url", raw)
+		}
+	}
+
+	target, err := CheckURL(context.Background(), "https://93.184.216.34/hook")
+	if err != nil || target.String() != "https://93.184.216.34/hook" {
+		t.Errorf("CheckURL on a public address = %v, %v", target, err)
+	}
+}
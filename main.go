@@ -1,35 +1,94 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"net"
 	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
 	"time"
 
 	"github.com/Abhishek-B-R/chat-app-golang/internals/app"
+	"github.com/Abhishek-B-R/chat-app-golang/internals/config"
 	"github.com/Abhishek-B-R/chat-app-golang/internals/routes"
 )
 
 func main() {
-	port := 8080
+	cfg, err := config.Load(os.Args[1:])
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
 
-	app, err := app.NewApplication()
+	app, err := app.NewApplication(cfg)
 	if err != nil {
 		panic(err)
 	}
-	defer app.DB.Close()
+
+	app.StartWorkers()
 
 	r := routes.SetupRoutes(app)
+
 	server := &http.Server{
-		Addr: fmt.Sprintf(":%d", port),
+		Addr: fmt.Sprintf(":%d", cfg.HTTP.Port),
 		Handler: r,
-		IdleTimeout: time.Minute,
-		ReadTimeout: 10 * time.Second,
-		WriteTimeout: 30 * time.Second,
+		IdleTimeout: cfg.HTTP.IdleTimeout,
+		ReadTimeout: cfg.HTTP.ReadTimeout,
+		WriteTimeout: cfg.HTTP.WriteTimeout,
+		ConnState: func(conn net.Conn, state http.ConnState) {
+			switch state {
+			case http.StateNew:
+				app.Metrics.ConnectionOpened()
+			case http.StateHijacked, http.StateClosed:
+				app.Metrics.ConnectionClosed()
+			}
+		},
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	serverErr := make(chan error, 1)
+	go func() {
+		app.Logger.Info("server started", "port", cfg.HTTP.Port)
+		serverErr <- server.ListenAndServe()
+	}()
+	app.SetReady(true)
+
+	select {
+	case err = <-serverErr:
+		app.Logger.Error("server stopped", "error", err)
+	case <-ctx.Done():
+		// a second signal kills the process straight away
+		stop()
+		app.Logger.Info("shutting down", "drain_delay", cfg.HTTP.DrainDelay.String())
+
+		// fail the health check first so the load balancer stops sending
+		// new requests, then let the ones in flight finish
+		app.SetReady(false)
+		time.Sleep(cfg.HTTP.DrainDelay)
+
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), cfg.HTTP.ShutdownTimeout)
+		defer cancel()
+
+		err = server.Shutdown(shutdownCtx)
+		if err != nil {
+			app.Logger.Error("draining http requests", "error", err)
+		}
 	}
-	app.Logger.Printf("We are now running on port %d\n", port)
 
-	err = server.ListenAndServe()
+	// workers and the database get a fresh deadline so a slow drain above
+	// does not leave the webhook queue without its last updates
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), cfg.HTTP.ShutdownTimeout)
+	defer cancel()
+
+	err = errors.Join(err, app.Shutdown(shutdownCtx))
 	if err != nil {
-		app.Logger.Fatal(err)
+		app.Logger.Error("shutdown", "error", err)
+		os.Exit(1)
 	}
-}
\ No newline at end of file
+	app.Logger.Info("shutdown complete")
+}
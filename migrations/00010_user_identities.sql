@@ -0,0 +1,47 @@
+-- +goose Up
+-- +goose StatementBegin
+-- Accounts provisioned through an identity provider have no local password
+ALTER TABLE users ALTER COLUMN password_hash DROP NOT NULL;
+
+-- Index for case-insensitive email logins
+CREATE INDEX idx_users_email_lower ON users(LOWER(email));
+
+CREATE TABLE IF NOT EXISTS user_identities (
+    id BIGSERIAL PRIMARY KEY,
+    user_id BIGINT REFERENCES users(id) ON DELETE CASCADE NOT NULL,
+    issuer TEXT NOT NULL,
+    subject TEXT NOT NULL,
+    email VARCHAR(255),
+    last_login_at TIMESTAMP WITH TIME ZONE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+
+    -- Constraint: an external account can only be linked once
+    CONSTRAINT unique_issuer_subject UNIQUE (issuer, subject)
+);
+
+-- Index for listing the identities linked to a user
+CREATE INDEX idx_user_identities_user_id ON user_identities(user_id);
+
+-- Pending authorization code flows (state, PKCE verifier and nonce)
+CREATE TABLE IF NOT EXISTS oidc_auth_requests (
+    state TEXT PRIMARY KEY,
+    provider TEXT NOT NULL,
+    code_verifier TEXT NOT NULL,
+    nonce TEXT NOT NULL,
+    expires_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Index for cleaning up abandoned flows
+CREATE INDEX idx_oidc_auth_requests_expires_at ON oidc_auth_requests(expires_at);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX IF EXISTS idx_oidc_auth_requests_expires_at;
+DROP TABLE IF EXISTS oidc_auth_requests;
+DROP INDEX IF EXISTS idx_user_identities_user_id;
+DROP TABLE IF EXISTS user_identities;
+DROP INDEX IF EXISTS idx_users_email_lower;
+ALTER TABLE users ALTER COLUMN password_hash SET NOT NULL;
+-- +goose StatementEnd
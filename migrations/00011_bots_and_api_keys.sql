@@ -0,0 +1,42 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE users ADD COLUMN is_bot BOOLEAN DEFAULT false NOT NULL;
+ALTER TABLE users ADD COLUMN bot_owner_id BIGINT REFERENCES users(id) ON DELETE CASCADE;
+
+-- Constraint: every bot is managed by a human account
+ALTER TABLE users ADD CONSTRAINT bot_must_have_owner CHECK (
+    (is_bot = false) OR (bot_owner_id IS NOT NULL)
+);
+
+-- Index for listing the bots a user manages
+CREATE INDEX idx_users_bot_owner_id ON users(bot_owner_id) WHERE bot_owner_id IS NOT NULL;
+
+CREATE TABLE IF NOT EXISTS api_keys (
+    id BIGSERIAL PRIMARY KEY,
+    user_id BIGINT REFERENCES users(id) ON DELETE CASCADE NOT NULL,
+    name TEXT NOT NULL,
+    key_prefix VARCHAR(16) NOT NULL,
+    key_hash BYTEA UNIQUE NOT NULL,
+    scopes TEXT[] NOT NULL,
+    -- NULL means every chat the bot is a member of
+    chat_ids BIGINT[],
+    created_by BIGINT REFERENCES users(id) ON DELETE SET NULL,
+    last_used_at TIMESTAMP WITH TIME ZONE,
+    expires_at TIMESTAMP WITH TIME ZONE,
+    revoked_at TIMESTAMP WITH TIME ZONE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Index for listing a bot's keys
+CREATE INDEX idx_api_keys_user_id ON api_keys(user_id);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX IF EXISTS idx_api_keys_user_id;
+DROP TABLE IF EXISTS api_keys;
+DROP INDEX IF EXISTS idx_users_bot_owner_id;
+ALTER TABLE users DROP CONSTRAINT IF EXISTS bot_must_have_owner;
+ALTER TABLE users DROP COLUMN IF EXISTS bot_owner_id;
+ALTER TABLE users DROP COLUMN IF EXISTS is_bot;
+-- +goose StatementEnd
@@ -0,0 +1,31 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS incoming_webhooks (
+    id BIGSERIAL PRIMARY KEY,
+    chat_id BIGINT REFERENCES chats(id) ON DELETE CASCADE NOT NULL,
+    name TEXT NOT NULL,
+    avatar_url TEXT,
+    token_hash BYTEA UNIQUE NOT NULL,
+    created_by BIGINT REFERENCES users(id) ON DELETE SET NULL,
+    last_used_at TIMESTAMP WITH TIME ZONE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Index for listing a chat's incoming webhooks
+CREATE INDEX idx_incoming_webhooks_chat_id ON incoming_webhooks(chat_id);
+
+-- Messages posted by an incoming webhook have no sender_id, they carry the
+-- webhook and the display name and avatar it posted with instead
+ALTER TABLE messages ADD COLUMN incoming_webhook_id BIGINT REFERENCES incoming_webhooks(id) ON DELETE SET NULL;
+ALTER TABLE messages ADD COLUMN display_name TEXT;
+ALTER TABLE messages ADD COLUMN avatar_url TEXT;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE messages DROP COLUMN IF EXISTS avatar_url;
+ALTER TABLE messages DROP COLUMN IF EXISTS display_name;
+ALTER TABLE messages DROP COLUMN IF EXISTS incoming_webhook_id;
+DROP INDEX IF EXISTS idx_incoming_webhooks_chat_id;
+DROP TABLE IF EXISTS incoming_webhooks;
+-- +goose StatementEnd
@@ -0,0 +1,23 @@
+-- +goose Up
+-- +goose StatementBegin
+-- Slash commands served by external bot endpoints, registered per chat
+CREATE TABLE IF NOT EXISTS chat_commands (
+    id BIGSERIAL PRIMARY KEY,
+    chat_id BIGINT REFERENCES chats(id) ON DELETE CASCADE NOT NULL,
+    name VARCHAR(32) NOT NULL,
+    url TEXT NOT NULL,
+    secret TEXT NOT NULL,
+    description TEXT,
+    usage TEXT,
+    created_by BIGINT REFERENCES users(id) ON DELETE SET NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+
+    -- Constraint: a command name can only be registered once per chat
+    CONSTRAINT unique_chat_command UNIQUE (chat_id, name)
+);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS chat_commands;
+-- +goose StatementEnd
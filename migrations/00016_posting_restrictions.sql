@@ -0,0 +1,20 @@
+-- +goose Up
+-- +goose StatementBegin
+-- Chat settings limiting who may post and how often. slow_mode_seconds is
+-- the minimum wait between two messages of the same member, 0 is off.
+ALTER TABLE chats ADD COLUMN slow_mode_seconds INTEGER NOT NULL DEFAULT 0 CHECK (slow_mode_seconds >= 0);
+ALTER TABLE chats ADD COLUMN admins_only BOOLEAN NOT NULL DEFAULT false;
+
+-- chat_members.muted is the member muting the chat's notifications; a
+-- member muted from posting by an admin gets posting_muted_until instead
+ALTER TABLE chat_members ADD COLUMN posting_muted_until TIMESTAMP WITH TIME ZONE;
+ALTER TABLE chat_members ADD COLUMN last_posted_at TIMESTAMP WITH TIME ZONE;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE chat_members DROP COLUMN IF EXISTS last_posted_at;
+ALTER TABLE chat_members DROP COLUMN IF EXISTS posting_muted_until;
+ALTER TABLE chats DROP COLUMN IF EXISTS admins_only;
+ALTER TABLE chats DROP COLUMN IF EXISTS slow_mode_seconds;
+-- +goose StatementEnd
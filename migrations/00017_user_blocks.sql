@@ -0,0 +1,22 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS user_blocks (
+    blocker_id BIGINT REFERENCES users(id) ON DELETE CASCADE NOT NULL,
+    blocked_id BIGINT REFERENCES users(id) ON DELETE CASCADE NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+
+    PRIMARY KEY (blocker_id, blocked_id),
+
+    -- Constraint: users cannot block themselves
+    CONSTRAINT no_self_block CHECK (blocker_id <> blocked_id)
+);
+
+-- Index for checking whether a user is blocked by others
+CREATE INDEX idx_user_blocks_blocked_id ON user_blocks(blocked_id);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX IF EXISTS idx_user_blocks_blocked_id;
+DROP TABLE IF EXISTS user_blocks;
+-- +goose StatementEnd
@@ -0,0 +1,41 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS reports (
+    id BIGSERIAL PRIMARY KEY,
+    reporter_id BIGINT REFERENCES users(id) ON DELETE SET NULL,
+    -- the reported user, or the sender of the reported message; NULL for
+    -- messages posted by incoming webhooks
+    reported_user_id BIGINT REFERENCES users(id) ON DELETE SET NULL,
+    message_id BIGINT REFERENCES messages(id) ON DELETE SET NULL,
+    chat_id BIGINT REFERENCES chats(id) ON DELETE SET NULL,
+    reason VARCHAR(20) NOT NULL,
+    details TEXT,
+    -- the message as it was when reported, later edits and deletes don't
+    -- change the evidence
+    message_snapshot JSONB,
+    status VARCHAR(20) DEFAULT 'open' NOT NULL,
+    actions TEXT[] NOT NULL DEFAULT '{}',
+    resolved_by BIGINT REFERENCES users(id) ON DELETE SET NULL,
+    resolution_note TEXT,
+    resolved_at TIMESTAMP WITH TIME ZONE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+
+    CONSTRAINT valid_reason CHECK (reason IN ('spam', 'harassment', 'hate_speech', 'violence', 'sexual_content', 'self_harm', 'impersonation', 'other')),
+    CONSTRAINT valid_status CHECK (status IN ('open', 'actioned', 'dismissed'))
+);
+
+-- Index for the moderation queue, oldest reports first
+CREATE INDEX idx_reports_status_created_at ON reports(status, created_at);
+
+-- A user reports a message or another user once until it is resolved
+CREATE UNIQUE INDEX idx_reports_open_message ON reports(reporter_id, message_id) WHERE status = 'open' AND message_id IS NOT NULL;
+CREATE UNIQUE INDEX idx_reports_open_user ON reports(reporter_id, reported_user_id) WHERE status = 'open' AND message_id IS NULL;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX IF EXISTS idx_reports_open_user;
+DROP INDEX IF EXISTS idx_reports_open_message;
+DROP INDEX IF EXISTS idx_reports_status_created_at;
+DROP TABLE IF EXISTS reports;
+-- +goose StatementEnd
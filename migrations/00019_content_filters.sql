@@ -0,0 +1,28 @@
+-- +goose Up
+-- +goose StatementBegin
+-- Content filter rules run on every message posted or edited. Rules with a
+-- chat_id apply to that chat and are managed by its admins; rules without
+-- one apply everywhere and are managed by moderators.
+CREATE TABLE IF NOT EXISTS content_filters (
+    id BIGSERIAL PRIMARY KEY,
+    chat_id BIGINT REFERENCES chats(id) ON DELETE CASCADE,
+    name VARCHAR(64) NOT NULL,
+    kind VARCHAR(20) NOT NULL,
+    action VARCHAR(20) NOT NULL,
+    -- the kind's settings, e.g. the word list or the regex
+    config JSONB NOT NULL DEFAULT '{}',
+    created_by BIGINT REFERENCES users(id) ON DELETE SET NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+
+    CONSTRAINT valid_kind CHECK (kind IN ('words', 'regex', 'domains', 'mentions')),
+    CONSTRAINT valid_action CHECK (action IN ('match', 'replace', 'reject'))
+);
+
+CREATE INDEX idx_content_filters_chat_id ON content_filters(chat_id);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX IF EXISTS idx_content_filters_chat_id;
+DROP TABLE IF EXISTS content_filters;
+-- +goose StatementEnd
@@ -0,0 +1,26 @@
+-- +goose Up
+-- +goose StatementBegin
+-- System messages carry a structured event instead of text so clients can
+-- render them in their own language; every system message has one and no
+-- other message does
+ALTER TABLE messages ADD COLUMN system_event JSONB;
+ALTER TABLE messages ADD CONSTRAINT system_message_has_event CHECK (
+    (type = 'system') = (system_event IS NOT NULL)
+);
+
+ALTER TABLE messages ADD COLUMN pinned_at TIMESTAMP WITH TIME ZONE;
+ALTER TABLE messages ADD COLUMN pinned_by BIGINT REFERENCES users(id) ON DELETE SET NULL;
+
+-- Index for listing the pinned messages of a chat
+CREATE INDEX idx_messages_pinned ON messages(chat_id, pinned_at DESC)
+    WHERE pinned_at IS NOT NULL;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX IF EXISTS idx_messages_pinned;
+ALTER TABLE messages DROP COLUMN IF EXISTS pinned_by;
+ALTER TABLE messages DROP COLUMN IF EXISTS pinned_at;
+ALTER TABLE messages DROP CONSTRAINT IF EXISTS system_message_has_event;
+ALTER TABLE messages DROP COLUMN IF EXISTS system_event;
+-- +goose StatementEnd
@@ -0,0 +1,32 @@
+-- +goose Up
+-- +goose StatementBegin
+-- Shareable invite links to group chats. The code is kept in plain text so
+-- admins can share a link again; it only lets someone join, and revoking
+-- the invite takes that away.
+CREATE TABLE IF NOT EXISTS chat_invites (
+    id BIGSERIAL PRIMARY KEY,
+    chat_id BIGINT REFERENCES chats(id) ON DELETE CASCADE NOT NULL,
+    code VARCHAR(32) UNIQUE NOT NULL,
+    role VARCHAR(20) DEFAULT 'member' NOT NULL,
+    max_uses INTEGER,
+    uses INTEGER DEFAULT 0 NOT NULL,
+    expires_at TIMESTAMP WITH TIME ZONE,
+    revoked_at TIMESTAMP WITH TIME ZONE,
+    created_by BIGINT REFERENCES users(id) ON DELETE SET NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+
+    -- Constraint: an invite never makes someone the owner
+    CONSTRAINT valid_invite_role CHECK (role IN ('member', 'admin')),
+    -- Constraint: max_uses is unset for unlimited use
+    CONSTRAINT valid_invite_max_uses CHECK (max_uses IS NULL OR max_uses > 0)
+);
+
+-- Index for listing a chat's invites
+CREATE INDEX idx_chat_invites_chat_id ON chat_invites(chat_id, created_at DESC);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX IF EXISTS idx_chat_invites_chat_id;
+DROP TABLE IF EXISTS chat_invites;
+-- +goose StatementEnd
@@ -0,0 +1,26 @@
+-- +goose Up
+-- +goose StatementBegin
+-- Chats used to be created with the creator as admin, leaving them without
+-- an owner. Give every such chat one: the creator if still a member, else
+-- the longest-standing admin, else the longest-standing member.
+UPDATE chat_members cm
+SET role = 'owner'
+FROM (
+    SELECT DISTINCT ON (m.chat_id) m.chat_id, m.user_id
+    FROM chat_members m
+    JOIN chats c ON c.id = m.chat_id
+    WHERE NOT EXISTS (
+        SELECT 1 FROM chat_members o
+        WHERE o.chat_id = m.chat_id AND o.role = 'owner'
+    )
+    ORDER BY m.chat_id, m.user_id = c.created_by DESC, m.role = 'admin' DESC, m.joined_at ASC, m.user_id ASC
+) pick
+WHERE cm.chat_id = pick.chat_id AND cm.user_id = pick.user_id;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+-- Backfilled owners can't be told apart from chats created as owner since,
+-- so they are kept.
+SELECT 1;
+-- +goose StatementEnd
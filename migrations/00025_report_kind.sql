@@ -0,0 +1,25 @@
+-- +goose Up
+-- +goose StatementBegin
+-- Whether a report is about a message or a user can't be told from
+-- message_id, which is nulled when the message's chat is deleted. That made
+-- message reports fall under the one-open-report-per-user index and
+-- deleting a chat fail on it, so the kind is stored instead.
+ALTER TABLE reports ADD COLUMN kind VARCHAR(10);
+UPDATE reports SET kind = CASE
+    WHEN message_id IS NOT NULL OR message_snapshot IS NOT NULL THEN 'message'
+    ELSE 'user'
+END;
+ALTER TABLE reports ALTER COLUMN kind SET NOT NULL;
+ALTER TABLE reports ADD CONSTRAINT valid_kind CHECK (kind IN ('message', 'user'));
+
+DROP INDEX IF EXISTS idx_reports_open_user;
+CREATE UNIQUE INDEX idx_reports_open_user ON reports(reporter_id, reported_user_id) WHERE status = 'open' AND kind = 'user';
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX IF EXISTS idx_reports_open_user;
+CREATE UNIQUE INDEX idx_reports_open_user ON reports(reporter_id, reported_user_id) WHERE status = 'open' AND message_id IS NULL;
+ALTER TABLE reports DROP CONSTRAINT IF EXISTS valid_kind;
+ALTER TABLE reports DROP COLUMN IF EXISTS kind;
+-- +goose StatementEnd
@@ -0,0 +1,19 @@
+-- +goose Up
+-- +goose StatementBegin
+-- Usernames are looked up case-insensitively, so two accounts differing only
+-- in case can't be told apart at login. The unique constraint from 00001
+-- only covers exact matches; every later duplicate gets its id appended
+-- before the index is added.
+UPDATE users u SET username = LEFT(u.username, 49 - LENGTH(u.id::text)) || '-' || u.id
+WHERE EXISTS (
+    SELECT 1 FROM users o
+    WHERE LOWER(o.username) = LOWER(u.username) AND o.id < u.id
+);
+
+CREATE UNIQUE INDEX users_username_lower_key ON users(LOWER(username));
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX IF EXISTS users_username_lower_key;
+-- +goose StatementEnd
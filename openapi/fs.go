@@ -0,0 +1,59 @@
+package openapi
+
+import (
+	_ "embed"
+	"encoding/json"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/go-chi/chi"
+)
+
+//go:embed openapi.json
+var Spec []byte
+
+var versionPrefix = regexp.MustCompile(`^/v[0-9]+(/|$)`)
+
+// Handler serves the OpenAPI document.
+func Handler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(Spec)
+}
+
+// Undocumented walks the router and returns every "METHOD /path" that has
+// no operation in the document, so a new route cannot ship without one.
+func Undocumented(routes chi.Routes) ([]string, error) {
+	var doc struct {
+		Paths map[string]map[string]json.RawMessage `json:"paths"`
+	}
+	err := json.Unmarshal(Spec, &doc)
+	if err != nil {
+		return nil, err
+	}
+
+	var missing []string
+	err = chi.Walk(routes, func(method, route string, handler http.Handler, middlewares ...func(http.Handler) http.Handler) error {
+		path := normalize(route)
+		if _, ok := doc.Paths[path][strings.ToLower(method)]; !ok {
+			missing = append(missing, method+" "+path)
+		}
+		return nil
+	})
+	sort.Strings(missing)
+	return missing, err
+}
+
+// normalize turns a chi pattern into the form used for document paths:
+// versioned routes are documented once relative to their server URL, and
+// routes mounted with r.Route report a trailing slash that clients do not
+// need to send.
+func normalize(route string) string {
+	route = strings.ReplaceAll(route, "/*/", "/")
+	route = versionPrefix.ReplaceAllString(route, "/")
+	if len(route) > 1 {
+		route = strings.TrimSuffix(route, "/")
+	}
+	return route
+}
@@ -0,0 +1,351 @@
+package openapi_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Abhishek-B-R/chat-app-golang/internals/api"
+	"github.com/Abhishek-B-R/chat-app-golang/internals/app"
+	"github.com/Abhishek-B-R/chat-app-golang/internals/config"
+	"github.com/Abhishek-B-R/chat-app-golang/internals/metrics"
+	"github.com/Abhishek-B-R/chat-app-golang/internals/middleware"
+	"github.com/Abhishek-B-R/chat-app-golang/internals/routes"
+	"github.com/Abhishek-B-R/chat-app-golang/internals/store"
+	"github.com/Abhishek-B-R/chat-app-golang/openapi"
+	"github.com/go-chi/chi"
+)
+
+func TestEveryRouteIsDocumented(t *testing.T) {
+	a := &app.Application{Config: config.Default(), Metrics: metrics.Nop{}}
+	a.MetricsMiddleware = middleware.MetricsMiddleware{Metrics: metrics.Nop{}}
+	a.RequestMiddleware = middleware.RequestMiddleware{Logger: slog.New(slog.DiscardHandler)}
+
+	missing, err := openapi.Undocumented(routes.SetupRoutes(a))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(missing) > 0 {
+		t.Errorf("routes missing from openapi/openapi.json:\n%s", strings.Join(missing, "\n"))
+	}
+}
+
+// The handlers below run against in-memory stores and their responses are
+// checked against the documented 200 response, in both API versions.
+
+type chatStore struct {
+	store.ChatStore
+	chat *store.Chat
+}
+
+func (s chatStore) GetChatByID(ctx context.Context, chatID int64) (*store.Chat, error) {
+	return s.chat, nil
+}
+
+type messageStore struct {
+	store.MessageStore
+	msg *store.Message
+}
+
+func (s messageStore) GetMessageForViewer(ctx context.Context, id, viewerID int64) (*store.Message, error) {
+	return s.msg, nil
+}
+
+type chatMemberStore struct {
+	store.ChatMemberStore
+	members []*store.ChatMemberWithUser
+}
+
+func (s chatMemberStore) GetChatMembers(ctx context.Context, chatID int64) ([]*store.ChatMemberWithUser, error) {
+	return s.members, nil
+}
+
+func ptr[T any](v T) *T {
+	return &v
+}
+
+func TestChatResponse(t *testing.T) {
+	now := time.Now()
+	chats := map[string]*store.Chat{
+		"full": {
+			ChatID: 1,
+			IsGroup: true,
+			Name: ptr("general"),
+			CreatedBy: 2,
+			LastMessageAt: &now,
+			Settings: store.ChatSettings{SlowModeSeconds: 30, AdminsOnly: true},
+			CreatedAt: now,
+			UpdatedAt: now,
+		},
+		"empty": {ChatID: 1, CreatedBy: 2, CreatedAt: now, UpdatedAt: now},
+	}
+
+	for name, chat := range chats {
+		h := api.NewChatHandler(chatStore{chat: chat}, nil, nil)
+		checkResponse(t, name, "GET", "/chats/{chatID}", "/chats/1", h.HandleGetChatByID)
+	}
+}
+
+func TestMessageResponse(t *testing.T) {
+	now := time.Now()
+	messages := map[string]*store.Message{
+		"text": {
+			ID: 1,
+			ChatID: 2,
+			SenderID: ptr(int64(3)),
+			Type: store.MessageTypeText,
+			Content: ptr("hello"),
+			ReplyToMessageID: ptr(int64(4)),
+			EditedAt: &now,
+			CreatedAt: now,
+			PinnedAt: &now,
+			PinnedBy: ptr(int64(3)),
+			Attachments: []store.MessageAttachment{{
+				ID: 5,
+				MessageID: 1,
+				Type: store.AttachmentImage,
+				URL: "https://example.com/cat.png",
+				Filename: ptr("cat.png"),
+				SizeBytes: ptr(int64(1024)),
+				Metadata: json.RawMessage(`{"width":640}`),
+				CreatedAt: now,
+			}},
+		},
+		"blocked sender": {
+			ID: 1,
+			ChatID: 2,
+			SenderID: ptr(int64(3)),
+			Type: store.MessageTypeText,
+			CreatedAt: now,
+			SenderBlocked: true,
+		},
+		"incoming webhook": {
+			ID: 1,
+			ChatID: 2,
+			Type: store.MessageTypeText,
+			Content: ptr("deployed"),
+			WebhookID: ptr(int64(6)),
+			DisplayName: ptr("CI"),
+			AvatarURL: ptr("https://example.com/ci.png"),
+			CreatedAt: now,
+		},
+		"system": {
+			ID: 1,
+			ChatID: 2,
+			Type: store.MessageTypeSystem,
+			Event: &store.SystemEvent{
+				Kind: store.SystemMemberRoleChanged,
+				ActorID: ptr(int64(3)),
+				TargetID: ptr(int64(7)),
+				Role: ptr(store.ADMIN),
+			},
+			CreatedAt: now,
+		},
+	}
+
+	for name, msg := range messages {
+		h := api.NewMessageHandler(messageStore{msg: msg}, nil, nil, nil, nil, nil, config.LimitsConfig{}, metrics.Nop{})
+		checkResponse(t, name, "GET", "/messages/{msgID}", "/messages/1", h.HandleGetMessage)
+	}
+}
+
+func TestChatMembersResponse(t *testing.T) {
+	now := time.Now()
+	members := map[string][]*store.ChatMemberWithUser{
+		"members": {
+			{ChatID: 1, UserID: 2, Role: string(store.OWNER), JoinedAt: now, Username: "alice", Email: "alice@example.com", ProfilePicURL: "https://example.com/a.png"},
+			{ChatID: 1, UserID: 3, Role: string(store.MEMBER), JoinedAt: now, Username: "bob", PostingMutedUntil: &now},
+		},
+		"none": nil,
+	}
+
+	for name, m := range members {
+		h := api.NewChatMemberHandler(chatMemberStore{members: m}, nil, nil, nil, nil)
+		checkResponse(t, name, "GET", "/chats/{chatID}/members", "/chats/1/members", h.HandleGetChatMembers)
+	}
+}
+
+// checkResponse serves target with handler mounted at the documented path
+// under /v1 and /v2 and checks the body against the 200 response of the
+// operation.
+func checkResponse(t *testing.T, name, method, path, target string, handler http.HandlerFunc) {
+	t.Helper()
+
+	spec := loadSpec(t)
+	raw, ok := spec.Paths[path][strings.ToLower(method)]
+	if !ok {
+		t.Fatalf("%s %s is not documented", method, path)
+	}
+	var op operation
+	err := json.Unmarshal(raw, &op)
+	if err != nil {
+		t.Fatal(err)
+	}
+	schema := op.Responses["200"].Content["application/json"].Schema
+
+	for version := 1; version <= 2; version++ {
+		r := chi.NewRouter()
+		r.With(middleware.APIVersion(version)).Method(method, path, handler)
+
+		rec := httptest.NewRecorder()
+		req := middleware.SetUser(httptest.NewRequest(method, target, nil), &store.User{ID: 3, Username: "alice"})
+		r.ServeHTTP(rec, req)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("%s v%d: status %d: %s", name, version, rec.Code, rec.Body)
+		}
+
+		var body any
+		err = json.Unmarshal(rec.Body.Bytes(), &body)
+		if err != nil {
+			t.Fatalf("%s v%d: %v", name, version, err)
+		}
+		for _, problem := range spec.check(schema, body, "$") {
+			t.Errorf("%s v%d: %s", name, version, problem)
+		}
+	}
+}
+
+type schema struct {
+	Ref        string             `json:"$ref"`
+	Type       string             `json:"type"`
+	Format     string             `json:"format"`
+	Nullable   bool               `json:"nullable"`
+	Enum       []any              `json:"enum"`
+	Properties map[string]*schema `json:"properties"`
+	Required   []string           `json:"required"`
+	Items      *schema            `json:"items"`
+	OneOf      []*schema          `json:"oneOf"`
+}
+
+type operation struct {
+	Responses map[string]struct {
+		Content map[string]struct {
+			Schema *schema `json:"schema"`
+		} `json:"content"`
+	} `json:"responses"`
+}
+
+// Paths holds raw path items because next to operations they carry
+// servers and parameters.
+type document struct {
+	Paths map[string]map[string]json.RawMessage `json:"paths"`
+	Components struct {
+		Schemas map[string]*schema `json:"schemas"`
+	} `json:"components"`
+}
+
+func loadSpec(t *testing.T) *document {
+	t.Helper()
+	var doc document
+	err := json.Unmarshal(openapi.Spec, &doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &doc
+}
+
+// check returns where v does not match s. It covers the parts of OpenAPI
+// the document uses; objects must not have undocumented properties, so a
+// field added to a response without the document fails the test.
+func (doc *document) check(s *schema, v any, at string) []string {
+	if s == nil {
+		return nil
+	}
+	if s.Ref != "" {
+		return doc.check(doc.Components.Schemas[strings.TrimPrefix(s.Ref, "#/components/schemas/")], v, at)
+	}
+	if v == nil {
+		if s.Nullable {
+			return nil
+		}
+		return []string{at + ": null is not allowed"}
+	}
+	if len(s.OneOf) > 0 {
+		for _, option := range s.OneOf {
+			if len(doc.check(option, v, at)) == 0 {
+				return nil
+			}
+		}
+		return []string{fmt.Sprintf("%s: %v matches none of oneOf", at, v)}
+	}
+	if len(s.Enum) > 0 {
+		found := false
+		for _, e := range s.Enum {
+			found = found || e == v
+		}
+		if !found {
+			return []string{fmt.Sprintf("%s: %v is not one of %v", at, v, s.Enum)}
+		}
+	}
+
+	switch s.Type {
+	case "object":
+		obj, ok := v.(map[string]any)
+		if !ok {
+			return []string{fmt.Sprintf("%s: want an object, got %T", at, v)}
+		}
+		var problems []string
+		for _, name := range s.Required {
+			if _, ok := obj[name]; !ok {
+				problems = append(problems, at+"."+name+": required property is missing")
+			}
+		}
+		names := make([]string, 0, len(obj))
+		for name := range obj {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			prop, ok := s.Properties[name]
+			if !ok {
+				if len(s.Properties) > 0 {
+					problems = append(problems, at+"."+name+": property is not documented")
+				}
+				continue
+			}
+			problems = append(problems, doc.check(prop, obj[name], at+"."+name)...)
+		}
+		return problems
+	case "array":
+		arr, ok := v.([]any)
+		if !ok {
+			return []string{fmt.Sprintf("%s: want an array, got %T", at, v)}
+		}
+		var problems []string
+		for i, item := range arr {
+			problems = append(problems, doc.check(s.Items, item, fmt.Sprintf("%s[%d]", at, i))...)
+		}
+		return problems
+	case "string":
+		str, ok := v.(string)
+		if !ok {
+			return []string{fmt.Sprintf("%s: want a string, got %T", at, v)}
+		}
+		if s.Format == "date-time" {
+			if _, err := time.Parse(time.RFC3339Nano, str); err != nil {
+				return []string{fmt.Sprintf("%s: %q is not a date-time", at, str)}
+			}
+		}
+	case "integer":
+		n, ok := v.(float64)
+		if !ok || n != float64(int64(n)) {
+			return []string{fmt.Sprintf("%s: want an integer, got %v", at, v)}
+		}
+	case "number":
+		if _, ok := v.(float64); !ok {
+			return []string{fmt.Sprintf("%s: want a number, got %T", at, v)}
+		}
+	case "boolean":
+		if _, ok := v.(bool); !ok {
+			return []string{fmt.Sprintf("%s: want a boolean, got %T", at, v)}
+		}
+	}
+	return nil
+}